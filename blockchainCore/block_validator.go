@@ -3,6 +3,7 @@ package blockchainCore
 import (
 	"fmt"
 	"math/big"
+	"sync/atomic"
 	"time"
 
 	"github.com/siotchain/siot/helper"
@@ -21,6 +22,22 @@ var (
 	bigMinus99    = big.NewInt(-99)
 )
 
+// futureBlockTolerance is the number of seconds a block header's timestamp may
+// be ahead of the local clock and still pass validation (accessed atomically).
+var futureBlockTolerance int64
+
+// SetFutureBlockTolerance sets how far in the future a block's timestamp may be
+// before it's rejected with BlockFutureErr. Private networks with imperfect
+// clock synchronisation may want to widen it from the default of zero.
+func SetFutureBlockTolerance(tolerance time.Duration) {
+	atomic.StoreInt64(&futureBlockTolerance, int64(tolerance/time.Second))
+}
+
+// FutureBlockTolerance returns the currently allowed clock drift of blocks.
+func FutureBlockTolerance() time.Duration {
+	return time.Duration(atomic.LoadInt64(&futureBlockTolerance)) * time.Second
+}
+
 // BlockValidator is responsible for validating block headers, uncles and
 // processed state.
 //
@@ -199,7 +216,7 @@ func ValidateHeader(config *configure.ChainConfig, pow validation.PoW, header *t
 			return BlockTSTooBigErr
 		}
 	} else {
-		if header.Time.Cmp(big.NewInt(time.Now().Unix())) == 1 {
+		if header.Time.Cmp(big.NewInt(time.Now().Unix()+atomic.LoadInt64(&futureBlockTolerance))) == 1 {
 			return BlockFutureErr
 		}
 	}
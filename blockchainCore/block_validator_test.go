@@ -0,0 +1,46 @@
+package blockchainCore
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/siotchain/siot/blockchainCore/types"
+	"github.com/siotchain/siot/configure"
+)
+
+// Tests that headers ahead of the local clock are accepted up to the configured
+// future block tolerance and rejected beyond it.
+func TestFutureBlockTolerance(t *testing.T) {
+	defer SetFutureBlockTolerance(FutureBlockTolerance())
+	SetFutureBlockTolerance(15 * time.Second)
+
+	config := MakeChainConfig()
+	now := time.Now().Unix()
+	parent := &types.Header{
+		Number:     big.NewInt(1),
+		Time:       big.NewInt(now - 10),
+		Difficulty: big.NewInt(0x2000),
+		GasLimit:   new(big.Int).Set(configure.GenesisGasLimit),
+	}
+	child := func(ahead int64) *types.Header {
+		return &types.Header{
+			ParentHash: parent.Hash(),
+			Number:     big.NewInt(2),
+			Time:       big.NewInt(now + ahead),
+			Difficulty: CalcDifficulty(config, uint64(now+ahead), parent.Time.Uint64(), parent.Number, parent.Difficulty),
+			GasLimit:   new(big.Int).Set(parent.GasLimit),
+		}
+	}
+	if err := ValidateHeader(config, FakePow{}, child(3), parent, false, false); err != nil {
+		t.Errorf("header 3s in the future rejected: %v", err)
+	}
+	if err := ValidateHeader(config, FakePow{}, child(30), parent, false, false); err != BlockFutureErr {
+		t.Errorf("header 30s in the future error mismatch: have %v, want %v", err, BlockFutureErr)
+	}
+	// Without tolerance, any header ahead of the clock is from the future
+	SetFutureBlockTolerance(0)
+	if err := ValidateHeader(config, FakePow{}, child(3), parent, false, false); err != BlockFutureErr {
+		t.Errorf("header 3s in the future without tolerance error mismatch: have %v, want %v", err, BlockFutureErr)
+	}
+}
@@ -33,7 +33,8 @@ var (
 	chainlogger = logger.NewLogger("CHAIN")
 	jsonlogger  = logger.NewJsonLogger()
 
-	blockInsertTimer = metrics.NewTimer("chain/inserts")
+	blockInsertTimer  = metrics.NewTimer("chain/inserts")
+	blockTimeoutMeter = metrics.NewMeter("chain/timeouts")
 
 	ErrNoGenesis = errors.New("Genesis not found in chain")
 )
@@ -42,6 +43,7 @@ const (
 	bodyCacheLimit      = 256
 	blockCacheLimit     = 256
 	maxFutureBlocks     = 256
+	maxSlowBlocks       = 256
 	maxTimeFutureBlocks = 30
 	// must be bumped when consensus algorithm is changed, this forces the upgradedb
 	// cmd to be run (forces the blocks to be imported again using the new algorithm)
@@ -63,7 +65,7 @@ const (
 // included in the canonical one where as GetBlockByNumber always represents the
 // canonical chain.
 type BlockChain struct {
-	config *configure.ChainConfig // chain & network configuration
+	config atomic.Value // chain & network configuration (*configure.ChainConfig), replaceable live
 
 	hc           *HeaderChain
 	chainDb      database.Database
@@ -83,11 +85,13 @@ type BlockChain struct {
 	bodyRLPCache *lru.Cache     // Cache for the most recent block bodies in RLP encoded format
 	blockCache   *lru.Cache     // Cache for the most recent entire blocks
 	futureBlocks *lru.Cache     // future blocks are blocks added for later processing
+	slowBlocks   *lru.Cache     // blocks rejected for exceeding the processing time limit
 
 	quit    chan struct{} // blockchain quit channel
 	running int32         // running must be called atomically
 	// procInterrupt must be atomically called
 	procInterrupt int32          // interrupt signaler for block processing
+	procTimeout   time.Duration  // maximum time allowed to process a single block (0 = unlimited)
 	wg            sync.WaitGroup // chain processing wait group for shutting down
 
 	pow       validation.PoW
@@ -103,9 +107,9 @@ func NewBlockChain(chainDb database.Database, config *configure.ChainConfig, pow
 	bodyRLPCache, _ := lru.New(bodyCacheLimit)
 	blockCache, _ := lru.New(blockCacheLimit)
 	futureBlocks, _ := lru.New(maxFutureBlocks)
+	slowBlocks, _ := lru.New(maxSlowBlocks)
 
 	bc := &BlockChain{
-		config:       config,
 		chainDb:      chainDb,
 		eventMux:     mux,
 		quit:         make(chan struct{}),
@@ -113,8 +117,10 @@ func NewBlockChain(chainDb database.Database, config *configure.ChainConfig, pow
 		bodyRLPCache: bodyRLPCache,
 		blockCache:   blockCache,
 		futureBlocks: futureBlocks,
+		slowBlocks:   slowBlocks,
 		pow:          pow,
 	}
+	bc.config.Store(config)
 	bc.SetValidator(NewBlockValidator(config, bc, pow))
 	bc.SetProcessor(NewStateProcessor(config, bc))
 
@@ -307,6 +313,15 @@ func (self *BlockChain) SetProcessor(processor Processor) {
 	self.processor = processor
 }
 
+// SetProcessTimeout sets the maximum time the processing of a single imported
+// block may take. Blocks exceeding it are rejected and remembered as bad. A
+// non-positive timeout disables the limit.
+func (self *BlockChain) SetProcessTimeout(timeout time.Duration) {
+	self.chainmu.Lock()
+	defer self.chainmu.Unlock()
+	self.procTimeout = timeout
+}
+
 // SetValidator sets the validator which is used to validate incoming blocks.
 func (self *BlockChain) SetValidator(validator Validator) {
 	self.procmu.Lock()
@@ -681,7 +696,7 @@ func (self *BlockChain) InsertReceiptChain(blockChain types.Blocks, receiptChain
 				continue
 			}
 			// Compute all the non-consensus fields of the receipts
-			SetReceiptsData(self.config, block, receipts)
+			SetReceiptsData(self.Config(), block, receipts)
 			// Write all the data out into the database
 			if err := WriteBody(self.chainDb, block.Hash(), block.NumberU64(), block.Body()); err != nil {
 				errs[index] = fmt.Errorf("failed to write block body: %v", err)
@@ -854,6 +869,11 @@ func (self *BlockChain) InsertChain(chain types.Blocks) (int, error) {
 			reportBlock(block, err)
 			return i, err
 		}
+		if timeout, ok := self.slowBlocks.Get(block.Hash()); ok {
+			err := &BlockTimeoutErr{Hash: block.Hash(), Number: block.Number(), Timeout: timeout.(time.Duration)}
+			reportBlock(block, err)
+			return i, err
+		}
 		// Stage 1 validation of the block using the chain's validator
 		// interface.
 		err := self.Validator().ValidateBlock(block)
@@ -867,7 +887,7 @@ func (self *BlockChain) InsertChain(chain types.Blocks) (int, error) {
 				// Allow up to MaxFuture second in the future blocks. If this limit
 				// is exceeded the chain is discarded and processed at a later time
 				// if given.
-				max := big.NewInt(time.Now().Unix() + maxTimeFutureBlocks)
+				max := big.NewInt(time.Now().Unix() + int64(FutureBlockTolerance()/time.Second) + maxTimeFutureBlocks)
 				if block.Time().Cmp(max) == 1 {
 					return i, fmt.Errorf("%v: BlockFutureErr, %v > %v", BlockFutureErr, block.Time(), max)
 				}
@@ -901,11 +921,16 @@ func (self *BlockChain) InsertChain(chain types.Blocks) (int, error) {
 			return i, err
 		}
 		// Process block using the parent state as reference point.
-		receipts, logs, usedGas, err := self.processor.Process(block, self.stateCache)
+		receipts, logs, usedGas, err := self.process(block)
 		if err != nil {
 			reportBlock(block, err)
 			return i, err
 		}
+		// Make sure no database failure was masked as missing state
+		if err := self.stateCache.Error(); err != nil {
+			reportBlock(block, err)
+			return i, err
+		}
 		// Validate the state using the default validator
 		err = self.Validator().ValidateState(block, self.GetBlock(block.ParentHash(), block.NumberU64()-1), self.stateCache, receipts, usedGas)
 		if err != nil {
@@ -913,7 +938,7 @@ func (self *BlockChain) InsertChain(chain types.Blocks) (int, error) {
 			return i, err
 		}
 		// Write state changes to database
-		_, err = self.stateCache.Commit(self.config.IsSiotImpr2(block.Number()))
+		_, err = self.stateCache.Commit(self.Config().IsSiotImpr2(block.Number()))
 		if err != nil {
 			return i, err
 		}
@@ -974,6 +999,54 @@ func (self *BlockChain) InsertChain(chain types.Blocks) (int, error) {
 	return 0, nil
 }
 
+// process runs the block processor on the state cache, enforcing the configured
+// processing time limit. If it is exceeded, the block is remembered as bad and
+// rejected right away. The processor is signalled to abort before its next
+// transaction and keeps the partially modified state to itself, the import
+// continuing on a fresh state (InsertChain resets it for every block anyway).
+//
+// Note, this method assumes the chain lock is held!
+func (self *BlockChain) process(block *types.Block) (types.Receipts, localEnv.Logs, *big.Int, error) {
+	if self.procTimeout <= 0 {
+		return self.processor.Process(block, self.stateCache, nil)
+	}
+	type result struct {
+		receipts types.Receipts
+		logs     localEnv.Logs
+		usedGas  *big.Int
+		err      error
+	}
+	var (
+		processor = self.processor
+		statedb   = self.stateCache
+		abort     = make(chan struct{})
+		done      = make(chan result, 1)
+	)
+	go func() {
+		receipts, logs, usedGas, err := processor.Process(block, statedb, abort)
+		done <- result{receipts, logs, usedGas, err}
+	}()
+	timer := time.NewTimer(self.procTimeout)
+	defer timer.Stop()
+
+	select {
+	case res := <-done:
+		return res.receipts, res.logs, res.usedGas, res.err
+	case <-timer.C:
+		close(abort)
+
+		fresh, err := statedb.New(self.currentBlock.Root())
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		self.stateCache = fresh
+		self.slowBlocks.Add(block.Hash(), self.procTimeout)
+		blockTimeoutMeter.Mark(1)
+
+		return nil, nil, nil, &BlockTimeoutErr{Hash: block.Hash(), Number: block.Number(), Timeout: self.procTimeout}
+	}
+}
+
 // insertStats tracks and reports on block insertion.
 type insertStats struct {
 	queued, processed, ignored int
@@ -1133,7 +1206,7 @@ func (self *BlockChain) reorg(oldBlock, newBlock *types.Block) error {
 	// Must be posted in a goroutine because of the transaction pool trying
 	// to acquire the chain manager lock
 	if len(diff) > 0 {
-		go self.eventMux.Post(RemovedTransactionEvent{diff})
+		go self.eventMux.Post(RemovedTransactionEvent{Txs: diff, Depth: len(oldChain)})
 	}
 	if len(deletedLogs) > 0 {
 		go self.eventMux.Post(RemovedLogsEvent{deletedLogs})
@@ -1145,6 +1218,12 @@ func (self *BlockChain) reorg(oldBlock, newBlock *types.Block) error {
 				self.eventMux.Post(ChainSideEvent{Block: block, Logs: deletedLogsByHash[block.Hash()]})
 			}
 		}()
+
+		added := make(types.Blocks, len(newChain))
+		for i, block := range newChain {
+			added[len(newChain)-1-i] = block
+		}
+		go self.eventMux.Post(ChainReorgEvent{Ancestor: commonBlock, Removed: oldChain, Added: added})
 	}
 
 	return nil
@@ -1287,4 +1366,18 @@ func (self *BlockChain) GetHeaderByNumber(number uint64) *types.Header {
 }
 
 // Config retrieves the blockchain's chain configuration.
-func (self *BlockChain) Config() *configure.ChainConfig { return self.config }
+func (self *BlockChain) Config() *configure.ChainConfig {
+	return self.config.Load().(*configure.ChainConfig)
+}
+
+// SetConfig replaces the chain configuration of the running chain, waiting for
+// any block import in progress to finish first. The default block validator and
+// processor are recreated on the new configuration, replacing any custom ones.
+func (self *BlockChain) SetConfig(config *configure.ChainConfig) {
+	self.chainmu.Lock()
+	defer self.chainmu.Unlock()
+
+	self.config.Store(config)
+	self.SetValidator(NewBlockValidator(config, self, self.pow))
+	self.SetProcessor(NewStateProcessor(config, self))
+}
@@ -0,0 +1,120 @@
+package blockchainCore
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/siotchain/siot/blockchainCore/localEnv"
+	"github.com/siotchain/siot/blockchainCore/state"
+	"github.com/siotchain/siot/blockchainCore/types"
+	"github.com/siotchain/siot/database"
+	"github.com/siotchain/siot/subscribe"
+)
+
+// testGenesis is a minimal genesis specification carrying its chain config.
+const testGenesis = `{
+	"config":     {"chainId": 1, "homesteadBlock": 0},
+	"nonce":      "0x0000000000000042",
+	"difficulty": "0x400",
+	"gasLimit":   "0x2fefd8",
+	"alloc":      {}
+}`
+
+// newTestChain creates a blockchain on an in-memory database, starting from a
+// genesis block funding the given accounts.
+func newTestChain(t *testing.T, accounts ...GenesisAccount) (database.Database, *BlockChain) {
+	spec, err := GenesisWithAlloc(testGenesis, accounts...)
+	if err != nil {
+		t.Fatalf("failed to assemble genesis: %v", err)
+	}
+	db, _ := database.NewMemDatabase()
+	if _, err := WriteGenesisBlock(db, strings.NewReader(spec)); err != nil {
+		t.Fatalf("failed to write genesis: %v", err)
+	}
+	blockchain, err := NewBlockChain(db, MakeChainConfig(), FakePow{}, new(subscribe.TypeMux))
+	if err != nil {
+		t.Fatalf("failed to create blockchain: %v", err)
+	}
+	return db, blockchain
+}
+
+// slowProcessor is a block processor taking a fixed amount of time per block,
+// without checking for aborts while doing so.
+type slowProcessor struct {
+	Processor
+	delay time.Duration
+}
+
+func (p slowProcessor) Process(block *types.Block, statedb *state.StateDB, abort <-chan struct{}) (types.Receipts, localEnv.Logs, *big.Int, error) {
+	time.Sleep(p.delay)
+	return p.Processor.Process(block, statedb, abort)
+}
+
+// Tests that blocks whose processing exceeds the import timeout are rejected in
+// time, remembered as bad, and don't affect the import of other blocks.
+func TestBlockProcessTimeout(t *testing.T) {
+	db, blockchain := newTestChain(t)
+	defer blockchain.Stop()
+
+	processor := blockchain.Processor()
+	blockchain.SetProcessor(slowProcessor{Processor: processor, delay: time.Second})
+	blockchain.SetProcessTimeout(50 * time.Millisecond)
+
+	slow := makeBlockChain(blockchain.CurrentBlock(), 1, db, canonicalSeed)
+	start := time.Now()
+	if _, err := blockchain.InsertChain(slow); !IsBlockTimeoutErr(err) {
+		t.Fatalf("slow block import error mismatch: have %v, want timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("timed out import took %v, want close to the timeout", elapsed)
+	}
+	if head := blockchain.CurrentBlock().NumberU64(); head != 0 {
+		t.Errorf("head after timed out import mismatch: have #%d, want #0", head)
+	}
+	// The slow block must be rejected as bad even without the slow processor
+	blockchain.SetProcessor(processor)
+	if _, err := blockchain.InsertChain(slow); !IsBlockTimeoutErr(err) {
+		t.Fatalf("known slow block import error mismatch: have %v, want timeout", err)
+	}
+	// Other blocks must import fine on top of the same parent
+	fork := makeBlockChain(blockchain.CurrentBlock(), 2, db, forkSeed)
+	if _, err := blockchain.InsertChain(fork); err != nil {
+		t.Fatalf("failed to import blocks after a timeout: %v", err)
+	}
+	if head := blockchain.CurrentBlock().Hash(); head != fork[1].Hash() {
+		t.Errorf("head mismatch: have %x, want %x", head, fork[1].Hash())
+	}
+}
+
+// Tests that the chain configuration can be replaced while blocks are imported,
+// and that the chain validates the blocks after the swap with the new one.
+func TestSetConfig(t *testing.T) {
+	db, blockchain := newTestChain(t)
+	defer blockchain.Stop()
+
+	blocks := makeBlockChain(blockchain.CurrentBlock(), 4, db, canonicalSeed)
+
+	config := *blockchain.Config()
+	config.SiotImpr2Block = big.NewInt(1000)
+
+	done := make(chan error)
+	go func() {
+		_, err := blockchain.InsertChain(blocks)
+		done <- err
+	}()
+	blockchain.SetConfig(&config)
+	if err := <-done; err != nil {
+		t.Fatalf("failed to import blocks: %v", err)
+	}
+	if blockchain.Config() != &config {
+		t.Errorf("chain config not replaced")
+	}
+	if processor, ok := blockchain.Processor().(*StateProcessor); !ok || processor.config != &config {
+		t.Errorf("processor not running on the new config")
+	}
+	if validator, ok := blockchain.Validator().(*BlockValidator); !ok || validator.config != &config {
+		t.Errorf("validator not running on the new config")
+	}
+}
@@ -90,7 +90,7 @@ func (b *BlockGen) AddTx(tx *types.Transaction) {
 	if b.gasPool == nil {
 		b.SetCoinbase(helper.Address{})
 	}
-	b.statedb.StartRecord(tx.Hash(), helper.Hash{}, len(b.txs))
+	b.statedb.Prepare(tx.Hash(), helper.Hash{}, len(b.txs))
 	receipt, _, _, err := ApplyTransaction(b.config, nil, b.gasPool, b.statedb, b.header, tx, b.header.GasUsed)
 	if err != nil {
 		panic(err)
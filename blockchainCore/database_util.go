@@ -21,6 +21,8 @@ var (
 	headHeaderKey = []byte("LastHeader")
 	headBlockKey  = []byte("LastBlock")
 	headFastKey   = []byte("LastFast")
+	lastMinedKey  = []byte("LastMined")
+	lastFrozenKey = []byte("LastFrozen")
 
 	headerPrefix        = []byte("h") // headerPrefix + num (uint64 big endian) + hash -> header
 	tdSuffix            = []byte("t") // headerPrefix + num (uint64 big endian) + hash + tdSuffix -> td
@@ -29,13 +31,15 @@ var (
 	bodyPrefix          = []byte("b") // bodyPrefix + num (uint64 big endian) + hash -> block body
 	blockReceiptsPrefix = []byte("r") // blockReceiptsPrefix + num (uint64 big endian) + hash -> block receipts
 
-	txMetaSuffix   = []byte{0x01}
-	receiptsPrefix = []byte("receipts-")
+	txMetaSuffix      = []byte{0x01}
+	receiptsPrefix    = []byte("receipts-")
+	senderIndexPrefix = []byte("sender-") // senderIndexPrefix + address + num (uint64 big endian) -> tx hashes
 
 	mipmapPre    = []byte("mipmap-log-bloom-")
 	MIPMapLevels = []uint64{1000000, 500000, 100000, 50000, 1000}
 
-	configPrefix = []byte("siot-config-") // config prefix for the db
+	configPrefix    = []byte("siot-config-")  // config prefix for the db
+	networkIdPrefix = []byte("siot-network-") // networkIdPrefix + genesis hash -> network id (uint64 big endian)
 
 	// used by old (non-sequential keys) db, now only used for conversion
 	oldBlockPrefix         = []byte("block-")
@@ -47,8 +51,88 @@ var (
 	oldBlockHashPrefix     = []byte("block-hash-") // [deprecated by the header/block split, remove eventually]
 
 	ChainConfigNotFoundErr = errors.New("ChainConfig not found") // general config not found error
+
+	// maxGasAccountingRange is the maximum number of blocks scanned by a single
+	// GetGasSpentBySender call; longer ranges are truncated.
+	maxGasAccountingRange = uint64(100000)
 )
 
+const (
+	// AncientThreshold is the number of blocks a canonical block must be behind
+	// the head before its body and receipts are moved to the ancient store.
+	AncientThreshold = 90000
+
+	// maxFreezeBlocks is the maximum number of blocks moved to the ancient store
+	// by a single FreezeAncientBlocks call.
+	maxFreezeBlocks = 2048
+)
+
+// IsAncientKey reports whether a database key holds chain data (block bodies and
+// receipts) that can be moved to a separate, slower store once the block is deep
+// enough in the canonical chain. See FreezeAncientBlocks.
+func IsAncientKey(key []byte) bool {
+	if len(key) != 1+8+helper.HashLength || bytes.HasPrefix(key, receiptsPrefix) {
+		return false
+	}
+	return key[0] == bodyPrefix[0] || key[0] == blockReceiptsPrefix[0]
+}
+
+// GetLastFrozenBlock retrieves the number of the last canonical block whose data
+// was moved to the ancient store, and whether any block was moved at all.
+func GetLastFrozenBlock(db database.Database) (uint64, bool) {
+	data, _ := db.Get(lastFrozenKey)
+	if len(data) != 8 {
+		return 0, false
+	}
+	return binary.BigEndian.Uint64(data), true
+}
+
+// FreezeAncientBlocks moves the bodies and receipts of the canonical blocks at
+// least AncientThreshold blocks behind head into the ancient store, continuing
+// from the last frozen block. Side chain and recent data is left in the hot
+// store. At most maxFreezeBlocks blocks are moved per call, the rest is picked up
+// as the chain advances. It returns the number of blocks moved.
+func FreezeAncientBlocks(db *database.TieredDatabase, head uint64) (int, error) {
+	if head < AncientThreshold {
+		return 0, nil
+	}
+	limit := head - AncientThreshold
+
+	next := uint64(0)
+	if last, ok := GetLastFrozenBlock(db); ok {
+		next = last + 1
+	}
+	if limit >= next+maxFreezeBlocks {
+		limit = next + maxFreezeBlocks - 1
+	}
+	var (
+		keys   [][]byte
+		frozen = 0
+	)
+	for number := next; number <= limit; number++ {
+		hash := GetCanonicalHash(db, number)
+		if hash == (helper.Hash{}) {
+			break
+		}
+		enc := encodeBlockNumber(number)
+		keys = append(keys,
+			append(append(append([]byte{}, bodyPrefix...), enc...), hash.Bytes()...),
+			append(append(append([]byte{}, blockReceiptsPrefix...), enc...), hash.Bytes()...),
+		)
+		frozen++
+	}
+	if frozen == 0 {
+		return 0, nil
+	}
+	if err := db.Freeze(keys); err != nil {
+		return 0, err
+	}
+	if err := db.Put(lastFrozenKey, encodeBlockNumber(next+uint64(frozen)-1)); err != nil {
+		return 0, err
+	}
+	return frozen, nil
+}
+
 // encodeBlockNumber encodes a block number as big endian uint64
 func encodeBlockNumber(number uint64) []byte {
 	enc := make([]byte, 8)
@@ -124,6 +208,16 @@ func GetHeadFastBlockHash(db database.Database) helper.Hash {
 	return helper.BytesToHash(data)
 }
 
+// GetLastMinedNumber retrieves the number of the last block sealed by the local
+// miner, and whether there was any.
+func GetLastMinedNumber(db database.Database) (uint64, bool) {
+	data, _ := db.Get(lastMinedKey)
+	if len(data) != 8 {
+		return 0, false
+	}
+	return binary.BigEndian.Uint64(data), true
+}
+
 // GetHeaderRLP retrieves a block header in its raw RLP database encoding, or nil
 // if the header's not found.
 func GetHeaderRLP(db database.Database, hash helper.Hash, number uint64) rlp.RawValue {
@@ -308,6 +402,15 @@ func WriteHeadFastBlockHash(db database.Database, hash helper.Hash) error {
 	return nil
 }
 
+// WriteLastMinedNumber stores the number of the last block sealed locally, so
+// that the miner can detect a chain head falling behind it after a restart.
+func WriteLastMinedNumber(db database.Database, number uint64) error {
+	if err := db.Put(lastMinedKey, encodeBlockNumber(number)); err != nil {
+		glog.Fatalf("failed to store last mined block's number into database: %v", err)
+	}
+	return nil
+}
+
 // WriteHeader serializes a block header into the database.
 func WriteHeader(db database.Database, header *types.Header) error {
 	data, err := rlp.EncodeToBytes(header)
@@ -403,6 +506,7 @@ func WriteBlockReceipts(db database.Database, hash helper.Hash, number uint64, r
 // of this within the blockchain.
 func WriteTransactions(db database.Database, block *types.Block) error {
 	batch := db.NewBatch()
+	senders := make(map[helper.Address][]helper.Hash)
 
 	// Iterate over each transaction and encode it with its metadata
 	for i, tx := range block.Transactions() {
@@ -431,6 +535,19 @@ func WriteTransactions(db database.Database, block *types.Block) error {
 		if err := batch.Put(append(tx.Hash().Bytes(), txMetaSuffix...), data); err != nil {
 			return err
 		}
+		// Track the transaction in its sender's index
+		if from, err := types.Sender(txSigner(tx), tx); err == nil {
+			senders[from] = append(senders[from], tx.Hash())
+		}
+	}
+	for from, hashes := range senders {
+		data, err := rlp.EncodeToBytes(hashes)
+		if err != nil {
+			return err
+		}
+		if err := batch.Put(senderIndexKey(from, block.NumberU64()), data); err != nil {
+			return err
+		}
 	}
 	// Write the scheduled data into the database
 	if err := batch.Write(); err != nil {
@@ -439,6 +556,68 @@ func WriteTransactions(db database.Database, block *types.Block) error {
 	return nil
 }
 
+// txSigner returns the signer able to derive the sender of a transaction that
+// was already accepted into the chain.
+func txSigner(tx *types.Transaction) types.Signer {
+	if tx.Protected() {
+		return types.NewSiotImpr1Signer(tx.ChainId())
+	}
+	return types.HomesteadSigner{}
+}
+
+// senderIndexKey returns the database key of the transactions sent by addr
+// in the block with the given number.
+func senderIndexKey(addr helper.Address, number uint64) []byte {
+	return append(append(append([]byte{}, senderIndexPrefix...), addr.Bytes()...), encodeBlockNumber(number)...)
+}
+
+// GetSenderTransactions retrieves the hashes of the transactions sent by addr in
+// the block with the given number. Entries of blocks that were reorged out are
+// not removed, so callers need to check the transactions are still canonical.
+func GetSenderTransactions(db database.Database, addr helper.Address, number uint64) []helper.Hash {
+	data, _ := db.Get(senderIndexKey(addr, number))
+	if len(data) == 0 {
+		return nil
+	}
+	var hashes []helper.Hash
+	if err := rlp.DecodeBytes(data, &hashes); err != nil {
+		glog.V(logger.Error).Infof("invalid sender index RLP for %x #%d: %v", addr, number, err)
+		return nil
+	}
+	return hashes
+}
+
+// GetGasSpentBySender sums up gasUsed * gasPrice over all the transactions sent
+// by addr in the canonical blocks between fromBlock and toBlock (inclusive).
+// Ranges longer than maxGasAccountingRange blocks are truncated.
+func GetGasSpentBySender(db database.Database, addr helper.Address, fromBlock, toBlock uint64) *big.Int {
+	total := new(big.Int)
+	if toBlock < fromBlock {
+		return total
+	}
+	if toBlock-fromBlock >= maxGasAccountingRange {
+		toBlock = fromBlock + maxGasAccountingRange - 1
+	}
+	for number := fromBlock; number <= toBlock; number++ {
+		for _, hash := range GetSenderTransactions(db, addr, number) {
+			// Skip transactions no longer part of the canonical chain
+			tx, _, txNumber, _ := GetTransaction(db, hash)
+			if tx == nil || txNumber != number {
+				continue
+			}
+			receipt := GetReceipt(db, hash)
+			if receipt == nil || receipt.GasUsed == nil {
+				continue
+			}
+			total.Add(total, new(big.Int).Mul(receipt.GasUsed, tx.GasPrice()))
+		}
+		if number == toBlock { // avoid overflow on math.MaxUint64
+			break
+		}
+	}
+	return total
+}
+
 // WriteReceipt stores a single transaction receipt into the database.
 func WriteReceipt(db database.Database, receipt *types.Receipt) error {
 	storageReceipt := (*types.ReceiptForStorage)(receipt)
@@ -618,6 +797,22 @@ func GetChainConfig(db database.Database, hash helper.Hash) (*configure.ChainCon
 	return &config, nil
 }
 
+// WriteNetworkId stores the network id the chain with the given genesis hash is
+// used with.
+func WriteNetworkId(db database.Database, hash helper.Hash, id uint64) error {
+	return db.Put(append(networkIdPrefix, hash[:]...), encodeBlockNumber(id))
+}
+
+// GetNetworkId retrieves the network id the chain with the given genesis hash
+// was last used with, if any.
+func GetNetworkId(db database.Database, hash helper.Hash) (uint64, bool) {
+	data, _ := db.Get(append(networkIdPrefix, hash[:]...))
+	if len(data) != 8 {
+		return 0, false
+	}
+	return binary.BigEndian.Uint64(data), true
+}
+
 // FindCommonAncestor returns the last helper ancestor of two block headers
 func FindCommonAncestor(db database.Database, a, b *types.Header) *types.Header {
 	for bn := b.Number.Uint64(); a.Number.Uint64() > bn; {
@@ -644,3 +839,50 @@ func FindCommonAncestor(db database.Database, a, b *types.Header) *types.Header
 	}
 	return a
 }
+
+// DiskUsage iterates over the entire database and sums up the size of the keys
+// and values stored, grouped by the kind of data they belong to. The scan is
+// expensive, so callers should cache its result.
+func DiskUsage(db database.Database) map[string]uint64 {
+	usage := make(map[string]uint64)
+
+	it := db.NewIterator(nil)
+	defer it.Release()
+	for it.Next() {
+		usage[keyCategory(it.Key())] += uint64(len(it.Key()) + len(it.Value()))
+	}
+	return usage
+}
+
+// keyCategory classifies a database key based on its prefix and length.
+func keyCategory(key []byte) string {
+	switch {
+	case bytes.Equal(key, headHeaderKey), bytes.Equal(key, headBlockKey), bytes.Equal(key, headFastKey), bytes.Equal(key, lastFrozenKey), bytes.Equal(key, lastMinedKey):
+		return "heads"
+	case bytes.HasPrefix(key, configPrefix):
+		return "config"
+	case bytes.HasPrefix(key, mipmapPre):
+		return "bloombits"
+	case bytes.HasPrefix(key, receiptsPrefix):
+		return "receipts"
+	case bytes.HasPrefix(key, senderIndexPrefix):
+		return "senderindex"
+	case bytes.HasPrefix(key, oldBlockPrefix), bytes.HasPrefix(key, oldBlockReceiptsPrefix):
+		return "legacy"
+	case bytes.HasPrefix(key, []byte("secure-key-")):
+		return "preimages"
+	case len(key) == helper.HashLength+len(txMetaSuffix) && bytes.HasSuffix(key, txMetaSuffix):
+		return "txlookup"
+	case len(key) == helper.HashLength:
+		return "state"
+	case bytes.HasPrefix(key, headerPrefix):
+		return "headers"
+	case bytes.HasPrefix(key, blockHashPrefix):
+		return "headers"
+	case bytes.HasPrefix(key, bodyPrefix):
+		return "bodies"
+	case bytes.HasPrefix(key, blockReceiptsPrefix):
+		return "receipts"
+	}
+	return "other"
+}
@@ -0,0 +1,86 @@
+package blockchainCore
+
+import (
+	"crypto/ecdsa"
+	"math/big"
+	"testing"
+
+	"github.com/siotchain/siot/blockchainCore/types"
+	"github.com/siotchain/siot/configure"
+	"github.com/siotchain/siot/crypto"
+	"github.com/siotchain/siot/database"
+	"github.com/siotchain/siot/helper"
+)
+
+// Tests that the number of the last locally mined block is stored, retrieved
+// and accounted for among the head markers.
+func TestLastMinedNumberStorage(t *testing.T) {
+	db, _ := database.NewMemDatabase()
+
+	if number, ok := GetLastMinedNumber(db); ok {
+		t.Fatalf("non existent last mined number returned: #%d", number)
+	}
+	if err := WriteLastMinedNumber(db, 314); err != nil {
+		t.Fatalf("failed to write last mined number: %v", err)
+	}
+	if number, ok := GetLastMinedNumber(db); !ok || number != 314 {
+		t.Fatalf("last mined number mismatch: have #%d (%v), want #314", number, ok)
+	}
+	if category := keyCategory(lastMinedKey); category != "heads" {
+		t.Errorf("last mined key category mismatch: have %q, want %q", category, "heads")
+	}
+}
+
+// Tests that the fees paid by an account are summed up over its transactions
+// in the requested block range only.
+func TestGasSpentBySender(t *testing.T) {
+	db, _ := database.NewMemDatabase()
+
+	var (
+		signer   = types.NewSiotImpr1Signer(configure.TestChainConfig.ChainId)
+		key, _   = crypto.GenerateKey()
+		other, _ = crypto.GenerateKey()
+		sender   = crypto.PubkeyToAddress(key.PublicKey)
+	)
+	// Store the transactions of a few blocks along with their receipts
+	transfer := func(key *ecdsa.PrivateKey, nonce uint64, price int64) *types.Transaction {
+		tx, _ := types.SignECDSA(signer, types.NewTransaction(nonce, helper.Address{}, big.NewInt(1), big.NewInt(50000), big.NewInt(price), nil), key)
+		return tx
+	}
+	blocks := []types.Transactions{
+		{transfer(key, 0, 2), transfer(other, 0, 5)},
+		{transfer(key, 1, 3)},
+		{transfer(key, 2, 7)},
+	}
+	for i, txs := range blocks {
+		block := types.NewBlock(&types.Header{Number: big.NewInt(int64(i + 1))}, txs, nil, nil)
+		if err := WriteTransactions(db, block); err != nil {
+			t.Fatalf("failed to write transactions of block #%d: %v", i+1, err)
+		}
+		for _, tx := range txs {
+			if err := WriteReceipt(db, &types.Receipt{TxHash: tx.Hash(), CumulativeGasUsed: big.NewInt(21000), GasUsed: big.NewInt(21000)}); err != nil {
+				t.Fatalf("failed to write receipt: %v", err)
+			}
+		}
+	}
+	// Two transactions in the first two blocks, 21000 gas each at prices 2 and 3
+	if spent := GetGasSpentBySender(db, sender, 1, 2); spent.Cmp(big.NewInt(21000*2+21000*3)) != 0 {
+		t.Errorf("gas spent mismatch: have %v, want %v", spent, 21000*2+21000*3)
+	}
+	if spent := GetGasSpentBySender(db, crypto.PubkeyToAddress(other.PublicKey), 1, 3); spent.Cmp(big.NewInt(21000*5)) != 0 {
+		t.Errorf("gas spent by other sender mismatch: have %v, want %v", spent, 21000*5)
+	}
+	if spent := GetGasSpentBySender(db, helper.Address{1}, 1, 3); spent.Sign() != 0 {
+		t.Errorf("gas spent by unknown account: have %v, want 0", spent)
+	}
+	if spent := GetGasSpentBySender(db, sender, 3, 1); spent.Sign() != 0 {
+		t.Errorf("gas spent in an inverted range: have %v, want 0", spent)
+	}
+	// Overly long ranges must be truncated
+	defer func(old uint64) { maxGasAccountingRange = old }(maxGasAccountingRange)
+	maxGasAccountingRange = 1
+
+	if spent := GetGasSpentBySender(db, sender, 1, 3); spent.Cmp(big.NewInt(21000*2)) != 0 {
+		t.Errorf("gas spent in a truncated range mismatch: have %v, want %v", spent, 21000*2)
+	}
+}
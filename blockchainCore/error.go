@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"math/big"
+	"time"
 
 	"github.com/siotchain/siot/helper"
 )
@@ -162,6 +163,24 @@ func IsValueTransferErr(e error) bool {
 	return ok
 }
 
+// BlockTimeoutErr is returned if the processing of a block exceeded the
+// configured time limit.
+type BlockTimeoutErr struct {
+	Hash    helper.Hash
+	Number  *big.Int
+	Timeout time.Duration
+}
+
+func (err *BlockTimeoutErr) Error() string {
+	return fmt.Sprintf("block #%v [%x…] exceeded the processing time limit of %v", err.Number, err.Hash[:4], err.Timeout)
+}
+
+// IsBlockTimeoutErr returns true for block processing timeout errors.
+func IsBlockTimeoutErr(err error) bool {
+	_, ok := err.(*BlockTimeoutErr)
+	return ok
+}
+
 type BadHashError helper.Hash
 
 func (h BadHashError) Error() string {
@@ -185,3 +204,19 @@ func IsGasLimitErr(err error) bool {
 func (err *GasLimitErr) Error() string {
 	return fmt.Sprintf("GasLimit reached. Have %d gas, transaction requires %d", err.Have, err.Want)
 }
+
+// HeaderChainErr is returned by VerifyHeaderChain, identifying the first
+// invalid header within the verified sequence.
+type HeaderChainErr struct {
+	Index int
+	Err   error
+}
+
+func (err *HeaderChainErr) Error() string {
+	return fmt.Sprintf("invalid header at index %d: %v", err.Index, err.Err)
+}
+
+func IsHeaderChainErr(err error) bool {
+	_, ok := err.(*HeaderChainErr)
+	return ok
+}
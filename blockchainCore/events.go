@@ -14,6 +14,20 @@ type TxPreEvent struct{ Tx *types.Transaction }
 // TxPostEvent is posted when a transaction has been processed.
 type TxPostEvent struct{ Tx *types.Transaction }
 
+// TxRejectedEvent is posted when a transaction is refused entry into the
+// transaction pool because it is priced below the accepted minimum.
+type TxRejectedEvent struct {
+	Hash   helper.Hash
+	Reason error
+}
+
+// TxDroppedEvent is posted when a local transaction is evicted from the pool,
+// either because it became invalid or to keep the pool within its limits.
+type TxDroppedEvent struct {
+	Tx     *types.Transaction
+	Reason error
+}
+
 // PendingLogsEvent is posted pre mining and notifies of pending logs.
 type PendingLogsEvent struct {
 	Logs localEnv.Logs
@@ -28,8 +42,13 @@ type NewBlockEvent struct{ Block *types.Block }
 // NewMinedBlockEvent is posted when a block has been imported.
 type NewMinedBlockEvent struct{ Block *types.Block }
 
-// RemovedTransactionEvent is posted when a reorg happens
-type RemovedTransactionEvent struct{ Txs types.Transactions }
+// RemovedTransactionEvent is posted when a reorg happens, carrying the
+// transactions of the orphaned blocks missing from the new chain and the
+// number of blocks orphaned.
+type RemovedTransactionEvent struct {
+	Txs   types.Transactions
+	Depth int
+}
 
 // RemovedLogEvent is posted when a reorg happens
 type RemovedLogsEvent struct{ Logs localEnv.Logs }
@@ -62,6 +81,15 @@ type ChainUncleEvent struct {
 
 type ChainHeadEvent struct{ Block *types.Block }
 
+// ChainReorgEvent is posted when the canonical chain is reorganised. Removed
+// holds the blocks dropped from the chain, newest first, and Added the blocks
+// that replaced them, oldest first.
+type ChainReorgEvent struct {
+	Ancestor *types.Block
+	Removed  types.Blocks
+	Added    types.Blocks
+}
+
 type GasPriceChanged struct{ Price *big.Int }
 
 // Mining operation events
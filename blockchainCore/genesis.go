@@ -133,6 +133,45 @@ type GenesisAccount struct {
 	Balance *big.Int
 }
 
+// GenesisWithAlloc returns the given genesis JSON with the accounts added to its
+// allocation. Accounts already allocated in the genesis get their balance
+// replaced, keeping any code and storage they have.
+func GenesisWithAlloc(genesis string, accounts ...GenesisAccount) (string, error) {
+	var spec map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(genesis), &spec); err != nil {
+		return "", err
+	}
+	var alloc map[string]map[string]interface{}
+	if raw, ok := spec["alloc"]; ok {
+		if err := json.Unmarshal(raw, &alloc); err != nil {
+			return "", fmt.Errorf("invalid genesis alloc: %v", err)
+		}
+	}
+	// Key the allocation by canonical address, the same account may be spelled
+	// differently in the genesis and the overrides
+	merged := make(map[string]map[string]interface{})
+	for addr, account := range alloc {
+		merged[fmt.Sprintf("%x", helper.HexToAddress(addr))] = account
+	}
+	for _, account := range accounts {
+		key := fmt.Sprintf("%x", account.Address)
+		if merged[key] == nil {
+			merged[key] = make(map[string]interface{})
+		}
+		merged[key]["balance"] = account.Balance.String()
+	}
+	blob, err := json.Marshal(merged)
+	if err != nil {
+		return "", err
+	}
+	spec["alloc"] = blob
+
+	if blob, err = json.Marshal(spec); err != nil {
+		return "", err
+	}
+	return string(blob), nil
+}
+
 func WriteGenesisBlockForTesting(db database.Database, accounts ...GenesisAccount) *types.Block {
 	accountJson := "{"
 	for i, account := range accounts {
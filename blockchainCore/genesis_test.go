@@ -0,0 +1,59 @@
+package blockchainCore
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/siotchain/siot/blockchainCore/state"
+	"github.com/siotchain/siot/database"
+	"github.com/siotchain/siot/helper"
+)
+
+// Tests that accounts added to the allocation of a genesis are funded at block 0,
+// overriding the balances of the accounts already allocated.
+func TestGenesisWithAlloc(t *testing.T) {
+	var (
+		funded   = helper.HexToAddress("0x00000000000000000000000000000000000000f1")
+		existing = helper.HexToAddress("0xDBDBDB2CBD23B783741E8D7FCF51E459B497E4A6")
+		other    = helper.HexToAddress("0x0000000000000000000000000000000000000001")
+	)
+	genesis := `{
+		"config":     {"chainId": 1, "homesteadBlock": 0},
+		"nonce":      "0x0000000000000042",
+		"difficulty": "0x400",
+		"gasLimit":   "0x2fefd8",
+		"alloc":      {
+			"dbdbdb2cbd23b783741e8d7fcf51e459b497e4a6": {"balance": "1"},
+			"0000000000000000000000000000000000000001": {"balance": "1"}
+		}
+	}`
+	spec, err := GenesisWithAlloc(genesis,
+		GenesisAccount{Address: funded, Balance: big.NewInt(1000)},
+		GenesisAccount{Address: existing, Balance: big.NewInt(2000)},
+	)
+	if err != nil {
+		t.Fatalf("failed to assemble genesis: %v", err)
+	}
+	db, _ := database.NewMemDatabase()
+	block, err := WriteGenesisBlock(db, strings.NewReader(spec))
+	if err != nil {
+		t.Fatalf("failed to write genesis: %v", err)
+	}
+	if block.NumberU64() != 0 {
+		t.Fatalf("genesis number mismatch: have %d, want 0", block.NumberU64())
+	}
+	statedb, err := state.New(block.Root(), db)
+	if err != nil {
+		t.Fatalf("failed to open genesis state: %v", err)
+	}
+	balances := map[helper.Address]int64{funded: 1000, existing: 2000, other: 1}
+	for addr, want := range balances {
+		if have := statedb.GetBalance(addr); have.Cmp(big.NewInt(want)) != 0 {
+			t.Errorf("%x: balance mismatch: have %v, want %d", addr, have, want)
+		}
+	}
+	if _, err := GenesisWithAlloc("not json"); err == nil {
+		t.Errorf("invalid genesis accepted")
+	}
+}
@@ -503,3 +503,34 @@ func (v *headerValidator) ValidateHeader(header, parent *types.Header, checkPow
 	}
 	return ValidateHeader(v.config, v.Pow, header, parent, checkPow, false)
 }
+
+// VerifyHeaderChain checks that the given headers form a contiguous, valid
+// sequence without requiring block bodies or state: parent links, timestamps,
+// difficulty and gas limit bounds are verified, proof-of-work is not. The parent
+// of the first header is looked up in db unless the first header is the genesis.
+//
+// If a header fails verification, a *HeaderChainErr is returned carrying its
+// index within the sequence and the reason.
+func VerifyHeaderChain(db database.Database, headers []*types.Header, config *configure.ChainConfig) error {
+	if len(headers) == 0 {
+		return nil
+	}
+	var parent *types.Header
+	if first := headers[0]; first.Number.Sign() > 0 {
+		if parent = GetHeader(db, first.ParentHash, first.Number.Uint64()-1); parent == nil {
+			return &HeaderChainErr{Index: 0, Err: ParentError(first.ParentHash)}
+		}
+	}
+	for i, header := range headers {
+		if parent != nil {
+			if header.ParentHash != parent.Hash() {
+				return &HeaderChainErr{Index: i, Err: ParentError(header.ParentHash)}
+			}
+			if err := ValidateHeader(config, nil, header, parent, false, false); err != nil {
+				return &HeaderChainErr{Index: i, Err: err}
+			}
+		}
+		parent = header
+	}
+	return nil
+}
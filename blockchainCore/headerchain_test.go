@@ -0,0 +1,41 @@
+package blockchainCore
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/siotchain/siot/blockchainCore/types"
+)
+
+// Tests that header chains are verified without bodies, and that the first
+// invalid header is reported with its index.
+func TestVerifyHeaderChain(t *testing.T) {
+	db, blockchain := newTestChain(t)
+	defer blockchain.Stop()
+
+	config := blockchain.Config()
+	headers := makeHeaderChain(blockchain.Genesis().Header(), 8, db, canonicalSeed)
+
+	if err := VerifyHeaderChain(db, headers, config); err != nil {
+		t.Fatalf("valid header chain rejected: %v", err)
+	}
+	// Headers continuing a stored one must be linked to it
+	if err := VerifyHeaderChain(db, headers[4:], config); err == nil {
+		t.Fatalf("header chain with unknown parent accepted")
+	}
+	// Break the chain by making a header's timestamp precede its parent's
+	broken := make([]*types.Header, len(headers))
+	copy(broken, headers)
+
+	bad := types.CopyHeader(broken[5])
+	bad.Time = new(big.Int).Sub(broken[4].Time, big.NewInt(1))
+	broken[5] = bad
+
+	err := VerifyHeaderChain(db, broken, config)
+	if !IsHeaderChainErr(err) {
+		t.Fatalf("broken header chain error mismatch: have %v, want header chain error", err)
+	}
+	if index := err.(*HeaderChainErr).Index; index != 5 {
+		t.Errorf("invalid header index mismatch: have %d, want 5", index)
+	}
+}
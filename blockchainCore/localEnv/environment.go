@@ -72,6 +72,7 @@ type Database interface {
 
 	GetNonce(helper.Address) uint64
 	SetNonce(helper.Address, uint64)
+	CanApplyNonce(helper.Address, uint64) bool
 
 	GetCodeHash(helper.Address) helper.Hash
 	GetCodeSize(helper.Address) int
@@ -0,0 +1,62 @@
+package state
+
+import (
+	"sync"
+
+	"github.com/hashicorp/golang-lru"
+	"github.com/siotchain/siot/helper"
+)
+
+// DefaultCodeCacheSize is the number of externalLogic codes kept in the shared
+// code cache unless configured otherwise.
+const DefaultCodeCacheSize = 4096
+
+var (
+	codeCacheLock sync.RWMutex
+	codeCache     = newCodeCache(DefaultCodeCacheSize)
+)
+
+// newCodeCache creates an LRU cache of the given size, or nil if the size is
+// not positive.
+func newCodeCache(size int) *lru.Cache {
+	if size <= 0 {
+		return nil
+	}
+	cache, _ := lru.New(size)
+	return cache
+}
+
+// SetCodeCacheSize replaces the code cache shared by all StateDBs with one
+// holding up to size entries, dropping any cached code. Code is content
+// addressed, so a single cache can safely serve every state and database. A
+// non-positive size disables the cache.
+func SetCodeCacheSize(size int) {
+	codeCacheLock.Lock()
+	defer codeCacheLock.Unlock()
+
+	codeCache = newCodeCache(size)
+}
+
+// cachedCode retrieves the code with the given hash from the shared cache.
+func cachedCode(codeHash []byte) ([]byte, bool) {
+	codeCacheLock.RLock()
+	defer codeCacheLock.RUnlock()
+
+	if codeCache == nil {
+		return nil, false
+	}
+	if code, ok := codeCache.Get(helper.BytesToHash(codeHash)); ok {
+		return code.([]byte), true
+	}
+	return nil, false
+}
+
+// cacheCode inserts a loaded code into the shared cache.
+func cacheCode(codeHash []byte, code []byte) {
+	codeCacheLock.RLock()
+	defer codeCacheLock.RUnlock()
+
+	if codeCache != nil {
+		codeCache.Add(helper.BytesToHash(codeHash), code)
+	}
+}
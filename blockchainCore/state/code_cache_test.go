@@ -0,0 +1,57 @@
+package state
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/siotchain/siot/database"
+	"github.com/siotchain/siot/helper"
+)
+
+// Tests that the code loaded by one state is served to other states from the
+// shared cache, without reading the database again.
+func TestSharedCodeCache(t *testing.T) {
+	defer SetCodeCacheSize(DefaultCodeCacheSize)
+
+	var (
+		addr = helper.HexToAddress("0xc0de")
+		code = []byte{0x60, 0x01, 0x60, 0x02}
+	)
+	for _, size := range []int{DefaultCodeCacheSize, 0} {
+		mem, _ := database.NewMemDatabase()
+		db := &failingDatabase{Database: mem}
+
+		statedb, _ := New(helper.Hash{}, db)
+		statedb.SetCode(addr, code)
+		root, err := statedb.Commit(false)
+		if err != nil {
+			t.Fatalf("size %d: failed to commit state: %v", size, err)
+		}
+		// Start with an empty cache, loading the code through a first state
+		SetCodeCacheSize(size)
+
+		first, _ := New(root, db)
+		if loaded := first.GetCode(addr); !bytes.Equal(loaded, code) {
+			t.Fatalf("size %d: first state code mismatch: have %x, want %x", size, loaded, code)
+		}
+		// Break code reads, a second state can only get the code from the cache
+		second, _ := New(root, db)
+		second.GetStateObject(addr)
+		db.broken = true
+
+		loaded := second.GetCode(addr)
+		if size == 0 {
+			if loaded != nil {
+				t.Errorf("code served without cache: %x", loaded)
+			}
+			continue
+		}
+		if !bytes.Equal(loaded, code) {
+			t.Errorf("second state code mismatch: have %x, want %x", loaded, code)
+		}
+		// Copies of a state must be served from the cache too
+		if loaded := first.Copy().GetCode(addr); !bytes.Equal(loaded, code) {
+			t.Errorf("copied state code mismatch: have %x, want %x", loaded, code)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package state
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+
+	"github.com/siotchain/siot/database"
+	"github.com/siotchain/siot/helper"
+	"github.com/siotchain/siot/helper/rlp"
+	"github.com/siotchain/siot/trie"
+)
+
+// AccountDiff describes how a single account changed between two states. Fields
+// of the missing side are left zero for created and deleted wallet.
+type AccountDiff struct {
+	Address     helper.Address // Address of the account (zero if the preimage is unknown)
+	AddressHash helper.Hash    // Hash of the address, the key in the state trie
+	Created     bool           // Whether the account only exists in the new state
+	Deleted     bool           // Whether the account only exists in the old state
+
+	BalanceBefore, BalanceAfter *big.Int
+	NonceBefore, NonceAfter     uint64
+	CodeBefore, CodeAfter       []byte // Only set if the code changed
+
+	Storage []StorageDiff // Changed storage slots, ordered by key hash
+}
+
+// StorageDiff describes a changed storage slot of an account.
+type StorageDiff struct {
+	Key           helper.Hash // Storage key (zero if the preimage is unknown)
+	KeyHash       helper.Hash // Hash of the storage key, the key in the storage trie
+	Before, After helper.Hash
+}
+
+// StateDiff computes the accounts whose balance, nonce, code or storage differs
+// between the two state roots. As all the differences are held in memory, use
+// StateDiffForEach for states that may have diverged a lot.
+func StateDiff(oldRoot, newRoot helper.Hash, db database.Database) ([]AccountDiff, error) {
+	var diffs []AccountDiff
+	err := StateDiffForEach(oldRoot, newRoot, db, func(diff AccountDiff) error {
+		diffs = append(diffs, diff)
+		return nil
+	})
+	return diffs, err
+}
+
+// StateDiffForEach walks the state tries of the two roots side by side, calling
+// fn for every account that differs, in the order of the address hashes. If fn
+// returns an error, the iteration is aborted and the error returned.
+func StateDiffForEach(oldRoot, newRoot helper.Hash, db database.Database, fn func(AccountDiff) error) error {
+	if oldRoot == newRoot {
+		return nil
+	}
+	oldTrie, err := trie.NewSecure(oldRoot, db, 0)
+	if err != nil {
+		return err
+	}
+	newTrie, err := trie.NewSecure(newRoot, db, 0)
+	if err != nil {
+		return err
+	}
+	return diffTries(oldTrie, newTrie, func(key, oldVal, newVal []byte) error {
+		diff, err := diffAccount(db, oldTrie, newTrie, key, oldVal, newVal)
+		if err != nil {
+			return err
+		}
+		return fn(diff)
+	})
+}
+
+// diffAccount assembles the difference of an account from its old and new RLP
+// encodings, either of which may be nil.
+func diffAccount(db database.Database, oldTrie, newTrie *trie.SecureTrie, key, oldVal, newVal []byte) (AccountDiff, error) {
+	diff := AccountDiff{
+		AddressHash: helper.BytesToHash(key),
+		Created:     oldVal == nil,
+		Deleted:     newVal == nil,
+	}
+	if addr := newTrie.GetKey(key); addr != nil {
+		diff.Address = helper.BytesToAddress(addr)
+	} else if addr := oldTrie.GetKey(key); addr != nil {
+		diff.Address = helper.BytesToAddress(addr)
+	}
+	var before, after Account
+	before.Balance, before.CodeHash = new(big.Int), emptyCodeHash
+	after.Balance, after.CodeHash = new(big.Int), emptyCodeHash
+
+	if oldVal != nil {
+		if err := rlp.DecodeBytes(oldVal, &before); err != nil {
+			return diff, fmt.Errorf("invalid account %x in old state: %v", key, err)
+		}
+	}
+	if newVal != nil {
+		if err := rlp.DecodeBytes(newVal, &after); err != nil {
+			return diff, fmt.Errorf("invalid account %x in new state: %v", key, err)
+		}
+	}
+	diff.BalanceBefore, diff.BalanceAfter = before.Balance, after.Balance
+	diff.NonceBefore, diff.NonceAfter = before.Nonce, after.Nonce
+
+	if !bytes.Equal(before.CodeHash, after.CodeHash) {
+		var err error
+		if diff.CodeBefore, err = loadCode(db, before.CodeHash); err != nil {
+			return diff, err
+		}
+		if diff.CodeAfter, err = loadCode(db, after.CodeHash); err != nil {
+			return diff, err
+		}
+	}
+	if before.Root != after.Root {
+		storage, err := diffStorage(db, before.Root, after.Root)
+		if err != nil {
+			return diff, err
+		}
+		diff.Storage = storage
+	}
+	return diff, nil
+}
+
+// diffStorage collects the storage slots that differ between two storage roots.
+func diffStorage(db database.Database, oldRoot, newRoot helper.Hash) ([]StorageDiff, error) {
+	oldTrie, err := trie.NewSecure(oldRoot, db, 0)
+	if err != nil {
+		return nil, err
+	}
+	newTrie, err := trie.NewSecure(newRoot, db, 0)
+	if err != nil {
+		return nil, err
+	}
+	var diffs []StorageDiff
+	err = diffTries(oldTrie, newTrie, func(key, oldVal, newVal []byte) error {
+		diff := StorageDiff{KeyHash: helper.BytesToHash(key)}
+		if preimage := newTrie.GetKey(key); preimage != nil {
+			diff.Key = helper.BytesToHash(preimage)
+		} else if preimage := oldTrie.GetKey(key); preimage != nil {
+			diff.Key = helper.BytesToHash(preimage)
+		}
+		var err error
+		if diff.Before, err = decodeStorageValue(oldVal); err != nil {
+			return err
+		}
+		if diff.After, err = decodeStorageValue(newVal); err != nil {
+			return err
+		}
+		diffs = append(diffs, diff)
+		return nil
+	})
+	return diffs, err
+}
+
+// diffTries iterates two tries in key order, calling fn for every key whose
+// value differs, with a nil value for the side missing the key.
+func diffTries(oldTrie, newTrie *trie.SecureTrie, fn func(key, oldVal, newVal []byte) error) error {
+	oldIt, newIt := oldTrie.Iterator(), newTrie.Iterator()
+	oldOk, newOk := oldIt.Next(), newIt.Next()
+	for oldOk || newOk {
+		var err error
+		switch {
+		case !newOk || (oldOk && bytes.Compare(oldIt.Key, newIt.Key) < 0):
+			err = fn(helper.CopyBytes(oldIt.Key), oldIt.Value, nil)
+			oldOk = oldIt.Next()
+		case !oldOk || bytes.Compare(oldIt.Key, newIt.Key) > 0:
+			err = fn(helper.CopyBytes(newIt.Key), nil, newIt.Value)
+			newOk = newIt.Next()
+		default:
+			if !bytes.Equal(oldIt.Value, newIt.Value) {
+				err = fn(helper.CopyBytes(oldIt.Key), oldIt.Value, newIt.Value)
+			}
+			oldOk, newOk = oldIt.Next(), newIt.Next()
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if err := oldIt.Err(); err != nil {
+		return err
+	}
+	return newIt.Err()
+}
+
+// loadCode retrieves the code with the given hash from the shared code cache,
+// falling back to the database.
+func loadCode(db trie.Database, codeHash []byte) ([]byte, error) {
+	if bytes.Equal(codeHash, emptyCodeHash) {
+		return nil, nil
+	}
+	if code, ok := cachedCode(codeHash); ok {
+		return code, nil
+	}
+	code, err := db.Get(codeHash)
+	if err != nil {
+		return nil, fmt.Errorf("can't load code hash %x: %v", codeHash, err)
+	}
+	cacheCode(codeHash, code)
+	return code, nil
+}
+
+// decodeStorageValue decodes an RLP encoded storage slot value.
+func decodeStorageValue(enc []byte) (helper.Hash, error) {
+	var value helper.Hash
+	if len(enc) == 0 {
+		return value, nil
+	}
+	_, content, _, err := rlp.Split(enc)
+	if err != nil {
+		return value, err
+	}
+	value.SetBytes(content)
+	return value, nil
+}
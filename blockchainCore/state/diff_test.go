@@ -0,0 +1,81 @@
+package state
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"github.com/siotchain/siot/database"
+	"github.com/siotchain/siot/helper"
+)
+
+// Tests that the diff of two states reports exactly the accounts changed by a
+// value transfer, a code deployment and a storage write.
+func TestStateDiff(t *testing.T) {
+	db, _ := database.NewMemDatabase()
+
+	var (
+		sender   = helper.HexToAddress("0x01")
+		receiver = helper.HexToAddress("0x02")
+		contract = helper.HexToAddress("0x03")
+		idle     = helper.HexToAddress("0x04")
+		slot     = helper.HexToHash("0x05")
+	)
+	statedb, _ := New(helper.Hash{}, db)
+	statedb.SetBalance(sender, big.NewInt(1000))
+	statedb.SetBalance(idle, big.NewInt(1))
+	statedb.SetState(contract, slot, helper.HexToHash("0x0a"))
+	oldRoot, err := statedb.Commit(false)
+	if err != nil {
+		t.Fatalf("failed to commit old state: %v", err)
+	}
+	// Apply a transfer along with a contract update on top of the old state
+	statedb, _ = New(oldRoot, db)
+	statedb.SetBalance(sender, big.NewInt(900))
+	statedb.SetNonce(sender, 1)
+	statedb.SetBalance(receiver, big.NewInt(100))
+	statedb.SetCode(contract, []byte{0x60, 0x00})
+	statedb.SetState(contract, slot, helper.HexToHash("0x0b"))
+	newRoot, err := statedb.Commit(false)
+	if err != nil {
+		t.Fatalf("failed to commit new state: %v", err)
+	}
+	diffs, err := StateDiff(oldRoot, newRoot, db)
+	if err != nil {
+		t.Fatalf("failed to diff states: %v", err)
+	}
+	changed := make(map[helper.Address]AccountDiff)
+	for _, diff := range diffs {
+		changed[diff.Address] = diff
+	}
+	if len(diffs) != 3 || len(changed) != 3 {
+		t.Fatalf("changed account count mismatch: have %d, want 3", len(diffs))
+	}
+	if _, ok := changed[idle]; ok {
+		t.Errorf("unchanged account reported")
+	}
+	if diff := changed[sender]; diff.BalanceBefore.Cmp(big.NewInt(1000)) != 0 || diff.BalanceAfter.Cmp(big.NewInt(900)) != 0 || diff.NonceBefore != 0 || diff.NonceAfter != 1 || diff.Created {
+		t.Errorf("sender diff mismatch: %+v", diff)
+	}
+	if diff := changed[receiver]; !diff.Created || diff.BalanceBefore.Sign() != 0 || diff.BalanceAfter.Cmp(big.NewInt(100)) != 0 {
+		t.Errorf("receiver diff mismatch: %+v", diff)
+	}
+	diff := changed[contract]
+	if diff.CodeBefore != nil || !bytes.Equal(diff.CodeAfter, []byte{0x60, 0x00}) {
+		t.Errorf("contract code diff mismatch: have %x -> %x", diff.CodeBefore, diff.CodeAfter)
+	}
+	if len(diff.Storage) != 1 {
+		t.Fatalf("contract storage diff count mismatch: have %d, want 1", len(diff.Storage))
+	}
+	if storage := diff.Storage[0]; storage.Key != slot || storage.Before != helper.HexToHash("0x0a") || storage.After != helper.HexToHash("0x0b") {
+		t.Errorf("contract storage diff mismatch: %+v", storage)
+	}
+	// The streaming variant must report the same accounts, identical roots none
+	var streamed int
+	if err := StateDiffForEach(oldRoot, newRoot, db, func(AccountDiff) error { streamed++; return nil }); err != nil || streamed != 3 {
+		t.Errorf("streamed diff mismatch: have %d accounts (%v), want 3", streamed, err)
+	}
+	if diffs, err := StateDiff(newRoot, newRoot, db); err != nil || len(diffs) != 0 {
+		t.Errorf("identical states diff mismatch: have %d accounts (%v), want 0", len(diffs), err)
+	}
+}
@@ -0,0 +1,190 @@
+package state
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/siotchain/siot/database"
+	"github.com/siotchain/siot/helper"
+	"github.com/siotchain/siot/helper/rlp"
+)
+
+// The binary dump starts with binaryDumpMagic and the state root, followed by
+// one record per account:
+//
+//	address (20 bytes)
+//	uvarint length, RLP encoded Account
+//	uvarint length, code
+//	for every storage slot: 0x01, key (32 bytes), uvarint length, RLP encoded value
+//	0x00
+var binaryDumpMagic = []byte("SIOTDMP1")
+
+const maxDumpField = 32 * 1024 * 1024 // Largest field accepted from a binary dump
+
+var errMissingPreimage = errors.New("missing trie key preimage")
+
+// RawDumpBinary streams the whole state into w in a compact binary format, much
+// smaller and faster to produce than the JSON dump. The dump can be loaded back
+// with LoadDumpBinary.
+func (self *StateDB) RawDumpBinary(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	out := &dumpWriter{w: bw}
+
+	out.raw(binaryDumpMagic)
+	out.raw(self.trie.Root())
+
+	it := self.trie.Iterator()
+	for it.Next() && out.err == nil {
+		addr := self.trie.GetKey(it.Key)
+		if addr == nil {
+			return fmt.Errorf("account %x: %v", it.Key, errMissingPreimage)
+		}
+		var data Account
+		if err := rlp.DecodeBytes(it.Value, &data); err != nil {
+			return fmt.Errorf("account %x: %v", addr, err)
+		}
+		obj := newObject(nil, helper.BytesToAddress(addr), data, nil)
+
+		out.raw(addr)
+		out.field(it.Value)
+		out.field(obj.Code(self.db))
+
+		storageIt := obj.getTrie(self.db).Iterator()
+		for storageIt.Next() && out.err == nil {
+			key := self.trie.GetKey(storageIt.Key)
+			if key == nil {
+				return fmt.Errorf("account %x: storage slot %x: %v", addr, storageIt.Key, errMissingPreimage)
+			}
+			out.raw([]byte{1})
+			out.raw(key)
+			out.field(storageIt.Value)
+		}
+		out.raw([]byte{0})
+	}
+	if out.err != nil {
+		return out.err
+	}
+	return bw.Flush()
+}
+
+// LoadDumpBinary rebuilds a state from a binary dump created by RawDumpBinary.
+// The resulting state is not committed, but its root is checked against the one
+// recorded in the dump.
+func LoadDumpBinary(r io.Reader, db database.Database) (*StateDB, error) {
+	in := &dumpReader{r: bufio.NewReader(r)}
+
+	if magic := in.raw(len(binaryDumpMagic)); in.err == nil && !bytes.Equal(magic, binaryDumpMagic) {
+		return nil, errors.New("not a binary state dump")
+	}
+	root := helper.BytesToHash(in.raw(helper.HashLength))
+	if in.err != nil {
+		return nil, in.err
+	}
+	statedb, err := New(helper.Hash{}, db)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		addrBytes := in.raw(helper.AddressLength)
+		if in.err == io.EOF {
+			break
+		}
+		addr := helper.BytesToAddress(addrBytes)
+
+		enc, code := in.field(), in.field()
+		if in.err != nil {
+			return nil, fmt.Errorf("account %x: %v", addr, in.err)
+		}
+		var data Account
+		if err := rlp.DecodeBytes(enc, &data); err != nil {
+			return nil, fmt.Errorf("account %x: %v", addr, err)
+		}
+		statedb.SetNonce(addr, data.Nonce)
+		statedb.SetBalance(addr, data.Balance)
+		if len(code) > 0 {
+			statedb.SetCode(addr, code)
+		}
+		for in.err == nil {
+			if more := in.raw(1); in.err != nil || more[0] == 0 {
+				break
+			}
+			key := helper.BytesToHash(in.raw(helper.HashLength))
+			enc := in.field()
+			if in.err != nil {
+				break
+			}
+			_, content, _, err := rlp.Split(enc)
+			if err != nil {
+				return nil, fmt.Errorf("account %x: storage slot %x: %v", addr, key, err)
+			}
+			statedb.SetState(addr, key, helper.BytesToHash(content))
+		}
+		if in.err != nil {
+			if in.err == io.EOF {
+				in.err = io.ErrUnexpectedEOF
+			}
+			return nil, fmt.Errorf("account %x: %v", addr, in.err)
+		}
+	}
+	if have := statedb.IntermediateRoot(false); have != root {
+		return nil, fmt.Errorf("state root mismatch: loaded %x, dumped %x", have, root)
+	}
+	return statedb, nil
+}
+
+// dumpWriter writes the fields of a binary dump, remembering the first error.
+type dumpWriter struct {
+	w   io.Writer
+	buf [binary.MaxVarintLen64]byte
+	err error
+}
+
+func (d *dumpWriter) raw(b []byte) {
+	if d.err == nil {
+		_, d.err = d.w.Write(b)
+	}
+}
+
+func (d *dumpWriter) field(b []byte) {
+	n := binary.PutUvarint(d.buf[:], uint64(len(b)))
+	d.raw(d.buf[:n])
+	d.raw(b)
+}
+
+// dumpReader reads the fields of a binary dump, remembering the first error.
+type dumpReader struct {
+	r   *bufio.Reader
+	err error
+}
+
+func (d *dumpReader) raw(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(d.r, b); err != nil {
+		d.err = err
+		return nil
+	}
+	return b
+}
+
+func (d *dumpReader) field() []byte {
+	if d.err != nil {
+		return nil
+	}
+	size, err := binary.ReadUvarint(d.r)
+	if err != nil {
+		d.err = err
+		return nil
+	}
+	if size > maxDumpField {
+		d.err = fmt.Errorf("field of %d bytes exceeds the limit", size)
+		return nil
+	}
+	return d.raw(int(size))
+}
@@ -0,0 +1,87 @@
+package state
+
+import (
+	"sync"
+
+	"github.com/siotchain/siot/helper"
+	"github.com/siotchain/siot/trie"
+)
+
+// prefetcher loads accounts from the state trie in the background, keeping
+// their encodings for the state to pick up instead of reading the trie itself.
+// The encodings are those of the root the prefetcher was started at, which the
+// state may only use for accounts it never loaded: any account modified since
+// is held in the live objects.
+type prefetcher struct {
+	accounts map[helper.Address][]byte // Encodings of the loaded accounts (empty = missing)
+	lock     sync.Mutex
+
+	quit chan struct{}
+	done chan struct{}
+}
+
+// Prefetch starts loading the given accounts in the background, so that the
+// disk reads overlap with the execution about to touch them. The loaded accounts
+// are served from memory when first accessed; errors are ignored as the regular
+// trie reads will hit and report them anyway. Any previous prefetch is stopped.
+func (self *StateDB) Prefetch(addrs []helper.Address) {
+	self.StopPrefetch()
+	self.prefetch = nil
+
+	if len(addrs) == 0 {
+		return
+	}
+	tr, err := trie.NewSecure(self.trie.Hash(), self.db, 0)
+	if err != nil {
+		return
+	}
+	p := &prefetcher{
+		accounts: make(map[helper.Address][]byte, len(addrs)),
+		quit:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	self.prefetch = p
+
+	go func() {
+		defer close(p.done)
+		for _, addr := range addrs {
+			select {
+			case <-p.quit:
+				return
+			default:
+			}
+			enc, err := tr.TryGet(addr[:])
+			if err != nil {
+				continue
+			}
+			p.lock.Lock()
+			p.accounts[addr] = helper.CopyBytes(enc)
+			p.lock.Unlock()
+		}
+	}()
+}
+
+// StopPrefetch terminates the background loading started by Prefetch and waits
+// for it to exit. The accounts loaded so far remain available.
+func (self *StateDB) StopPrefetch() {
+	if p := self.prefetch; p != nil {
+		select {
+		case <-p.quit:
+		default:
+			close(p.quit)
+		}
+		<-p.done
+	}
+}
+
+// get returns the prefetched encoding of an account, if it was loaded.
+func (p *prefetcher) get(addr helper.Address) ([]byte, bool) {
+	if p == nil {
+		return nil, false
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	enc, ok := p.accounts[addr]
+	return enc, ok
+}
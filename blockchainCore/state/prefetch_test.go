@@ -0,0 +1,101 @@
+package state
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/siotchain/siot/database"
+	"github.com/siotchain/siot/helper"
+)
+
+// newAccountState creates a database with the given number of funded accounts,
+// returning the state root and their addresses.
+func newAccountState(tb testing.TB, db database.Database, count int) (helper.Hash, []helper.Address) {
+	statedb, _ := New(helper.Hash{}, db)
+
+	addrs := make([]helper.Address, count)
+	for i := range addrs {
+		addrs[i] = helper.BigToAddress(big.NewInt(int64(i + 1)))
+		statedb.SetBalance(addrs[i], big.NewInt(int64(i+1)))
+	}
+	root, err := statedb.Commit(false)
+	if err != nil {
+		tb.Fatalf("failed to commit state: %v", err)
+	}
+	return root, addrs
+}
+
+// Tests that prefetched accounts are served without reading the database, and
+// that accounts modified after the prefetch keep their live values.
+func TestPrefetch(t *testing.T) {
+	mem, _ := database.NewMemDatabase()
+	db := &failingDatabase{Database: mem}
+	root, addrs := newAccountState(t, db, 16)
+
+	statedb, _ := New(root, db)
+	statedb.SetBalance(addrs[0], big.NewInt(100))
+
+	statedb.Prefetch(addrs)
+	<-statedb.prefetch.done
+
+	// Break the database, any account read would now fail
+	db.broken = true
+	if balance := statedb.GetBalance(addrs[0]); balance.Cmp(big.NewInt(100)) != 0 {
+		t.Errorf("modified account balance mismatch: have %v, want 100", balance)
+	}
+	for i, addr := range addrs[1:] {
+		if balance := statedb.GetBalance(addr); balance.Cmp(big.NewInt(int64(i+2))) != 0 {
+			t.Errorf("account %d balance mismatch: have %v, want %d", i+1, balance, i+2)
+		}
+	}
+	if err := statedb.Error(); err != nil {
+		t.Errorf("database read despite prefetching: %v", err)
+	}
+	if balance := statedb.GetBalance(helper.HexToAddress("0xdead")); balance.Sign() != 0 {
+		t.Errorf("balance of an unknown account: %v", balance)
+	}
+	if err := statedb.Error(); err == nil {
+		t.Errorf("read of an account not prefetched did not hit the database")
+	}
+}
+
+// slowDatabase is a database taking a fixed time for every read, simulating the
+// latency of a disk.
+type slowDatabase struct {
+	database.Database
+	delay time.Duration
+}
+
+func (db *slowDatabase) Get(key []byte) ([]byte, error) {
+	time.Sleep(db.delay)
+	return db.Database.Get(key)
+}
+
+// benchmarkPrefetch reads a set of accounts from a cold state, with some time
+// spent on execution between the reads for the prefetcher to run ahead.
+func benchmarkPrefetch(b *testing.B, prefetch bool) {
+	mem, _ := database.NewMemDatabase()
+	db := &slowDatabase{Database: mem}
+	root, addrs := newAccountState(b, db, 50)
+	db.delay = time.Millisecond
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		statedb, _ := New(root, db)
+		if prefetch {
+			statedb.Prefetch(addrs)
+		}
+		for _, addr := range addrs {
+			statedb.GetBalance(addr)
+
+			// Keep the CPU busy as transaction execution would
+			for start := time.Now(); time.Since(start) < time.Millisecond; {
+			}
+		}
+		statedb.StopPrefetch()
+	}
+}
+
+func BenchmarkStateCold(b *testing.B)       { benchmarkPrefetch(b, false) }
+func BenchmarkStatePrefetched(b *testing.B) { benchmarkPrefetch(b, true) }
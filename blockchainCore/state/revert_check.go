@@ -0,0 +1,133 @@
+package state
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+
+	"github.com/siotchain/siot/helper"
+	"github.com/siotchain/siot/helper/rlp"
+)
+
+// VerifyReverts enables checking every RevertToSnapshot against a copy of the
+// live state taken by the matching Snapshot, logging any field the journal did
+// not restore. It is meant for hunting consensus issues only, as every snapshot
+// copies all the live state objects.
+var VerifyReverts = false
+
+// objectCheckpoint is the copy of a live state object taken at snapshot time.
+type objectCheckpoint struct {
+	nonce    uint64
+	balance  *big.Int
+	codeHash []byte
+	suicided bool
+	deleted  bool
+	storage  Storage
+}
+
+// stateCheckpoint is the copy of the live state taken at snapshot time.
+type stateCheckpoint struct {
+	objects map[helper.Address]objectCheckpoint
+	refund  *big.Int
+	logSize uint
+}
+
+// checkpoint copies the parts of the live state the journal is responsible for.
+func (self *StateDB) checkpoint() *stateCheckpoint {
+	cp := &stateCheckpoint{
+		objects: make(map[helper.Address]objectCheckpoint, len(self.stateObjects)),
+		refund:  new(big.Int).Set(self.refund),
+		logSize: self.logSize,
+	}
+	for addr, obj := range self.stateObjects {
+		cp.objects[addr] = objectCheckpoint{
+			nonce:    obj.data.Nonce,
+			balance:  new(big.Int).Set(obj.data.Balance),
+			codeHash: helper.CopyBytes(obj.data.CodeHash),
+			suicided: obj.suicided,
+			deleted:  obj.deleted,
+			storage:  obj.cachedStorage.Copy(),
+		}
+	}
+	return cp
+}
+
+// verifyRevert compares the live state with a checkpoint and returns a
+// description of every difference. Objects loaded after the checkpoint must
+// still match the committed state they were loaded from.
+func (self *StateDB) verifyRevert(cp *stateCheckpoint) []string {
+	var problems []string
+	report := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+	if self.refund.Cmp(cp.refund) != 0 {
+		report("refund: have %v, want %v", self.refund, cp.refund)
+	}
+	if self.logSize != cp.logSize {
+		report("log count: have %d, want %d", self.logSize, cp.logSize)
+	}
+	for addr, want := range cp.objects {
+		obj := self.stateObjects[addr]
+		if obj == nil {
+			report("%x: object missing", addr)
+			continue
+		}
+		if obj.data.Nonce != want.nonce {
+			report("%x: nonce: have %d, want %d", addr, obj.data.Nonce, want.nonce)
+		}
+		if obj.data.Balance.Cmp(want.balance) != 0 {
+			report("%x: balance: have %v, want %v", addr, obj.data.Balance, want.balance)
+		}
+		if !bytes.Equal(obj.data.CodeHash, want.codeHash) {
+			report("%x: code hash: have %x, want %x", addr, obj.data.CodeHash, want.codeHash)
+		}
+		if obj.suicided != want.suicided {
+			report("%x: suicided: have %v, want %v", addr, obj.suicided, want.suicided)
+		}
+		if obj.deleted != want.deleted {
+			report("%x: deleted: have %v, want %v", addr, obj.deleted, want.deleted)
+		}
+		for key, value := range obj.cachedStorage {
+			expect, ok := want.storage[key]
+			if !ok {
+				expect = self.committedStorage(obj, key)
+			}
+			if value != expect {
+				report("%x: storage slot %x: have %x, want %x", addr, key, value, expect)
+			}
+		}
+	}
+	for addr, obj := range self.stateObjects {
+		if _, ok := cp.objects[addr]; ok {
+			continue
+		}
+		var want Account
+		if enc, err := self.trie.TryGet(addr[:]); err != nil || len(enc) == 0 {
+			report("%x: object created after the snapshot not removed", addr)
+			continue
+		} else if err := rlp.DecodeBytes(enc, &want); err != nil {
+			continue
+		}
+		if obj.data.Nonce != want.Nonce || obj.data.Balance.Cmp(want.Balance) != 0 || !bytes.Equal(obj.data.CodeHash, want.CodeHash) {
+			report("%x: account loaded after the snapshot modified", addr)
+		}
+		for key, value := range obj.cachedStorage {
+			if expect := self.committedStorage(obj, key); value != expect {
+				report("%x: storage slot %x: have %x, want %x", addr, key, value, expect)
+			}
+		}
+	}
+	return problems
+}
+
+// committedStorage reads a storage slot of an object from its storage trie,
+// bypassing the cached and dirty slots.
+func (self *StateDB) committedStorage(obj *StateObject, key helper.Hash) helper.Hash {
+	var value helper.Hash
+	if enc, err := obj.getTrie(self.db).TryGet(key[:]); err == nil && len(enc) > 0 {
+		if _, content, _, err := rlp.Split(enc); err == nil {
+			value.SetBytes(content)
+		}
+	}
+	return value
+}
@@ -0,0 +1,73 @@
+package state
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/siotchain/siot/blockchainCore/localEnv"
+	"github.com/siotchain/siot/database"
+	"github.com/siotchain/siot/helper"
+)
+
+// Tests that the revert verifier accepts a complete revert of all kinds of
+// journalled changes, and reports changes the journal could not undo.
+func TestVerifyRevert(t *testing.T) {
+	defer func(old bool) { VerifyReverts = old }(VerifyReverts)
+	VerifyReverts = true
+
+	var (
+		existing = helper.HexToAddress("0xaa")
+		loaded   = helper.HexToAddress("0xbb")
+		created  = helper.HexToAddress("0xcc")
+		slot     = helper.HexToHash("0x01")
+	)
+	db, _ := database.NewMemDatabase()
+	statedb, _ := New(helper.Hash{}, db)
+	for _, addr := range []helper.Address{existing, loaded} {
+		statedb.SetBalance(addr, big.NewInt(100))
+		statedb.SetState(addr, slot, helper.HexToHash("0x11"))
+	}
+	root, err := statedb.Commit(false)
+	if err != nil {
+		t.Fatalf("failed to commit state: %v", err)
+	}
+	statedb, _ = New(root, db)
+	statedb.GetStateObject(existing)
+
+	// Mutate every journalled field, including objects loaded and created after
+	// the snapshot, and revert it all
+	id := statedb.Snapshot()
+	cp := statedb.checkpoints[id]
+	if cp == nil {
+		t.Fatalf("no checkpoint taken at snapshot")
+	}
+	statedb.SetNonce(existing, 5)
+	statedb.AddBalance(existing, big.NewInt(10))
+	statedb.SetCode(existing, []byte{0x60})
+	statedb.SetState(existing, slot, helper.HexToHash("0x22"))
+	statedb.SetState(loaded, slot, helper.HexToHash("0x22"))
+	statedb.CreateAccount(created)
+	statedb.AddBalance(created, big.NewInt(1))
+	statedb.AddRefund(big.NewInt(100))
+	statedb.AddLog(new(localEnv.Log))
+	statedb.Suicide(existing)
+
+	statedb.RevertToSnapshot(id)
+	if problems := statedb.verifyRevert(cp); len(problems) != 0 {
+		t.Errorf("complete revert reported: %v", problems)
+	}
+	if len(statedb.checkpoints) != 0 {
+		t.Errorf("checkpoints left after revert: %d", len(statedb.checkpoints))
+	}
+	// Changes bypassing the journal must be reported
+	id = statedb.Snapshot()
+	cp = statedb.checkpoints[id]
+
+	statedb.GetStateObject(existing).data.Balance = big.NewInt(1)
+	statedb.GetStateObject(loaded).cachedStorage[slot] = helper.HexToHash("0x33")
+
+	statedb.RevertToSnapshot(id)
+	if problems := statedb.verifyRevert(cp); len(problems) != 2 {
+		t.Errorf("incomplete revert problems mismatch: have %v, want 2", problems)
+	}
+}
@@ -16,6 +16,9 @@ import (
 
 var emptyCodeHash = crypto.Keccak256(nil)
 
+// emptyRoot is the root hash of an empty storage trie.
+var emptyRoot = helper.HexToHash("56e81f171bcc55a6ff8345e692c0f86e5b48e01b996cadc001622fb5e363b421")
+
 type Code []byte
 
 func (self Code) String() string {
@@ -60,8 +63,9 @@ type StateObject struct {
 	dbErr error
 
 	// Write caches.
-	trie *trie.SecureTrie // storage trie, which becomes non-nil on first access
-	code Code             // externalLogic bytecode, which gets set when code is loaded
+	trie       *trie.SecureTrie // storage trie, which becomes non-nil on first access
+	trieShared bool             // trie is shared with a copy of the object, clone before use
+	code       Code             // externalLogic bytecode, which gets set when code is loaded
 
 	cachedStorage Storage // Storage entry cache to avoid duplicate reads
 	dirtyStorage  Storage // Storage entries that need to be flushed to disk
@@ -70,11 +74,24 @@ type StateObject struct {
 	// When an object is marked suicided it will be delete from the trie
 	// during the "update" phase of the state transition.
 	dirtyCode bool // true if the code was updated
+	dirtyTrie bool // true if the storage was modified since the storage trie was last committed
 	suicided  bool
 	deleted   bool
 	onDirty   func(addr helper.Address) // Callback method to mark a state object newly dirty
 }
 
+// approxSize returns an estimate of the memory held by the state object, i.e.
+// its account data, cached and dirty storage slots and code.
+func (self *StateObject) approxSize() int {
+	size := helper.AddressLength + 8 + helper.HashLength + len(self.data.CodeHash)
+	if self.data.Balance != nil {
+		size += len(self.data.Balance.Bits()) * 8
+	}
+	size += (len(self.cachedStorage) + len(self.dirtyStorage)) * 2 * helper.HashLength
+	size += len(self.code)
+	return size
+}
+
 // empty returns whether the account is considered empty.
 func (s *StateObject) empty() bool {
 	return s.data.Nonce == 0 && s.data.Balance.BitLen() == 0 && bytes.Equal(s.data.CodeHash, emptyCodeHash)
@@ -97,6 +114,9 @@ func newObject(db *StateDB, address helper.Address, data Account, onDirty func(a
 	if data.CodeHash == nil {
 		data.CodeHash = emptyCodeHash
 	}
+	if data.Root == (helper.Hash{}) {
+		data.Root = emptyRoot
+	}
 	return &StateObject{db: db, address: address, data: data, cachedStorage: make(Storage), dirtyStorage: make(Storage), onDirty: onDirty}
 }
 
@@ -124,6 +144,11 @@ func (self *StateObject) markSuicided() {
 }
 
 func (c *StateObject) getTrie(db trie.Database) *trie.SecureTrie {
+	// Even reads resolve nodes into the trie, so a shared one is never touched
+	if c.trieShared {
+		c.trie = c.trie.Copy()
+		c.trieShared = false
+	}
 	if c.trie == nil {
 		var err error
 		c.trie, err = trie.NewSecure(c.data.Root, db, 0)
@@ -142,7 +167,11 @@ func (self *StateObject) GetState(db trie.Database, key helper.Hash) helper.Hash
 		return value
 	}
 	// Load from DB in case it is missing.
-	if enc := self.getTrie(db).Get(key[:]); len(enc) > 0 {
+	enc, err := self.getTrie(db).TryGet(key[:])
+	if err != nil {
+		self.setError(err)
+	}
+	if len(enc) > 0 {
 		_, content, _, err := rlp.Split(enc)
 		if err != nil {
 			self.setError(err)
@@ -168,6 +197,7 @@ func (self *StateObject) SetState(db trie.Database, key, value helper.Hash) {
 func (self *StateObject) setState(key, value helper.Hash) {
 	self.cachedStorage[key] = value
 	self.dirtyStorage[key] = value
+	self.dirtyTrie = true
 
 	if self.onDirty != nil {
 		self.onDirty(self.Address())
@@ -190,22 +220,32 @@ func (self *StateObject) updateTrie(db trie.Database) {
 	}
 }
 
-// UpdateRoot sets the trie root to the current root hash of
+// UpdateRoot sets the trie root to the current root hash of the storage trie.
+//
+// Accounts whose storage wasn't touched keep their root without opening and
+// hashing the storage trie, which is all plain value transfers need.
 func (self *StateObject) updateRoot(db trie.Database) {
+	if !self.dirtyTrie {
+		return
+	}
 	self.updateTrie(db)
-	self.data.Root = self.trie.Hash()
+	self.data.Root = self.getTrie(db).Hash()
 }
 
 // CommitTrie the storage trie of the object to dwb.
 // This updates the trie root.
 func (self *StateObject) CommitTrie(db trie.Database, dbw trie.DatabaseWriter) error {
+	if !self.dirtyTrie {
+		return nil
+	}
 	self.updateTrie(db)
 	if self.dbErr != nil {
 		return self.dbErr
 	}
-	root, err := self.trie.CommitTo(dbw)
+	root, err := self.getTrie(db).CommitTo(dbw)
 	if err == nil {
 		self.data.Root = root
+		self.dirtyTrie = false
 	}
 	return err
 }
@@ -259,12 +299,18 @@ func (c *StateObject) ReturnGas(gas, price *big.Int) {}
 
 func (self *StateObject) deepCopy(db *StateDB, onDirty func(addr helper.Address)) *StateObject {
 	stateObject := newObject(db, self.address, self.data, onDirty)
-	stateObject.trie = self.trie
+	// The storage trie is shared until either side uses it, as most copies never
+	// access the storage of most of their objects
+	if self.trie != nil {
+		stateObject.trie, stateObject.trieShared = self.trie, true
+		self.trieShared = true
+	}
 	stateObject.code = self.code
 	stateObject.dirtyStorage = self.dirtyStorage.Copy()
 	stateObject.cachedStorage = self.dirtyStorage.Copy()
 	stateObject.suicided = self.suicided
 	stateObject.dirtyCode = self.dirtyCode
+	stateObject.dirtyTrie = self.dirtyTrie
 	stateObject.deleted = self.deleted
 	return stateObject
 }
@@ -283,12 +329,9 @@ func (self *StateObject) Code(db trie.Database) []byte {
 	if self.code != nil {
 		return self.code
 	}
-	if bytes.Equal(self.CodeHash(), emptyCodeHash) {
-		return nil
-	}
-	code, err := db.Get(self.CodeHash())
+	code, err := loadCode(db, self.CodeHash())
 	if err != nil {
-		self.setError(fmt.Errorf("can't load code hash %x: %v", self.CodeHash(), err))
+		self.setError(err)
 	}
 	self.code = code
 	return code
@@ -355,10 +398,11 @@ func (self *StateObject) ForEachStorage(cb func(key, value helper.Hash) bool) {
 		cb(h, value)
 	}
 
-	it := self.getTrie(self.db.db).Iterator()
+	tr := self.getTrie(self.db.db)
+	it := tr.Iterator()
 	for it.Next() {
 		// ignore cached values
-		key := helper.BytesToHash(self.trie.GetKey(it.Key))
+		key := helper.BytesToHash(tr.GetKey(it.Key))
 		if _, ok := self.cachedStorage[key]; !ok {
 			cb(key, helper.BytesToHash(it.Value))
 		}
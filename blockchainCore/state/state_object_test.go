@@ -0,0 +1,162 @@
+package state
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/siotchain/siot/database"
+	"github.com/siotchain/siot/helper"
+)
+
+// newStorageState creates a database with the given number of accounts, each
+// holding a few storage slots, returning their addresses.
+func newStorageState(tb testing.TB, count int) (database.Database, helper.Hash, []helper.Address) {
+	db, _ := database.NewMemDatabase()
+	statedb, _ := New(helper.Hash{}, db)
+
+	addrs := make([]helper.Address, count)
+	for i := range addrs {
+		addrs[i] = helper.BigToAddress(big.NewInt(int64(i + 1)))
+		for j := int64(1); j <= 4; j++ {
+			statedb.SetState(addrs[i], helper.BigToHash(big.NewInt(j)), helper.BigToHash(big.NewInt(j)))
+		}
+	}
+	root, err := statedb.Commit(false)
+	if err != nil {
+		tb.Fatalf("failed to commit state: %v", err)
+	}
+	return db, root, addrs
+}
+
+// Tests that accounts whose storage wasn't modified keep their storage root
+// without opening the storage trie, while storage writes still update it.
+func TestStorageRootSkip(t *testing.T) {
+	db, root, addrs := newStorageState(t, 1)
+	addr, slot := addrs[0], helper.BigToHash(big.NewInt(1))
+
+	statedb, _ := New(root, db)
+	storageRoot := statedb.GetStateObject(addr).data.Root
+
+	// A balance change must not touch the storage trie
+	statedb.AddBalance(addr, big.NewInt(1))
+	statedb.IntermediateRoot(false)
+	if obj := statedb.GetStateObject(addr); obj.trie != nil {
+		t.Errorf("storage trie opened for a balance change")
+	}
+	if have := statedb.GetStateObject(addr).data.Root; have != storageRoot {
+		t.Errorf("storage root changed by a balance change: have %x, want %x", have, storageRoot)
+	}
+	root, err := statedb.Commit(false)
+	if err != nil {
+		t.Fatalf("failed to commit state: %v", err)
+	}
+	statedb, _ = New(root, db)
+	if value := statedb.GetState(addr, slot); value != slot {
+		t.Errorf("storage lost by a balance change: have %x, want %x", value, slot)
+	}
+	// A storage write must update the root, and be committed only once
+	statedb.SetState(addr, slot, helper.Hash{})
+	statedb.IntermediateRoot(false)
+	obj := statedb.GetStateObject(addr)
+	if obj.data.Root == storageRoot {
+		t.Errorf("storage root not updated by a storage write")
+	}
+	if root, err = statedb.Commit(false); err != nil {
+		t.Fatalf("failed to commit state: %v", err)
+	}
+	if obj.dirtyTrie {
+		t.Errorf("storage still marked dirty after commit")
+	}
+	statedb, _ = New(root, db)
+	if value := statedb.GetState(addr, slot); value != (helper.Hash{}) {
+		t.Errorf("storage write lost: have %x, want empty", value)
+	}
+}
+
+// Benchmarks hashing the state after a block of plain value transfers between
+// accounts holding storage, which must not rehash any storage trie.
+func BenchmarkTransferRoot(b *testing.B) {
+	db, root, addrs := newStorageState(b, 1000)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		statedb, _ := New(root, db)
+		for _, addr := range addrs {
+			statedb.AddBalance(addr, big.NewInt(1))
+		}
+		b.StartTimer()
+
+		statedb.IntermediateRoot(false)
+	}
+}
+
+// Tests that state copies share the storage tries of their objects until first
+// use, and that storage changes on either side never leak into the other.
+func TestCopySharedStorage(t *testing.T) {
+	db, root, addrs := newStorageState(t, 1)
+	addr, slot := addrs[0], helper.BigToHash(big.NewInt(1))
+
+	orig, _ := New(root, db)
+	orig.AddBalance(addr, big.NewInt(1)) // only dirty objects are copied
+	orig.GetState(addr, helper.BigToHash(big.NewInt(100)))
+
+	copied := orig.Copy()
+	if obj := copied.GetStateObject(addr); obj.trie != orig.GetStateObject(addr).trie || !obj.trieShared {
+		t.Fatalf("storage trie not shared with the copy")
+	}
+	// Modify the storage in the copy, and differently in the original
+	copied.SetState(addr, slot, helper.HexToHash("0xc0"))
+	copied.IntermediateRoot(false)
+	orig.SetState(addr, slot, helper.HexToHash("0x0a"))
+	orig.IntermediateRoot(false)
+
+	if copied.GetStateObject(addr).trie == orig.GetStateObject(addr).trie {
+		t.Fatalf("storage trie still shared after modifications")
+	}
+	origRoot, err := orig.Commit(false)
+	if err != nil {
+		t.Fatalf("failed to commit original state: %v", err)
+	}
+	copyRoot, err := copied.Commit(false)
+	if err != nil {
+		t.Fatalf("failed to commit copied state: %v", err)
+	}
+	for root, want := range map[helper.Hash]helper.Hash{origRoot: helper.HexToHash("0x0a"), copyRoot: helper.HexToHash("0xc0")} {
+		statedb, _ := New(root, db)
+		if value := statedb.GetState(addr, slot); value != want {
+			t.Errorf("state %x: storage mismatch: have %x, want %x", root, value, want)
+		}
+		if value := statedb.GetState(addr, helper.BigToHash(big.NewInt(2))); value != helper.BigToHash(big.NewInt(2)) {
+			t.Errorf("state %x: untouched storage mismatch: have %x, want 0x02", root, value)
+		}
+	}
+}
+
+// Benchmarks copying a state whose objects hold large loaded, but unchanged
+// storage tries.
+func BenchmarkCopyLargeStorage(b *testing.B) {
+	db, _ := database.NewMemDatabase()
+	statedb, _ := New(helper.Hash{}, db)
+
+	addrs := make([]helper.Address, 100)
+	for i := range addrs {
+		addrs[i] = helper.BigToAddress(big.NewInt(int64(i + 1)))
+		for j := int64(1); j <= 1000; j++ {
+			statedb.SetState(addrs[i], helper.BigToHash(big.NewInt(j)), helper.BigToHash(big.NewInt(j)))
+		}
+	}
+	root, err := statedb.Commit(false)
+	if err != nil {
+		b.Fatalf("failed to commit state: %v", err)
+	}
+	statedb, _ = New(root, db)
+	for _, addr := range addrs {
+		statedb.AddBalance(addr, big.NewInt(1))
+		statedb.GetState(addr, helper.BigToHash(big.NewInt(1)))
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		statedb.Copy()
+	}
+}
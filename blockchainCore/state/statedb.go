@@ -50,6 +50,10 @@ type StateDB struct {
 	pastTries     []*trie.SecureTrie
 	codeSizeCache *lru.Cache
 
+	dbErr error // First error hit while reading accounts from the trie
+
+	emptyDeletion *bool // Overrides the fork derived deletion of empty objects (nil = no override)
+
 	// This map holds 'live' objects, which will get modified while processing a state transition.
 	stateObjects      map[helper.Address]*StateObject
 	stateObjectsDirty map[helper.Address]struct{}
@@ -67,6 +71,9 @@ type StateDB struct {
 	journal        journal
 	validRevisions []revision
 	nextRevisionId int
+	checkpoints    map[int]*stateCheckpoint // Live state copies per snapshot (only if VerifyReverts is set)
+
+	prefetch *prefetcher // Background loader of the accounts about to be accessed (nil = none)
 
 	lock sync.Mutex
 }
@@ -121,6 +128,9 @@ func (self *StateDB) Reset(root helper.Hash) error {
 		return err
 	}
 	self.trie = tr
+	self.dbErr = nil
+	self.StopPrefetch()
+	self.prefetch = nil
 	self.stateObjects = make(map[helper.Address]*StateObject)
 	self.stateObjectsDirty = make(map[helper.Address]struct{})
 	self.thash = helper.Hash{}
@@ -163,6 +173,14 @@ func (self *StateDB) StartRecord(thash, bhash helper.Hash, ti int) {
 	self.txIndex = ti
 }
 
+// Prepare sets the current transaction hash, block hash and index used when
+// recording logs, and clears any per-transaction leftovers such as the refund
+// counter. It should be called before executing each transaction.
+func (self *StateDB) Prepare(thash, bhash helper.Hash, ti int) {
+	self.StartRecord(thash, bhash, ti)
+	self.refund = new(big.Int)
+}
+
 func (self *StateDB) AddLog(log *localEnv.Log) {
 	self.journal = append(self.journal, addLogChange{txhash: self.thash})
 
@@ -226,6 +244,13 @@ func (self *StateDB) GetNonce(addr helper.Address) uint64 {
 	return StartingNonce
 }
 
+// CanApplyNonce reports whether a transaction with the given nonce is the next
+// one of the account, i.e. applying it would neither reuse a nonce nor leave a
+// gap.
+func (self *StateDB) CanApplyNonce(addr helper.Address, nonce uint64) bool {
+	return self.GetNonce(addr) == nonce
+}
+
 func (self *StateDB) GetCode(addr helper.Address) []byte {
 	stateObject := self.GetStateObject(addr)
 	if stateObject != nil {
@@ -253,6 +278,33 @@ func (self *StateDB) GetCodeSize(addr helper.Address) int {
 	return size
 }
 
+// PreloadCodeSizes populates the code size cache for the given wallet in one
+// go, so that subsequent GetCodeSize calls against them are served from memory.
+// Code already measured is not loaded again, and the loaded code itself is not
+// retained.
+func (self *StateDB) PreloadCodeSizes(addrs []helper.Address) {
+	for _, addr := range addrs {
+		stateObject := self.GetStateObject(addr)
+		if stateObject == nil {
+			continue
+		}
+		key := helper.BytesToHash(stateObject.CodeHash())
+		if self.codeSizeCache.Contains(key) {
+			continue
+		}
+		if stateObject.code != nil {
+			self.codeSizeCache.Add(key, len(stateObject.code))
+			continue
+		}
+		code, err := loadCode(self.db, stateObject.CodeHash())
+		if err != nil {
+			self.setError(err)
+			continue
+		}
+		self.codeSizeCache.Add(key, len(code))
+	}
+}
+
 func (self *StateDB) GetCodeHash(addr helper.Address) helper.Hash {
 	stateObject := self.GetStateObject(addr)
 	if stateObject == nil {
@@ -367,14 +419,29 @@ func (self *StateDB) GetStateObject(addr helper.Address) (stateObject *StateObje
 		return obj
 	}
 
-	// Load the object from the database.
-	enc := self.trie.Get(addr[:])
+	// Load the object from the prefetched accounts or the database.
+	enc, ok := self.prefetch.get(addr)
+	var err error
+	if !ok {
+		enc, err = self.trie.TryGet(addr[:])
+	}
+	if err != nil {
+		if _, ok := err.(*trie.CorruptTrieError); ok {
+			// Keep the error type so callers can tell corruption from missing data
+			glog.Errorf("can't load object at %x: %v", addr[:], err)
+			self.setError(err)
+			return nil
+		}
+		self.setError(fmt.Errorf("can't load object at %x: %v", addr[:], err))
+		return nil
+	}
 	if len(enc) == 0 {
 		return nil
 	}
 	var data Account
 	if err := rlp.DecodeBytes(enc, &data); err != nil {
 		glog.Errorf("can't decode object at %x: %v", addr[:], err)
+		self.setError(fmt.Errorf("can't decode object at %x: %v", addr[:], err))
 		return nil
 	}
 	// Insert into the live set.
@@ -383,6 +450,19 @@ func (self *StateDB) GetStateObject(addr helper.Address) (stateObject *StateObje
 	return obj
 }
 
+// setError remembers the first non-nil error it is called with.
+func (self *StateDB) setError(err error) {
+	if self.dbErr == nil {
+		self.dbErr = err
+	}
+}
+
+// Error returns the first database error encountered while reading the state,
+// if any. Failed reads are otherwise indistinguishable from missing accounts.
+func (self *StateDB) Error() error {
+	return self.dbErr
+}
+
 func (self *StateDB) setStateObject(object *StateObject) {
 	self.stateObjects[object.Address()] = object
 }
@@ -447,7 +527,7 @@ func (self *StateDB) Copy() *StateDB {
 	// Copy all the basic fields, initialize the memory ones
 	state := &StateDB{
 		db:                self.db,
-		trie:              self.trie,
+		trie:              self.trie.Copy(),
 		pastTries:         self.pastTries,
 		codeSizeCache:     self.codeSizeCache,
 		stateObjects:      make(map[helper.Address]*StateObject, len(self.stateObjectsDirty)),
@@ -455,6 +535,7 @@ func (self *StateDB) Copy() *StateDB {
 		refund:            new(big.Int).Set(self.refund),
 		logs:              make(map[helper.Hash]localEnv.Logs, len(self.logs)),
 		logSize:           self.logSize,
+		emptyDeletion:     self.emptyDeletion,
 	}
 	// Copy the dirty states and logs
 	for addr, _ := range self.stateObjectsDirty {
@@ -468,11 +549,36 @@ func (self *StateDB) Copy() *StateDB {
 	return state
 }
 
+// DirtyStats returns the number of state objects modified since the last commit
+// along with a rough estimate of the memory held by them (account data, cached
+// storage slots and code).
+func (self *StateDB) DirtyStats() (count int, approxBytes int) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	for addr := range self.stateObjectsDirty {
+		obj := self.stateObjects[addr]
+		if obj == nil {
+			continue
+		}
+		count++
+		approxBytes += obj.approxSize()
+	}
+	return count, approxBytes
+}
+
 // Snapshot returns an identifier for the current revision of the state.
 func (self *StateDB) Snapshot() int {
 	id := self.nextRevisionId
 	self.nextRevisionId++
 	self.validRevisions = append(self.validRevisions, revision{id, len(self.journal)})
+
+	if VerifyReverts {
+		if self.checkpoints == nil {
+			self.checkpoints = make(map[int]*stateCheckpoint)
+		}
+		self.checkpoints[id] = self.checkpoint()
+	}
 	return id
 }
 
@@ -494,7 +600,20 @@ func (self *StateDB) RevertToSnapshot(revid int) {
 	self.journal = self.journal[:snapshot]
 
 	// Remove invalidated snapshots from the stack.
+	for _, rev := range self.validRevisions[idx:] {
+		if rev.id != revid {
+			delete(self.checkpoints, rev.id)
+		}
+	}
 	self.validRevisions = self.validRevisions[:idx]
+
+	// Make sure the journal restored everything if requested
+	if cp, ok := self.checkpoints[revid]; ok {
+		delete(self.checkpoints, revid)
+		for _, problem := range self.verifyRevert(cp) {
+			glog.V(logger.Error).Infof("Incomplete revert to state snapshot %d: %s", revid, problem)
+		}
+	}
 }
 
 // GetRefund returns the current value of the refund counter.
@@ -504,10 +623,28 @@ func (self *StateDB) GetRefund() *big.Int {
 	return self.refund
 }
 
+// SetEmptyDeletion overrides whether empty objects are deleted from the state
+// on IntermediateRoot and Commit, regardless of the value passed by the caller.
+// It allows tests and historical replays to pick the rule independently of the
+// block number the callers derive it from.
+func (s *StateDB) SetEmptyDeletion(enabled bool) {
+	s.emptyDeletion = &enabled
+}
+
+// deleteEmpty resolves whether empty objects are to be deleted, giving the
+// override precedence over the requested behaviour.
+func (s *StateDB) deleteEmpty(requested bool) bool {
+	if s.emptyDeletion != nil {
+		return *s.emptyDeletion
+	}
+	return requested
+}
+
 // IntermediateRoot computes the current root hash of the state trie.
 // It is called in between transactions to get the root hash that
 // goes into transaction receipts.
 func (s *StateDB) IntermediateRoot(deleteEmptyObjects bool) helper.Hash {
+	deleteEmptyObjects = s.deleteEmpty(deleteEmptyObjects)
 	for addr, _ := range s.stateObjectsDirty {
 		stateObject := s.stateObjects[addr]
 		if stateObject.suicided || (deleteEmptyObjects && stateObject.empty()) {
@@ -545,6 +682,9 @@ func (s *StateDB) DeleteSuicides() {
 
 // Commit commits all state changes to the database.
 func (s *StateDB) Commit(deleteEmptyObjects bool) (root helper.Hash, err error) {
+	if s.dbErr != nil {
+		return helper.Hash{}, s.dbErr
+	}
 	root, batch := s.CommitBatch(deleteEmptyObjects)
 	return root, batch.Write()
 }
@@ -563,11 +703,13 @@ func (s *StateDB) CommitBatch(deleteEmptyObjects bool) (root helper.Hash, batch
 func (s *StateDB) clearJournalAndRefund() {
 	s.journal = nil
 	s.validRevisions = s.validRevisions[:0]
+	s.checkpoints = nil
 	s.refund = new(big.Int)
 }
 
 func (s *StateDB) commit(dbw trie.DatabaseWriter, deleteEmptyObjects bool) (root helper.Hash, err error) {
 	defer s.clearJournalAndRefund()
+	deleteEmptyObjects = s.deleteEmpty(deleteEmptyObjects)
 
 	// Commit objects to the trie.
 	for addr, stateObject := range s.stateObjects {
@@ -0,0 +1,319 @@
+package state
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/siotchain/siot/blockchainCore/localEnv"
+	"github.com/siotchain/siot/database"
+	"github.com/siotchain/siot/helper"
+	"github.com/siotchain/siot/helper/rlp"
+	"github.com/siotchain/siot/trie"
+)
+
+// Tests that the dirty statistics track the accounts modified since the last
+// commit.
+func TestDirtyStats(t *testing.T) {
+	db, _ := database.NewMemDatabase()
+	statedb, _ := New(helper.Hash{}, db)
+
+	if count, size := statedb.DirtyStats(); count != 0 || size != 0 {
+		t.Fatalf("fresh state dirty stats mismatch: have %d objects, %d bytes; want 0, 0", count, size)
+	}
+	var last int
+	for i := byte(1); i <= 3; i++ {
+		statedb.SetBalance(helper.BytesToAddress([]byte{i}), big.NewInt(int64(i)))
+
+		count, size := statedb.DirtyStats()
+		if count != int(i) {
+			t.Errorf("dirty count mismatch after %d accounts: have %d", i, count)
+		}
+		if size <= last {
+			t.Errorf("dirty size not growing after %d accounts: have %d, previously %d", i, size, last)
+		}
+		last = size
+	}
+	// Modifying a dirty account again must not count it twice
+	statedb.SetBalance(helper.BytesToAddress([]byte{1}), big.NewInt(10))
+	if count, _ := statedb.DirtyStats(); count != 3 {
+		t.Errorf("dirty count mismatch after modifying a dirty account: have %d, want 3", count)
+	}
+	if _, err := statedb.Commit(false); err != nil {
+		t.Fatalf("failed to commit state: %v", err)
+	}
+	if count, size := statedb.DirtyStats(); count != 0 || size != 0 {
+		t.Errorf("committed state dirty stats mismatch: have %d objects, %d bytes; want 0, 0", count, size)
+	}
+}
+
+// failingDatabase is a database failing all reads once broken.
+type failingDatabase struct {
+	database.Database
+	broken bool
+}
+
+func (db *failingDatabase) Get(key []byte) ([]byte, error) {
+	if db.broken {
+		return nil, errors.New("broken database")
+	}
+	return db.Database.Get(key)
+}
+
+// Tests that account reads failing in the database are remembered as errors
+// instead of being reported as missing accounts only.
+func TestStateReadError(t *testing.T) {
+	mem, _ := database.NewMemDatabase()
+	db := &failingDatabase{Database: mem}
+
+	// Create a state with enough accounts to store them outside the root node
+	statedb, _ := New(helper.Hash{}, db)
+	for i := byte(1); i <= 16; i++ {
+		statedb.SetBalance(helper.BytesToAddress([]byte{i}), big.NewInt(int64(i)))
+	}
+	root, err := statedb.Commit(false)
+	if err != nil {
+		t.Fatalf("failed to commit state: %v", err)
+	}
+	statedb, err = New(root, db)
+	if err != nil {
+		t.Fatalf("failed to reopen state: %v", err)
+	}
+	if err := statedb.Error(); err != nil {
+		t.Fatalf("fresh state has error: %v", err)
+	}
+	db.broken = true
+	if balance := statedb.GetBalance(helper.BytesToAddress([]byte{1})); balance.Sign() != 0 {
+		t.Errorf("balance read from a broken database: %v", balance)
+	}
+	if err := statedb.Error(); err == nil {
+		t.Fatalf("read failure not reported")
+	}
+	if _, err := statedb.Commit(false); err == nil {
+		t.Errorf("state with read failure committed")
+	}
+	// Resetting the state must clear the error
+	db.broken = false
+	if err := statedb.Reset(root); err != nil {
+		t.Fatalf("failed to reset state: %v", err)
+	}
+	if err := statedb.Error(); err != nil {
+		t.Errorf("error not cleared by reset: %v", err)
+	}
+	if balance := statedb.GetBalance(helper.BytesToAddress([]byte{1})); balance.Cmp(big.NewInt(1)) != 0 {
+		t.Errorf("balance mismatch after reset: have %v, want 1", balance)
+	}
+}
+
+// Tests that preparing the state for a transaction resets the refund counter
+// left behind by the previous one and records logs for the new transaction.
+func TestPrepare(t *testing.T) {
+	db, _ := database.NewMemDatabase()
+	statedb, _ := New(helper.Hash{}, db)
+
+	var (
+		block  = helper.HexToHash("0xb1")
+		first  = helper.HexToHash("0x01")
+		second = helper.HexToHash("0x02")
+	)
+	statedb.Prepare(first, block, 0)
+	statedb.AddRefund(big.NewInt(15000))
+	statedb.AddLog(new(localEnv.Log))
+
+	statedb.Prepare(second, block, 1)
+	if refund := statedb.GetRefund(); refund.Sign() != 0 {
+		t.Errorf("refund not reset: have %v, want 0", refund)
+	}
+	log := new(localEnv.Log)
+	statedb.AddLog(log)
+	if log.TxHash != second || log.BlockHash != block || log.TxIndex != 1 {
+		t.Errorf("log context mismatch: have %x/%x/%d, want %x/%x/1", log.TxHash, log.BlockHash, log.TxIndex, second, block)
+	}
+	if logs := statedb.GetLogs(first); len(logs) != 1 {
+		t.Errorf("logs of the previous transaction lost: have %d, want 1", len(logs))
+	}
+}
+
+// newCodeState creates a database with the given number of externalLogics, each
+// with distinct code of the given size, returning their addresses.
+func newCodeState(tb testing.TB, count, size int) (database.Database, helper.Hash, []helper.Address) {
+	db, _ := database.NewMemDatabase()
+	statedb, _ := New(helper.Hash{}, db)
+
+	addrs := make([]helper.Address, count)
+	for i := range addrs {
+		addrs[i] = helper.BigToAddress(big.NewInt(int64(i + 1)))
+		code := make([]byte, size)
+		copy(code, addrs[i].Bytes())
+		statedb.SetCode(addrs[i], code)
+	}
+	root, err := statedb.Commit(false)
+	if err != nil {
+		tb.Fatalf("failed to commit state: %v", err)
+	}
+	return db, root, addrs
+}
+
+// Tests that preloading the code sizes makes them available without loading
+// the code again.
+func TestPreloadCodeSizes(t *testing.T) {
+	defer SetCodeCacheSize(DefaultCodeCacheSize)
+	SetCodeCacheSize(0)
+
+	mem, root, addrs := newCodeState(t, 8, 100)
+	db := &failingDatabase{Database: mem}
+
+	statedb, _ := New(root, db)
+	statedb.PreloadCodeSizes(append(addrs, helper.HexToAddress("0xdead")))
+	if err := statedb.Error(); err != nil {
+		t.Fatalf("failed to preload code sizes: %v", err)
+	}
+	// Break the database, any code read would now fail
+	db.broken = true
+	for _, addr := range addrs {
+		if size := statedb.GetCodeSize(addr); size != 100 {
+			t.Errorf("%x: code size mismatch: have %d, want 100", addr, size)
+		}
+	}
+	if err := statedb.Error(); err != nil {
+		t.Errorf("code loaded after preloading: %v", err)
+	}
+}
+
+func benchmarkCodeSize(b *testing.B, preload bool) {
+	defer SetCodeCacheSize(DefaultCodeCacheSize)
+	SetCodeCacheSize(0)
+
+	db, root, addrs := newCodeState(b, 1000, 1024)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		statedb, _ := New(root, db)
+		for _, addr := range addrs {
+			statedb.GetStateObject(addr)
+		}
+		if preload {
+			statedb.PreloadCodeSizes(addrs)
+		}
+		b.StartTimer()
+
+		for _, addr := range addrs {
+			statedb.GetCodeSize(addr)
+		}
+	}
+}
+
+func BenchmarkCodeSizeCold(b *testing.B)      { benchmarkCodeSize(b, false) }
+func BenchmarkCodeSizePreloaded(b *testing.B) { benchmarkCodeSize(b, true) }
+
+// Tests that the empty object deletion override takes precedence over the rule
+// requested on commit and when computing intermediate roots.
+func TestEmptyDeletionOverride(t *testing.T) {
+	empty := helper.HexToAddress("0xe0")
+
+	tests := []struct {
+		override  bool
+		requested bool
+		pruned    bool
+	}{
+		{override: false, requested: true, pruned: false},
+		{override: true, requested: false, pruned: true},
+	}
+	for i, tt := range tests {
+		db, _ := database.NewMemDatabase()
+		statedb, _ := New(helper.Hash{}, db)
+		statedb.SetEmptyDeletion(tt.override)
+		statedb.AddBalance(empty, new(big.Int))
+
+		statedb.IntermediateRoot(tt.requested)
+		if exist := statedb.Exist(empty); exist == tt.pruned {
+			t.Errorf("test %d: intermediate root: empty account existence mismatch: have %v, want %v", i, exist, !tt.pruned)
+		}
+		root, err := statedb.Commit(tt.requested)
+		if err != nil {
+			t.Fatalf("test %d: failed to commit state: %v", i, err)
+		}
+		statedb, _ = New(root, db)
+		if exist := statedb.Exist(empty); exist == tt.pruned {
+			t.Errorf("test %d: commit: empty account existence mismatch: have %v, want %v", i, exist, !tt.pruned)
+		}
+	}
+	// Without override, the requested rule applies
+	db, _ := database.NewMemDatabase()
+	statedb, _ := New(helper.Hash{}, db)
+	statedb.AddBalance(empty, new(big.Int))
+	root, _ := statedb.Commit(true)
+	if statedb, _ = New(root, db); statedb.Exist(empty) {
+		t.Errorf("empty account kept without override")
+	}
+}
+
+// Tests that account lookups in a corrupted database holding a trie node that
+// references itself abort with a corruption error instead of looping.
+func TestCyclicTrie(t *testing.T) {
+	// Create a branch node all of whose children are the node itself
+	root := helper.HexToHash("0x0102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f20")
+
+	children := make([][]byte, 17)
+	for i := 0; i < 16; i++ {
+		children[i] = root[:]
+	}
+	blob, err := rlp.EncodeToBytes(children)
+	if err != nil {
+		t.Fatalf("failed to encode node: %v", err)
+	}
+	db, _ := database.NewMemDatabase()
+	db.Put(root[:], blob)
+
+	statedb, err := New(root, db)
+	if err != nil {
+		t.Fatalf("failed to open state: %v", err)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if obj := statedb.GetStateObject(helper.HexToAddress("0x01")); obj != nil {
+			t.Errorf("account loaded from a cyclic trie")
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("account lookup stuck in the trie cycle")
+	}
+	if _, ok := statedb.Error().(*trie.CorruptTrieError); !ok {
+		t.Errorf("error mismatch: have %v, want corruption error", statedb.Error())
+	}
+}
+
+// Tests that only the next nonce of an account can be applied, for both fresh
+// and existing accounts.
+func TestCanApplyNonce(t *testing.T) {
+	db, _ := database.NewMemDatabase()
+	statedb, _ := New(helper.Hash{}, db)
+
+	var (
+		fresh = helper.BytesToAddress([]byte{0x01})
+		used  = helper.BytesToAddress([]byte{0x02})
+	)
+	statedb.SetNonce(used, 5)
+
+	tests := []struct {
+		addr  helper.Address
+		nonce uint64
+		want  bool
+	}{
+		{fresh, StartingNonce, true},
+		{fresh, StartingNonce + 1, false},
+		{used, 5, true},
+		{used, 4, false},
+		{used, 6, false},
+	}
+	for i, tt := range tests {
+		if ok := statedb.CanApplyNonce(tt.addr, tt.nonce); ok != tt.want {
+			t.Errorf("test %d (%x, nonce %d): have %v, want %v", i, tt.addr[:1], tt.nonce, ok, tt.want)
+		}
+	}
+}
@@ -1,12 +1,14 @@
 package blockchainCore
 
 import (
+	"errors"
 	"math/big"
 
 	"github.com/siotchain/siot/blockchainCore/state"
 	"github.com/siotchain/siot/blockchainCore/types"
 	"github.com/siotchain/siot/blockchainCore/localEnv"
 	"github.com/siotchain/siot/crypto"
+	"github.com/siotchain/siot/helper"
 	"github.com/siotchain/siot/logger"
 	"github.com/siotchain/siot/logger/glog"
 	"github.com/siotchain/siot/configure"
@@ -15,6 +17,8 @@ import (
 var (
 	big8  = big.NewInt(8)
 	big32 = big.NewInt(32)
+
+	errProcessAborted = errors.New("block processing aborted")
 )
 
 // StateProcessor is a basic Processor, which takes care of transitioning
@@ -41,7 +45,10 @@ func NewStateProcessor(config *configure.ChainConfig, bc *BlockChain) *StateProc
 // Process returns the receipts and logs accumulated during the process and
 // returns the amount of gas that was used in the process. If any of the
 // transactions failed to execute due to insufficient gas it will return an error.
-func (p *StateProcessor) Process(block *types.Block, statedb *state.StateDB) (types.Receipts, localEnv.Logs, *big.Int, error) {
+//
+// Closing abort interrupts the processing before the next transaction, leaving
+// the statedb partially modified. A nil abort never interrupts it.
+func (p *StateProcessor) Process(block *types.Block, statedb *state.StateDB, abort <-chan struct{}) (types.Receipts, localEnv.Logs, *big.Int, error) {
 	var (
 		receipts     types.Receipts
 		totalUsedGas  = big.NewInt(0)
@@ -54,9 +61,18 @@ func (p *StateProcessor) Process(block *types.Block, statedb *state.StateDB) (ty
 	if p.config.DAOForkSupport && p.config.DAOForkBlock != nil && p.config.DAOForkBlock.Cmp(block.Number()) == 0 {
 		ApplyDAOHardFork(statedb)
 	}
+	// Warm up the wallet the transactions are about to touch
+	statedb.Prefetch(touchedAddresses(p.config, block))
+	defer statedb.StopPrefetch()
+
 	// Iterate over and process the individual transactions
 	for i, tx := range block.Transactions() {
-		statedb.StartRecord(tx.Hash(), block.Hash(), i)
+		select {
+		case <-abort:
+			return nil, nil, nil, errProcessAborted
+		default:
+		}
+		statedb.Prepare(tx.Hash(), block.Hash(), i)
 		receipt, logs, _, err := ApplyTransaction(p.config, p.bc, gp, statedb, header, tx, totalUsedGas)
 		if err != nil {
 			return nil, nil, nil, err
@@ -69,20 +85,47 @@ func (p *StateProcessor) Process(block *types.Block, statedb *state.StateDB) (ty
 	return receipts, allLogs, totalUsedGas, err
 }
 
+// touchedAddresses collects the coinbase along with the senders and recipients
+// of the transactions in a block.
+func touchedAddresses(config *configure.ChainConfig, block *types.Block) []helper.Address {
+	signer := types.MakeSigner(config, block.Number())
+
+	addrs := []helper.Address{block.Coinbase()}
+	for _, tx := range block.Transactions() {
+		if from, err := types.Sender(signer, tx); err == nil {
+			addrs = append(addrs, from)
+		}
+		if to := tx.To(); to != nil {
+			addrs = append(addrs, *to)
+		}
+	}
+	return addrs
+}
+
 // ApplyTransaction attempts to apply a transaction to the given state database
 // and uses the input parameters for its environment.
 //
 // ApplyTransactions returns the generated receipts and localEnv logs during the
-// execution of the state transition phase.
+// execution of the state transition phase. The state database must already be
+// prepared for the transaction via StateDB.Prepare.
 func ApplyTransaction(config *configure.ChainConfig, bc *BlockChain, gp *GasPool, statedb *state.StateDB, header *types.Header, tx *types.Transaction, usedGas *big.Int) (*types.Receipt, localEnv.Logs, *big.Int, error) {
+	receipt, logs, gas, _, err := ApplyTransactionWithVMError(config, bc, gp, statedb, header, tx, usedGas)
+	return receipt, logs, gas, err
+}
+
+// ApplyTransactionWithVMError applies the transaction like ApplyTransaction
+// does, but additionally returns the error of the Env execution itself (e.g. a
+// reverted call). Such errors don't invalidate the transaction, so its effects
+// stay in the state and the receipt is generated regardless.
+func ApplyTransactionWithVMError(config *configure.ChainConfig, bc *BlockChain, gp *GasPool, statedb *state.StateDB, header *types.Header, tx *types.Transaction, usedGas *big.Int) (*types.Receipt, localEnv.Logs, *big.Int, error, error) {
 	msg, err := tx.AsMessage(types.MakeSigner(config, header.Number))
 	if err != nil {
-		return nil, nil, nil, err
+		return nil, nil, nil, nil, err
 	}
 
-	_, gas, err := ApplyMessage(NewEnv(statedb, config, bc, msg, header), msg, gp)
+	_, _, gas, vmerr, err := NewStateTransition(NewEnv(statedb, config, bc, msg, header), msg, gp).transitionDb()
 	if err != nil {
-		return nil, nil, nil, err
+		return nil, nil, nil, nil, err
 	}
 
 	// Update the state with pending changes
@@ -100,7 +143,7 @@ func ApplyTransaction(config *configure.ChainConfig, bc *BlockChain, gp *GasPool
 
 	glog.V(logger.Debug).Infoln(receipt)
 
-	return receipt, logs, gas, err
+	return receipt, logs, gas, vmerr, nil
 }
 
 // AccumulateRewards credits the coinbase of the given block with the
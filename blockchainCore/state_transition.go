@@ -64,13 +64,15 @@ func MessageCreatesExternalLogic(msg Message) bool {
 }
 
 // IntrinsicGas computes the 'intrinsic gas' for a message
-// with the given data.
+// with the given data, using the prices of the active fork.
 func IntrinsicGas(data []byte, externalLogicCreation, homestead bool) *big.Int {
+	table := configure.IntrinsicTxGasTable(homestead)
+
 	igas := new(big.Int)
-	if externalLogicCreation && homestead {
-		igas.Set(configure.TxGasExternalLogicCreation)
+	if externalLogicCreation {
+		igas.Set(table.Create)
 	} else {
-		igas.Set(configure.TxGas)
+		igas.Set(table.Call)
 	}
 	if len(data) > 0 {
 		var nz int64
@@ -80,10 +82,10 @@ func IntrinsicGas(data []byte, externalLogicCreation, homestead bool) *big.Int {
 			}
 		}
 		m := big.NewInt(nz)
-		m.Mul(m, configure.TxDataNonZeroGas)
+		m.Mul(m, table.DataNonZero)
 		igas.Add(igas, m)
 		m.SetInt64(int64(len(data)) - nz)
-		m.Mul(m, configure.TxDataZeroGas)
+		m.Mul(m, table.DataZero)
 		igas.Add(igas, m)
 	}
 	return igas
@@ -177,8 +179,8 @@ func (self *StateTransition) preCheck() (err error) {
 
 	// Make sure this transaction's nonce is correct
 	if msg.CheckNonce() {
-		if n := self.state.GetNonce(sender.Address()); n != msg.Nonce() {
-			return NonceError(msg.Nonce(), n)
+		if !self.state.CanApplyNonce(sender.Address(), msg.Nonce()) {
+			return NonceError(msg.Nonce(), self.state.GetNonce(sender.Address()))
 		}
 	}
 
@@ -193,8 +195,25 @@ func (self *StateTransition) preCheck() (err error) {
 	return nil
 }
 
+// SimulateMessage applies the message like ApplyMessage does, but additionally
+// returns the error raised by the Env execution itself (e.g. out of gas), which
+// is not a consensus error and is therefore swallowed by ApplyMessage.
+func SimulateMessage(env localEnv.Environment, msg Message, gp *GasPool) ([]byte, error, error) {
+	st := NewStateTransition(env, msg, gp)
+
+	ret, _, _, vmerr, err := st.transitionDb()
+	return ret, vmerr, err
+}
+
 // TransitionDb will move the state by applying the message against the given environment.
 func (self *StateTransition) TransitionDb() (ret []byte, requiredGas, usedGas *big.Int, err error) {
+	ret, requiredGas, usedGas, _, err = self.transitionDb()
+	return
+}
+
+// transitionDb is the implementation of TransitionDb, also reporting the non
+// consensus error of the Env execution separately as vmerr.
+func (self *StateTransition) transitionDb() (ret []byte, requiredGas, usedGas *big.Int, vmerr, err error) {
 	if err = self.preCheck(); err != nil {
 		return
 	}
@@ -205,7 +224,7 @@ func (self *StateTransition) TransitionDb() (ret []byte, requiredGas, usedGas *b
 	externalLogicCreation := MessageCreatesExternalLogic(msg)
 	// Pay intrinsic gas
 	if err = self.useGas(IntrinsicGas(self.data, externalLogicCreation, homestead)); err != nil {
-		return nil, nil, nil, InvalidTxError(err)
+		return nil, nil, nil, nil, InvalidTxError(err)
 	}
 
 	vmenv := self.env
@@ -223,6 +242,11 @@ func (self *StateTransition) TransitionDb() (ret []byte, requiredGas, usedGas *b
 	} else {
 		// Increment the nonce for the next transaction
 		self.state.SetNonce(sender.Address(), self.state.GetNonce(sender.Address())+1)
+		if *msg.To() == sender.Address() && self.value.Sign() == 0 && len(self.data) == 0 {
+			// Nothing but the nonce and the gas payment changes, the sender can't
+			// be empty any more so the call won't touch it into deletion either
+			glog.V(logger.Debug).Infof("No-op self-transfer of %x, nonce bumped to %d", sender.Address(), self.state.GetNonce(sender.Address()))
+		}
 		ret, err = vmenv.Call(sender, self.to().Address(), self.data, self.gas, self.gasPrice, self.value)
 		if err != nil {
 			glog.V(logger.Core).Infoln("VM call err:", err)
@@ -230,12 +254,12 @@ func (self *StateTransition) TransitionDb() (ret []byte, requiredGas, usedGas *b
 	}
 
 	if err != nil && IsValueTransferErr(err) {
-		return nil, nil, nil, InvalidTxError(err)
+		return nil, nil, nil, nil, InvalidTxError(err)
 	}
 
 	// We aren't interested in errors here. Errors returned by the VM are non-consensus errors and therefor shouldn't bubble up
 	if err != nil {
-		err = nil
+		vmerr, err = err, nil
 	}
 
 	requiredGas = new(big.Int).Set(self.gasUsed())
@@ -243,7 +267,7 @@ func (self *StateTransition) TransitionDb() (ret []byte, requiredGas, usedGas *b
 	self.refundGas()
 	self.state.AddBalance(self.env.Coinbase(), new(big.Int).Mul(self.gasUsed(), self.gasPrice))
 
-	return ret, requiredGas, self.gasUsed(), err
+	return ret, requiredGas, self.gasUsed(), vmerr, err
 }
 
 func (self *StateTransition) refundGas() {
@@ -0,0 +1,78 @@
+package blockchainCore
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/siotchain/siot/blockchainCore/state"
+	"github.com/siotchain/siot/blockchainCore/types"
+	"github.com/siotchain/siot/configure"
+	"github.com/siotchain/siot/crypto"
+	"github.com/siotchain/siot/database"
+	"github.com/siotchain/siot/helper"
+)
+
+// Tests the intrinsic gas of an identical payload sent as a call and as an
+// externalLogic creation, on both sides of the homestead fork.
+func TestIntrinsicGas(t *testing.T) {
+	data := []byte{0x00, 0x01, 0x00, 0x02} // 2 zero bytes at 4, 2 non-zero at 68
+
+	tests := []struct {
+		create, homestead bool
+		want              int64
+	}{
+		{false, false, 21000 + 2*4 + 2*68},
+		{true, false, 21000 + 2*4 + 2*68},
+		{false, true, 21000 + 2*4 + 2*68},
+		{true, true, 53000 + 2*4 + 2*68},
+	}
+	for i, tt := range tests {
+		if gas := IntrinsicGas(data, tt.create, tt.homestead); gas.Cmp(big.NewInt(tt.want)) != 0 {
+			t.Errorf("test %d (create %v, homestead %v): intrinsic gas mismatch: have %v, want %d", i, tt.create, tt.homestead, gas, tt.want)
+		}
+	}
+	// Creations must never be cheaper than calls with the same payload
+	for _, homestead := range []bool{false, true} {
+		if IntrinsicGas(data, true, homestead).Cmp(IntrinsicGas(data, false, homestead)) < 0 {
+			t.Errorf("homestead %v: creation cheaper than call", homestead)
+		}
+	}
+	if gas := IntrinsicGas(nil, false, true); gas.Cmp(big.NewInt(21000)) != 0 {
+		t.Errorf("empty call intrinsic gas mismatch: have %v, want 21000", gas)
+	}
+}
+
+// Tests that a zero-value self-transfer without data only bumps the nonce of
+// the sender, leaving the state otherwise identical.
+func TestSelfTransfer(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	sender := crypto.PubkeyToAddress(key.PublicKey)
+
+	newState := func() *state.StateDB {
+		db, _ := database.NewMemDatabase()
+		statedb, _ := state.New(helper.Hash{}, db)
+		statedb.AddBalance(sender, big.NewInt(1000000000))
+		return statedb
+	}
+	statedb := newState()
+
+	// Mine the transfer to the sender itself, so the fee is paid back too
+	header := &types.Header{Number: big.NewInt(1), Coinbase: sender, GasLimit: big.NewInt(1000000)}
+	tx, _ := types.SignECDSA(types.MakeSigner(configure.TestChainConfig, header.Number), types.NewTransaction(0, sender, new(big.Int), big.NewInt(21000), big.NewInt(1), nil), key)
+
+	if _, _, _, err := ApplyTransaction(configure.TestChainConfig, nil, new(GasPool).AddGas(header.GasLimit), statedb, header, tx, new(big.Int)); err != nil {
+		t.Fatalf("failed to apply self-transfer: %v", err)
+	}
+	if nonce := statedb.GetNonce(sender); nonce != 1 {
+		t.Errorf("sender nonce mismatch: have %d, want 1", nonce)
+	}
+	if balance := statedb.GetBalance(sender); balance.Cmp(big.NewInt(1000000000)) != 0 {
+		t.Errorf("sender balance mismatch: have %v, want 1000000000", balance)
+	}
+	want := newState()
+	want.SetNonce(sender, 1)
+
+	if have, want := statedb.IntermediateRoot(false), want.IntermediateRoot(false); have != want {
+		t.Errorf("state root mismatch: have %x, want %x", have, want)
+	}
+}
@@ -197,6 +197,22 @@ func (m *txSortedMap) Flatten() types.Transactions {
 	return txs
 }
 
+// Snapshot is like Flatten, but never populates the sorting cache, making it
+// safe for concurrent use by multiple readers.
+func (m *txSortedMap) Snapshot() types.Transactions {
+	if m.cache != nil {
+		txs := make(types.Transactions, len(m.cache))
+		copy(txs, m.cache)
+		return txs
+	}
+	txs := make(types.Transactions, 0, len(m.items))
+	for _, tx := range m.items {
+		txs = append(txs, tx)
+	}
+	sort.Sort(types.TxByNonce(txs))
+	return txs
+}
+
 // txList is a "list" of transactions belonging to an account, sorted by account
 // nonce. The same type can be used both for storing contiguous transactions for
 // the executable/pending queue; and for storing gapped transactions for the non-
@@ -222,8 +238,12 @@ func newTxList(strict bool) *txList {
 //
 // If the new transaction is accepted into the list, the lists' cost threshold
 // is also potentially updated.
+//
+// A transaction only replaces an existing one with the same nonce if it pays a
+// strictly higher gas price. On a price tie the first seen transaction is kept,
+// so that equally priced resubmissions don't churn the pool.
 func (l *txList) Add(tx *types.Transaction) (bool, *types.Transaction) {
-	// If there's an older better transaction, abort
+	// If there's an older better (or equally good) transaction, abort
 	old := l.txs.Get(tx.Nonce())
 	if old != nil && old.GasPrice().Cmp(tx.GasPrice()) >= 0 {
 		return false, nil
@@ -236,6 +256,11 @@ func (l *txList) Add(tx *types.Transaction) (bool, *types.Transaction) {
 	return true, old
 }
 
+// Get retrieves the transaction with the given nonce, if any.
+func (l *txList) Get(nonce uint64) *types.Transaction {
+	return l.txs.Get(nonce)
+}
+
 // Forward removes all transactions from the list with a nonce lower than the
 // provided threshold. Every removed transaction is returned for any post-removal
 // maintenance.
@@ -324,3 +349,9 @@ func (l *txList) Empty() bool {
 func (l *txList) Flatten() types.Transactions {
 	return l.txs.Flatten()
 }
+
+// Snapshot creates a nonce-sorted slice of the current transactions like
+// Flatten, but is safe for concurrent use by multiple readers.
+func (l *txList) Snapshot() types.Transactions {
+	return l.txs.Snapshot()
+}
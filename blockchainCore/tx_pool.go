@@ -1,6 +1,7 @@
 package blockchainCore
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"math/big"
@@ -30,6 +31,12 @@ var (
 	ErrIntrinsicGas       = errors.New("Intrinsic gas too low")
 	ErrGasLimit           = errors.New("Exceeds block gas limit")
 	ErrNegativeValue      = errors.New("Negative value")
+	ErrReadOnly           = errors.New("Transaction pool is read-only")
+	ErrKnownNonce         = errors.New("Known transaction with same nonce and higher or equal gas price")
+	ErrRateLimited        = errors.New("Transaction dropped to keep the pool within its limits")
+	ErrReplaceTooSoon     = errors.New("Transaction with same nonce replaced too recently")
+	ErrResigned           = errors.New("Re-signed copy of a known transaction without a higher gas price")
+	ErrTxGasCap           = errors.New("Exceeds the gas allowed for a single transaction")
 )
 
 var (
@@ -37,7 +44,7 @@ var (
 	maxPendingTotal      = uint64(4096)  // Max limit of pending transactions from all wallet (soft)
 	maxQueuedPerAccount  = uint64(64)    // Max limit of queued transactions per address
 	maxQueuedInTotal     = uint64(1024)  // Max limit of queued transactions from all wallet
-	maxQueuedLifetime    = 3 * time.Hour // Max amount of time transactions from idle wallet are queued
+	maxQueuedLifetime    = 3 * time.Hour // Default max amount of time transactions from idle wallet are queued
 	evictionInterval     = time.Minute   // Time interval to check for evictable transactions
 )
 
@@ -55,7 +62,14 @@ var (
 	queuedNofundsCounter = metrics.NewCounter("txpool/queued/nofunds")   // Dropped due to out-of-funds
 
 	// General tx metrics
-	invalidTxCounter = metrics.NewCounter("txpool/invalid")
+	invalidTxCounter     = metrics.NewCounter("txpool/invalid")
+	underpricedTxCounter = metrics.NewCounter("txpool/underpriced") // Rejected for a gas price below the minimum
+	simFailedTxCounter   = metrics.NewCounter("txpool/simfail")     // Rejected by the admission simulation
+	resignedTxCounter    = metrics.NewCounter("txpool/resigned")    // Rejected as a re-signed copy of a pooled transaction
+
+	// Reorg metrics
+	reinjectedTxCounter = metrics.NewCounter("txpool/reorg/reinjected") // Re-added from blocks orphaned by a reorg
+	reorgDepthGauge     = metrics.NewGauge("txpool/reorg/depth")        // Orphaned blocks of the last reorg dropping transactions
 )
 
 type stateFn func() (*state.StateDB, error)
@@ -76,13 +90,28 @@ type TxPool struct {
 	eventMux     *subscribe.TypeMux
 	events       subscribe.Subscription
 	localTx      *txSet
+	locals       map[helper.Address]struct{} // Senders of local transactions, never expired unlike localTx
 	signer       types.Signer
+	simulator    *BlockChain   // Chain to simulate transactions against on admission (nil = disabled)
+	readonly     bool          // Whether all incoming transactions are rejected
+	lifetime     time.Duration // Max amount of time transactions from idle wallet are queued
 	mu           sync.RWMutex
 
+	promoteBatch   int              // Max number of wallet to promote per pass (0 = all at once)
+	promoteBacklog []helper.Address // Wallet left over for the next promotion pass
+	promoteCh      chan struct{}    // Notification channel to run a promotion pass in the background
+	limitsDue      bool             // Whether a bounded promotion cycle completed and the global limits are to be enforced
+
+	maxTxGasPercent int // Max gas of a single transaction in percent of the block gas limit
+
+	replaceCooldown time.Duration        // Min time between replacements of the same nonce (0 = disabled)
+	replaced        map[txSlot]time.Time // Last time each nonce slot had its transaction replaced
+
 	pending map[helper.Address]*txList         // All currently processable transactions
 	queue   map[helper.Address]*txList         // Queued but non-processable transactions
 	all     map[helper.Hash]*types.Transaction // All transactions to allow lookups
 	beats   map[helper.Address]time.Time       // Last heartbeat from each known account
+	seen    map[helper.Hash]time.Time          // First time each pooled transaction was seen
 
 	wg   sync.WaitGroup // for shutdown sync
 	quit chan struct{}
@@ -90,7 +119,13 @@ type TxPool struct {
 	homestead bool
 }
 
-func NewTxPool(config *configure.ChainConfig, eventMux *subscribe.TypeMux, currentStateFn stateFn, gasLimitFn func() *big.Int) *TxPool {
+// NewTxPool creates a new transaction pool. Queued transactions of wallet that
+// stayed idle for longer than lifetime are evicted; a non-positive lifetime
+// falls back to the default of maxQueuedLifetime.
+func NewTxPool(config *configure.ChainConfig, eventMux *subscribe.TypeMux, currentStateFn stateFn, gasLimitFn func() *big.Int, lifetime time.Duration) *TxPool {
+	if lifetime <= 0 {
+		lifetime = maxQueuedLifetime
+	}
 	pool := &TxPool{
 		config:       config,
 		signer:       types.NewSiotImpr1Signer(config.ChainId),
@@ -98,19 +133,25 @@ func NewTxPool(config *configure.ChainConfig, eventMux *subscribe.TypeMux, curre
 		queue:        make(map[helper.Address]*txList),
 		all:          make(map[helper.Hash]*types.Transaction),
 		beats:        make(map[helper.Address]time.Time),
+		seen:         make(map[helper.Hash]time.Time),
+		replaced:     make(map[txSlot]time.Time),
 		eventMux:     eventMux,
 		currentState: currentStateFn,
 		gasLimit:     gasLimitFn,
 		minGasPrice:  new(big.Int),
 		pendingState: nil,
 		localTx:      newTxSet(),
+		locals:       make(map[helper.Address]struct{}),
+		lifetime:     lifetime,
+		promoteCh:    make(chan struct{}, 1),
 		events:       eventMux.Subscribe(ChainHeadEvent{}, GasPriceChanged{}, RemovedTransactionEvent{}),
 		quit:         make(chan struct{}),
 	}
 
-	pool.wg.Add(2)
+	pool.wg.Add(3)
 	go pool.eventLoop()
 	go pool.expirationLoop()
+	go pool.promotionLoop()
 
 	return pool
 }
@@ -138,7 +179,8 @@ func (pool *TxPool) eventLoop() {
 			pool.minGasPrice = ev.Price
 			pool.mu.Unlock()
 		case RemovedTransactionEvent:
-			pool.AddBatch(ev.Txs)
+			reorgDepthGauge.Update(int64(ev.Depth))
+			reinjectedTxCounter.Inc(int64(pool.reinject(ev.Txs)))
 		}
 	}
 }
@@ -168,10 +210,47 @@ func (pool *TxPool) resetState() {
 		pool.pendingState.SetNonce(addr, txs[len(txs)-1].Nonce()+1)
 	}
 	// Check the queue and move transactions over to the pending if possible
-	// or remove those that have become invalid
+	// or remove those that have become invalid. As the state changed, wallet
+	// already checked in an unfinished bounded promotion need rechecking too.
+	pool.promoteBacklog = nil
 	pool.promoteExecutables()
 }
 
+// Revalidate re-checks all pooled transactions against the current chain state,
+// as done on every new head. It reconciles the pool after the chain was changed
+// without a head event, e.g. by rewinding it manually. The number of transactions
+// that became executable and of those that were dropped is returned.
+func (pool *TxPool) Revalidate() (promoted int, dropped int) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	wasPending := make(map[helper.Hash]struct{})
+	for _, list := range pool.pending {
+		for _, tx := range list.txs.items {
+			wasPending[tx.Hash()] = struct{}{}
+		}
+	}
+	known := make([]helper.Hash, 0, len(pool.all))
+	for hash := range pool.all {
+		known = append(known, hash)
+	}
+	pool.resetState()
+
+	for _, list := range pool.pending {
+		for _, tx := range list.txs.items {
+			if _, ok := wasPending[tx.Hash()]; !ok {
+				promoted++
+			}
+		}
+	}
+	for _, hash := range known {
+		if pool.all[hash] == nil {
+			dropped++
+		}
+	}
+	return promoted, dropped
+}
+
 func (pool *TxPool) Stop() {
 	pool.events.Unsubscribe()
 	close(pool.quit)
@@ -200,6 +279,119 @@ func (pool *TxPool) Stats() (pending int, queued int) {
 	return
 }
 
+// OldestPending returns how long the oldest processable transaction has been
+// waiting in the pool for inclusion, or zero if there are none. A steadily
+// growing value means pending transactions are not getting mined.
+func (pool *TxPool) OldestPending() time.Duration {
+	pool.mu.RLock()
+	defer pool.mu.RUnlock()
+
+	var oldest time.Time
+	for _, list := range pool.pending {
+		for _, tx := range list.txs.items {
+			if seen, ok := pool.seen[tx.Hash()]; ok && (oldest.IsZero() || seen.Before(oldest)) {
+				oldest = seen
+			}
+		}
+	}
+	if oldest.IsZero() {
+		return 0
+	}
+	return time.Since(oldest)
+}
+
+// PriceHistogram counts the pending transactions per gas price bucket. Each
+// bucket is given by its lower bound and spans up to the next larger one, the
+// counts are keyed by the decimal lower bound. Transactions cheaper than every
+// bucket are counted under "0".
+func (pool *TxPool) PriceHistogram(buckets []*big.Int) map[string]int {
+	bounds := make([]*big.Int, len(buckets))
+	copy(bounds, buckets)
+	sort.Sort(bigIntsAsc(bounds))
+
+	counts := make(map[string]int)
+	for _, bound := range bounds {
+		counts[bound.String()] = 0
+	}
+	pool.mu.RLock()
+	defer pool.mu.RUnlock()
+
+	for _, list := range pool.pending {
+		for _, tx := range list.txs.items {
+			key := "0"
+			for i := len(bounds) - 1; i >= 0; i-- {
+				if tx.GasPrice().Cmp(bounds[i]) >= 0 {
+					key = bounds[i].String()
+					break
+				}
+			}
+			counts[key]++
+		}
+	}
+	return counts
+}
+
+// Pressure returns how close the pool is to its capacity limits as a ratio in
+// the range [0, 1], taking the fuller of the pending and queued pools. Once it
+// reaches 1, further transactions start being dropped by the rate limiter.
+func (pool *TxPool) Pressure() float64 {
+	pool.mu.RLock()
+	defer pool.mu.RUnlock()
+
+	var pending, queued uint64
+	for _, list := range pool.pending {
+		pending += uint64(list.Len())
+	}
+	for _, list := range pool.queue {
+		queued += uint64(list.Len())
+	}
+	pressure := float64(pending) / float64(maxPendingTotal)
+	if q := float64(queued) / float64(maxQueuedInTotal); q > pressure {
+		pressure = q
+	}
+	if pressure > 1 {
+		pressure = 1
+	}
+	return pressure
+}
+
+// NonceGaps returns the nonces missing between the account's current nonce and
+// its highest queued transaction. Transactions above a gap can never become
+// executable until the gap is filled.
+func (pool *TxPool) NonceGaps(addr helper.Address) []uint64 {
+	pool.mu.RLock()
+	defer pool.mu.RUnlock()
+
+	queued := pool.queue[addr]
+	if queued == nil || queued.Empty() {
+		return nil
+	}
+	currentState, err := pool.currentState()
+	if err != nil {
+		return nil
+	}
+	known := make(map[uint64]bool)
+	if pending := pool.pending[addr]; pending != nil {
+		for _, tx := range pending.Snapshot() {
+			known[tx.Nonce()] = true
+		}
+	}
+	var highest uint64
+	for _, tx := range queued.Snapshot() {
+		known[tx.Nonce()] = true
+		if tx.Nonce() > highest {
+			highest = tx.Nonce()
+		}
+	}
+	var gaps []uint64
+	for nonce := currentState.GetNonce(addr); nonce < highest; nonce++ {
+		if !known[nonce] {
+			gaps = append(gaps, nonce)
+		}
+	}
+	return gaps
+}
+
 // Content retrieves the data content of the transaction pool, returning all the
 // pending as well as queued transactions, grouped by account and sorted by nonce.
 func (pool *TxPool) Content() (map[helper.Address]types.Transactions, map[helper.Address]types.Transactions) {
@@ -208,11 +400,27 @@ func (pool *TxPool) Content() (map[helper.Address]types.Transactions, map[helper
 
 	pending := make(map[helper.Address]types.Transactions)
 	for addr, list := range pool.pending {
-		pending[addr] = list.Flatten()
+		pending[addr] = list.Snapshot()
 	}
 	queued := make(map[helper.Address]types.Transactions)
 	for addr, list := range pool.queue {
-		queued[addr] = list.Flatten()
+		queued[addr] = list.Snapshot()
+	}
+	return pending, queued
+}
+
+// ContentFrom retrieves the pending and queued transactions of a single account,
+// each sorted by nonce. Empty lists are returned if the account has none.
+func (pool *TxPool) ContentFrom(addr helper.Address) (types.Transactions, types.Transactions) {
+	pool.mu.RLock()
+	defer pool.mu.RUnlock()
+
+	pending, queued := types.Transactions{}, types.Transactions{}
+	if list, ok := pool.pending[addr]; ok {
+		pending = list.Snapshot()
+	}
+	if list, ok := pool.queue[addr]; ok {
+		queued = list.Snapshot()
 	}
 	return pending, queued
 }
@@ -220,6 +428,10 @@ func (pool *TxPool) Content() (map[helper.Address]types.Transactions, map[helper
 // Pending retrieves all currently processable transactions, groupped by origin
 // account and sorted by nonce. The returned transaction set is a copy and can be
 // freely modified by calling code.
+//
+// The queue is promoted and the pending set revalidated before the retrieval,
+// so this is the method to use when the result must reflect the latest state,
+// e.g. when assembling a block. Use PendingSnapshot for read only queries.
 func (pool *TxPool) Pending() map[helper.Address]types.Transactions {
 	pool.mu.Lock()
 	defer pool.mu.Unlock()
@@ -237,12 +449,110 @@ func (pool *TxPool) Pending() map[helper.Address]types.Transactions {
 	return pending
 }
 
+// PendingSnapshot retrieves a copy of the currently processable transactions,
+// like Pending, but without promoting or revalidating anything beforehand. It
+// only takes the read lock and thus doesn't contend with other readers, at the
+// cost of missing any changes since the last pool reset or insertion.
+func (pool *TxPool) PendingSnapshot() map[helper.Address]types.Transactions {
+	pool.mu.RLock()
+	defer pool.mu.RUnlock()
+
+	pending := make(map[helper.Address]types.Transactions)
+	for addr, list := range pool.pending {
+		pending[addr] = list.Snapshot()
+	}
+	return pending
+}
+
 // SetLocal marks a transaction as local, skipping gas price
 //  check against local miner minimum in the future
 func (pool *TxPool) SetLocal(tx *types.Transaction) {
 	pool.mu.Lock()
 	defer pool.mu.Unlock()
 	pool.localTx.add(tx.Hash())
+	if from, err := types.Sender(pool.signer, tx); err == nil {
+		pool.locals[from] = struct{}{}
+	}
+}
+
+// IsLocal reports whether the transaction with the given hash is local, i.e. it
+// was sent by an account that submitted transactions locally.
+func (pool *TxPool) IsLocal(hash helper.Hash) bool {
+	pool.mu.RLock()
+	defer pool.mu.RUnlock()
+
+	if tx, ok := pool.all[hash]; ok {
+		return pool.isLocal(tx)
+	}
+	return pool.localTx.contains(hash)
+}
+
+// isLocal reports whether the transaction was sent by a local account. Unlike
+// the hashes in localTx, the local accounts are remembered for the lifetime of
+// the pool, so their transactions stay local however long they are queued.
+//
+// Note, this method assumes the pool lock is held!
+func (pool *TxPool) isLocal(tx *types.Transaction) bool {
+	from, err := types.Sender(pool.signer, tx)
+	if err != nil {
+		return false
+	}
+	_, ok := pool.locals[from]
+	return ok
+}
+
+// EnableSimulation makes the pool execute every transaction against the state
+// of the given chain before admitting it, rejecting those that would fail.
+// This is expensive and thus disabled by default.
+func (pool *TxPool) EnableSimulation(chain *BlockChain) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	pool.simulator = chain
+}
+
+// SetReadOnly makes the pool reject every transaction, local or remote. It is
+// used by nodes that only serve queries and never mine.
+func (pool *TxPool) SetReadOnly() {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	pool.readonly = true
+}
+
+// SetPromoteBatch limits the number of wallet whose queued transactions are
+// promoted in a single pass while holding the pool lock. The remaining wallet
+// are promoted in subsequent passes, releasing the lock in between to keep the
+// latency of other pool operations low. Zero processes all wallet at once.
+func (pool *TxPool) SetPromoteBatch(batch int) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	pool.promoteBatch = batch
+}
+
+// SetReplaceCooldown sets the minimum amount of time that has to pass between two
+// replacements of the transaction holding the same nonce of a wallet. Faster
+// replacements are rejected with ErrReplaceTooSoon, regardless of their gas
+// price. Zero disables the limit.
+func (pool *TxPool) SetReplaceCooldown(cooldown time.Duration) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	pool.replaceCooldown = cooldown
+}
+
+// SetMaxTxGas caps the gas a single transaction may request to the given
+// percentage of the block gas limit, rejecting larger ones with ErrTxGasCap.
+// Transactions may use the whole block gas limit at 100 percent or above.
+func (pool *TxPool) SetMaxTxGas(percent int) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	pool.maxTxGasPercent = percent
+}
+
+// SetChainConfig replaces the chain configuration the pool validates incoming
+// transactions with. The chain id, and with it the signer, cannot change.
+func (pool *TxPool) SetChainConfig(config *configure.ChainConfig) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	pool.config = config
 }
 
 // validateTx checks whether a transaction is valid according
@@ -277,9 +587,17 @@ func (pool *TxPool) validateTx(tx *types.Transaction) error {
 
 	// Check the transaction doesn't exceed the current
 	// block limit gas.
-	if pool.gasLimit().Cmp(tx.Gas()) < 0 {
+	gasLimit := pool.gasLimit()
+	if gasLimit.Cmp(tx.Gas()) < 0 {
 		return ErrGasLimit
 	}
+	// Don't let a single transaction take over most of a block, if so requested
+	if pool.maxTxGasPercent > 0 && pool.maxTxGasPercent < 100 {
+		limit := new(big.Int).Mul(gasLimit, big.NewInt(int64(pool.maxTxGasPercent)))
+		if limit.Div(limit, big.NewInt(100)).Cmp(tx.Gas()) < 0 {
+			return ErrTxGasCap
+		}
+	}
 
 	// Transactions can't be negative. This may never happen
 	// using RLP decoded transactions but may occur if you create
@@ -299,12 +617,50 @@ func (pool *TxPool) validateTx(tx *types.Transaction) error {
 		return ErrIntrinsicGas
 	}
 
+	// Optionally make sure the transaction would actually execute. Only those
+	// executable right on top of the head can be, later nonces depend on the
+	// transactions before them.
+	if pool.simulator != nil && currentState.GetNonce(from) == tx.Nonce() {
+		return pool.simulateTx(tx, currentState)
+	}
+	return nil
+}
+
+// simulateTx executes the transaction on top of a copy of the current state
+// and returns an error describing why it failed, if it did.
+func (pool *TxPool) simulateTx(tx *types.Transaction, currentState *state.StateDB) error {
+	msg, err := tx.AsMessage(pool.signer)
+	if err != nil {
+		return err
+	}
+	parent := pool.simulator.CurrentBlock().Header()
+	header := &types.Header{
+		ParentHash: parent.Hash(),
+		Coinbase:   parent.Coinbase,
+		Number:     new(big.Int).Add(parent.Number, helper.Big1),
+		GasLimit:   pool.gasLimit(),
+		Difficulty: parent.Difficulty,
+		Time:       big.NewInt(time.Now().Unix()),
+	}
+	env := NewEnv(currentState.Copy(), pool.config, pool.simulator, msg, header)
+
+	_, vmerr, err := SimulateMessage(env, msg, new(GasPool).AddGas(header.GasLimit))
+	if err == nil {
+		err = vmerr
+	}
+	if err != nil {
+		simFailedTxCounter.Inc(1)
+		return fmt.Errorf("Transaction execution failed: %v", err)
+	}
 	return nil
 }
 
 // add validates a transaction and inserts it into the non-executable queue for
 // later pending promotion and execution.
 func (pool *TxPool) add(tx *types.Transaction) error {
+	if pool.readonly {
+		return ErrReadOnly
+	}
 	// If the transaction is alreayd known, discard it
 	hash := tx.Hash()
 	if pool.all[hash] != nil {
@@ -313,13 +669,68 @@ func (pool *TxPool) add(tx *types.Transaction) error {
 	// Otherwise ensure basic validation passes and queue it up
 	if err := pool.validateTx(tx); err != nil {
 		invalidTxCounter.Inc(1)
+		if err == ErrCheap {
+			underpricedTxCounter.Inc(1)
+			go pool.eventMux.Post(TxRejectedEvent{Hash: hash, Reason: err})
+		}
 		return err
 	}
+	// Reject transactions that can't displace the one already holding the nonce,
+	// keeping the first seen one on a gas price tie. Re-signed copies of the same
+	// transfer are only replacements too, but are reported as such.
+	from, _ := types.Sender(pool.signer, tx) // already validated
+	replacing := false
+	if list := pool.pending[from]; list != nil {
+		if old := list.Get(tx.Nonce()); old != nil {
+			if old.GasPrice().Cmp(tx.GasPrice()) >= 0 {
+				pendingDiscardCounter.Inc(1)
+				return knownNonceError(old, tx)
+			}
+			replacing = true
+		}
+	}
+	if list := pool.queue[from]; list != nil {
+		if old := list.Get(tx.Nonce()); old != nil {
+			if old.GasPrice().Cmp(tx.GasPrice()) >= 0 {
+				queuedDiscardCounter.Inc(1)
+				return knownNonceError(old, tx)
+			}
+			replacing = true
+		}
+	}
+	// Rate limit the replacements of a single nonce if requested
+	if replacing && pool.replaceCooldown > 0 {
+		slot := txSlot{addr: from, nonce: tx.Nonce()}
+		if last, ok := pool.replaced[slot]; ok && time.Since(last) < pool.replaceCooldown {
+			return ErrReplaceTooSoon
+		}
+		pool.replaced[slot] = time.Now()
+	}
 	pool.enqueueTx(hash, tx)
 
 	return nil
 }
 
+// knownNonceError returns the error rejecting a transaction that doesn't outbid
+// the pooled one with the same sender and nonce, telling apart copies that only
+// differ in their signature or gas settings.
+func knownNonceError(old, tx *types.Transaction) error {
+	if sameTransfer(old, tx) {
+		resignedTxCounter.Inc(1)
+		return ErrResigned
+	}
+	return ErrKnownNonce
+}
+
+// sameTransfer reports whether two transactions of the same sender and nonce move
+// the same value with the same payload to the same recipient.
+func sameTransfer(a, b *types.Transaction) bool {
+	if (a.To() == nil) != (b.To() == nil) || (a.To() != nil && *a.To() != *b.To()) {
+		return false
+	}
+	return a.Value().Cmp(b.Value()) == 0 && bytes.Equal(a.Data(), b.Data())
+}
+
 // enqueueTx inserts a new transaction into the non-executable transaction queue.
 //
 // Note, this method assumes the pool lock is held!
@@ -337,9 +748,18 @@ func (pool *TxPool) enqueueTx(hash helper.Hash, tx *types.Transaction) {
 	// Discard any previous transaction and mark this
 	if old != nil {
 		delete(pool.all, old.Hash())
+		delete(pool.seen, old.Hash())
 		queuedReplaceCounter.Inc(1)
 	}
 	pool.all[hash] = tx
+	if _, ok := pool.seen[hash]; !ok {
+		pool.seen[hash] = time.Now() // Keep the first sighting of demoted transactions
+	}
+
+	// Make sure an unfinished bounded promotion doesn't miss the wallet
+	if len(pool.promoteBacklog) > 0 {
+		pool.promoteBacklog = append(pool.promoteBacklog, from)
+	}
 }
 
 // promoteTx adds a transaction to the pending (processable) list of transactions.
@@ -360,15 +780,20 @@ func (pool *TxPool) promoteTx(addr helper.Address, hash helper.Hash, tx *types.T
 	if !inserted {
 		// An older transaction was better, discard this
 		delete(pool.all, hash)
+		delete(pool.seen, hash)
 		pendingDiscardCounter.Inc(1)
 		return
 	}
 	// Otherwise discard any previous transaction and mark this
 	if old != nil {
 		delete(pool.all, old.Hash())
+		delete(pool.seen, old.Hash())
 		pendingReplaceCounter.Inc(1)
 	}
 	pool.all[hash] = tx // Failsafe to work around direct pending inserts (tests)
+	if _, ok := pool.seen[hash]; !ok {
+		pool.seen[hash] = time.Now()
+	}
 
 	// Set the potentially new pending nonce and notify any subsystems of the new tx
 	pool.beats[addr] = time.Now()
@@ -402,6 +827,39 @@ func (pool *TxPool) AddBatch(txs []*types.Transaction) {
 	pool.promoteExecutables()
 }
 
+// reinject puts the transactions of blocks orphaned by a reorg back into the pool.
+// The orphaned blocks are collected newest first, so the transactions are sorted
+// into nonce order per account and added under a single lock acquisition. This
+// way they are promoted in one pass without transient nonce gaps, and ahead of
+// any transaction arriving in the meantime. It returns the number of
+// transactions accepted back.
+func (pool *TxPool) reinject(txs types.Transactions) (added int) {
+	accounts := make(map[helper.Address]types.Transactions)
+	for _, tx := range txs {
+		from, err := types.Sender(pool.signer, tx)
+		if err != nil {
+			glog.V(logger.Debug).Infoln("tx error:", err)
+			continue
+		}
+		accounts[from] = append(accounts[from], tx)
+	}
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	for _, list := range accounts {
+		sort.Sort(types.TxByNonce(list))
+		for _, tx := range list {
+			if err := pool.add(tx); err != nil {
+				glog.V(logger.Debug).Infoln("tx error:", err)
+				continue
+			}
+			added++
+		}
+	}
+	pool.promoteExecutables()
+	return added
+}
+
 // Get returns a transaction if it is contained in the pool
 // and nil otherwise.
 func (pool *TxPool) Get(hash helper.Hash) *types.Transaction {
@@ -441,6 +899,7 @@ func (pool *TxPool) removeTx(hash helper.Hash) {
 
 	// Remove it from the list of known transactions
 	delete(pool.all, hash)
+	delete(pool.seen, hash)
 
 	// Remove the transaction from the pending lists and reset the account nonce
 	if pending := pool.pending[addr]; pending != nil {
@@ -473,6 +932,10 @@ func (pool *TxPool) removeTx(hash helper.Hash) {
 // promoteExecutables moves transactions that have become processable from the
 // future queue to the set of pending transactions. During this process, all
 // invalidated transactions (low nonce, low balance) are deleted.
+//
+// If passes are bounded, only the wallet of the current batch are touched and
+// the global pool limits are enforced in the background once all batches of the
+// cycle are done, instead of on every pass.
 func (pool *TxPool) promoteExecutables() {
 	// Init delayed since tx pool could have been started before any state sync
 	if pool.pendingState == nil {
@@ -484,15 +947,19 @@ func (pool *TxPool) promoteExecutables() {
 		glog.Errorf("Could not get current state: %v", err)
 		return
 	}
-	// Iterate over all wallet and promote any executable transactions
-	queued := uint64(0)
-	for addr, list := range pool.queue {
+	// Iterate over the wallet of this pass and promote any executable transactions
+	for _, addr := range pool.promotable() {
+		list, ok := pool.queue[addr]
+		if !ok {
+			continue
+		}
 		// Drop all transactions that are deemed too old (low nonce)
 		for _, tx := range list.Forward(state.GetNonce(addr)) {
 			if glog.V(logger.Core) {
 				glog.Infof("Removed old queued transaction: %v", tx)
 			}
 			delete(pool.all, tx.Hash())
+			delete(pool.seen, tx.Hash())
 		}
 		// Drop all transactions that are too costly (low balance)
 		drops, _ := list.Filter(state.GetBalance(addr))
@@ -501,7 +968,9 @@ func (pool *TxPool) promoteExecutables() {
 				glog.Infof("Removed unpayable queued transaction: %v", tx)
 			}
 			delete(pool.all, tx.Hash())
+			delete(pool.seen, tx.Hash())
 			queuedNofundsCounter.Inc(1)
+			pool.dropped(tx, ErrInsufficientFunds)
 		}
 		// Gather all executable transactions and promote them
 		for _, tx := range list.Ready(pool.pendingState.GetNonce(addr)) {
@@ -516,15 +985,38 @@ func (pool *TxPool) promoteExecutables() {
 				glog.Infof("Removed cap-exceeding queued transaction: %v", tx)
 			}
 			delete(pool.all, tx.Hash())
+			delete(pool.seen, tx.Hash())
 			queuedRLCounter.Inc(1)
+			pool.dropped(tx, ErrRateLimited)
 		}
-		queued += uint64(list.Len())
-
 		// Delete the entire queue entry if it became empty.
 		if list.Empty() {
 			delete(pool.queue, addr)
 		}
 	}
+	if pool.promoteBatch <= 0 {
+		pool.enforceLimits()
+		return
+	}
+	if len(pool.promoteBacklog) == 0 {
+		pool.limitsDue = true
+		select {
+		case pool.promoteCh <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// enforceLimits drops transactions until both the pending and the queued
+// transactions are within the pool wide limits, evicting from the wallet with the
+// most pending and the longest idle queued transactions first.
+//
+// Note, this method assumes the pool lock is held!
+func (pool *TxPool) enforceLimits() {
+	queued := uint64(0)
+	for _, list := range pool.queue {
+		queued += uint64(list.Len())
+	}
 	// If the pending limit is overflown, start equalizing allowances
 	pending := uint64(0)
 	for _, list := range pool.pending {
@@ -600,6 +1092,7 @@ func (pool *TxPool) promoteExecutables() {
 			if size := uint64(list.Len()); size <= drop {
 				for _, tx := range list.Flatten() {
 					pool.removeTx(tx.Hash())
+					pool.dropped(tx, ErrRateLimited)
 				}
 				drop -= size
 				queuedRLCounter.Inc(int64(size))
@@ -609,6 +1102,7 @@ func (pool *TxPool) promoteExecutables() {
 			txs := list.Flatten()
 			for i := len(txs) - 1; i >= 0 && drop > 0; i-- {
 				pool.removeTx(txs[i].Hash())
+				pool.dropped(txs[i], ErrRateLimited)
 				drop--
 				queuedRLCounter.Inc(1)
 			}
@@ -616,6 +1110,71 @@ func (pool *TxPool) promoteExecutables() {
 	}
 }
 
+// dropped notifies subsystems of an evicted transaction if it was submitted
+// locally, so they can decide whether it's worth resubmitting.
+//
+// Note, this method assumes the pool lock is held!
+func (pool *TxPool) dropped(tx *types.Transaction, reason error) {
+	if pool.isLocal(tx) {
+		go pool.eventMux.Post(TxDroppedEvent{Tx: tx, Reason: reason})
+	}
+}
+
+// promotable returns the wallet whose queued transactions are to be checked in
+// the current promotion pass. If passes are bounded, the wallet are taken from
+// the backlog, which is refilled with the addresses of all queued wallet once
+// exhausted, and a new pass is scheduled as long as wallet remain.
+//
+// Note, this method assumes the pool lock is held!
+func (pool *TxPool) promotable() []helper.Address {
+	if pool.promoteBatch <= 0 || len(pool.promoteBacklog) == 0 {
+		addrs := make([]helper.Address, 0, len(pool.queue))
+		for addr := range pool.queue {
+			addrs = append(addrs, addr)
+		}
+		if pool.promoteBatch <= 0 {
+			return addrs
+		}
+		pool.promoteBacklog = addrs
+	}
+	batch := pool.promoteBacklog
+	if len(batch) > pool.promoteBatch {
+		batch = batch[:pool.promoteBatch]
+	}
+	pool.promoteBacklog = pool.promoteBacklog[len(batch):]
+	if len(pool.promoteBacklog) > 0 {
+		select {
+		case pool.promoteCh <- struct{}{}:
+		default:
+		}
+	}
+	return batch
+}
+
+// promotionLoop runs the promotion passes scheduled for the wallet left over
+// by a bounded pass, acquiring the pool lock anew for each of them, and enforces
+// the global limits once a bounded cycle completes.
+func (pool *TxPool) promotionLoop() {
+	defer pool.wg.Done()
+
+	for {
+		select {
+		case <-pool.promoteCh:
+			pool.mu.Lock()
+			if len(pool.promoteBacklog) > 0 {
+				pool.promoteExecutables()
+			} else if pool.limitsDue {
+				pool.limitsDue = false
+				pool.enforceLimits()
+			}
+			pool.mu.Unlock()
+
+		case <-pool.quit:
+			return
+		}
+	}
+}
+
 // demoteUnexecutables removes invalid and processed transactions from the pools
 // executable/pending queue and any subsequent transactions that become unexecutable
 // are moved back into the future queue.
@@ -636,6 +1195,7 @@ func (pool *TxPool) demoteUnexecutables() {
 				glog.Infof("Removed old pending transaction: %v", tx)
 			}
 			delete(pool.all, tx.Hash())
+			delete(pool.seen, tx.Hash())
 		}
 		// Drop all transactions that are too costly (low balance), and queue any invalids back for later
 		drops, invalids := list.Filter(state.GetBalance(addr))
@@ -644,7 +1204,9 @@ func (pool *TxPool) demoteUnexecutables() {
 				glog.Infof("Removed unpayable pending transaction: %v", tx)
 			}
 			delete(pool.all, tx.Hash())
+			delete(pool.seen, tx.Hash())
 			pendingNofundsCounter.Inc(1)
+			pool.dropped(tx, ErrInsufficientFunds)
 		}
 		for _, tx := range invalids {
 			if glog.V(logger.Core) {
@@ -662,7 +1224,7 @@ func (pool *TxPool) demoteUnexecutables() {
 
 // expirationLoop is a loop that periodically iterates over all wallet with
 // queued transactions and drop all that have been inactive for a prolonged amount
-// of time.
+// of time. Locally submitted transactions are exempt from expiration.
 func (pool *TxPool) expirationLoop() {
 	defer pool.wg.Done()
 
@@ -674,12 +1236,21 @@ func (pool *TxPool) expirationLoop() {
 		case <-evict.C:
 			pool.mu.Lock()
 			for addr := range pool.queue {
-				if time.Since(pool.beats[addr]) > maxQueuedLifetime {
+				// Skip local wallet, the operator cares about their transactions
+				if _, ok := pool.locals[addr]; ok {
+					continue
+				}
+				if time.Since(pool.beats[addr]) > pool.lifetime {
 					for _, tx := range pool.queue[addr].Flatten() {
 						pool.removeTx(tx.Hash())
 					}
 				}
 			}
+			for slot, last := range pool.replaced {
+				if time.Since(last) >= pool.replaceCooldown {
+					delete(pool.replaced, slot)
+				}
+			}
 			pool.mu.Unlock()
 
 		case <-pool.quit:
@@ -688,6 +1259,19 @@ func (pool *TxPool) expirationLoop() {
 	}
 }
 
+// bigIntsAsc implements sort.Interface to order big integers ascending.
+type bigIntsAsc []*big.Int
+
+func (s bigIntsAsc) Len() int           { return len(s) }
+func (s bigIntsAsc) Less(i, j int) bool { return s[i].Cmp(s[j]) < 0 }
+func (s bigIntsAsc) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// txSlot identifies the position of a transaction in the nonce sequence of a wallet.
+type txSlot struct {
+	addr  helper.Address
+	nonce uint64
+}
+
 // addressByHeartbeat is an account address tagged with its last activity timestamp.
 type addressByHeartbeat struct {
 	address   helper.Address
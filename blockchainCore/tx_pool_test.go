@@ -0,0 +1,570 @@
+package blockchainCore
+
+import (
+	"crypto/ecdsa"
+	"math/big"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/siotchain/siot/blockchainCore/state"
+	"github.com/siotchain/siot/blockchainCore/types"
+	"github.com/siotchain/siot/configure"
+	"github.com/siotchain/siot/crypto"
+	"github.com/siotchain/siot/database"
+	"github.com/siotchain/siot/helper"
+	"github.com/siotchain/siot/subscribe"
+	"github.com/rcrowley/go-metrics"
+)
+
+// testTxPoolSigner signs the transactions of the test pools, which run on the
+// test chain config.
+var testTxPoolSigner = types.NewSiotImpr1Signer(configure.TestChainConfig.ChainId)
+
+func transaction(nonce uint64, gaslimit *big.Int, key *ecdsa.PrivateKey) *types.Transaction {
+	return pricedTransaction(nonce, gaslimit, big.NewInt(1), key)
+}
+
+func pricedTransaction(nonce uint64, gaslimit, gasprice *big.Int, key *ecdsa.PrivateKey) *types.Transaction {
+	tx, _ := types.SignECDSA(testTxPoolSigner, types.NewTransaction(nonce, helper.Address{}, big.NewInt(100), gaslimit, gasprice, nil), key)
+	return tx
+}
+
+// setupTxPool creates a pool on an empty state with a block gas limit of one
+// million, queueing transactions for at most the given lifetime.
+func setupTxPool(lifetime time.Duration) (*TxPool, *state.StateDB) {
+	db, _ := database.NewMemDatabase()
+	statedb, _ := state.New(helper.Hash{}, db)
+
+	pool := NewTxPool(configure.TestChainConfig, new(subscribe.TypeMux), func() (*state.StateDB, error) { return statedb, nil }, func() *big.Int { return big.NewInt(1000000) }, lifetime)
+	pool.mu.Lock()
+	pool.resetState()
+	pool.mu.Unlock()
+
+	return pool, statedb
+}
+
+// fundedKey creates an account funded in the given state.
+func fundedKey(statedb *state.StateDB) *ecdsa.PrivateKey {
+	key, _ := crypto.GenerateKey()
+	statedb.AddBalance(crypto.PubkeyToAddress(key.PublicKey), big.NewInt(1000000000))
+	return key
+}
+
+// Tests that the expiration loop evicts the queued transactions of remote
+// accounts idle for longer than the pool lifetime, but keeps those of local ones.
+func TestTransactionQueueExpiration(t *testing.T) {
+	defer func(old time.Duration) { evictionInterval = old }(evictionInterval)
+	evictionInterval = 10 * time.Millisecond
+
+	pool, statedb := setupTxPool(50 * time.Millisecond)
+	defer pool.Stop()
+
+	remote, local := fundedKey(statedb), fundedKey(statedb)
+
+	// Queue a transaction of each account behind a nonce gap
+	remoteTx := transaction(1, big.NewInt(100000), remote)
+	localTx := transaction(1, big.NewInt(100000), local)
+
+	pool.SetLocal(localTx)
+	if err := pool.Add(localTx); err != nil {
+		t.Fatalf("failed to add local transaction: %v", err)
+	}
+	if err := pool.Add(remoteTx); err != nil {
+		t.Fatalf("failed to add remote transaction: %v", err)
+	}
+	if pending, queued := pool.Stats(); pending != 0 || queued != 2 {
+		t.Fatalf("pool stats mismatch: have %d pending, %d queued; want 0, 2", pending, queued)
+	}
+	time.Sleep(200 * time.Millisecond)
+
+	if pool.Get(remoteTx.Hash()) != nil {
+		t.Errorf("idle remote transaction not evicted")
+	}
+	if pool.Get(localTx.Hash()) == nil {
+		t.Errorf("idle local transaction evicted")
+	}
+}
+
+// Tests that with simulation enabled, transactions executable on the head are
+// only admitted if they execute, while those with later nonces are queued as
+// they can't be simulated yet.
+func TestTransactionSimulation(t *testing.T) {
+	_, blockchain := newTestChain(t)
+	defer blockchain.Stop()
+
+	pool, statedb := setupTxPool(0)
+	defer pool.Stop()
+
+	key := fundedKey(statedb)
+
+	// The pool checks the intrinsic gas of creations by the pre-homestead rules
+	// until it sees a homestead head, execution always by the chain config
+	create := func(key *ecdsa.PrivateKey) *types.Transaction {
+		tx, _ := types.SignECDSA(testTxPoolSigner, types.NewExternalLogicCreation(0, new(big.Int), big.NewInt(30000), big.NewInt(1), nil), key)
+		return tx
+	}
+	if err := pool.Add(create(fundedKey(statedb))); err != nil {
+		t.Fatalf("creation rejected without simulation: %v", err)
+	}
+	pool.EnableSimulation(blockchain)
+	if err := pool.Add(create(key)); err == nil {
+		t.Fatalf("failing creation admitted with simulation")
+	}
+	if err := pool.Add(transaction(0, big.NewInt(100000), key)); err != nil {
+		t.Fatalf("executable transaction rejected: %v", err)
+	}
+	if err := pool.Add(transaction(2, big.NewInt(100000), key)); err != nil {
+		t.Fatalf("future transaction rejected: %v", err)
+	}
+	if pending, queued := pool.Stats(); pending != 2 || queued != 1 {
+		t.Errorf("pool stats mismatch: have %d pending, %d queued; want 2, 1", pending, queued)
+	}
+}
+
+// Tests that transactions priced below the pool minimum are counted and
+// announced as underpriced rejections, other invalid ones not.
+func TestTransactionUnderpricedRejection(t *testing.T) {
+	defer func(old metrics.Counter) { underpricedTxCounter = old }(underpricedTxCounter)
+	underpricedTxCounter = metrics.NewCounter()
+
+	pool, statedb := setupTxPool(0)
+	defer pool.Stop()
+
+	sub := pool.eventMux.Subscribe(TxRejectedEvent{})
+	defer sub.Unsubscribe()
+
+	pool.mu.Lock()
+	pool.minGasPrice = big.NewInt(2)
+	pool.mu.Unlock()
+
+	key := fundedKey(statedb)
+	cheap := pricedTransaction(0, big.NewInt(100000), big.NewInt(1), key)
+	if err := pool.Add(cheap); err != ErrCheap {
+		t.Fatalf("underpriced transaction error mismatch: have %v, want %v", err, ErrCheap)
+	}
+	if err := pool.Add(pricedTransaction(0, big.NewInt(1), big.NewInt(2), key)); err == nil {
+		t.Fatalf("transaction below the intrinsic gas admitted")
+	}
+	if count := underpricedTxCounter.Count(); count != 1 {
+		t.Errorf("underpriced counter mismatch: have %d, want 1", count)
+	}
+	select {
+	case ev := <-sub.Chan():
+		rejected := ev.Data.(TxRejectedEvent)
+		if rejected.Hash != cheap.Hash() || rejected.Reason != ErrCheap {
+			t.Errorf("rejection event mismatch: have %x (%v), want %x (%v)", rejected.Hash, rejected.Reason, cheap.Hash(), ErrCheap)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("rejection event not posted")
+	}
+}
+
+// Tests that the nonces missing between an account's state nonce and its
+// highest queued transaction are reported as gaps.
+func TestTransactionNonceGaps(t *testing.T) {
+	pool, statedb := setupTxPool(0)
+	defer pool.Stop()
+
+	key := fundedKey(statedb)
+	addr := crypto.PubkeyToAddress(key.PublicKey)
+
+	if gaps := pool.NonceGaps(addr); len(gaps) != 0 {
+		t.Fatalf("gaps reported without transactions: %v", gaps)
+	}
+	for _, nonce := range []uint64{0, 1, 3, 6} {
+		if err := pool.Add(transaction(nonce, big.NewInt(100000), key)); err != nil {
+			t.Fatalf("failed to add transaction %d: %v", nonce, err)
+		}
+	}
+	gaps := pool.NonceGaps(addr)
+	if want := []uint64{2, 4, 5}; !reflect.DeepEqual(gaps, want) {
+		t.Errorf("nonce gaps mismatch: have %v, want %v", gaps, want)
+	}
+	// Filling the first gap must drop it from the report
+	if err := pool.Add(transaction(2, big.NewInt(100000), key)); err != nil {
+		t.Fatalf("failed to fill the gap: %v", err)
+	}
+	gaps = pool.NonceGaps(addr)
+	if want := []uint64{4, 5}; !reflect.DeepEqual(gaps, want) {
+		t.Errorf("nonce gaps after filling mismatch: have %v, want %v", gaps, want)
+	}
+}
+
+// Tests that the content of a single account is returned split into its
+// executable and gapped transactions.
+func TestTransactionContentFrom(t *testing.T) {
+	pool, statedb := setupTxPool(0)
+	defer pool.Stop()
+
+	key := fundedKey(statedb)
+	addr := crypto.PubkeyToAddress(key.PublicKey)
+
+	pending, queued := pool.ContentFrom(addr)
+	if pending == nil || queued == nil || len(pending) != 0 || len(queued) != 0 {
+		t.Fatalf("empty account content mismatch: have %v pending, %v queued; want empty lists", pending, queued)
+	}
+	ready, gapped := transaction(0, big.NewInt(100000), key), transaction(2, big.NewInt(100000), key)
+	for _, tx := range []*types.Transaction{gapped, ready} {
+		if err := pool.Add(tx); err != nil {
+			t.Fatalf("failed to add transaction %d: %v", tx.Nonce(), err)
+		}
+	}
+	pending, queued = pool.ContentFrom(addr)
+	if len(pending) != 1 || pending[0] != ready {
+		t.Errorf("pending content mismatch: have %v, want the ready transaction", pending)
+	}
+	if len(queued) != 1 || queued[0] != gapped {
+		t.Errorf("queued content mismatch: have %v, want the gapped transaction", queued)
+	}
+}
+
+// Tests that with bounded promotion passes, the executable transactions of all
+// wallet are still promoted eventually, a batch at a time.
+func TestTransactionPromoteBatch(t *testing.T) {
+	pool, statedb := setupTxPool(0)
+	defer pool.Stop()
+
+	pool.SetPromoteBatch(2)
+
+	txs := make([]*types.Transaction, 10)
+	for i := range txs {
+		txs[i] = transaction(0, big.NewInt(100000), fundedKey(statedb))
+	}
+	pool.AddBatch(txs)
+
+	for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+		pending, queued := pool.Stats()
+		if pending == len(txs) && queued == 0 {
+			break
+		}
+		if time.Since(start) > 5*time.Second {
+			t.Fatalf("transactions not promoted: have %d pending, %d queued; want %d, 0", pending, queued, len(txs))
+		}
+	}
+}
+
+// Tests that a transaction with the nonce and gas price of a pooled one is
+// rejected, keeping the first seen one without counting a replacement, while a
+// pricier one replaces it.
+func TestTransactionSamePriceTie(t *testing.T) {
+	defer func(pending, queued metrics.Counter) {
+		pendingReplaceCounter, queuedReplaceCounter = pending, queued
+	}(pendingReplaceCounter, queuedReplaceCounter)
+	pendingReplaceCounter, queuedReplaceCounter = metrics.NewCounter(), metrics.NewCounter()
+
+	pool, statedb := setupTxPool(0)
+	defer pool.Stop()
+
+	key := fundedKey(statedb)
+	transfer := func(nonce uint64, value, price int64) *types.Transaction {
+		tx, _ := types.SignECDSA(testTxPoolSigner, types.NewTransaction(nonce, helper.Address{}, big.NewInt(value), big.NewInt(100000), big.NewInt(price), nil), key)
+		return tx
+	}
+	// Check ties both in the pending and the queued sets
+	for _, nonce := range []uint64{0, 2} {
+		first, second := transfer(nonce, 1, 1), transfer(nonce, 2, 1)
+		if err := pool.Add(first); err != nil {
+			t.Fatalf("nonce %d: failed to add first transaction: %v", nonce, err)
+		}
+		if err := pool.Add(second); err != ErrKnownNonce {
+			t.Errorf("nonce %d: tied transaction error mismatch: have %v, want %v", nonce, err, ErrKnownNonce)
+		}
+		if pool.Get(first.Hash()) == nil || pool.Get(second.Hash()) != nil {
+			t.Errorf("nonce %d: first seen transaction not kept", nonce)
+		}
+	}
+	if pending, queued := pendingReplaceCounter.Count(), queuedReplaceCounter.Count(); pending != 0 || queued != 0 {
+		t.Errorf("replacements counted on ties: have %d pending, %d queued", pending, queued)
+	}
+	// A higher price must still replace the pooled transaction
+	pricier := transfer(0, 3, 2)
+	if err := pool.Add(pricier); err != nil {
+		t.Fatalf("failed to replace with a higher price: %v", err)
+	}
+	if pool.Get(pricier.Hash()) == nil {
+		t.Errorf("pricier transaction not pooled")
+	}
+}
+
+// Tests that pending snapshots can be taken concurrently with insertions, each
+// one being a consistent copy of the nonce-ordered pending transactions.
+func TestTransactionPendingSnapshot(t *testing.T) {
+	pool, statedb := setupTxPool(0)
+	defer pool.Stop()
+
+	keys := make([]*ecdsa.PrivateKey, 4)
+	for i := range keys {
+		keys[i] = fundedKey(statedb)
+	}
+	var wg sync.WaitGroup
+	for _, key := range keys {
+		wg.Add(1)
+		go func(key *ecdsa.PrivateKey) {
+			defer wg.Done()
+			for nonce := uint64(0); nonce < 32; nonce++ {
+				if err := pool.Add(transaction(nonce, big.NewInt(100000), key)); err != nil {
+					t.Errorf("failed to add transaction %d: %v", nonce, err)
+				}
+			}
+		}(key)
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	for finished := false; !finished; {
+		select {
+		case <-done:
+			finished = true
+		default:
+		}
+		for addr, txs := range pool.PendingSnapshot() {
+			for i, tx := range txs {
+				if tx.Nonce() != uint64(i) {
+					t.Fatalf("%x: inconsistent snapshot: nonce %d at position %d", addr, tx.Nonce(), i)
+				}
+			}
+			// Snapshots are copies, modifying them must not affect the pool
+			txs[0] = nil
+		}
+	}
+	pending := pool.PendingSnapshot()
+	if len(pending) != len(keys) {
+		t.Fatalf("pending account count mismatch: have %d, want %d", len(pending), len(keys))
+	}
+	for addr, txs := range pending {
+		if len(txs) != 32 || txs[0] == nil {
+			t.Errorf("%x: pending transactions mismatch: have %d, want 32", addr, len(txs))
+		}
+	}
+}
+
+// Tests that the age of the oldest pending transaction grows while it stays
+// unmined, unaffected by the arrival of newer ones.
+func TestTransactionOldestPending(t *testing.T) {
+	pool, statedb := setupTxPool(0)
+	defer pool.Stop()
+
+	if age := pool.OldestPending(); age != 0 {
+		t.Fatalf("empty pool oldest pending age: have %v, want 0", age)
+	}
+	key := fundedKey(statedb)
+	old := transaction(0, big.NewInt(100000), key)
+	if err := pool.Add(old); err != nil {
+		t.Fatalf("failed to add transaction: %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	first := pool.OldestPending()
+	if first < 50*time.Millisecond {
+		t.Fatalf("oldest pending age too low: have %v, want at least 50ms", first)
+	}
+	if err := pool.Add(transaction(0, big.NewInt(100000), fundedKey(statedb))); err != nil {
+		t.Fatalf("failed to add newer transaction: %v", err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if age := pool.OldestPending(); age <= first {
+		t.Errorf("oldest pending age not growing: have %v, previously %v", age, first)
+	}
+	// Once the oldest one is gone, the age is that of the newer one
+	pool.Remove(old.Hash())
+	if age := pool.OldestPending(); age >= first {
+		t.Errorf("oldest pending age after removal mismatch: have %v, want below %v", age, first)
+	}
+}
+
+// Tests that the transactions of blocks orphaned by a reorg, reported newest
+// block first, are all pending again without gaps once reinjected.
+func TestTransactionReorgReinjection(t *testing.T) {
+	pool, statedb := setupTxPool(0)
+	defer pool.Stop()
+
+	key := fundedKey(statedb)
+	orphaned := types.Transactions{
+		transaction(2, big.NewInt(100000), key),
+		transaction(1, big.NewInt(100000), key),
+		transaction(0, big.NewInt(100000), key),
+	}
+	pool.eventMux.Post(RemovedTransactionEvent{Txs: orphaned})
+
+	addr := crypto.PubkeyToAddress(key.PublicKey)
+	for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+		pending, queued := pool.ContentFrom(addr)
+		if len(pending) == len(orphaned) && len(queued) == 0 {
+			for i, tx := range pending {
+				if tx.Nonce() != uint64(i) {
+					t.Errorf("pending tx %d: nonce mismatch: have %d, want %d", i, tx.Nonce(), i)
+				}
+			}
+			break
+		}
+		if time.Since(start) > 5*time.Second {
+			t.Fatalf("orphaned transactions not reinjected: have %d pending, %d queued; want %d, 0", len(pending), len(queued), len(orphaned))
+		}
+	}
+	if gaps := pool.NonceGaps(addr); len(gaps) != 0 {
+		t.Errorf("nonce gaps after reinjection: %v", gaps)
+	}
+}
+
+// Tests that the transactions reinjected after a reorg are counted, leaving out
+// those rejected by the pool, and that the depth of the reorg is recorded.
+func TestTransactionReorgMetrics(t *testing.T) {
+	defer func(counter metrics.Counter, gauge metrics.Gauge) {
+		reinjectedTxCounter, reorgDepthGauge = counter, gauge
+	}(reinjectedTxCounter, reorgDepthGauge)
+	reinjectedTxCounter, reorgDepthGauge = metrics.NewCounter(), metrics.NewGauge()
+
+	pool, statedb := setupTxPool(0)
+	defer pool.Stop()
+
+	key, unfunded := fundedKey(statedb), fundedKey(statedb)
+	statedb.SetBalance(crypto.PubkeyToAddress(unfunded.PublicKey), new(big.Int))
+
+	orphaned := types.Transactions{
+		transaction(1, big.NewInt(100000), key),
+		transaction(0, big.NewInt(100000), unfunded),
+		transaction(0, big.NewInt(100000), key),
+	}
+	pool.eventMux.Post(RemovedTransactionEvent{Txs: orphaned, Depth: 3})
+
+	for start := time.Now(); reinjectedTxCounter.Count() < 2; time.Sleep(10 * time.Millisecond) {
+		if time.Since(start) > 5*time.Second {
+			t.Fatalf("reinjected transactions not counted: have %d, want 2", reinjectedTxCounter.Count())
+		}
+	}
+	time.Sleep(10 * time.Millisecond)
+	if count := reinjectedTxCounter.Count(); count != 2 {
+		t.Errorf("reinjected transaction count mismatch: have %d, want 2", count)
+	}
+	if depth := reorgDepthGauge.Value(); depth != 3 {
+		t.Errorf("reorg depth mismatch: have %d, want 3", depth)
+	}
+}
+
+// Tests that rapid replacements of the transaction holding the same nonce are
+// rejected under a replacement cooldown, but accepted once it passed.
+func TestTransactionReplaceCooldown(t *testing.T) {
+	pool, statedb := setupTxPool(0)
+	defer pool.Stop()
+
+	pool.SetReplaceCooldown(100 * time.Millisecond)
+
+	key := fundedKey(statedb)
+	for _, nonce := range []uint64{0, 2} { // pending and queued
+		if err := pool.Add(pricedTransaction(nonce, big.NewInt(100000), big.NewInt(1), key)); err != nil {
+			t.Fatalf("nonce %d: failed to add transaction: %v", nonce, err)
+		}
+		if err := pool.Add(pricedTransaction(nonce, big.NewInt(100000), big.NewInt(2), key)); err != nil {
+			t.Fatalf("nonce %d: failed to replace transaction: %v", nonce, err)
+		}
+		if err := pool.Add(pricedTransaction(nonce, big.NewInt(100000), big.NewInt(3), key)); err != ErrReplaceTooSoon {
+			t.Errorf("nonce %d: rapid replacement error mismatch: have %v, want %v", nonce, err, ErrReplaceTooSoon)
+		}
+	}
+	time.Sleep(100 * time.Millisecond)
+	for _, nonce := range []uint64{0, 2} {
+		if err := pool.Add(pricedTransaction(nonce, big.NewInt(100000), big.NewInt(3), key)); err != nil {
+			t.Errorf("nonce %d: failed to replace transaction after the cooldown: %v", nonce, err)
+		}
+	}
+	// Without a cooldown, replacements are only limited by their price
+	pool.SetReplaceCooldown(0)
+	for price := int64(4); price < 8; price++ {
+		if err := pool.Add(pricedTransaction(0, big.NewInt(100000), big.NewInt(price), key)); err != nil {
+			t.Errorf("price %d: failed to replace transaction without a cooldown: %v", price, err)
+		}
+	}
+}
+
+// Tests that the price histogram counts the pending transactions into the
+// buckets given by their lower bounds, ignoring the queued ones.
+func TestTransactionPriceHistogram(t *testing.T) {
+	pool, statedb := setupTxPool(0)
+	defer pool.Stop()
+
+	for _, price := range []int64{1, 2, 5, 10, 50, 99, 100, 1000} {
+		if err := pool.Add(pricedTransaction(0, big.NewInt(100000), big.NewInt(price), fundedKey(statedb))); err != nil {
+			t.Fatalf("price %d: failed to add transaction: %v", price, err)
+		}
+	}
+	if err := pool.Add(pricedTransaction(1, big.NewInt(100000), big.NewInt(50), fundedKey(statedb))); err != nil {
+		t.Fatalf("failed to add queued transaction: %v", err)
+	}
+	have := pool.PriceHistogram([]*big.Int{big.NewInt(100), big.NewInt(2), big.NewInt(10)})
+	want := map[string]int{"0": 1, "2": 2, "10": 3, "100": 2}
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("histogram mismatch: have %v, want %v", have, want)
+	}
+	// Buckets without transactions must be reported too
+	have = pool.PriceHistogram([]*big.Int{big.NewInt(10000)})
+	want = map[string]int{"0": 8, "10000": 0}
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("histogram mismatch: have %v, want %v", have, want)
+	}
+}
+
+// Tests that re-signed copies of pooled transactions, moving the same value to
+// the same recipient, are only accepted as replacements outbidding the original.
+func TestTransactionResigned(t *testing.T) {
+	pool, statedb := setupTxPool(0)
+	defer pool.Stop()
+
+	key := fundedKey(statedb)
+	for _, nonce := range []uint64{0, 2} { // pending and queued
+		// Signatures are deterministic, vary the gas limit to obtain a new one
+		orig := pricedTransaction(nonce, big.NewInt(100000), big.NewInt(1), key)
+		copied := pricedTransaction(nonce, big.NewInt(100001), big.NewInt(1), key)
+		if orig.Hash() == copied.Hash() {
+			t.Fatalf("nonce %d: copy not re-signed", nonce)
+		}
+		if err := pool.Add(orig); err != nil {
+			t.Fatalf("nonce %d: failed to add transaction: %v", nonce, err)
+		}
+		if err := pool.Add(copied); err != ErrResigned {
+			t.Errorf("nonce %d: re-signed copy error mismatch: have %v, want %v", nonce, err, ErrResigned)
+		}
+		if pool.Get(orig.Hash()) == nil || pool.Get(copied.Hash()) != nil {
+			t.Errorf("nonce %d: original transaction not kept", nonce)
+		}
+		// A different transfer with the same nonce is a plain conflict
+		other, _ := types.SignECDSA(testTxPoolSigner, types.NewTransaction(nonce, helper.Address{}, big.NewInt(1), big.NewInt(100000), big.NewInt(1), nil), key)
+		if err := pool.Add(other); err != ErrKnownNonce {
+			t.Errorf("nonce %d: conflicting transaction error mismatch: have %v, want %v", nonce, err, ErrKnownNonce)
+		}
+		// A copy outbidding the original replaces it
+		pricier := pricedTransaction(nonce, big.NewInt(100000), big.NewInt(2), key)
+		if err := pool.Add(pricier); err != nil {
+			t.Errorf("nonce %d: failed to replace with a pricier copy: %v", nonce, err)
+		}
+		if pool.Get(orig.Hash()) != nil || pool.Get(pricier.Hash()) == nil {
+			t.Errorf("nonce %d: original transaction not replaced", nonce)
+		}
+	}
+}
+
+// Tests that transactions requesting more than the allowed share of the block
+// gas limit are rejected, while those within it are accepted.
+func TestTransactionMaxGasCap(t *testing.T) {
+	pool, statedb := setupTxPool(0)
+	defer pool.Stop()
+
+	key := fundedKey(statedb)
+	if err := pool.Add(transaction(0, big.NewInt(900000), key)); err != nil {
+		t.Fatalf("failed to add transaction without a cap: %v", err)
+	}
+	pool.SetMaxTxGas(50)
+	if err := pool.Add(transaction(1, big.NewInt(900000), key)); err != ErrTxGasCap {
+		t.Errorf("capped transaction error mismatch: have %v, want %v", err, ErrTxGasCap)
+	}
+	if err := pool.Add(transaction(1, big.NewInt(500000), key)); err != nil {
+		t.Errorf("failed to add transaction at the cap: %v", err)
+	}
+	// A cap of the whole block reverts to the block gas limit check
+	pool.SetMaxTxGas(100)
+	if err := pool.Add(transaction(2, big.NewInt(1000000), key)); err != nil {
+		t.Errorf("failed to add transaction at the block gas limit: %v", err)
+	}
+}
@@ -40,7 +40,7 @@ type HeaderValidator interface {
 // Process takes the block to be processed and the statedb upon which the
 // initial state is based. It should return the receipts generated, amount
 // of gas used in the process and return an error if any of the internal rules
-// failed.
+// failed. If abort is non-nil, closing it makes Process give up early.
 type Processor interface {
-	Process(block *types.Block, statedb *state.StateDB) (types.Receipts, localEnv.Logs, *big.Int, error)
+	Process(block *types.Block, statedb *state.StateDB, abort <-chan struct{}) (types.Receipts, localEnv.Logs, *big.Int, error)
 }
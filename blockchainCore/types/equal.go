@@ -0,0 +1,15 @@
+package types
+
+import "github.com/siotchain/siot/helper"
+
+// BlockEqual reports whether two blocks are identical in their canonical RLP
+// encoding, regardless of any cached hash, size or difficulty values.
+func BlockEqual(a, b *Block) (bool, error) {
+	return helper.RLPEqual(a, b)
+}
+
+// TxEqual reports whether two transactions are identical in their canonical
+// RLP encoding, regardless of any cached hash, size or sender values.
+func TxEqual(a, b *Transaction) (bool, error) {
+	return helper.RLPEqual(a, b)
+}
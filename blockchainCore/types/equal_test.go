@@ -0,0 +1,39 @@
+package types
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/siotchain/siot/helper"
+	"github.com/siotchain/siot/helper/rlp"
+)
+
+// Tests that transactions and blocks compare equal by their consensus content,
+// whatever values their copies have cached.
+func TestRLPEquality(t *testing.T) {
+	tx := NewTransaction(3, helper.HexToAddress("0x0b0b"), big.NewInt(10), big.NewInt(21000), big.NewInt(1), []byte{0x01})
+	tx.Hash() // Populate the hash cache of one copy only
+
+	blob, _ := rlp.EncodeToBytes(tx)
+	decoded := new(Transaction)
+	if err := rlp.DecodeBytes(blob, decoded); err != nil {
+		t.Fatalf("failed to decode transaction: %v", err)
+	}
+	if equal, err := TxEqual(tx, decoded); err != nil || !equal {
+		t.Errorf("decoded transaction mismatch: equal %v, err %v", equal, err)
+	}
+	other := NewTransaction(4, helper.HexToAddress("0x0b0b"), big.NewInt(10), big.NewInt(21000), big.NewInt(1), []byte{0x01})
+	if equal, err := TxEqual(tx, other); err != nil || equal {
+		t.Errorf("different transactions reported equal: err %v", err)
+	}
+	header := &Header{Number: big.NewInt(1), Difficulty: big.NewInt(131072), GasLimit: big.NewInt(3141592), GasUsed: new(big.Int), Time: big.NewInt(10)}
+	block := NewBlock(header, []*Transaction{tx}, nil, nil)
+	block.Hash()
+
+	if equal, err := BlockEqual(block, NewBlock(header, []*Transaction{decoded}, nil, nil)); err != nil || !equal {
+		t.Errorf("identical blocks mismatch: equal %v, err %v", equal, err)
+	}
+	if equal, err := BlockEqual(block, NewBlock(header, []*Transaction{other}, nil, nil)); err != nil || equal {
+		t.Errorf("blocks with different transactions reported equal: err %v", err)
+	}
+}
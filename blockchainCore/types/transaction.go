@@ -458,8 +458,9 @@ func (s *TxByPrice) Pop() interface{} {
 // transactions in a profit-maximising sorted order, while supporting removing
 // entire batches of transactions for non-executable wallet.
 type TransactionsByPriceAndNonce struct {
-	txs   map[helper.Address]Transactions // Per account nonce-sorted list of transactions
-	heads TxByPrice                       // Next transaction for each unique account (price heap)
+	txs       map[helper.Address]Transactions // Per account nonce-sorted list of transactions
+	heads     headsByPrice                    // Next transaction for each unique account (price heap)
+	effective bool                            // Whether accounts are ranked by their effective price
 }
 
 // NewTransactionsByPriceAndNonce creates a transaction set that can retrieve
@@ -468,19 +469,42 @@ type TransactionsByPriceAndNonce struct {
 // Note, the input map is reowned so the caller should not interact any more with
 // if after providng it to the constructor.
 func NewTransactionsByPriceAndNonce(txs map[helper.Address]Transactions) *TransactionsByPriceAndNonce {
+	return newTransactionsByPriceAndNonce(txs, false)
+}
+
+// NewTransactionsByEffectivePrice creates a transaction set like the one of
+// NewTransactionsByPriceAndNonce, but ranks every account by the effective price
+// of its pending sequence instead of the price of its next transaction alone.
+// This way a cheap transaction is not left behind if the ones it unblocks pay a
+// high fee, e.g. after its successor was replaced by a pricier one.
+func NewTransactionsByEffectivePrice(txs map[helper.Address]Transactions) *TransactionsByPriceAndNonce {
+	return newTransactionsByPriceAndNonce(txs, true)
+}
+
+func newTransactionsByPriceAndNonce(txs map[helper.Address]Transactions, effective bool) *TransactionsByPriceAndNonce {
+	t := &TransactionsByPriceAndNonce{
+		txs:       txs,
+		heads:     make(headsByPrice, 0, len(txs)),
+		effective: effective,
+	}
 	// Initialize a price based heap with the head transactions
-	heads := make(TxByPrice, 0, len(txs))
 	for acc, accTxs := range txs {
-		heads = append(heads, accTxs[0])
 		txs[acc] = accTxs[1:]
+		t.heads = append(t.heads, t.newHead(acc, accTxs[0]))
 	}
-	heap.Init(&heads)
+	heap.Init(&t.heads)
+
+	return t
+}
 
-	// Assemble and return the transaction set
-	return &TransactionsByPriceAndNonce{
-		txs:   txs,
-		heads: heads,
+// newHead creates the heap entry of an account's next transaction, pricing it
+// according to the ranking mode of the set.
+func (t *TransactionsByPriceAndNonce) newHead(acc helper.Address, tx *Transaction) *txHead {
+	price := tx.data.Price
+	if t.effective {
+		price = effectivePrice(tx, t.txs[acc])
 	}
+	return &txHead{tx: tx, from: acc, price: price}
 }
 
 // Peek returns the next transaction by price.
@@ -488,16 +512,16 @@ func (t *TransactionsByPriceAndNonce) Peek() *Transaction {
 	if len(t.heads) == 0 {
 		return nil
 	}
-	return t.heads[0]
+	return t.heads[0].tx
 }
 
-// Shift replaces the current best head with the next one from the same account.
+// Shift replaces the current best head with the next one from the same account,
+// re-pricing the account according to its remaining transactions.
 func (t *TransactionsByPriceAndNonce) Shift() {
-	signer := deriveSigner(t.heads[0].data.V)
-	// derive signer but don't cache.
-	acc, _ := Sender(signer, t.heads[0]) // we only sort valid txs so this cannot fail
+	acc := t.heads[0].from
 	if txs, ok := t.txs[acc]; ok && len(txs) > 0 {
-		t.heads[0], t.txs[acc] = txs[0], txs[1:]
+		t.txs[acc] = txs[1:]
+		t.heads[0] = t.newHead(acc, txs[0])
 		heap.Fix(&t.heads, 0)
 	} else {
 		heap.Pop(&t.heads)
@@ -511,6 +535,57 @@ func (t *TransactionsByPriceAndNonce) Pop() {
 	heap.Pop(&t.heads)
 }
 
+// effectivePrice calculates the best gas price a miner can earn by including the
+// head transaction together with any number of its successors: the highest gas
+// weighted average price over all nonce-ordered prefixes of the sequence.
+func effectivePrice(head *Transaction, rest Transactions) *big.Int {
+	var (
+		best = new(big.Int).Set(head.data.Price)
+		fees = new(big.Int).Mul(head.data.Price, head.data.GasLimit)
+		gas  = new(big.Int).Set(head.data.GasLimit)
+		avg  = new(big.Int)
+	)
+	for _, tx := range rest {
+		fees.Add(fees, new(big.Int).Mul(tx.data.Price, tx.data.GasLimit))
+		gas.Add(gas, tx.data.GasLimit)
+		if gas.Sign() == 0 {
+			continue
+		}
+		if avg.Div(fees, gas); avg.Cmp(best) > 0 {
+			best.Set(avg)
+		}
+	}
+	return best
+}
+
+// txHead is the next transaction of an account along with the price the account
+// is ranked by.
+type txHead struct {
+	tx    *Transaction
+	from  helper.Address
+	price *big.Int
+}
+
+// headsByPrice implements the heap interface over the next transactions of the
+// accounts, ordering them by their ranking price.
+type headsByPrice []*txHead
+
+func (s headsByPrice) Len() int           { return len(s) }
+func (s headsByPrice) Less(i, j int) bool { return s[i].price.Cmp(s[j].price) > 0 }
+func (s headsByPrice) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+func (s *headsByPrice) Push(x interface{}) {
+	*s = append(*s, x.(*txHead))
+}
+
+func (s *headsByPrice) Pop() interface{} {
+	old := *s
+	n := len(old)
+	x := old[n-1]
+	*s = old[0 : n-1]
+	return x
+}
+
 // Message is a fully derived transaction and implements blockchainCore.Message
 //
 // NOTE: In a future PR this will be removed.
@@ -0,0 +1,62 @@
+package types
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/siotchain/siot/helper"
+)
+
+// Tests that ranking wallets by their effective price picks up a cheap
+// transaction unblocking a far pricier one, while the default ranking leaves
+// it behind the other wallets.
+func TestTransactionsByEffectivePrice(t *testing.T) {
+	var (
+		replaced = helper.HexToAddress("0x0a")
+		other    = helper.HexToAddress("0x0b")
+	)
+	priced := func(nonce uint64, price int64) *Transaction {
+		return NewTransaction(nonce, helper.Address{}, new(big.Int), big.NewInt(21000), big.NewInt(price), nil)
+	}
+	var (
+		cheap  = priced(0, 1)
+		pricey = priced(1, 100)
+		middle = priced(0, 10)
+	)
+	order := func(set *TransactionsByPriceAndNonce) []*Transaction {
+		var txs []*Transaction
+		for tx := set.Peek(); tx != nil; tx = set.Peek() {
+			txs = append(txs, tx)
+			set.Shift()
+		}
+		return txs
+	}
+	tests := []struct {
+		effective bool
+		want      []*Transaction
+	}{
+		{false, []*Transaction{middle, cheap, pricey}},
+		{true, []*Transaction{cheap, pricey, middle}},
+	}
+	for _, tt := range tests {
+		txs := map[helper.Address]Transactions{
+			replaced: {cheap, pricey},
+			other:    {middle},
+		}
+		var set *TransactionsByPriceAndNonce
+		if tt.effective {
+			set = NewTransactionsByEffectivePrice(txs)
+		} else {
+			set = NewTransactionsByPriceAndNonce(txs)
+		}
+		have := order(set)
+		if len(have) != len(tt.want) {
+			t.Fatalf("effective %v: transaction count mismatch: have %d, want %d", tt.effective, len(have), len(tt.want))
+		}
+		for i := range have {
+			if have[i] != tt.want[i] {
+				t.Errorf("effective %v: tx %d mismatch: have nonce %d price %v, want nonce %d price %v", tt.effective, i, have[i].Nonce(), have[i].GasPrice(), tt.want[i].Nonce(), tt.want[i].GasPrice())
+			}
+		}
+	}
+}
@@ -3,14 +3,20 @@ package client
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"math/big"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/siotchain/siot"
 	"github.com/siotchain/siot/helper"
 	"github.com/siotchain/siot/blockchainCore/types"
 	"github.com/siotchain/siot/blockchainCore/localEnv"
 	"github.com/siotchain/siot/helper/rlp"
+	"github.com/siotchain/siot/logger"
+	"github.com/siotchain/siot/logger/glog"
 	"github.com/siotchain/siot/net/rpc"
 	"golang.org/x/net/context"
 	"github.com/siotchain/siot/net/p2p"
@@ -19,7 +25,9 @@ import (
 
 // Client defines typed wrappers for the Siotchain RPC API.
 type Client struct {
-	c *rpc.Client
+	c      *rpc.Client
+	opts   ClientOptions // Timeout and retry policy of the calls
+	closed int32         // Set once the client is closed, accessed atomically
 }
 
 // Dial connects a client to the given URL.
@@ -33,7 +41,43 @@ func Dial(rawurl string) (*Client, error) {
 
 // NewClient creates a client that uses the given RPC client.
 func NewClient(c *rpc.Client) *Client {
-	return &Client{c}
+	return &Client{c: c}
+}
+
+// Close closes the underlying RPC client, aborting in-flight requests and
+// terminating active subscriptions with rpc.ErrClientQuit. The client is not
+// usable after Close: every further call fails with rpc.ErrClientQuit.
+func (ec *Client) Close() {
+	if atomic.CompareAndSwapInt32(&ec.closed, 0, 1) {
+		ec.c.Close()
+	}
+}
+
+// IsConnected reports whether the node is reachable, probing it with a cheap
+// net_version call. It is always false after Close.
+func (ec *Client) IsConnected(ctx context.Context) bool {
+	if ec.isClosed() {
+		return false
+	}
+	var version string
+	return ec.c.CallContext(ctx, &version, "net_version") == nil
+}
+
+// isClosed reports whether Close has been called on the client.
+func (ec *Client) isClosed() bool {
+	return atomic.LoadInt32(&ec.closed) == 1
+}
+
+// subscribe starts a subscription on the node, unless the client is closed.
+func (ec *Client) subscribe(ctx context.Context, channel interface{}, args ...interface{}) (siotchain.Subscription, error) {
+	if ec.isClosed() {
+		return nil, rpc.ErrClientQuit
+	}
+	sub, err := ec.c.SiotSubscribe(ctx, channel, args...)
+	if err != nil {
+		return nil, err
+	}
+	return sub, nil
 }
 
 // Blockchain Access
@@ -63,7 +107,7 @@ type rpcBlock struct {
 
 func (ec *Client) getBlock(ctx context.Context, method string, args ...interface{}) (*types.Block, error) {
 	var raw json.RawMessage
-	err := ec.c.CallContext(ctx, &raw, method, args...)
+	err := ec.call(ctx, &raw, method, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -101,7 +145,7 @@ func (ec *Client) getBlock(ctx context.Context, method string, args ...interface
 				Result: &uncles[i],
 			}
 		}
-		if err := ec.c.BatchCallContext(ctx, reqs); err != nil {
+		if err := ec.batchCall(ctx, reqs); err != nil {
 			return nil, err
 		}
 		for i := range reqs {
@@ -116,22 +160,71 @@ func (ec *Client) getBlock(ctx context.Context, method string, args ...interface
 // HeaderByHash returns the block header with the given hash.
 func (ec *Client) HeaderByHash(ctx context.Context, hash helper.Hash) (*types.Header, error) {
 	var head *types.Header
-	err := ec.c.CallContext(ctx, &head, "siot_getBlockByHash", hash, false)
+	err := ec.call(ctx, &head, "siot_getBlockByHash", hash, false)
 	return head, err
 }
 
+// HeaderBatchError is returned by HeadersByHash if some of the headers could not
+// be retrieved, detailing the failure for each affected hash.
+type HeaderBatchError struct {
+	Errors map[helper.Hash]error
+}
+
+func (e *HeaderBatchError) Error() string {
+	for hash, err := range e.Errors {
+		return fmt.Sprintf("failed to retrieve %d header(s), e.g. %x: %v", len(e.Errors), hash[:4], err)
+	}
+	return "failed to retrieve headers"
+}
+
+// HeadersByHash retrieves the block headers with the given hashes in a single
+// batch request, returning them in input order. Unknown headers are returned
+// as nil entries. If some of the individual requests fail, the headers that
+// could be retrieved are returned along with a *HeaderBatchError.
+func (ec *Client) HeadersByHash(ctx context.Context, hashes []helper.Hash) ([]*types.Header, error) {
+	heads := make([]*types.Header, len(hashes))
+	reqs := make([]rpc.BatchElem, len(hashes))
+	for i, hash := range hashes {
+		reqs[i] = rpc.BatchElem{
+			Method: "siot_getBlockByHash",
+			Args:   []interface{}{hash, false},
+			Result: &heads[i],
+		}
+	}
+	if len(reqs) == 0 {
+		return heads, nil
+	}
+	if err := ec.batchCall(ctx, reqs); err != nil {
+		return nil, err
+	}
+	var failed map[helper.Hash]error
+	for i := range reqs {
+		if reqs[i].Error != nil {
+			if failed == nil {
+				failed = make(map[helper.Hash]error)
+			}
+			failed[hashes[i]] = reqs[i].Error
+			heads[i] = nil
+		}
+	}
+	if failed != nil {
+		return heads, &HeaderBatchError{Errors: failed}
+	}
+	return heads, nil
+}
+
 // HeaderByNumber returns a block header from the current canonical chain. If number is
 // nil, the latest known header is returned.
 func (ec *Client) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
 	var head *types.Header
-	err := ec.c.CallContext(ctx, &head, "siot_getBlockByNumber", toBlockNumArg(number), false)
+	err := ec.call(ctx, &head, "siot_getBlockByNumber", toBlockNumArg(number), false)
 	return head, err
 }
 
 // TransactionByHash returns the transaction with the given hash.
 func (ec *Client) TransactionByHash(ctx context.Context, hash helper.Hash) (*types.Transaction, error) {
 	var tx *types.Transaction
-	err := ec.c.CallContext(ctx, &tx, "siot_getTransactionByHash", hash)
+	err := ec.call(ctx, &tx, "siot_getTransactionByHash", hash)
 	if err == nil {
 		if _, r, _ := tx.RawSignatureValues(); r == nil {
 			return nil, fmt.Errorf("server returned transaction without signature")
@@ -143,14 +236,27 @@ func (ec *Client) TransactionByHash(ctx context.Context, hash helper.Hash) (*typ
 // TransactionCount returns the total number of transactions in the given block.
 func (ec *Client) TransactionCount(ctx context.Context, blockHash helper.Hash) (uint, error) {
 	var num rpc.HexNumber
-	err := ec.c.CallContext(ctx, &num, "siot_getBlockTransactionCountByHash", blockHash)
+	err := ec.call(ctx, &num, "siot_getBlockTransactionCountByHash", blockHash)
+	return num.Uint(), err
+}
+
+// TransactionCountByNumber returns the total number of transactions in the block
+// with the given number. A nil number selects the latest block, the value of
+// rpc.PendingBlockNumber the pending one.
+func (ec *Client) TransactionCountByNumber(ctx context.Context, number *big.Int) (uint, error) {
+	arg := toBlockNumArg(number)
+	if number != nil && number.Cmp(big.NewInt(int64(rpc.PendingBlockNumber))) == 0 {
+		arg = "pending"
+	}
+	var num rpc.HexNumber
+	err := ec.call(ctx, &num, "siot_getBlockTransactionCountByNumber", arg)
 	return num.Uint(), err
 }
 
 // TransactionInBlock returns a single transaction at index in the given block.
 func (ec *Client) TransactionInBlock(ctx context.Context, blockHash helper.Hash, index uint) (*types.Transaction, error) {
 	var tx *types.Transaction
-	err := ec.c.CallContext(ctx, &tx, "siot_getTransactionByBlockHashAndIndex", blockHash, index)
+	err := ec.call(ctx, &tx, "siot_getTransactionByBlockHashAndIndex", blockHash, index)
 	if err == nil {
 		var signer types.Signer = types.HomesteadSigner{}
 		if tx.Protected() {
@@ -167,7 +273,7 @@ func (ec *Client) TransactionInBlock(ctx context.Context, blockHash helper.Hash,
 // Note that the receipt is not available for pending transactions.
 func (ec *Client) TransactionReceipt(ctx context.Context, txHash helper.Hash) (*types.Receipt, error) {
 	var r *types.Receipt
-	err := ec.c.CallContext(ctx, &r, "siot_getTransactionReceipt", txHash)
+	err := ec.call(ctx, &r, "siot_getTransactionReceipt", txHash)
 	if err == nil && r != nil && len(r.PostState) == 0 {
 		return nil, fmt.Errorf("server returned receipt without post state")
 	}
@@ -193,7 +299,7 @@ type rpcProgress struct {
 // no sync currently running, it returns nil.
 func (ec *Client) SyncProgress(ctx context.Context) (*siotchain.SyncProgress, error) {
 	var raw json.RawMessage
-	if err := ec.c.CallContext(ctx, &raw, "siot_syncing"); err != nil {
+	if err := ec.call(ctx, &raw, "siot_syncing"); err != nil {
 		return nil, err
 	}
 	// Handle the possible response types
@@ -214,48 +320,192 @@ func (ec *Client) SyncProgress(ctx context.Context) (*siotchain.SyncProgress, er
 	}, nil
 }
 
+// Delays between two sync progress polls performed by WaitForSync. The delay
+// doubles while the sync makes no progress and is reset once it does.
+const (
+	syncPollMinInterval = time.Second
+	syncPollMaxInterval = 16 * time.Second
+)
+
+// WaitForSync blocks until the node reports no running sync, or the context is
+// cancelled. A node that isn't syncing at the time of the call, e.g. because it
+// is already at the tip, returns immediately; so does one that hasn't found any
+// peer to sync with yet. If progress is non-nil, the completion percentage of
+// the chain download is sent on it after every poll, dropping values the
+// receiver isn't ready for. Failed polls are retried until the context is done.
+func (ec *Client) WaitForSync(ctx context.Context, progress chan<- float64) error {
+	var (
+		delay = syncPollMinInterval
+		last  uint64
+	)
+	for {
+		sync, err := ec.SyncProgress(ctx)
+		if err == nil {
+			if sync == nil {
+				return nil
+			}
+			if progress != nil {
+				select {
+				case progress <- syncPercentage(sync):
+				default:
+				}
+			}
+			if sync.CurrentBlock > last {
+				last, delay = sync.CurrentBlock, syncPollMinInterval
+			} else if delay *= 2; delay > syncPollMaxInterval {
+				delay = syncPollMaxInterval
+			}
+		}
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// syncPercentage returns how far the chain download of a sync got, in percent.
+func syncPercentage(sync *siotchain.SyncProgress) float64 {
+	if sync.HighestBlock <= sync.StartingBlock || sync.CurrentBlock >= sync.HighestBlock {
+		return 100
+	}
+	if sync.CurrentBlock <= sync.StartingBlock {
+		return 0
+	}
+	return float64(sync.CurrentBlock-sync.StartingBlock) * 100 / float64(sync.HighestBlock-sync.StartingBlock)
+}
+
 // SubscribeNewHead subscribes to notifications about the current blockchain head
 // on the given channel.
 func (ec *Client) SubscribeNewHead(ctx context.Context, ch chan<- *types.Header) (siotchain.Subscription, error) {
-	return ec.c.SiotSubscribe(ctx, ch, "newHeads", map[string]struct{}{})
+	return ec.subscribe(ctx, ch, "newHeads", map[string]struct{}{})
+}
+
+// SubscribeNewBlock subscribes to notifications about the current blockchain head,
+// delivering the full blocks including transactions and uncles. Every block is
+// fetched as its header is announced, so blocks arrive slightly later than with
+// SubscribeNewHead. Blocks that can't be fetched, e.g. because they were
+// reorganised away meanwhile, are skipped without ending the subscription.
+func (ec *Client) SubscribeNewBlock(ctx context.Context, ch chan<- *types.Block) (siotchain.Subscription, error) {
+	heads := make(chan *types.Header, 16)
+	inner, err := ec.SubscribeNewHead(ctx, heads)
+	if err != nil {
+		return nil, err
+	}
+	fetchCtx, cancel := context.WithCancel(context.Background())
+	sub := &blockSub{
+		quit:     make(chan struct{}),
+		finished: make(chan struct{}),
+		err:      make(chan error, 1),
+		cancel:   cancel,
+	}
+	go func() {
+		defer close(sub.finished)
+		defer inner.Unsubscribe()
+
+		for {
+			select {
+			case head := <-heads:
+				block, err := ec.BlockByHash(fetchCtx, head.Hash())
+				if err != nil {
+					glog.V(logger.Debug).Infof("Skipping block #%v [%x…]: %v", head.Number, head.Hash().Bytes()[:4], err)
+					continue
+				}
+				select {
+				case ch <- block:
+				case <-sub.quit:
+					return
+				}
+			case err := <-inner.Err():
+				sub.err <- err
+				return
+			case <-sub.quit:
+				return
+			}
+		}
+	}()
+	return sub, nil
+}
+
+// blockSub is the subscription handle of SubscribeNewBlock.
+type blockSub struct {
+	quit     chan struct{}
+	finished chan struct{}
+	err      chan error
+	cancel   context.CancelFunc // Aborts the block being fetched on unsubscribe
+	once     sync.Once
+}
+
+// Unsubscribe stops the delivery of blocks and waits for the forwarding loop to
+// exit.
+func (s *blockSub) Unsubscribe() {
+	s.once.Do(func() {
+		close(s.quit)
+		s.cancel()
+		<-s.finished
+		close(s.err)
+	})
+}
+
+// Err returns the error channel of the subscription, receiving the error of the
+// underlying head subscription if it fails.
+func (s *blockSub) Err() <-chan error {
+	return s.err
+}
+
+// SubscribeChainReorg subscribes to notifications about reorganisations of the
+// canonical chain. Data derived from the removed blocks should be unapplied,
+// newest first, before the added blocks are applied.
+func (ec *Client) SubscribeChainReorg(ctx context.Context, ch chan<- *siotchain.ChainReorg) (siotchain.Subscription, error) {
+	return ec.subscribe(ctx, ch, "chainReorg")
 }
 
 // State Access
 // TODO WEI: add client api to handle rpc call
 func (ec *Client) NodeInfoAt(ctx context.Context) (*p2p.NodeInfo, error) {
 	var result p2p.NodeInfo
-	err := ec.c.CallContext(ctx, &result, "manage_nodeInfo")
+	err := ec.call(ctx, &result, "manage_nodeInfo")
 	return (*p2p.NodeInfo)(&result), err
 }
 
 func (ec *Client) ListAccountsAt(ctx context.Context) ([]rpc.HexBytes, error) {
 	var result []rpc.HexBytes
-	err := ec.c.CallContext(ctx, &result, "user_listAccounts")
+	err := ec.call(ctx, &result, "user_listAccounts")
 	return result, err
 }
 
 func (ec *Client) NewAccount(ctx context.Context, password string) (rpc.HexBytes, error) {
 	var result rpc.HexBytes
-	err := ec.c.CallContext(ctx, &result, "user_newAccount", password)
+	err := ec.call(ctx, &result, "user_newAccount", password)
 	return result, err
 }
 
 func (ec *Client) UnlockAccount(ctx context.Context, account helper.Address, password string) (bool, error) {
 	var result bool
-	err := ec.c.CallContext(ctx, &result, "user_unlockAccount", account, password)
+	err := ec.call(ctx, &result, "user_unlockAccount", account, password)
 	return result, err
 }
 
 func (ec *Client) LockAccount(ctx context.Context) (helper.Address, error) {
 	var result helper.Address
-	err := ec.c.CallContext(ctx, &result, "user_lockAccount")
+	err := ec.call(ctx, &result, "user_lockAccount")
 	return result, err
 }
 // BalanceAt returns the wei balance of the given account.
 // The block number can be nil, in which case the balance is taken from the latest known block.
 func (ec *Client) BalanceAt(ctx context.Context, account helper.Address, blockNumber *big.Int) (*big.Int, error) {
 	var result rpc.HexNumber
-	err := ec.c.CallContext(ctx, &result, "siot_getBalance", account, toBlockNumArg(blockNumber))
+	err := ec.call(ctx, &result, "siot_getBalance", account, toBlockNumArg(blockNumber))
+	return (*big.Int)(&result), err
+}
+
+// BalanceAtHash returns the wei balance of the given account in the state of the
+// block with the given hash. In contrast to BalanceAt, the result is consistent
+// across chain reorganisations. An error is returned if the block is unknown to
+// the server.
+func (ec *Client) BalanceAtHash(ctx context.Context, account helper.Address, blockHash helper.Hash) (*big.Int, error) {
+	var result rpc.HexNumber
+	err := ec.call(ctx, &result, "siot_getBalanceByHash", account, blockHash)
 	return (*big.Int)(&result), err
 }
 
@@ -263,37 +513,67 @@ func (ec *Client) SendAsset(ctx context.Context, sender helper.Address, receiver
 	var result rpc.HexBytes
 	value.Mul(value, big.NewInt(1000000000000))
 	args := siotapi.SendTxArgs{From: sender, To: &receiver, Value: rpc.NewHexNumber(value), Data: ""}
-	err := ec.c.CallContext(ctx, &result, "siot_sendTransaction", args)
+	err := ec.call(ctx, &result, "siot_sendTransaction", args)
 	return result, err
 }
 
+// SignTransaction asks the node to sign a transaction with the given, already
+// unlocked account without broadcasting it, returning the signed transaction.
+func (ec *Client) SignTransaction(ctx context.Context, sender helper.Address, receiver helper.Address, value *big.Int, nonce uint64, gasPrice, gasLimit *big.Int) (*types.Transaction, error) {
+	var result struct {
+		Raw string `json:"raw"`
+	}
+	args := siotapi.SignTransactionArgs{
+		From:     sender,
+		To:       &receiver,
+		Nonce:    rpc.NewHexNumber(nonce),
+		Value:    rpc.NewHexNumber(value),
+		Gas:      rpc.NewHexNumber(gasLimit),
+		GasPrice: rpc.NewHexNumber(gasPrice),
+	}
+	if err := ec.call(ctx, &result, "siot_signTransaction", args); err != nil {
+		return nil, err
+	}
+	tx := new(types.Transaction)
+	if err := rlp.DecodeBytes(helper.FromHex(result.Raw), tx); err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
 func (ec *Client) AddPeer(ctx context.Context, url string) (bool, error) {
 	var result bool
-	err := ec.c.CallContext(ctx, &result, "manage_addPeer", url)
+	err := ec.call(ctx, &result, "manage_addPeer", url)
 	return result, err
 }
 
 func (ec *Client) GetPeers(ctx context.Context) ([]*p2p.PeerInfo, error) {
 	var result []*p2p.PeerInfo
-	err := ec.c.CallContext(ctx, &result, "manage_peers")
+	err := ec.call(ctx, &result, "manage_peers")
 	return result, err
 }
 
+func (ec *Client) DiscoveryStats(ctx context.Context) (*p2p.DiscoveryStats, error) {
+	var result p2p.DiscoveryStats
+	err := ec.call(ctx, &result, "manage_discoveryStats")
+	return &result, err
+}
+
 func (ec *Client) SetMiner(ctx context.Context, account helper.Address) (bool, error) {
 	var result bool
-	err := ec.c.CallContext(ctx, &result, "miner_setMiner", account)
+	err := ec.call(ctx, &result, "miner_setMiner", account)
 	return result, err
 }
 
 func (ec *Client) StartMining(ctx context.Context) (bool, error) {
 	var result bool
-	err := ec.c.CallContext(ctx, &result, "miner_start")
+	err := ec.call(ctx, &result, "miner_start")
 	return result, err
 }
 
 func (ec *Client) StopMining(ctx context.Context) (bool, error) {
 	var result bool
-	err := ec.c.CallContext(ctx, &result, "miner_stop")
+	err := ec.call(ctx, &result, "miner_stop")
 	return result, err
 }
 
@@ -303,7 +583,7 @@ func (ec *Client) StopMining(ctx context.Context) (bool, error) {
 // The block number can be nil, in which case the value is taken from the latest known block.
 func (ec *Client) StorageAt(ctx context.Context, account helper.Address, key helper.Hash, blockNumber *big.Int) ([]byte, error) {
 	var result rpc.HexBytes
-	err := ec.c.CallContext(ctx, &result, "siot_getStorageAt", account, key, toBlockNumArg(blockNumber))
+	err := ec.call(ctx, &result, "siot_getStorageAt", account, key, toBlockNumArg(blockNumber))
 	return result, err
 }
 
@@ -311,7 +591,26 @@ func (ec *Client) StorageAt(ctx context.Context, account helper.Address, key hel
 // The block number can be nil, in which case the code is taken from the latest known block.
 func (ec *Client) CodeAt(ctx context.Context, account helper.Address, blockNumber *big.Int) ([]byte, error) {
 	var result rpc.HexBytes
-	err := ec.c.CallContext(ctx, &result, "siot_getCode", account, toBlockNumArg(blockNumber))
+	err := ec.call(ctx, &result, "siot_getCode", account, toBlockNumArg(blockNumber))
+	return result, err
+}
+
+// StorageAtHash returns the value of key in the externalLogic storage of the given
+// account in the state of the block with the given hash. Reads against the same
+// hash stay consistent even if the chain reorganises in between. An error is
+// returned if the block is unknown to the server.
+func (ec *Client) StorageAtHash(ctx context.Context, account helper.Address, key helper.Hash, blockHash helper.Hash) ([]byte, error) {
+	var result rpc.HexBytes
+	err := ec.call(ctx, &result, "siot_getStorageAtByHash", account, key, blockHash)
+	return result, err
+}
+
+// CodeAtHash returns the externalLogic code of the given account in the state of
+// the block with the given hash. An error is returned if the block is unknown to
+// the server.
+func (ec *Client) CodeAtHash(ctx context.Context, account helper.Address, blockHash helper.Hash) ([]byte, error) {
+	var result rpc.HexBytes
+	err := ec.call(ctx, &result, "siot_getCodeByHash", account, blockHash)
 	return result, err
 }
 
@@ -319,22 +618,179 @@ func (ec *Client) CodeAt(ctx context.Context, account helper.Address, blockNumbe
 // The block number can be nil, in which case the nonce is taken from the latest known block.
 func (ec *Client) NonceAt(ctx context.Context, account helper.Address, blockNumber *big.Int) (uint64, error) {
 	var result rpc.HexNumber
-	err := ec.c.CallContext(ctx, &result, "siot_getTransactionCount", account, toBlockNumArg(blockNumber))
+	err := ec.call(ctx, &result, "siot_getTransactionCount", account, toBlockNumArg(blockNumber))
 	return result.Uint64(), err
 }
 
+// NonceGaps returns the nonces missing in the transaction pool between the
+// account's current nonce and its highest queued transaction.
+func (ec *Client) NonceGaps(ctx context.Context, account helper.Address) ([]uint64, error) {
+	var result []rpc.HexNumber
+	if err := ec.call(ctx, &result, "siot_getNonceGaps", account); err != nil {
+		return nil, err
+	}
+	gaps := make([]uint64, len(result))
+	for i, nonce := range result {
+		gaps[i] = nonce.Uint64()
+	}
+	return gaps, nil
+}
+
 // Filters
 
 // FilterLogs executes a filter query.
 func (ec *Client) FilterLogs(ctx context.Context, q siotchain.FilterQuery) ([]localEnv.Log, error) {
 	var result []localEnv.Log
-	err := ec.c.CallContext(ctx, &result, "siot_getLogs", toFilterArg(q))
+	err := ec.call(ctx, &result, "siot_getLogs", toFilterArg(q))
 	return result, err
 }
 
 // SubscribeFilterLogs subscribes to the results of a streaming filter query.
 func (ec *Client) SubscribeFilterLogs(ctx context.Context, q siotchain.FilterQuery, ch chan<- localEnv.Log) (siotchain.Subscription, error) {
-	return ec.c.SiotSubscribe(ctx, ch, "logs", toFilterArg(q))
+	return ec.subscribe(ctx, ch, "logs", toFilterArg(q))
+}
+
+// ErrFilterNotFound is returned when polling or removing a filter the server
+// doesn't know, usually because it expired after not being polled for a while.
+var ErrFilterNotFound = errors.New("filter not found")
+
+// NewFilter installs a log filter on the server, whose new matches can then be
+// polled with GetFilterChanges. Filters which are not polled regularly expire.
+func (ec *Client) NewFilter(ctx context.Context, q siotchain.FilterQuery) (string, error) {
+	var id string
+	err := ec.call(ctx, &id, "siot_newFilter", toFilterArg(q))
+	return id, err
+}
+
+// GetFilterChanges returns the logs matched by an installed filter since it was
+// last polled.
+func (ec *Client) GetFilterChanges(ctx context.Context, filterID string) ([]localEnv.Log, error) {
+	var result []localEnv.Log
+	err := ec.call(ctx, &result, "siot_getFilterChanges", filterID)
+	return result, filterError(err)
+}
+
+// UninstallFilter removes an installed filter from the server.
+func (ec *Client) UninstallFilter(ctx context.Context, filterID string) error {
+	var removed bool
+	if err := ec.call(ctx, &removed, "siot_uninstallFilter", filterID); err != nil {
+		return err
+	}
+	if !removed {
+		return ErrFilterNotFound
+	}
+	return nil
+}
+
+// filterError translates the error of the server about an unknown filter.
+func filterError(err error) error {
+	if err != nil && err.Error() == ErrFilterNotFound.Error() {
+		return ErrFilterNotFound
+	}
+	return err
+}
+
+// FilterLogsPaged executes a filter query in pages of roughly pageSize logs,
+// splitting the queried block range into multiple siot_getLogs calls that are
+// only issued as the returned iterator advances. Logs of a single block are
+// never split, so a page may exceed pageSize if one block holds more logs.
+func (ec *Client) FilterLogsPaged(ctx context.Context, q siotchain.FilterQuery, pageSize int) *LogIterator {
+	if pageSize < 1 {
+		pageSize = 1
+	}
+	return &LogIterator{ec: ec, ctx: ctx, query: q, pageSize: pageSize, span: uint64(pageSize)}
+}
+
+// LogIterator iterates over the pages of a filter query, preserving the order
+// in which the logs were emitted on chain.
+type LogIterator struct {
+	ec       *Client
+	ctx      context.Context
+	query    siotchain.FilterQuery
+	pageSize int
+
+	next, last uint64 // Block range still to be queried
+	span       uint64 // Number of blocks to request in the next call
+	started    bool   // Whether the block range has been resolved
+	logs       []localEnv.Log
+	err        error
+}
+
+// Next retrieves the next non-empty page of logs, returning false once the
+// block range is exhausted or an error occurred.
+func (it *LogIterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	if !it.started {
+		if it.err = it.resolveRange(); it.err != nil {
+			return false
+		}
+		it.started = true
+	}
+	for it.next <= it.last {
+		to := it.next + it.span - 1
+		if to > it.last || to < it.next {
+			to = it.last
+		}
+		q := it.query
+		q.FromBlock, q.ToBlock = new(big.Int).SetUint64(it.next), new(big.Int).SetUint64(to)
+
+		logs, err := it.ec.FilterLogs(it.ctx, q)
+		if err != nil {
+			it.err = err
+			return false
+		}
+		// Shrink the window and retry if the page is too large, unless it is
+		// a single block that cannot be split any further
+		if len(logs) > it.pageSize && to > it.next {
+			it.span = (to - it.next + 1) / 2
+			continue
+		}
+		// Widen the window for sparse ranges to reduce the number of calls
+		if len(logs) < it.pageSize/2 && to-it.next+1 == it.span {
+			it.span *= 2
+		}
+		it.next = to + 1
+		if it.next == 0 {
+			it.last, it.next = 0, 1 // Overflow, range exhausted
+		}
+		if len(logs) > 0 {
+			it.logs = logs
+			return true
+		}
+	}
+	it.logs = nil
+	return false
+}
+
+// resolveRange converts the query's block boundaries into concrete numbers. A
+// nil boundary stands for the current head, as it does for siot_getLogs.
+func (it *LogIterator) resolveRange() error {
+	if it.query.FromBlock == nil || it.query.ToBlock == nil {
+		head, err := it.ec.HeaderByNumber(it.ctx, nil)
+		if err != nil {
+			return err
+		}
+		it.next, it.last = head.Number.Uint64(), head.Number.Uint64()
+	}
+	if it.query.FromBlock != nil {
+		it.next = it.query.FromBlock.Uint64()
+	}
+	if it.query.ToBlock != nil {
+		it.last = it.query.ToBlock.Uint64()
+	}
+	return nil
+}
+
+// Logs returns the current page of logs.
+func (it *LogIterator) Logs() []localEnv.Log {
+	return it.logs
+}
+
+// Err returns the error that stopped the iteration, if any.
+func (it *LogIterator) Err() error {
+	return it.err
 }
 
 func toFilterArg(q siotchain.FilterQuery) interface{} {
@@ -355,21 +811,49 @@ func toFilterArg(q siotchain.FilterQuery) interface{} {
 // PendingBalanceAt returns the wei balance of the given account in the pending state.
 func (ec *Client) PendingBalanceAt(ctx context.Context, account helper.Address) (*big.Int, error) {
 	var result rpc.HexNumber
-	err := ec.c.CallContext(ctx, &result, "siot_getBalance", account, "pending")
+	err := ec.call(ctx, &result, "siot_getBalance", account, "pending")
 	return (*big.Int)(&result), err
 }
 
+// PendingBalancesAt returns the wei balances of the given accounts in the pending
+// state, retrieved in a single batch request and returned in input order.
+func (ec *Client) PendingBalancesAt(ctx context.Context, accounts []helper.Address) ([]*big.Int, error) {
+	results := make([]rpc.HexNumber, len(accounts))
+	reqs := make([]rpc.BatchElem, len(accounts))
+	for i, account := range accounts {
+		reqs[i] = rpc.BatchElem{
+			Method: "siot_getBalance",
+			Args:   []interface{}{account, "pending"},
+			Result: &results[i],
+		}
+	}
+	if len(reqs) == 0 {
+		return []*big.Int{}, nil
+	}
+	if err := ec.batchCall(ctx, reqs); err != nil {
+		return nil, err
+	}
+	balances := make([]*big.Int, len(accounts))
+	for i := range reqs {
+		if reqs[i].Error != nil {
+			return nil, fmt.Errorf("balance of %x: %v", accounts[i], reqs[i].Error)
+		}
+		balances[i] = (*big.Int)(&results[i])
+	}
+	return balances, nil
+}
+
 // PendingStorageAt returns the value of key in the externalLogic storage of the given account in the pending state.
 func (ec *Client) PendingStorageAt(ctx context.Context, account helper.Address, key helper.Hash) ([]byte, error) {
 	var result rpc.HexBytes
-	err := ec.c.CallContext(ctx, &result, "siot_getStorageAt", account, key, "pending")
+	err := ec.call(ctx, &result, "siot_getStorageAt", account, key, "pending")
 	return result, err
 }
 
 // PendingCodeAt returns the externalLogic code of the given account in the pending state.
 func (ec *Client) PendingCodeAt(ctx context.Context, account helper.Address) ([]byte, error) {
 	var result rpc.HexBytes
-	err := ec.c.CallContext(ctx, &result, "siot_getCode", account, "pending")
+	err := ec.call(ctx, &result, "siot_getCode", account, "pending")
 	return result, err
 }
 
@@ -377,14 +861,14 @@ func (ec *Client) PendingCodeAt(ctx context.Context, account helper.Address) ([]
 // This is the nonce that should be used for the next transaction.
 func (ec *Client) PendingNonceAt(ctx context.Context, account helper.Address) (uint64, error) {
 	var result rpc.HexNumber
-	err := ec.c.CallContext(ctx, &result, "siot_getTransactionCount", account, "pending")
+	err := ec.call(ctx, &result, "siot_getTransactionCount", account, "pending")
 	return result.Uint64(), err
 }
 
 // PendingTransactionCount returns the total number of transactions in the pending state.
 func (ec *Client) PendingTransactionCount(ctx context.Context) (uint, error) {
 	var num rpc.HexNumber
-	err := ec.c.CallContext(ctx, &num, "siot_getBlockTransactionCountByNumber", "pending")
+	err := ec.call(ctx, &num, "siot_getBlockTransactionCountByNumber", "pending")
 	return num.Uint(), err
 }
 
@@ -400,7 +884,7 @@ func (ec *Client) PendingTransactionCount(ctx context.Context) (uint, error) {
 // blocks might not be available.
 func (ec *Client) CallExternalLogic(ctx context.Context, msg siotchain.CallMsg, blockNumber *big.Int) ([]byte, error) {
 	var hex string
-	err := ec.c.CallContext(ctx, &hex, "siot_call", toCallArg(msg), toBlockNumArg(blockNumber))
+	err := ec.call(ctx, &hex, "siot_call", toCallArg(msg), toBlockNumArg(blockNumber))
 	if err != nil {
 		return nil, err
 	}
@@ -411,7 +895,7 @@ func (ec *Client) CallExternalLogic(ctx context.Context, msg siotchain.CallMsg,
 // The state seen by the externalLogic call is the pending state.
 func (ec *Client) PendingCallExternalLogic(ctx context.Context, msg siotchain.CallMsg) ([]byte, error) {
 	var hex string
-	err := ec.c.CallContext(ctx, &hex, "siot_call", toCallArg(msg), "pending")
+	err := ec.call(ctx, &hex, "siot_call", toCallArg(msg), "pending")
 	if err != nil {
 		return nil, err
 	}
@@ -422,7 +906,7 @@ func (ec *Client) PendingCallExternalLogic(ctx context.Context, msg siotchain.Ca
 // execution of a transaction.
 func (ec *Client) SuggestGasPrice(ctx context.Context) (*big.Int, error) {
 	var hex rpc.HexNumber
-	if err := ec.c.CallContext(ctx, &hex, "siot_gasPrice"); err != nil {
+	if err := ec.call(ctx, &hex, "siot_gasPrice"); err != nil {
 		return nil, err
 	}
 	return (*big.Int)(&hex), nil
@@ -434,7 +918,54 @@ func (ec *Client) SuggestGasPrice(ctx context.Context) (*big.Int, error) {
 // but it should provide a basis for setting a reasonable default.
 func (ec *Client) EstimateGas(ctx context.Context, msg siotchain.CallMsg) (*big.Int, error) {
 	var hex rpc.HexNumber
-	err := ec.c.CallContext(ctx, &hex, "siot_estimateGas", toCallArg(msg))
+	err := ec.call(ctx, &hex, "siot_estimateGas", toCallArg(msg))
+	if err != nil {
+		return nil, err
+	}
+	return (*big.Int)(&hex), nil
+}
+
+// AccountOverride replaces fields of an account for the duration of a single gas
+// estimation. Nil fields keep their value from the pending state.
+type AccountOverride struct {
+	Balance *big.Int
+	Nonce   *uint64
+	Code    []byte
+	State   map[helper.Hash]helper.Hash
+}
+
+// MarshalJSON encodes the override in the hex format expected by the node.
+func (o AccountOverride) MarshalJSON() ([]byte, error) {
+	enc := make(map[string]interface{})
+	if o.Balance != nil {
+		enc["balance"] = fmt.Sprintf("%#x", o.Balance)
+	}
+	if o.Nonce != nil {
+		enc["nonce"] = fmt.Sprintf("%#x", *o.Nonce)
+	}
+	if o.Code != nil {
+		enc["code"] = fmt.Sprintf("%#x", o.Code)
+	}
+	if len(o.State) > 0 {
+		state := make(map[string]string, len(o.State))
+		for key, value := range o.State {
+			state[key.Hex()] = value.Hex()
+		}
+		enc["state"] = state
+	}
+	return json.Marshal(enc)
+}
+
+// EstimateGasWithOverrides is like EstimateGas, but executes the call against the
+// pending state with the given accounts overridden. This allows estimating calls
+// into contracts which are not deployed yet, or from accounts lacking the funds.
+func (ec *Client) EstimateGasWithOverrides(ctx context.Context, msg siotchain.CallMsg, overrides map[helper.Address]AccountOverride) (*big.Int, error) {
+	diff := make(map[string]AccountOverride, len(overrides))
+	for addr, account := range overrides {
+		diff[addr.Hex()] = account
+	}
+	var hex rpc.HexNumber
+	err := ec.call(ctx, &hex, "siot_estimateGas", toCallArg(msg), diff)
 	if err != nil {
 		return nil, err
 	}
@@ -450,7 +981,51 @@ func (ec *Client) SendTransaction(ctx context.Context, tx *types.Transaction) er
 	if err != nil {
 		return err
 	}
-	return ec.c.CallContext(ctx, nil, "siot_sendRawTransaction", helper.ToHex(data))
+	return ec.call(ctx, nil, "siot_sendRawTransaction", helper.ToHex(data))
+}
+
+// receiptPollInterval is the delay between two receipt lookups performed by
+// SendTransactionAndWait.
+const receiptPollInterval = time.Second
+
+// TxWaitError is returned by SendTransactionAndWait if no receipt could be
+// obtained. It tells apart transactions rejected on submission from the ones
+// that were accepted but not mined before the context expired.
+type TxWaitError struct {
+	Hash      helper.Hash // Hash of the transaction
+	Submitted bool        // Whether the node accepted the transaction
+	Err       error       // Submission error or context error
+}
+
+func (e *TxWaitError) Error() string {
+	if !e.Submitted {
+		return fmt.Sprintf("failed to submit transaction %x: %v", e.Hash[:4], e.Err)
+	}
+	return fmt.Sprintf("timed out waiting for transaction %x to be mined: %v", e.Hash[:4], e.Err)
+}
+
+// SendTransactionAndWait injects a signed transaction into the pending pool and
+// blocks until it is mined, returning its receipt. Failures to look up the
+// receipt are retried until the context is cancelled, so callers should supply
+// a context with a deadline. Any error returned is a *TxWaitError.
+func (ec *Client) SendTransactionAndWait(ctx context.Context, tx *types.Transaction) (*types.Receipt, error) {
+	hash := tx.Hash()
+	if err := ec.SendTransaction(ctx, tx); err != nil {
+		return nil, &TxWaitError{Hash: hash, Err: err}
+	}
+	ticker := time.NewTicker(receiptPollInterval)
+	defer ticker.Stop()
+
+	for {
+		if receipt, err := ec.TransactionReceipt(ctx, hash); err == nil && receipt != nil {
+			return receipt, nil
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return nil, &TxWaitError{Hash: hash, Submitted: true, Err: ctx.Err()}
+		}
+	}
 }
 
 func toCallArg(msg siotchain.CallMsg) interface{} {
@@ -0,0 +1,216 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/siotchain/siot/blockchainCore/types"
+	"github.com/siotchain/siot/helper"
+	"github.com/siotchain/siot/net/rpc"
+	"golang.org/x/net/context"
+)
+
+// TestNetAPI is a minimal net namespace answering the liveness probe.
+type TestNetAPI struct{}
+
+func (TestNetAPI) Version() string { return "1" }
+
+func newTestClient(t *testing.T) *Client {
+	server := rpc.NewServer()
+	if err := server.RegisterName("net", TestNetAPI{}); err != nil {
+		t.Fatalf("failed to register net API: %v", err)
+	}
+	return NewClient(rpc.DialInProc(server))
+}
+
+// Tests that a closed client reports itself disconnected and fails every call
+// with a clear error instead of panicking.
+func TestClientCallAfterClose(t *testing.T) {
+	ec := newTestClient(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if !ec.IsConnected(ctx) {
+		t.Fatalf("open client reported disconnected")
+	}
+	ec.Close()
+	ec.Close() // closing twice must be harmless
+
+	if ec.IsConnected(ctx) {
+		t.Errorf("closed client reported connected")
+	}
+	if _, err := ec.HeaderByNumber(ctx, nil); err != rpc.ErrClientQuit {
+		t.Errorf("call error mismatch: have %v, want %v", err, rpc.ErrClientQuit)
+	}
+	if _, err := ec.SubscribeNewHead(ctx, make(chan *types.Header)); err != rpc.ErrClientQuit {
+		t.Errorf("subscription error mismatch: have %v, want %v", err, rpc.ErrClientQuit)
+	}
+}
+
+// TestSiotAPI is a mock siot namespace announcing the heads fed to it and
+// serving the blocks it knows of.
+type TestSiotAPI struct {
+	heads    chan *types.Header
+	blocks   map[helper.Hash]*types.Header
+	txCounts map[rpc.BlockNumber]int
+}
+
+func (api *TestSiotAPI) NewHeads(ctx context.Context) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+	rpcSub := notifier.CreateSubscription()
+
+	go func() {
+		for {
+			select {
+			case head := <-api.heads:
+				notifier.Notify(rpcSub.ID, head)
+			case <-rpcSub.Err():
+				return
+			case <-notifier.Closed():
+				return
+			}
+		}
+	}()
+	return rpcSub, nil
+}
+
+func (api *TestSiotAPI) GetBlockByHash(hash helper.Hash, fullTx bool) (map[string]interface{}, error) {
+	header, ok := api.blocks[hash]
+	if !ok {
+		return nil, errors.New("unknown block")
+	}
+	blob, err := json.Marshal(header)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(blob, &fields); err != nil {
+		return nil, err
+	}
+	fields["hash"] = hash
+	fields["transactions"] = []interface{}{}
+	fields["uncles"] = []interface{}{}
+	return fields, nil
+}
+
+func (api *TestSiotAPI) GetBlockTransactionCountByNumber(number rpc.BlockNumber) *rpc.HexNumber {
+	if count, ok := api.txCounts[number]; ok {
+		return rpc.NewHexNumber(count)
+	}
+	return nil
+}
+
+// testHeader creates an empty block header with the given number.
+func testHeader(number int64) *types.Header {
+	return &types.Header{
+		UncleHash:  types.EmptyUncleHash,
+		TxHash:     types.EmptyRootHash,
+		Difficulty: big.NewInt(1),
+		Number:     big.NewInt(number),
+		GasLimit:   big.NewInt(3141592),
+		GasUsed:    new(big.Int),
+		Time:       big.NewInt(number),
+		Extra:      []byte{},
+	}
+}
+
+// Tests that the block subscription delivers the full block of every announced
+// head, skipping the ones that can't be fetched without ending the subscription.
+func TestSubscribeNewBlock(t *testing.T) {
+	var (
+		first   = testHeader(1)
+		missing = testHeader(2)
+		second  = testHeader(3)
+	)
+	api := &TestSiotAPI{
+		heads:  make(chan *types.Header),
+		blocks: map[helper.Hash]*types.Header{first.Hash(): first, second.Hash(): second},
+	}
+	server := rpc.NewServer()
+	if err := server.RegisterName("net", TestNetAPI{}); err != nil {
+		t.Fatalf("failed to register net API: %v", err)
+	}
+	if err := server.RegisterName("siot", api); err != nil {
+		t.Fatalf("failed to register siot API: %v", err)
+	}
+	ec := NewClient(rpc.DialInProc(server))
+	defer ec.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	blocks := make(chan *types.Block)
+	sub, err := ec.SubscribeNewBlock(ctx, blocks)
+	if err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+	// Notifications are dropped until the subscription is activated, which the
+	// server does right after replying; a round trip makes sure it's done
+	if !ec.IsConnected(ctx) {
+		t.Fatalf("client disconnected")
+	}
+	go func() {
+		for _, head := range []*types.Header{first, missing, second} {
+			api.heads <- head
+		}
+	}()
+	for _, want := range []*types.Header{first, second} {
+		select {
+		case block := <-blocks:
+			if block.Hash() != want.Hash() {
+				t.Errorf("block mismatch: have #%v [%x], want #%v [%x]", block.Number(), block.Hash(), want.Number, want.Hash())
+			}
+		case err := <-sub.Err():
+			t.Fatalf("subscription failed: %v", err)
+		case <-ctx.Done():
+			t.Fatalf("block #%v not delivered", want.Number)
+		}
+	}
+	sub.Unsubscribe()
+	if _, ok := <-sub.Err(); ok {
+		t.Errorf("error channel not closed on unsubscribe")
+	}
+}
+
+// Tests that transaction counts are requested by block number, nil selecting the
+// latest block and rpc.PendingBlockNumber the pending one.
+func TestTransactionCountByNumber(t *testing.T) {
+	api := &TestSiotAPI{
+		txCounts: map[rpc.BlockNumber]int{5: 3, rpc.LatestBlockNumber: 7, rpc.PendingBlockNumber: 9},
+	}
+	server := rpc.NewServer()
+	if err := server.RegisterName("siot", api); err != nil {
+		t.Fatalf("failed to register siot API: %v", err)
+	}
+	ec := NewClient(rpc.DialInProc(server))
+	defer ec.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tests := []struct {
+		number *big.Int
+		count  uint
+	}{
+		{big.NewInt(5), 3},
+		{nil, 7},
+		{big.NewInt(int64(rpc.PendingBlockNumber)), 9},
+	}
+	for _, tt := range tests {
+		count, err := ec.TransactionCountByNumber(ctx, tt.number)
+		if err != nil {
+			t.Errorf("block %v: failed to retrieve count: %v", tt.number, err)
+			continue
+		}
+		if count != tt.count {
+			t.Errorf("block %v: count mismatch: have %d, want %d", tt.number, count, tt.count)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/siotchain/siot/blockchainCore/localEnv"
+	"github.com/siotchain/siot/crypto"
+	"github.com/siotchain/siot/helper"
+)
+
+// DecodedLog is a log entry matched against an event of an externalLogic ABI,
+// with its indexed topics and data decoded into named values.
+//
+// Values are represented as helper.Address for addresses, *big.Int for integers,
+// bool for booleans, []byte for fixed and dynamic byte arrays and string for
+// strings. Indexed dynamic values can't be recovered from a log, so these are
+// given as the helper.Hash stored in their topic.
+type DecodedLog struct {
+	Event  string                 // Name of the matched event
+	Fields map[string]interface{} // Decoded event parameters, keyed by name
+	Log    localEnv.Log           // Raw log entry
+}
+
+// abiEvent is an event definition of an externalLogic ABI.
+type abiEvent struct {
+	Type      string `json:"type"`
+	Name      string `json:"name"`
+	Anonymous bool   `json:"anonymous"`
+	Inputs    []struct {
+		Name    string `json:"name"`
+		Type    string `json:"type"`
+		Indexed bool   `json:"indexed"`
+	} `json:"inputs"`
+}
+
+// DecodeLogs matches the logs against the events defined in the JSON ABI of an
+// externalLogic, decoding the parameters of every matching one. Logs whose first
+// topic is not the signature of any (non-anonymous) event in the ABI are
+// skipped. Only elementary parameter types are supported; arrays and tuples
+// result in an error.
+func DecodeLogs(logs []localEnv.Log, abiJSON string) ([]DecodedLog, error) {
+	var defs []abiEvent
+	if err := json.Unmarshal([]byte(abiJSON), &defs); err != nil {
+		return nil, fmt.Errorf("invalid ABI: %v", err)
+	}
+	events := make(map[helper.Hash]abiEvent)
+	for _, def := range defs {
+		if def.Type != "event" || def.Anonymous {
+			continue
+		}
+		types := make([]string, len(def.Inputs))
+		for i, input := range def.Inputs {
+			types[i] = canonicalType(input.Type)
+		}
+		sig := fmt.Sprintf("%s(%s)", def.Name, strings.Join(types, ","))
+		events[crypto.Keccak256Hash([]byte(sig))] = def
+	}
+	decoded := make([]DecodedLog, 0, len(logs))
+	for _, log := range logs {
+		if len(log.Topics) == 0 {
+			continue
+		}
+		event, ok := events[log.Topics[0]]
+		if !ok {
+			continue
+		}
+		fields, err := decodeEvent(event, log)
+		if err != nil {
+			return nil, fmt.Errorf("log %d of tx %x: event %s: %v", log.Index, log.TxHash, event.Name, err)
+		}
+		decoded = append(decoded, DecodedLog{Event: event.Name, Fields: fields, Log: log})
+	}
+	return decoded, nil
+}
+
+// decodeEvent decodes the parameters of an event from the topics and data of
+// a log entry.
+func decodeEvent(event abiEvent, log localEnv.Log) (map[string]interface{}, error) {
+	fields := make(map[string]interface{}, len(event.Inputs))
+	topic, head := 1, 0
+	for i, input := range event.Inputs {
+		name := input.Name
+		if name == "" {
+			name = strconv.Itoa(i)
+		}
+		typ := canonicalType(input.Type)
+		if input.Indexed {
+			if topic >= len(log.Topics) {
+				return nil, fmt.Errorf("missing topic for %s", name)
+			}
+			if typ == "string" || typ == "bytes" {
+				fields[name] = log.Topics[topic]
+			} else {
+				value, err := decodeWord(typ, log.Topics[topic].Bytes())
+				if err != nil {
+					return nil, err
+				}
+				fields[name] = value
+			}
+			topic++
+			continue
+		}
+		if len(log.Data) < head+32 {
+			return nil, fmt.Errorf("data too short for %s", name)
+		}
+		word := log.Data[head : head+32]
+		head += 32
+
+		var (
+			value interface{}
+			err   error
+		)
+		if typ == "string" || typ == "bytes" {
+			value, err = decodeDynamic(typ, log.Data, word)
+		} else {
+			value, err = decodeWord(typ, word)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		fields[name] = value
+	}
+	return fields, nil
+}
+
+// canonicalType expands the type aliases of the ABI to the form used in event
+// signatures.
+func canonicalType(typ string) string {
+	switch typ {
+	case "uint":
+		return "uint256"
+	case "int":
+		return "int256"
+	}
+	return typ
+}
+
+// decodeWord decodes a static value from its 32 byte ABI encoding.
+func decodeWord(typ string, word []byte) (interface{}, error) {
+	switch {
+	case typ == "address":
+		return helper.BytesToAddress(word[12:]), nil
+	case typ == "bool":
+		return word[31] != 0, nil
+	case strings.HasPrefix(typ, "uint"):
+		return new(big.Int).SetBytes(word), nil
+	case strings.HasPrefix(typ, "int"):
+		value := new(big.Int).SetBytes(word)
+		if word[0]&0x80 != 0 {
+			value.Sub(value, new(big.Int).Lsh(big.NewInt(1), 256))
+		}
+		return value, nil
+	case strings.HasPrefix(typ, "bytes"):
+		size, err := strconv.Atoi(typ[len("bytes"):])
+		if err != nil || size < 1 || size > 32 {
+			return nil, fmt.Errorf("unsupported type %s", typ)
+		}
+		return helper.CopyBytes(word[:size]), nil
+	}
+	return nil, fmt.Errorf("unsupported type %s", typ)
+}
+
+// decodeDynamic decodes a string or byte array whose offset into the data is
+// given by the head word.
+func decodeDynamic(typ string, data []byte, word []byte) (interface{}, error) {
+	offset := new(big.Int).SetBytes(word)
+	if !offset.IsUint64() || uint64(len(data)) < 32 || offset.Uint64() > uint64(len(data))-32 {
+		return nil, fmt.Errorf("offset %v out of bounds", offset)
+	}
+	start := offset.Uint64() + 32
+	size := new(big.Int).SetBytes(data[offset.Uint64():start])
+	if !size.IsUint64() || size.Uint64() > uint64(len(data))-start {
+		return nil, fmt.Errorf("length %v out of bounds", size)
+	}
+	content := helper.CopyBytes(data[start : start+size.Uint64()])
+	if typ == "string" {
+		return string(content), nil
+	}
+	return content, nil
+}
@@ -0,0 +1,87 @@
+package client
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/siotchain/siot/blockchainCore/localEnv"
+	"github.com/siotchain/siot/crypto"
+	"github.com/siotchain/siot/helper"
+)
+
+const testTokenABI = `[
+	{"type": "function", "name": "transfer", "inputs": [{"name": "to", "type": "address"}, {"name": "value", "type": "uint256"}]},
+	{"type": "event", "name": "Transfer", "inputs": [
+		{"name": "from", "type": "address", "indexed": true},
+		{"name": "to", "type": "address", "indexed": true},
+		{"name": "value", "type": "uint256", "indexed": false}
+	]},
+	{"type": "event", "name": "Memo", "inputs": [
+		{"name": "id", "type": "uint", "indexed": true},
+		{"name": "text", "type": "string", "indexed": false}
+	]}
+]`
+
+// Tests that logs are decoded against the events of an ABI, skipping those not
+// emitted by any of them.
+func TestDecodeLogs(t *testing.T) {
+	var (
+		from = helper.HexToAddress("0x00000000000000000000000000000000000000aa")
+		to   = helper.HexToAddress("0x00000000000000000000000000000000000000bb")
+	)
+	transfer := localEnv.Log{
+		Topics: []helper.Hash{
+			helper.HexToHash("0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"), // Transfer(address,address,uint256)
+			helper.BytesToHash(from.Bytes()),
+			helper.BytesToHash(to.Bytes()),
+		},
+		Data: helper.LeftPadBytes(big.NewInt(1000).Bytes(), 32),
+	}
+	unknown := localEnv.Log{
+		Topics: []helper.Hash{helper.HexToHash("0x01")},
+	}
+	memo := localEnv.Log{
+		Topics: []helper.Hash{
+			crypto.Keccak256Hash([]byte("Memo(uint256,string)")),
+			helper.BigToHash(big.NewInt(7)),
+		},
+	}
+	// String data: offset of the content, its length and the padded content
+	memo.Data = append(memo.Data, helper.LeftPadBytes([]byte{0x20}, 32)...)
+	memo.Data = append(memo.Data, helper.LeftPadBytes([]byte{5}, 32)...)
+	memo.Data = append(memo.Data, helper.RightPadBytes([]byte("hello"), 32)...)
+
+	decoded, err := DecodeLogs([]localEnv.Log{transfer, unknown}, testTokenABI)
+	if err != nil {
+		t.Fatalf("failed to decode logs: %v", err)
+	}
+	if len(decoded) != 1 {
+		t.Fatalf("decoded log count mismatch: have %d, want 1", len(decoded))
+	}
+	if event := decoded[0].Event; event != "Transfer" {
+		t.Errorf("event mismatch: have %s, want Transfer", event)
+	}
+	fields := decoded[0].Fields
+	if fields["from"] != from || fields["to"] != to {
+		t.Errorf("indexed fields mismatch: have %v -> %v, want %x -> %x", fields["from"], fields["to"], from, to)
+	}
+	if value, ok := fields["value"].(*big.Int); !ok || value.Cmp(big.NewInt(1000)) != 0 {
+		t.Errorf("value mismatch: have %v, want 1000", fields["value"])
+	}
+	// Dynamic data must be decoded through its offset, with uint aliases expanded
+	decoded, err = DecodeLogs([]localEnv.Log{memo}, testTokenABI)
+	if err != nil {
+		t.Fatalf("failed to decode memo: %v", err)
+	}
+	if len(decoded) != 1 || decoded[0].Fields["text"] != "hello" {
+		t.Fatalf("memo mismatch: have %v, want hello", decoded)
+	}
+	if id, ok := decoded[0].Fields["id"].(*big.Int); !ok || id.Int64() != 7 {
+		t.Errorf("memo id mismatch: have %v, want 7", decoded[0].Fields["id"])
+	}
+	// Truncated data must be rejected
+	transfer.Data = transfer.Data[:16]
+	if _, err := DecodeLogs([]localEnv.Log{transfer}, testTokenABI); err == nil {
+		t.Errorf("truncated log decoded")
+	}
+}
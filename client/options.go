@@ -0,0 +1,132 @@
+package client
+
+import (
+	"io"
+	"net"
+	"time"
+
+	"github.com/siotchain/siot/net/rpc"
+	"golang.org/x/net/context"
+)
+
+// ClientOptions configures the timeout and retry policy of a Client. The zero
+// value disables both, matching the behaviour of Dial.
+type ClientOptions struct {
+	Timeout    time.Duration // Maximum duration of a single call attempt (0 = no limit)
+	MaxRetries int           // Number of times a failed read call is retried
+	Backoff    time.Duration // Delay before the first retry, doubled after each attempt
+}
+
+// retryableMethods are the read-only RPC methods that may be safely retried on
+// transport failures. Calls that modify state on the node, such as sending a
+// transaction, unlocking an account or controlling the miner, are never retried
+// as the failed attempt might have reached the server nonetheless.
+var retryableMethods = map[string]bool{
+	"siot_getBlockByHash":                    true,
+	"siot_getBlockByNumber":                  true,
+	"siot_getUncleByBlockHashAndIndex":       true,
+	"siot_getTransactionByHash":              true,
+	"siot_getTransactionByBlockHashAndIndex": true,
+	"siot_getBlockTransactionCountByHash":    true,
+	"siot_getBlockTransactionCountByNumber":  true,
+	"siot_getTransactionReceipt":             true,
+	"siot_syncing":                           true,
+	"siot_getBalance":                        true,
+	"siot_getBalanceByHash":                  true,
+	"siot_getStorageAt":                      true,
+	"siot_getCode":                           true,
+	"siot_getStorageAtByHash":                true,
+	"siot_getCodeByHash":                     true,
+	"siot_getTransactionCount":               true,
+	"siot_getNonceGaps":                      true,
+	"siot_getLogs":                           true,
+	"siot_call":                              true,
+	"siot_estimateGas":                       true,
+	"siot_gasPrice":                          true,
+	"manage_nodeInfo":                        true,
+	"manage_peers":                           true,
+	"user_listAccounts":                      true,
+}
+
+// DialWithOptions connects a client to the given URL, applying the given timeout
+// and retry policy to all calls. Only the methods in retryableMethods are ever
+// retried; subscriptions are subject to neither timeouts nor retries.
+func DialWithOptions(rawurl string, opts ClientOptions) (*Client, error) {
+	c, err := rpc.Dial(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{c: c, opts: opts}, nil
+}
+
+// call invokes an RPC method, enforcing the configured per-attempt timeout and
+// retrying read-only methods that failed due to transport errors.
+func (ec *Client) call(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+	if ec.isClosed() {
+		return rpc.ErrClientQuit
+	}
+	return ec.retry(ctx, retryableMethods[method], func(ctx context.Context) error {
+		return ec.c.CallContext(ctx, result, method, args...)
+	})
+}
+
+// batchCall sends a batch of requests like call, retrying the whole batch only
+// if every request in it is read-only.
+func (ec *Client) batchCall(ctx context.Context, reqs []rpc.BatchElem) error {
+	if ec.isClosed() {
+		return rpc.ErrClientQuit
+	}
+	retryable := true
+	for _, req := range reqs {
+		retryable = retryable && retryableMethods[req.Method]
+	}
+	return ec.retry(ctx, retryable, func(ctx context.Context) error {
+		return ec.c.BatchCallContext(ctx, reqs)
+	})
+}
+
+// retry runs a call attempt with the configured timeout, repeating it with an
+// exponential backoff as long as it is allowed to and the failure is transient.
+func (ec *Client) retry(ctx context.Context, retryable bool, attempt func(context.Context) error) error {
+	backoff := ec.opts.Backoff
+	for i := 0; ; i++ {
+		err := ec.attempt(ctx, attempt)
+		if err == nil || !retryable || i >= ec.opts.MaxRetries || !isTransient(ctx, err) {
+			return err
+		}
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		backoff *= 2
+	}
+}
+
+// attempt runs a single call attempt, bounded by the configured timeout.
+func (ec *Client) attempt(ctx context.Context, attempt func(context.Context) error) error {
+	if ec.opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, ec.opts.Timeout)
+		defer cancel()
+	}
+	return attempt(ctx)
+}
+
+// isTransient reports whether a call failed due to the transport rather than
+// being rejected by the server, and may thus succeed if repeated. Timeouts of
+// a single attempt count as transient, cancellation of the caller's context not.
+func isTransient(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if _, ok := err.(rpc.Error); ok {
+		return false // the server responded with an error
+	}
+	switch err {
+	case context.DeadlineExceeded, io.EOF, io.ErrUnexpectedEOF:
+		return true
+	}
+	_, ok := err.(net.Error)
+	return ok
+}
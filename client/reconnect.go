@@ -0,0 +1,347 @@
+package client
+
+import (
+	"errors"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/siotchain/siot"
+	"github.com/siotchain/siot/blockchainCore/localEnv"
+	"github.com/siotchain/siot/blockchainCore/types"
+	"github.com/siotchain/siot/helper"
+	"golang.org/x/net/context"
+)
+
+const (
+	reconnectMinDelay = time.Second      // Initial delay between two redial attempts
+	reconnectMaxDelay = 30 * time.Second // Maximum delay between two redial attempts
+	logDedupBlocks    = 16               // Blocks below the latest one whose delivered logs are remembered
+)
+
+// ErrReconnectClosed is delivered on the error channel of the subscriptions of
+// a ReconnectingClient once it is closed.
+var ErrReconnectClosed = errors.New("reconnecting client closed")
+
+// ReconnectEvent is sent on the status channel of a ReconnectingClient every
+// time a subscription recovered from a connection loss.
+type ReconnectEvent struct {
+	Err       error         // Error that terminated the previous subscription
+	LastBlock uint64        // Number of the last block seen before the failure
+	Downtime  time.Duration // Time it took to re-establish the subscription
+}
+
+// ReconnectingClient wraps a Client, re-dialing the endpoint and restoring the
+// subscriptions whenever the underlying connection is lost.
+type ReconnectingClient struct {
+	url    string
+	client *Client
+	status chan ReconnectEvent
+	closed chan struct{} // Closed by Close, stops any further redial
+	once   sync.Once
+	lock   sync.Mutex
+}
+
+// DialReconnecting connects to the given URL, returning a client whose
+// subscriptions survive connection failures.
+func DialReconnecting(rawurl string) (*ReconnectingClient, error) {
+	c, err := Dial(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	return &ReconnectingClient{
+		url:    rawurl,
+		client: c,
+		status: make(chan ReconnectEvent, 16),
+		closed: make(chan struct{}),
+	}, nil
+}
+
+// Client returns the currently connected client, to be used for plain calls.
+func (rc *ReconnectingClient) Client() *Client {
+	rc.lock.Lock()
+	defer rc.lock.Unlock()
+
+	return rc.client
+}
+
+// Status returns the channel on which reconnection events are reported. Events
+// are dropped if the channel is not drained.
+func (rc *ReconnectingClient) Status() <-chan ReconnectEvent {
+	return rc.status
+}
+
+// Close terminates the current connection for good. The subscriptions are not
+// restored anymore, but end with ErrReconnectClosed.
+func (rc *ReconnectingClient) Close() {
+	rc.once.Do(func() { close(rc.closed) })
+
+	rc.lock.Lock()
+	defer rc.lock.Unlock()
+
+	rc.client.c.Close()
+}
+
+// redial replaces the failed client with a fresh connection, unless another
+// subscription already did so or the client was closed.
+func (rc *ReconnectingClient) redial(failed *Client) (*Client, error) {
+	rc.lock.Lock()
+	defer rc.lock.Unlock()
+
+	select {
+	case <-rc.closed:
+		return nil, ErrReconnectClosed
+	default:
+	}
+	if rc.client != failed {
+		return rc.client, nil
+	}
+	c, err := Dial(rc.url)
+	if err != nil {
+		return nil, err
+	}
+	failed.c.Close()
+	rc.client = c
+	return c, nil
+}
+
+// SubscribeNewHead subscribes to notifications about the current blockchain
+// head. After a reconnection, the headers of the blocks missed while offline
+// are delivered before the live notifications resume.
+func (rc *ReconnectingClient) SubscribeNewHead(ctx context.Context, ch chan<- *types.Header) (siotchain.Subscription, error) {
+	var (
+		sub   = newReconnectingSub()
+		heads = make(chan *types.Header)
+		last  *big.Int
+	)
+	subscribe := func(c *Client) (siotchain.Subscription, error) {
+		s, err := c.SubscribeNewHead(ctx, heads)
+		if err != nil || last == nil {
+			return s, err
+		}
+		// Replay the headers missed while disconnected
+		head, err := c.HeaderByNumber(ctx, nil)
+		if err != nil {
+			s.Unsubscribe()
+			return nil, err
+		}
+		for n := new(big.Int).Add(last, big.NewInt(1)); n.Cmp(head.Number) <= 0; n.Add(n, big.NewInt(1)) {
+			header, err := c.HeaderByNumber(ctx, n)
+			if err != nil {
+				s.Unsubscribe()
+				return nil, err
+			}
+			select {
+			case ch <- header:
+				last = header.Number
+			case <-sub.quit:
+				return s, nil
+			}
+		}
+		return s, nil
+	}
+	inner, err := subscribe(rc.Client())
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		defer sub.done()
+		for {
+			select {
+			case header := <-heads:
+				last = header.Number
+				select {
+				case ch <- header:
+				case <-sub.quit:
+					inner.Unsubscribe()
+					return
+				}
+			case err := <-inner.Err():
+				var lastBlock uint64
+				if last != nil {
+					lastBlock = last.Uint64()
+				}
+				if inner = rc.resubscribe(sub, err, lastBlock, subscribe); inner == nil {
+					sub.fail(ErrReconnectClosed)
+					return
+				}
+			case <-sub.quit:
+				inner.Unsubscribe()
+				return
+			}
+		}
+	}()
+	return sub, nil
+}
+
+// logKey identifies a delivered log.
+type logKey struct {
+	tx    helper.Hash
+	index uint
+}
+
+// SubscribeFilterLogs subscribes to the results of a streaming filter query.
+// After a reconnection, the logs emitted while offline are retrieved with a
+// regular filter query and delivered first. The replay starts at the last block
+// seen, as the connection may have been lost midway through its logs, and the
+// logs already delivered are skipped.
+func (rc *ReconnectingClient) SubscribeFilterLogs(ctx context.Context, q siotchain.FilterQuery, ch chan<- localEnv.Log) (siotchain.Subscription, error) {
+	var (
+		sub     = newReconnectingSub()
+		logs    = make(chan localEnv.Log)
+		last    uint64
+		started bool
+		seen    = make(map[logKey]uint64) // Logs delivered from the recent blocks
+	)
+	// deliver forwards a log unless it was already delivered, returning false if
+	// the subscription was cancelled meanwhile.
+	deliver := func(log localEnv.Log) bool {
+		key := logKey{log.TxHash, log.Index}
+		if _, ok := seen[key]; ok {
+			return true
+		}
+		select {
+		case ch <- log:
+		case <-sub.quit:
+			return false
+		}
+		seen[key] = log.BlockNumber
+		if log.BlockNumber > last || !started {
+			last, started = log.BlockNumber, true
+			for key, number := range seen {
+				if number+logDedupBlocks < last {
+					delete(seen, key)
+				}
+			}
+		}
+		return true
+	}
+	subscribe := func(c *Client) (siotchain.Subscription, error) {
+		s, err := c.SubscribeFilterLogs(ctx, q, logs)
+		if err != nil || !started {
+			return s, err
+		}
+		// Replay the logs missed while disconnected
+		replay := q
+		replay.FromBlock, replay.ToBlock = new(big.Int).SetUint64(last), nil
+		missed, err := c.FilterLogs(ctx, replay)
+		if err != nil {
+			s.Unsubscribe()
+			return nil, err
+		}
+		for _, log := range missed {
+			if !deliver(log) {
+				return s, nil
+			}
+		}
+		return s, nil
+	}
+	inner, err := subscribe(rc.Client())
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		defer sub.done()
+		for {
+			select {
+			case log := <-logs:
+				if !deliver(log) {
+					inner.Unsubscribe()
+					return
+				}
+			case err := <-inner.Err():
+				// Without any log seen, replay from the head at the time of failure
+				if !started {
+					if head, herr := rc.Client().HeaderByNumber(ctx, nil); herr == nil {
+						last, started = head.Number.Uint64(), true
+					}
+				}
+				if inner = rc.resubscribe(sub, err, last, subscribe); inner == nil {
+					sub.fail(ErrReconnectClosed)
+					return
+				}
+			case <-sub.quit:
+				inner.Unsubscribe()
+				return
+			}
+		}
+	}()
+	return sub, nil
+}
+
+// resubscribe keeps re-dialing the endpoint with an increasing delay until the
+// subscription can be re-established, reporting the recovery on the status
+// channel. It returns nil if the subscription was cancelled or the client was
+// closed meanwhile.
+func (rc *ReconnectingClient) resubscribe(sub *reconnectingSub, cause error, lastBlock uint64, subscribe func(*Client) (siotchain.Subscription, error)) siotchain.Subscription {
+	start, delay := time.Now(), reconnectMinDelay
+	for {
+		failed := rc.Client()
+		if c, err := rc.redial(failed); err == nil {
+			if s, err := subscribe(c); err == nil {
+				select {
+				case rc.status <- ReconnectEvent{Err: cause, LastBlock: lastBlock, Downtime: time.Since(start)}:
+				default:
+				}
+				return s
+			}
+		}
+		select {
+		case <-time.After(delay):
+		case <-sub.quit:
+			return nil
+		case <-rc.closed:
+			return nil
+		}
+		if delay *= 2; delay > reconnectMaxDelay {
+			delay = reconnectMaxDelay
+		}
+	}
+}
+
+// reconnectingSub is the subscription handle returned to callers, which stays
+// valid across reconnections until explicitly unsubscribed.
+type reconnectingSub struct {
+	quit     chan struct{}
+	finished chan struct{}
+	err      chan error
+	once     sync.Once
+}
+
+func newReconnectingSub() *reconnectingSub {
+	return &reconnectingSub{
+		quit:     make(chan struct{}),
+		finished: make(chan struct{}),
+		err:      make(chan error),
+	}
+}
+
+// Unsubscribe stops the delivery of events and waits for the forwarding loop
+// to exit.
+func (s *reconnectingSub) Unsubscribe() {
+	s.once.Do(func() {
+		close(s.quit)
+		<-s.finished
+		close(s.err)
+	})
+}
+
+// Err returns the error channel of the subscription. As connection failures
+// are recovered from, it only delivers ErrReconnectClosed once the client is
+// closed, and is closed by Unsubscribe.
+func (s *reconnectingSub) Err() <-chan error {
+	return s.err
+}
+
+// fail delivers the error ending the subscription, unless it is unsubscribed.
+func (s *reconnectingSub) fail(err error) {
+	select {
+	case s.err <- err:
+	case <-s.quit:
+	}
+}
+
+// done signals that the forwarding loop has exited.
+func (s *reconnectingSub) done() {
+	close(s.finished)
+}
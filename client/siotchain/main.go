@@ -13,6 +13,8 @@ import (
 	"github.com/siotchain/siot/blockchainCore"
 	"github.com/siotchain/siot/blockchainCore/state"
 	"github.com/siotchain/siot/siot"
+	"github.com/siotchain/siot/siot/downloader"
+	"github.com/siotchain/siot/subscribe"
 	"github.com/siotchain/siot/internal/debug"
 	"github.com/siotchain/siot/logger"
 	"github.com/siotchain/siot/logger/glog"
@@ -62,14 +64,41 @@ participating.
 		utils.PasswordFileFlag,
 		utils.BootnodesFlag,
 		utils.DataDirFlag,
+		utils.AncientDirFlag,
 		utils.KeyStoreDirFlag,
 		utils.OlympicFlag,
 		utils.FastSyncFlag,
+		utils.ReadOnlyFlag,
+		utils.ExitWhenSyncedFlag,
+		utils.TxPoolSimulateFlag,
+		utils.TxPoolLifetimeFlag,
+		utils.ImportTimeoutFlag,
+		utils.CacheDatabaseFlag,
+		utils.CacheTrieFlag,
+		utils.CacheGCFlag,
+		utils.CodeCacheFlag,
+		utils.TxPoolPromoteBatchFlag,
+		utils.TxPoolReplaceCooldownFlag,
+		utils.TxPoolMaxGasPerTxFlag,
+		utils.TxPoolResubmitsFlag,
+		utils.TxPoolResubmitDelayFlag,
+		utils.TxAnnounceModeFlag,
+		utils.TxPrivacyDelayFlag,
 		utils.ListenPortFlag,
 		utils.MaxPeersFlag,
 		utils.MaxPendingPeersFlag,
 		utils.MinerFlag,
+		utils.MinerAddrsFlag,
+		utils.MinerDryRunFlag,
+		utils.MinerEffectivePriceFlag,
+		utils.MinerBlockTimeFlag,
+		utils.MinerUncleWindowFlag,
+		utils.MinerUncleRetentionFlag,
+		utils.MinerUnclesFlag,
+		utils.MinerUncleMinRewardFlag,
+		utils.MinerUncleThresholdFlag,
 		utils.GasPriceFlag,
+		utils.MinerMinFeeFlag,
 		utils.SupportDAOFork,
 		utils.OpposeDAOFork,
 		utils.MinerThreadsFlag,
@@ -86,6 +115,12 @@ participating.
 		utils.RequestFlag,
 		utils.RPCPortFlag,
 		utils.RPCApiFlag,
+		utils.RPCUnixSocketFlag,
+		utils.RPCHealthBehindFlag,
+		utils.RPCAccessLogFlag,
+		utils.RPCMethodFilterFlag,
+		utils.RPCGasCapFlag,
+		utils.RPCGasCapStrictFlag,
 		utils.WSEnabledFlag,
 		utils.WSListenAddrFlag,
 		utils.WSPortFlag,
@@ -97,11 +132,14 @@ participating.
 		utils.ExecFlag,
 		utils.PreloadJSFlag,
 		utils.DevModeFlag,
+		utils.DevGenesisAllocFlag,
 		utils.TestNetFlag,
 		utils.VMForceJitFlag,
 		utils.VMJitCacheFlag,
 		utils.VMEnableJitFlag,
+		utils.VerifyRevertsFlag,
 		utils.NetworkIdFlag,
+		utils.NetworkIdForceFlag,
 		utils.RPCCORSDomainFlag,
 		utils.MetricsEnabledFlag,
 		utils.FakePoWFlag,
@@ -225,6 +263,70 @@ func startNode(ctx *cli.Context, stack *context.Node) {
 			utils.Fatalf("Failed to start mining: %v", err)
 		}
 	}
+	if ctx.GlobalBool(utils.ExitWhenSyncedFlag.Name) {
+		var siotchain *siot.Siotchain
+		if err := stack.Service(&siotchain); err != nil {
+			utils.Fatalf("Siotchain service not running: %v", err)
+		}
+		// Stopping the node closes the chain database, flushing it. The pool is
+		// saved beforehand, to be reloaded with admin.importTxPool if needed.
+		go func() {
+			if waitSynced(siotchain) {
+				glog.V(logger.Info).Infof("Synchronised with the network, shutting down")
+				if journal := stack.ResolvePath(txPoolJournal); journal != "" {
+					if _, err := siot.NewPrivateAdminAPI(siotchain).ExportTxPool(journal); err != nil {
+						glog.V(logger.Error).Infof("Failed to save the transaction pool: %v", err)
+					}
+				}
+				stack.Stop()
+			}
+		}()
+	}
+}
+
+const (
+	syncCheckInterval = 3 * time.Second // Interval at which waitSynced checks the sync status
+	txPoolJournal     = "txpool.rlp"    // File the transaction pool is saved to on a synced exit
+)
+
+// syncBackend is the part of the Siotchain service waitSynced watches.
+type syncBackend interface {
+	EventMux() *subscribe.TypeMux
+	Synchronising() bool
+	SyncStatus() (height uint64, behind uint64, known bool)
+}
+
+// waitSynced blocks until the node is in sync with the network: no sync cycle is
+// running, and either one completed or the local chain is already at least as
+// heavy as the one of the best peer, in which case none is ever started. Failed
+// sync cycles are retried by the syncer, so the wait simply continues. It
+// returns false if the node is stopped before that happens.
+func waitSynced(siotchain syncBackend) bool {
+	sub := siotchain.EventMux().Subscribe(downloader.DoneEvent{}, downloader.FailedEvent{})
+	defer sub.Unsubscribe()
+
+	ticker := time.NewTicker(syncCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case ev, ok := <-sub.Chan():
+			if !ok {
+				return false
+			}
+			if failed, ok := ev.Data.(downloader.FailedEvent); ok {
+				glog.V(logger.Info).Infof("Synchronisation failed, waiting for a retry: %v", failed.Err)
+				continue
+			}
+		case <-ticker.C:
+		}
+		if siotchain.Synchronising() {
+			continue
+		}
+		if _, behind, known := siotchain.SyncStatus(); known && behind == 0 {
+			return true
+		}
+	}
 }
 
 // tries unlocking the specified account a few times.
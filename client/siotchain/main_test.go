@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/siotchain/siot/siot/downloader"
+	"github.com/siotchain/siot/subscribe"
+)
+
+// testSyncBackend is a mock sync backend whose downloader status is set by the
+// tests.
+type testSyncBackend struct {
+	mux           *subscribe.TypeMux
+	synchronising bool
+	behind        uint64
+	known         bool
+	lock          sync.Mutex
+}
+
+func (b *testSyncBackend) EventMux() *subscribe.TypeMux { return b.mux }
+
+func (b *testSyncBackend) Synchronising() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.synchronising
+}
+
+func (b *testSyncBackend) SyncStatus() (uint64, uint64, bool) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return 100, b.behind, b.known
+}
+
+func (b *testSyncBackend) set(synchronising bool, behind uint64, known bool) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.synchronising, b.behind, b.known = synchronising, behind, known
+}
+
+// Tests that waitSynced returns as soon as the downloader reports a completed
+// sync, but not while one is still running or after one failed.
+func TestWaitSynced(t *testing.T) {
+	backend := &testSyncBackend{mux: new(subscribe.TypeMux), synchronising: true, behind: 50, known: true}
+	defer backend.mux.Stop()
+
+	done := make(chan bool)
+	go func() { done <- waitSynced(backend) }()
+
+	// Give the waiter time to subscribe, then report events while still behind
+	time.Sleep(50 * time.Millisecond)
+	backend.mux.Post(downloader.FailedEvent{Err: errors.New("peer dropped")})
+	backend.set(false, 50, true)
+	backend.mux.Post(downloader.DoneEvent{})
+
+	select {
+	case <-done:
+		t.Fatalf("wait finished while behind the network")
+	case <-time.After(100 * time.Millisecond):
+	}
+	// Report a completed sync and check that the wait finishes right away
+	backend.set(false, 0, true)
+	backend.mux.Post(downloader.DoneEvent{})
+
+	select {
+	case synced := <-done:
+		if !synced {
+			t.Fatalf("wait finished without being synced")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("wait didn't finish after the sync completed")
+	}
+}
+
+// Tests that waitSynced gives up if the node is stopped before being synced.
+func TestWaitSyncedStopped(t *testing.T) {
+	backend := &testSyncBackend{mux: new(subscribe.TypeMux)}
+
+	done := make(chan bool)
+	go func() { done <- waitSynced(backend) }()
+
+	time.Sleep(50 * time.Millisecond)
+	backend.mux.Stop()
+
+	select {
+	case synced := <-done:
+		if synced {
+			t.Fatalf("wait reported synced on a stopped node")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("wait didn't finish after the node stopped")
+	}
+}
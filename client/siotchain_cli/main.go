@@ -11,8 +11,10 @@ import (
 	"strings"
 	"time"
 
+	"github.com/siotchain/siot/blockchainCore/types"
 	"github.com/siotchain/siot/client/utils"
 	"github.com/siotchain/siot/helper"
+	"github.com/siotchain/siot/helper/rlp"
 	"github.com/siotchain/siot/siot"
 	"github.com/siotchain/siot/internal/debug"
 	"github.com/siotchain/siot/logger"
@@ -51,6 +53,9 @@ var (
 		"startmine": 0,
 		"stopmine": 0,
 		"sendasset": 3,
+		"sign": 6,
+		"sendraw": 1,
+		"noncegaps": 1,
 	}
 )
 
@@ -388,12 +393,117 @@ func handleRequest(cliCtx *cli.Context, client *client.Client, input string) err
 		} else {
 			fmt.Println("incorrect format: should be sendAsset [from] [to] [password]")
 		}
+	case chunks[0] == "sign":
+		if numofparams == requestmap["sign"] {
+			tx, err := signTransaction(ctx, client, chunks[1:])
+			if err != nil {
+				fmt.Println(err)
+				break
+			}
+			raw, err := rlp.EncodeToBytes(tx)
+			if err != nil {
+				fmt.Println(err)
+				break
+			}
+			green("0x%s\n", hex.EncodeToString(raw))
+		} else {
+			fmt.Println("incorrect format: should be sign [from] [to] [value] [nonce] [gasprice] [gaslimit]")
+		}
+	case chunks[0] == "sendraw":
+		if numofparams == requestmap["sendraw"] {
+			raw, err := hex.DecodeString(strings.TrimPrefix(chunks[1], "0x"))
+			if err != nil {
+				fmt.Println("invalid hex encoding:", err)
+				break
+			}
+			tx := new(types.Transaction)
+			if err := rlp.DecodeBytes(raw, tx); err != nil {
+				fmt.Println("invalid transaction:", err)
+				break
+			}
+			if err := client.SendTransaction(ctx, tx); err != nil {
+				fmt.Println(err)
+				break
+			}
+			green("%s\n", hex.EncodeToString(tx.Hash().Bytes()))
+		} else {
+			fmt.Println("incorrect format: should be sendraw [signed transaction hex]")
+		}
+	case chunks[0] == "noncegaps":
+		if numofparams == requestmap["noncegaps"] {
+			addrString, err := parseInput(chunks[1])
+			if err != nil {
+				fmt.Println(err)
+				break
+			}
+			gaps, err := client.NonceGaps(ctx, stringAddrToCommonAddr(addrString))
+			if err != nil {
+				fmt.Println(err)
+				break
+			}
+			if len(gaps) == 0 {
+				fmt.Println("no nonce gaps")
+				break
+			}
+			for _, nonce := range gaps {
+				green("%d\n", nonce)
+			}
+		} else {
+			fmt.Println("incorrect format: should be noncegaps [address]")
+		}
 	default:
 		fmt.Println("undefined cmd")
 	}
 	return nil
 }
 
+// signTransaction validates the parameters of the sign command and has the node
+// sign the transaction with the unlocked sender account, without broadcasting it.
+func signTransaction(ctx context.Context, client *client.Client, params []string) (*types.Transaction, error) {
+	fromString, err := parseInput(params[0])
+	if err != nil {
+		return nil, err
+	}
+	toString, err := parseInput(params[1])
+	if err != nil {
+		return nil, err
+	}
+	value, ok := new(big.Int).SetString(params[2], 10)
+	if !ok || value.Sign() < 0 {
+		return nil, fmt.Errorf("invalid value: %s", params[2])
+	}
+	value.Mul(value, big.NewInt(1000000000000))
+	nonce, err := strconv.ParseUint(params[3], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid nonce: %s", params[3])
+	}
+	gasPrice, ok := new(big.Int).SetString(params[4], 10)
+	if !ok || gasPrice.Sign() < 0 {
+		return nil, fmt.Errorf("invalid gas price: %s", params[4])
+	}
+	gasLimit, ok := new(big.Int).SetString(params[5], 10)
+	if !ok || gasLimit.Sign() <= 0 {
+		return nil, fmt.Errorf("invalid gas limit: %s", params[5])
+	}
+	from := stringAddrToCommonAddr(fromString)
+	tx, err := client.SignTransaction(ctx, from, stringAddrToCommonAddr(toString), value, nonce, gasPrice, gasLimit)
+	if err != nil {
+		return nil, err
+	}
+	// Make sure the signature is replay protected and belongs to the sender
+	if !tx.Protected() {
+		return nil, errors.New("signed transaction is missing the chain id")
+	}
+	sender, err := types.Sender(types.NewSiotImpr1Signer(tx.ChainId()), tx)
+	if err != nil {
+		return nil, err
+	}
+	if sender != from {
+		return nil, fmt.Errorf("signature mismatch for chain id %v: signed by 0x%x", tx.ChainId(), sender)
+	}
+	return tx, nil
+}
+
 func prettyprint(b []byte) ([]byte, error) {
 	var out bytes.Buffer
 	err := json.Indent(&out, b, "", "  ")
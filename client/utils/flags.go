@@ -2,15 +2,20 @@ package utils
 
 import (
 	"crypto/ecdsa"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"math"
 	"math/big"
+	"net"
 	"os"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 	"github.com/ethereum/ethash"
 	"github.com/siotchain/siot/wallet"
 	"github.com/siotchain/siot/helper"
@@ -20,9 +25,11 @@ import (
 	"github.com/siotchain/siot/siot"
 	"github.com/siotchain/siot/database"
 	"github.com/siotchain/siot/subscribe"
+	"github.com/siotchain/siot/trie"
 	"github.com/siotchain/siot/logger"
 	"github.com/siotchain/siot/logger/glog"
 	"github.com/siotchain/siot/helper/metrics"
+	"github.com/siotchain/siot/miner"
 	"github.com/siotchain/siot/context"
 	"github.com/siotchain/siot/net/p2p/discover"
 	"github.com/siotchain/siot/net/p2p/nat"
@@ -83,6 +90,10 @@ var (
 		Usage: "Target directory to save the databases and account keystore",
 		Value: DirectoryString{context.DefaultDataDir()},
 	}
+	AncientDirFlag = DirectoryFlag{
+		Name:  "datadir.ancient",
+		Usage: "Directory for the bodies and receipts of old canonical blocks (default = inside the datadir)",
+	}
 	KeyStoreDirFlag = DirectoryFlag{
 		Name:  "keystore",
 		Usage: "Directory for the keystore (default = inside the datadir)",
@@ -92,6 +103,10 @@ var (
 		Usage: "Network identifier",
 		Value: siot.NetworkId,
 	}
+	NetworkIdForceFlag = cli.BoolFlag{
+		Name:  "networkid.force",
+		Usage: "Allow a network identifier differing from the one the chain database was used with",
+	}
 	IPFlag = cli.StringFlag{
 		Name:  "IP",
 		Usage: "IP address (integer, 0=Olympic, 1=Frontier, 2=Morden)",
@@ -109,6 +124,10 @@ var (
 		Name:  "dev",
 		Usage: "Developer mode: pre-configured private network with several debugging flags",
 	}
+	DevGenesisAllocFlag = cli.StringFlag{
+		Name:  "dev.genesisalloc",
+		Usage: "Accounts to fund in the developer mode genesis: comma separated address:balance pairs or a JSON file mapping addresses to balances",
+	}
 	IdentityFlag = cli.StringFlag{
 		Name:  "identity",
 		Usage: "Custom node name",
@@ -131,6 +150,80 @@ var (
 		Usage: "Megabytes of memory allocated to internal caching (min 16MB / database forced)",
 		Value: 128,
 	}
+	CacheDatabaseFlag = cli.IntFlag{
+		Name:  "cache.database",
+		Usage: "Percentage of the cache allocated to the database (default = what the other shares leave)",
+	}
+	CacheTrieFlag = cli.IntFlag{
+		Name:  "cache.trie",
+		Usage: "Percentage of the cache allocated to trie nodes unloaded from memory",
+	}
+	CacheGCFlag = cli.IntFlag{
+		Name:  "cache.gc",
+		Usage: "Percentage of the cache left unallocated as garbage collection headroom",
+	}
+	CodeCacheFlag = cli.IntFlag{
+		Name:  "cache.code",
+		Usage: "Number of externalLogic codes cached in memory across all states (negative = disabled)",
+		Value: state.DefaultCodeCacheSize,
+	}
+	ReadOnlyFlag = cli.BoolFlag{
+		Name:  "readonly",
+		Usage: "Serve queries only: disable mining and reject all transaction submissions",
+	}
+	ExitWhenSyncedFlag = cli.BoolFlag{
+		Name:  "exitwhensynced",
+		Usage: "Shut the node down cleanly once it has synchronised with the network",
+	}
+	TxPoolSimulateFlag = cli.BoolFlag{
+		Name:  "txpool.simulate",
+		Usage: "Execute transactions against the current state before admitting them into the pool (expensive)",
+	}
+	TxPoolLifetimeFlag = cli.DurationFlag{
+		Name:  "txpool.lifetime",
+		Usage: "Maximum amount of time non-executable transactions are queued (longer lifetimes use more memory)",
+		Value: 3 * time.Hour,
+	}
+	TxPoolResubmitsFlag = cli.IntFlag{
+		Name:  "txpool.resubmits",
+		Usage: "Number of times a local transaction dropped by the pool limits is resubmitted before giving up (0 = disabled)",
+		Value: 3,
+	}
+	TxPoolResubmitDelayFlag = cli.DurationFlag{
+		Name:  "txpool.resubmitdelay",
+		Usage: "Time to wait before resubmitting a dropped local transaction",
+		Value: time.Minute,
+	}
+	ImportTimeoutFlag = cli.DurationFlag{
+		Name:  "import.timeout",
+		Usage: "Maximum time allowed to process a single imported block before it is rejected and its peer dropped (0 = unlimited)",
+	}
+	TxPoolPromoteBatchFlag = cli.IntFlag{
+		Name:  "txpool.promotebatch",
+		Usage: "Maximum number of wallet whose queued transactions are promoted per pass, yielding the pool lock in between (0 = unlimited)",
+	}
+	TxPoolReplaceCooldownFlag = cli.DurationFlag{
+		Name:  "txpool.replacecooldown",
+		Usage: "Minimum time between two replacements of the transaction holding the same nonce of an account (0 = disabled)",
+	}
+	TxPoolMaxGasPerTxFlag = cli.IntFlag{
+		Name:  "txpool.maxgaspertx",
+		Usage: "Maximum gas a single transaction may request, in percent of the block gas limit",
+		Value: 100,
+	}
+	TxAnnounceModeFlag = cli.StringFlag{
+		Name:  "txannounce.mode",
+		Usage: `Transaction propagation mode: "full" sends every transaction to every peer, "hash" sends it to sqrt(peers) and announces the hash to the rest`,
+		Value: siot.TxAnnounceFull,
+	}
+	TxPrivacyDelayFlag = cli.DurationFlag{
+		Name:  "txprivacy.delay",
+		Usage: "Maximum random delay before broadcasting locally submitted transactions, obscuring their origin (0 = immediate)",
+	}
+	VerifyRevertsFlag = cli.BoolFlag{
+		Name:  "debug.verifyreverts",
+		Usage: "Check every state revert against a copy of the state taken at the snapshot, logging incomplete reverts (slow)",
+	}
 	TrieCacheGenFlag = cli.IntFlag{
 		Name:  "trie-cache-gens",
 		Usage: "Number of trie node generations to keep in memory",
@@ -169,14 +262,59 @@ var (
 		Usage: "Public address for block mining rewards (default = first account created)",
 		Value: "0",
 	}
+	MinerAddrsFlag = cli.StringFlag{
+		Name:  "miner.etherbases",
+		Usage: "Comma separated list of reward addresses (or account indices) rotated per mined block",
+	}
+	MinerDryRunFlag = cli.BoolFlag{
+		Name:  "miner.dryrun",
+		Usage: "Assemble blocks and log their contents without ever sealing them (profiling)",
+	}
+	MinerEffectivePriceFlag = cli.BoolFlag{
+		Name:  "miner.effectiveprice",
+		Usage: "Rank wallet by the average gas price of their pending transaction sequence instead of the next transaction only",
+	}
+	MinerBlockTimeFlag = cli.DurationFlag{
+		Name:  "miner.blocktime",
+		Usage: "Target interval between mined blocks, only allowed with --dev or --fakepow (0 = as fast as possible)",
+	}
+	MinerUncleWindowFlag = cli.IntFlag{
+		Name:  "miner.unclewindow",
+		Usage: "Number of recent locally mined blocks to measure the uncle rate over",
+		Value: 20,
+	}
+	MinerUncleRetentionFlag = cli.IntFlag{
+		Name:  "miner.uncleretention",
+		Usage: "Number of blocks below the head side blocks are kept as possible uncles",
+		Value: 7,
+	}
+	MinerUnclesFlag = cli.StringFlag{
+		Name:  "miner.uncles",
+		Usage: `Uncle inclusion policy: "always", "never", or "profitable" to include only uncles earning more than --miner.uncleminreward`,
+		Value: miner.UnclesAlways,
+	}
+	MinerUncleMinRewardFlag = cli.StringFlag{
+		Name:  "miner.uncleminreward",
+		Usage: "Reward in wei an uncle must earn the miner to be included under the profitable uncle policy",
+		Value: "0",
+	}
+	MinerUncleThresholdFlag = cli.Float64Flag{
+		Name:  "miner.unclethreshold",
+		Usage: "Uncle rate (0-1) of the locally mined blocks above which a warning is logged",
+		Value: 0.25,
+	}
 	GasPriceFlag = cli.StringFlag{
 		Name:  "gasprice",
 		Usage: "Minimal gas price to accept for mining a transactions",
 		Value: new(big.Int).Mul(big.NewInt(20), helper.Shannon).String(),
 	}
+	MinerMinFeeFlag = cli.StringFlag{
+		Name:  "miner.minfee",
+		Usage: "Minimal gas price of the transactions included in mined blocks, overriding --gasprice for the miner only (--gpomin still seeds the price oracle)",
+	}
 	ExtraDataFlag = cli.StringFlag{
 		Name:  "extradata",
-		Usage: "Block extra data set by the miner (default = client version)",
+		Usage: "Block extra data set by the miner, 0x prefixed for hex (default = client version)",
 	}
 	// Account settings
 	UnlockedAccountFlag = cli.StringFlag{
@@ -244,6 +382,32 @@ var (
 		Usage: "API's offered over the HTTP-RPC interface",
 		Value: rpc.DefaultHTTPApis,
 	}
+	RPCUnixSocketFlag = cli.StringFlag{
+		Name:  "rpc.unixsocket",
+		Usage: "Path of a Unix domain socket to serve the HTTP-RPC API on (same modules as --rpcapi)",
+	}
+	RPCHealthBehindFlag = cli.IntFlag{
+		Name:  "rpc.healthbehind",
+		Usage: "Number of blocks the node may lag behind its peers while the HTTP /health probe still reports healthy",
+		Value: 5,
+	}
+	RPCAccessLogFlag = cli.BoolFlag{
+		Name:  "rpc.accesslog",
+		Usage: "Log the method, caller, duration and status of every RPC request (debug verbosity)",
+	}
+	RPCMethodFilterFlag = cli.StringFlag{
+		Name:  "rpc.methodfilter",
+		Usage: `Comma separated glob patterns of methods allowed over HTTP-RPC and WS-RPC, "!" prefixed ones denied (e.g. "siot_*,!siot_sendRawTransaction")`,
+	}
+	RPCGasCapFlag = cli.IntFlag{
+		Name:  "rpc.gascap",
+		Usage: "Maximum gas available to siot_call and siot_estimateGas executions, higher requests are capped (0 = unlimited)",
+		Value: 50000000,
+	}
+	RPCGasCapStrictFlag = cli.BoolFlag{
+		Name:  "rpc.gascap.strict",
+		Usage: "Reject calls requesting more gas than --rpc.gascap instead of capping them",
+	}
 	IPCDisabledFlag = cli.BoolFlag{
 		Name:  "ipcdisable",
 		Usage: "Disable the IPC-RPC server",
@@ -545,13 +709,104 @@ func MakeMiner(accman *wallet.Manager, ctx *cli.Context) helper.Address {
 	return account.Address
 }
 
+// MakeMiners retrieves the list of rotating reward addresses specified on the
+// command line, resolving keystore indices where needed.
+func MakeMiners(accman *wallet.Manager, ctx *cli.Context) []helper.Address {
+	var addrs []helper.Address
+	for _, entry := range strings.Split(ctx.GlobalString(MinerAddrsFlag.Name), ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		account, err := MakeAddress(accman, entry)
+		if err != nil {
+			Fatalf("Option %q: %v", MinerAddrsFlag.Name, err)
+		}
+		addrs = append(addrs, account.Address)
+	}
+	return addrs
+}
+
+// MakeGenesisAlloc parses the accounts to pre-fund in the developer mode genesis.
+// The flag either names a JSON file mapping addresses to balances or lists the
+// address:balance pairs directly. Balances are decimal or 0x prefixed hex wei.
+func MakeGenesisAlloc(ctx *cli.Context) []blockchainCore.GenesisAccount {
+	value := ctx.GlobalString(DevGenesisAllocFlag.Name)
+	if value == "" {
+		return nil
+	}
+	var pairs [][2]string
+	if _, err := os.Stat(value); err == nil {
+		blob, err := ioutil.ReadFile(value)
+		if err != nil {
+			Fatalf("Failed to read --%s file: %v", DevGenesisAllocFlag.Name, err)
+		}
+		var balances map[string]string
+		if err := json.Unmarshal(blob, &balances); err != nil {
+			Fatalf("Invalid --%s file: %v", DevGenesisAllocFlag.Name, err)
+		}
+		addrs := make([]string, 0, len(balances))
+		for addr := range balances {
+			addrs = append(addrs, addr)
+		}
+		sort.Strings(addrs)
+		for _, addr := range addrs {
+			pairs = append(pairs, [2]string{addr, balances[addr]})
+		}
+	} else {
+		for _, entry := range strings.Split(value, ",") {
+			if entry = strings.TrimSpace(entry); entry == "" {
+				continue
+			}
+			parts := strings.SplitN(entry, ":", 2)
+			if len(parts) != 2 {
+				Fatalf("Invalid --%s entry %q: expected address:balance", DevGenesisAllocFlag.Name, entry)
+			}
+			pairs = append(pairs, [2]string{parts[0], parts[1]})
+		}
+	}
+	accounts := make([]blockchainCore.GenesisAccount, 0, len(pairs))
+	for _, pair := range pairs {
+		addr, balance := strings.TrimSpace(pair[0]), strings.TrimSpace(pair[1])
+		if !helper.IsHexAddress(addr) {
+			Fatalf("Invalid --%s address %q", DevGenesisAllocFlag.Name, addr)
+		}
+		amount, ok := new(big.Int).SetString(balance, 0)
+		if !ok || amount.Sign() < 0 {
+			Fatalf("Invalid --%s balance %q for %s", DevGenesisAllocFlag.Name, balance, addr)
+		}
+		accounts = append(accounts, blockchainCore.GenesisAccount{Address: helper.HexToAddress(addr), Balance: amount})
+	}
+	return accounts
+}
+
 // MakeMinerExtra resolves extradata for the miner from the set cmd line flags
 // or returns a default one composed on the client, runtime and OS metadata.
+// A 0x prefixed flag value is decoded as hex, anything else is taken verbatim.
 func MakeMinerExtra(extra []byte, ctx *cli.Context) []byte {
-	if ctx.GlobalIsSet(ExtraDataFlag.Name) {
-		return []byte(ctx.GlobalString(ExtraDataFlag.Name))
+	if !ctx.GlobalIsSet(ExtraDataFlag.Name) {
+		return extra
+	}
+	data, err := parseExtraData(ctx.GlobalString(ExtraDataFlag.Name))
+	if err != nil {
+		Fatalf("Invalid --%s: %v", ExtraDataFlag.Name, err)
+	}
+	return data
+}
+
+// parseExtraData decodes a 0x prefixed extra data value as hex, taking anything
+// else verbatim, and checks it fits into a block header.
+func parseExtraData(value string) ([]byte, error) {
+	data := []byte(value)
+	if strings.HasPrefix(value, "0x") || strings.HasPrefix(value, "0X") {
+		var err error
+		if data, err = hex.DecodeString(value[2:]); err != nil {
+			return nil, fmt.Errorf("invalid hex %q: %v", value, err)
+		}
 	}
-	return extra
+	if uint64(len(data)) > configure.MaximumExtraDataSize.Uint64() {
+		return nil, fmt.Errorf("%d bytes exceed the limit of %v", len(data), configure.MaximumExtraDataSize)
+	}
+	return data, nil
 }
 
 // MakePasswordList reads password lines from the file specified by --password.
@@ -576,8 +831,13 @@ func MakePasswordList(ctx *cli.Context) []string {
 func MakeNode(ctx *cli.Context, name, gitCommit string) *context.Node {
 	vsn := Version
 
+	healthBehind := ctx.GlobalInt(RPCHealthBehindFlag.Name)
+	if healthBehind < 0 {
+		Fatalf("Invalid --%s %d: must not be negative", RPCHealthBehindFlag.Name, healthBehind)
+	}
 	config := &context.Config{
 		DataDir:           MakeDataDir(ctx),
+		AncientDir:        ctx.GlobalString(AncientDirFlag.Name),
 		KeyStoreDir:       ctx.GlobalString(KeyStoreDirFlag.Name),
 		PrivateKey:        MakeNodeKey(ctx),
 		Name:              name,
@@ -593,10 +853,14 @@ func MakeNode(ctx *cli.Context, name, gitCommit string) *context.Node {
 		HTTPPort:          ctx.GlobalInt(RPCPortFlag.Name),
 		HTTPCors:          ctx.GlobalString(RPCCORSDomainFlag.Name),
 		HTTPModules:       MakeRPCModules(ctx.GlobalString(RPCApiFlag.Name)),
+		HTTPUnixSocket:    ctx.GlobalString(RPCUnixSocketFlag.Name),
+		HealthMaxBlocksBehind: uint64(healthBehind),
 		WSHost:            MakeWSRpcHost(ctx),
 		WSPort:            ctx.GlobalInt(WSPortFlag.Name),
 		WSOrigins:         ctx.GlobalString(WSAllowedOriginsFlag.Name),
 		WSModules:         MakeRPCModules(ctx.GlobalString(WSApiFlag.Name)),
+		RPCAccessLog:      ctx.GlobalBool(RPCAccessLogFlag.Name),
+		RPCMethodFilter:   ctx.GlobalString(RPCMethodFilterFlag.Name),
 	}
 	if ctx.GlobalBool(DevModeFlag.Name) {
 		if !ctx.GlobalIsSet(DataDirFlag.Name) {
@@ -610,9 +874,35 @@ func MakeNode(ctx *cli.Context, name, gitCommit string) *context.Node {
 	if err != nil {
 		Fatalf("Failed to create the protocol stack: %v", err)
 	}
+	if err := checkIPCEndpoint(stack.IPCEndpoint()); err != nil {
+		Fatalf("Option %q: %v", IPCPathFlag.Name, err)
+	}
 	return stack
 }
 
+// checkIPCEndpoint makes sure no other running instance serves the given IPC
+// endpoint, which would otherwise be clobbered. Stale sockets left behind by
+// a crashed instance are removed.
+func checkIPCEndpoint(endpoint string) error {
+	// Named pipes on Windows cannot be shared, nothing to check there
+	if endpoint == "" || runtime.GOOS == "windows" {
+		return nil
+	}
+	if _, err := os.Stat(endpoint); os.IsNotExist(err) {
+		return nil
+	}
+	conn, err := net.DialTimeout("unix", endpoint, time.Second)
+	if err == nil {
+		conn.Close()
+		return fmt.Errorf("IPC endpoint %s is in use by another running instance", endpoint)
+	}
+	glog.V(logger.Info).Infof("Removing stale IPC endpoint %s", endpoint)
+	if err := os.Remove(endpoint); err != nil {
+		return fmt.Errorf("failed to remove stale IPC endpoint %s: %v", endpoint, err)
+	}
+	return nil
+}
+
 // RegisterSiotService configures siot.Siotchain from cmd line flags and adds it to the
 // given node.
 func RegisterSiotService(ctx *cli.Context, stack *context.Node, extra []byte) {
@@ -626,6 +916,34 @@ func RegisterSiotService(ctx *cli.Context, stack *context.Node, extra []byte) {
 	if networks > 1 {
 		Fatalf("The %v flags are mutually exclusive", netFlags)
 	}
+	if lifetime := ctx.GlobalDuration(TxPoolLifetimeFlag.Name); lifetime <= 0 {
+		Fatalf("Invalid --%s %v: must be positive", TxPoolLifetimeFlag.Name, lifetime)
+	}
+	if delay := ctx.GlobalDuration(TxPoolResubmitDelayFlag.Name); ctx.GlobalInt(TxPoolResubmitsFlag.Name) > 0 && delay <= 0 {
+		Fatalf("Invalid --%s %v: must be positive", TxPoolResubmitDelayFlag.Name, delay)
+	}
+	if cooldown := ctx.GlobalDuration(TxPoolReplaceCooldownFlag.Name); cooldown < 0 {
+		Fatalf("Invalid --%s %v: must not be negative", TxPoolReplaceCooldownFlag.Name, cooldown)
+	}
+	if percent := ctx.GlobalInt(TxPoolMaxGasPerTxFlag.Name); percent <= 0 || percent > 100 {
+		Fatalf("Invalid --%s %d: must be between 1 and 100", TxPoolMaxGasPerTxFlag.Name, percent)
+	}
+	if gasCap := ctx.GlobalInt(RPCGasCapFlag.Name); gasCap < 0 {
+		Fatalf("Invalid --%s %d: must not be negative", RPCGasCapFlag.Name, gasCap)
+	}
+	if delay := ctx.GlobalDuration(TxPrivacyDelayFlag.Name); delay < 0 || delay > siot.MaxTxPrivacyDelay {
+		Fatalf("Invalid --%s %v: must be between 0 and %v", TxPrivacyDelayFlag.Name, delay, siot.MaxTxPrivacyDelay)
+	}
+	switch mode := ctx.GlobalString(TxAnnounceModeFlag.Name); mode {
+	case siot.TxAnnounceFull, siot.TxAnnounceHash:
+	default:
+		Fatalf("Invalid --%s %q: must be %q or %q", TxAnnounceModeFlag.Name, mode, siot.TxAnnounceFull, siot.TxAnnounceHash)
+	}
+	readonly := ctx.GlobalBool(ReadOnlyFlag.Name)
+	databaseCache, trieCache := MakeCacheSizes(ctx)
+	if readonly && ctx.GlobalBool(MiningEnabledFlag.Name) {
+		Fatalf("The --%s and --%s flags are mutually exclusive", ReadOnlyFlag.Name, MiningEnabledFlag.Name)
+	}
 
 	// initialise new random number generator
 	// get enabled jit flag
@@ -634,13 +952,31 @@ func RegisterSiotService(ctx *cli.Context, stack *context.Node, extra []byte) {
 
 	siotConf := &siot.Config{
 		MinerAddr:       MakeMiner(stack.AccountManager(), ctx),
+		MinerAddrs:      MakeMiners(stack.AccountManager(), ctx),
 		ChainConfig:     MakeChainConfig(ctx, stack),
 		FastSync:        ctx.GlobalBool(FastSyncFlag.Name),
+		TxPoolSimulate:  ctx.GlobalBool(TxPoolSimulateFlag.Name),
+		TxPoolLifetime:  ctx.GlobalDuration(TxPoolLifetimeFlag.Name),
+		ImportTimeout:   ctx.GlobalDuration(ImportTimeoutFlag.Name),
+		TxAnnounceMode:  ctx.GlobalString(TxAnnounceModeFlag.Name),
+		TxPoolPromote:   ctx.GlobalInt(TxPoolPromoteBatchFlag.Name),
+		TxPoolCooldown:  ctx.GlobalDuration(TxPoolReplaceCooldownFlag.Name),
+		TxPoolMaxGas:    ctx.GlobalInt(TxPoolMaxGasPerTxFlag.Name),
+		TxPrivacyDelay:  ctx.GlobalDuration(TxPrivacyDelayFlag.Name),
+		TxResubmits:     ctx.GlobalInt(TxPoolResubmitsFlag.Name),
+		TxResubmitDelay: ctx.GlobalDuration(TxPoolResubmitDelayFlag.Name),
+		ReadOnly:        readonly,
+		RPCGasCap:       uint64(ctx.GlobalInt(RPCGasCapFlag.Name)),
+		RPCGasCapStrict: ctx.GlobalBool(RPCGasCapStrictFlag.Name),
 		MaxPeers:        ctx.GlobalInt(MaxPeersFlag.Name),
-		DatabaseCache:   ctx.GlobalInt(CacheFlag.Name),
+		DatabaseCache:   databaseCache,
+		TrieCache:       trieCache,
+		CodeCacheSize:   ctx.GlobalInt(CodeCacheFlag.Name),
 		DatabaseHandles: MakeDatabaseHandles(),
 		NetworkId:       ctx.GlobalInt(NetworkIdFlag.Name),
 		MinerThreads:    ctx.GlobalInt(MinerThreadsFlag.Name),
+		MinerDryRun:     ctx.GlobalBool(MinerDryRunFlag.Name),
+		MinerEffectivePrice: ctx.GlobalBool(MinerEffectivePriceFlag.Name),
 		ExtraData:       MakeMinerExtra(extra, ctx),
 		NatSpec:         ctx.GlobalBool(NatspecEnabledFlag.Name),
 		DocRoot:                 ctx.GlobalString(DocRootFlag.Name),
@@ -653,7 +989,11 @@ func RegisterSiotService(ctx *cli.Context, stack *context.Node, extra []byte) {
 		GpobaseStepDown:         ctx.GlobalInt(GpobaseStepDownFlag.Name),
 		GpobaseStepUp:           ctx.GlobalInt(GpobaseStepUpFlag.Name),
 		GpobaseCorrectionFactor: ctx.GlobalInt(GpobaseCorrectionFactorFlag.Name),
-		AutoDAG:                 ctx.GlobalBool(AutoDAGFlag.Name) || ctx.GlobalBool(MiningEnabledFlag.Name),
+		UncleRateWindow:         ctx.GlobalInt(MinerUncleWindowFlag.Name),
+		UncleRateThreshold:      ctx.GlobalFloat64(MinerUncleThresholdFlag.Name),
+		UncleRetention:          ctx.GlobalInt(MinerUncleRetentionFlag.Name),
+		UnclePolicy:             ctx.GlobalString(MinerUnclesFlag.Name),
+		AutoDAG:                 !readonly && (ctx.GlobalBool(AutoDAGFlag.Name) || ctx.GlobalBool(MiningEnabledFlag.Name)),
 	}
 
 	// Override any default configs in dev mode or the test net
@@ -666,15 +1006,66 @@ func RegisterSiotService(ctx *cli.Context, stack *context.Node, extra []byte) {
 
 	case ctx.GlobalBool(DevModeFlag.Name):
 		siotConf.Genesis = blockchainCore.OlympicGenesisBlock()
+		if alloc := MakeGenesisAlloc(ctx); len(alloc) > 0 {
+			genesis, err := blockchainCore.GenesisWithAlloc(siotConf.Genesis, alloc...)
+			if err != nil {
+				Fatalf("Failed to fund the genesis accounts: %v", err)
+			}
+			siotConf.Genesis = genesis
+		}
 		if !ctx.GlobalIsSet(GasPriceFlag.Name) {
 			siotConf.GasPrice = new(big.Int)
 		}
 		siotConf.PowTest = true
 	}
+	if siotConf.UncleRetention < 0 {
+		Fatalf("Invalid --%s: %d", MinerUncleRetentionFlag.Name, siotConf.UncleRetention)
+	}
+	switch siotConf.UnclePolicy {
+	case miner.UnclesAlways, miner.UnclesNever, miner.UnclesProfitable:
+	default:
+		Fatalf("Invalid --%s %q: must be %q, %q or %q", MinerUnclesFlag.Name, siotConf.UnclePolicy, miner.UnclesAlways, miner.UnclesNever, miner.UnclesProfitable)
+	}
+	reward, ok := new(big.Int).SetString(ctx.GlobalString(MinerUncleMinRewardFlag.Name), 0)
+	if !ok || reward.Sign() < 0 {
+		Fatalf("Invalid --%s: %q", MinerUncleMinRewardFlag.Name, ctx.GlobalString(MinerUncleMinRewardFlag.Name))
+	}
+	siotConf.UncleMinReward = reward
+	if ctx.GlobalIsSet(MinerMinFeeFlag.Name) {
+		fee, ok := new(big.Int).SetString(ctx.GlobalString(MinerMinFeeFlag.Name), 0)
+		if !ok || fee.Sign() < 0 {
+			Fatalf("Invalid --%s: %q", MinerMinFeeFlag.Name, ctx.GlobalString(MinerMinFeeFlag.Name))
+		}
+		siotConf.MinerMinFee = fee
+	}
+	if ctx.GlobalIsSet(DevGenesisAllocFlag.Name) && !ctx.GlobalBool(DevModeFlag.Name) {
+		Fatalf("Option %q is only allowed with --%s", DevGenesisAllocFlag.Name, DevModeFlag.Name)
+	}
+	if blockTime := ctx.GlobalDuration(MinerBlockTimeFlag.Name); blockTime != 0 {
+		if blockTime < 0 {
+			Fatalf("Invalid --%s: %v", MinerBlockTimeFlag.Name, blockTime)
+		}
+		// Pacing the blocks on a real difficulty network would only lose races
+		if !ctx.GlobalBool(DevModeFlag.Name) && !ctx.GlobalBool(FakePoWFlag.Name) {
+			Fatalf("Option %q is only allowed with --%s or --%s", MinerBlockTimeFlag.Name, DevModeFlag.Name, FakePoWFlag.Name)
+		}
+		siotConf.MinerBlockTime = blockTime
+	}
+	if !ctx.GlobalBool(NetworkIdForceFlag.Name) {
+		db := MakeChainDatabase(ctx, stack)
+		err := checkNetworkId(db, siotConf.NetworkId)
+		db.Close()
+		if err != nil {
+			Fatalf("%v (use --%s to override)", err, NetworkIdForceFlag.Name)
+		}
+	}
 	// Override any global options pertaining to the Siotchain protocol
 	if gen := ctx.GlobalInt(TrieCacheGenFlag.Name); gen > 0 {
 		state.MaxTrieCacheGen = uint16(gen)
 	}
+	if ctx.GlobalBool(VerifyRevertsFlag.Name) {
+		state.VerifyReverts = true
+	}
 
 	if err := stack.Register(func(ctx *context.ServiceContext) (context.Service, error) {
 		fullNode, err := siot.New(ctx, siotConf)
@@ -699,6 +1090,20 @@ func SetupNetwork(ctx *cli.Context) {
 	configure.TargetGasLimit = helper.String2Big(ctx.GlobalString(TargetGasLimitFlag.Name))
 }
 
+// checkNetworkId ensures that the network id matches the one the chain database
+// was last used with, as peers of a different network would only be rejected
+// during the handshake with confusing errors.
+func checkNetworkId(db database.Database, networkId int) error {
+	genesis := blockchainCore.GetCanonicalHash(db, 0)
+	if genesis == (helper.Hash{}) {
+		return nil
+	}
+	if stored, ok := blockchainCore.GetNetworkId(db, genesis); ok && stored != uint64(networkId) {
+		return fmt.Errorf("network id %d doesn't match the id %d of the stored chain %x", networkId, stored, genesis[:4])
+	}
+	return nil
+}
+
 // MakeChainConfig reads the chain configuration from the database in ctx.Datadir.
 func MakeChainConfig(ctx *cli.Context, stack *context.Node) *configure.ChainConfig {
 	db := MakeChainDatabase(ctx, stack)
@@ -804,19 +1209,48 @@ func ChainDbName(ctx *cli.Context) string {
 	return "chaindata"
 }
 
+// MakeCacheSizes partitions the megabytes of the cache flag between the database
+// and the trie node cache, leaving the garbage collection share unallocated. The
+// whole cache goes to the database unless the percentages are configured.
+func MakeCacheSizes(ctx *cli.Context) (databaseCache int, trieCache int) {
+	var (
+		total     = ctx.GlobalInt(CacheFlag.Name)
+		trieShare = ctx.GlobalInt(CacheTrieFlag.Name)
+		gcShare   = ctx.GlobalInt(CacheGCFlag.Name)
+		dbShare   = 100 - trieShare - gcShare
+	)
+	if ctx.GlobalIsSet(CacheDatabaseFlag.Name) {
+		dbShare = ctx.GlobalInt(CacheDatabaseFlag.Name)
+	}
+	for _, flag := range []cli.IntFlag{CacheDatabaseFlag, CacheTrieFlag, CacheGCFlag} {
+		if share := ctx.GlobalInt(flag.Name); share < 0 || share > 100 {
+			Fatalf("Invalid --%s %d: must be a percentage", flag.Name, share)
+		}
+	}
+	if dbShare < 0 || dbShare+trieShare+gcShare > 100 {
+		Fatalf("The --%s, --%s and --%s percentages exceed 100 in total", CacheDatabaseFlag.Name, CacheTrieFlag.Name, CacheGCFlag.Name)
+	}
+	return total * dbShare / 100, total * trieShare / 100
+}
+
 // MakeChainDatabase open an LevelDB using the flags passed to the client and will hard crash if it fails.
 func MakeChainDatabase(ctx *cli.Context, stack *context.Node) database.Database {
 	var (
-		cache   = ctx.GlobalInt(CacheFlag.Name)
-		handles = MakeDatabaseHandles()
-		name    = ChainDbName(ctx)
+		cache, _ = MakeCacheSizes(ctx)
+		handles  = MakeDatabaseHandles()
+		name     = ChainDbName(ctx)
 	)
 
 	chainDb, err := stack.OpenDatabase(name, cache, handles)
 	if err != nil {
 		Fatalf("Could not open database: %v", err)
 	}
-	return chainDb
+	// Old chain segments are rarely read, a minimal cache suffices for them
+	ancientDb, err := stack.OpenAncientDatabase(name, 0, 0)
+	if err != nil {
+		Fatalf("Could not open ancient database: %v", err)
+	}
+	return database.NewTieredDatabase(chainDb, ancientDb, blockchainCore.IsAncientKey)
 }
 
 // MakeChain creates a chain manager from set cmd line flags.
@@ -824,6 +1258,9 @@ func MakeChain(ctx *cli.Context, stack *context.Node) (chain *blockchainCore.Blo
 	var err error
 	chainDb = MakeChainDatabase(ctx, stack)
 
+	_, trieCache := MakeCacheSizes(ctx)
+	trie.SetCleanCacheSize(trieCache)
+
 	if ctx.GlobalBool(OlympicFlag.Name) {
 		_, err := blockchainCore.WriteTestNetGenesisBlock(chainDb)
 		if err != nil {
@@ -0,0 +1,107 @@
+package utils
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/siotchain/siot/blockchainCore"
+	"github.com/siotchain/siot/database"
+	"github.com/siotchain/siot/helper"
+)
+
+// Tests that starting on a chain database with a network id differing from the
+// one it was used with is refused.
+func TestCheckNetworkId(t *testing.T) {
+	db, _ := database.NewMemDatabase()
+
+	// A fresh database may be used with any network id
+	if err := checkNetworkId(db, 3); err != nil {
+		t.Fatalf("fresh database rejected: %v", err)
+	}
+	genesis := helper.HexToHash("0x0102030405")
+	if err := blockchainCore.WriteCanonicalHash(db, genesis, 0); err != nil {
+		t.Fatalf("failed to write genesis hash: %v", err)
+	}
+	if err := blockchainCore.WriteNetworkId(db, genesis, 3); err != nil {
+		t.Fatalf("failed to write network id: %v", err)
+	}
+	if err := checkNetworkId(db, 3); err != nil {
+		t.Errorf("matching network id rejected: %v", err)
+	}
+	if err := checkNetworkId(db, 4); err == nil {
+		t.Errorf("mismatched network id accepted")
+	}
+}
+
+// Tests that a live IPC endpoint is refused while stale ones are removed.
+func TestCheckIPCEndpoint(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("named pipes are not checked")
+	}
+	dir, err := ioutil.TempDir("", "ipc-check")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	endpoint := filepath.Join(dir, "siotchain.ipc")
+
+	// A missing endpoint is free to use
+	if err := checkIPCEndpoint(endpoint); err != nil {
+		t.Fatalf("missing endpoint rejected: %v", err)
+	}
+	// A socket with a listener belongs to another instance
+	listener, err := net.Listen("unix", endpoint)
+	if err != nil {
+		t.Fatalf("failed to listen on endpoint: %v", err)
+	}
+	if err := checkIPCEndpoint(endpoint); err == nil {
+		t.Errorf("live endpoint accepted")
+	}
+	// A socket left behind without listener must be cleaned up
+	listener.(*net.UnixListener).SetUnlinkOnClose(false)
+	listener.Close()
+
+	if err := checkIPCEndpoint(endpoint); err != nil {
+		t.Fatalf("stale endpoint rejected: %v", err)
+	}
+	if _, err := os.Stat(endpoint); !os.IsNotExist(err) {
+		t.Errorf("stale endpoint not removed: %v", err)
+	}
+}
+
+// Tests that extra data is taken verbatim unless 0x prefixed, in which case it
+// is decoded as hex, and that it must fit into a block header.
+func TestParseExtraData(t *testing.T) {
+	tests := []struct {
+		value string
+		want  []byte
+		fail  bool
+	}{
+		{value: "siotchain", want: []byte("siotchain")},
+		{value: "0x00ff10", want: []byte{0x00, 0xff, 0x10}},
+		{value: "0XABCD", want: []byte{0xab, 0xcd}},
+		{value: "0xzz", fail: true},
+		{value: "0x" + strings.Repeat("00", 33), fail: true},
+		{value: strings.Repeat("a", 33), fail: true},
+	}
+	for _, tt := range tests {
+		data, err := parseExtraData(tt.value)
+		if tt.fail {
+			if err == nil {
+				t.Errorf("%q: invalid extra data accepted as %x", tt.value, data)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: failed to parse extra data: %v", tt.value, err)
+		} else if !bytes.Equal(data, tt.want) {
+			t.Errorf("%q: extra data mismatch: have %x, want %x", tt.value, data, tt.want)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package configure
 
 import (
+	"fmt"
 	"math/big"
 
 	"github.com/siotchain/siot/helper"
@@ -103,6 +104,51 @@ func (c *ChainConfig) IsSiotImpr2(num *big.Int) bool {
 
 }
 
+// CheckCompatible checks whether newcfg can replace c on a chain whose head is at
+// the given block number, i.e. that no fork which already activated is moved,
+// removed or reconfigured and that no fork is scheduled into the past.
+func (c *ChainConfig) CheckCompatible(newcfg *ChainConfig, head *big.Int) error {
+	if newcfg.ChainId == nil {
+		return fmt.Errorf("missing chain id")
+	}
+	if c.ChainId.Cmp(newcfg.ChainId) != 0 {
+		return fmt.Errorf("chain id mismatch: stored %v, new %v", c.ChainId, newcfg.ChainId)
+	}
+	forks := []struct {
+		name       string
+		have, want *big.Int
+	}{
+		{"homestead", c.HomesteadBlock, newcfg.HomesteadBlock},
+		{"DAO fork", c.DAOForkBlock, newcfg.DAOForkBlock},
+		{"SiotImpr0", c.SiotImpr0Block, newcfg.SiotImpr0Block},
+		{"SiotImpr1", c.SiotImpr1Block, newcfg.SiotImpr1Block},
+		{"SiotImpr2", c.SiotImpr2Block, newcfg.SiotImpr2Block},
+	}
+	for _, fork := range forks {
+		if isForked(fork.have, head) || isForked(fork.want, head) {
+			if fork.have == nil || fork.want == nil || fork.have.Cmp(fork.want) != 0 {
+				return fmt.Errorf("%s fork block mismatch: stored %v, new %v (head #%v)", fork.name, fork.have, fork.want, head)
+			}
+		}
+	}
+	if isForked(c.DAOForkBlock, head) && c.DAOForkSupport != newcfg.DAOForkSupport {
+		return fmt.Errorf("DAO fork support flag cannot change after block #%v", c.DAOForkBlock)
+	}
+	if isForked(c.SiotImpr0Block, head) && c.SiotImpr0Hash != newcfg.SiotImpr0Hash {
+		return fmt.Errorf("SiotImpr0 hash cannot change after block #%v", c.SiotImpr0Block)
+	}
+	return nil
+}
+
+// isForked returns whether a fork scheduled at block s is active at the given
+// head block number.
+func isForked(s, head *big.Int) bool {
+	if s == nil || head == nil {
+		return false
+	}
+	return s.Cmp(head) <= 0
+}
+
 // Rules wraps ChainConfig and is merely syntatic sugar or can be used for functions
 // that do not have or require information about the block.
 //
@@ -65,3 +65,41 @@ var (
 		CreateBySuicide: big.NewInt(25000),
 	}
 )
+
+// TxGasTable contains the intrinsic gas charged for a transaction before any of
+// its code is executed.
+type TxGasTable struct {
+	Call        *big.Int // Base cost of a transaction calling an account
+	Create      *big.Int // Base cost of a transaction creating an externalLogic
+	DataZero    *big.Int // Per zero byte of data attached to the transaction
+	DataNonZero *big.Int // Per non-zero byte of data attached to the transaction
+}
+
+var (
+	// TxGasTableFrontier contains the intrinsic gas prices before homestead,
+	// which did not charge extra for creating an externalLogic.
+	TxGasTableFrontier = TxGasTable{
+		Call:        TxGas,
+		Create:      TxGas,
+		DataZero:    TxDataZeroGas,
+		DataNonZero: TxDataNonZeroGas,
+	}
+
+	// TxGasTableHomestead contains the intrinsic gas prices from homestead on,
+	// charging the creation surcharge on top of the call cost.
+	TxGasTableHomestead = TxGasTable{
+		Call:        TxGas,
+		Create:      TxGasExternalLogicCreation,
+		DataZero:    TxDataZeroGas,
+		DataNonZero: TxDataNonZeroGas,
+	}
+)
+
+// IntrinsicTxGasTable returns the intrinsic gas prices in effect on either side
+// of the homestead fork.
+func IntrinsicTxGasTable(homestead bool) TxGasTable {
+	if homestead {
+		return TxGasTableHomestead
+	}
+	return TxGasTableFrontier
+}
@@ -188,6 +188,15 @@ func (api *PublicAdminAPI) NodeInfo() (*p2p.NodeInfo, error) {
 	return server.NodeInfo(), nil
 }
 
+// DiscoveryStats retrieves the health metrics of the peer discovery.
+func (api *PublicAdminAPI) DiscoveryStats() (*p2p.DiscoveryStats, error) {
+	server := api.node.Server()
+	if server == nil {
+		return nil, ErrNodeStopped
+	}
+	return server.DiscoveryStats(), nil
+}
+
 // Datadir retrieves the current data directory the node is using.
 func (api *PublicAdminAPI) Datadir() string {
 	return api.node.DataDir()
@@ -50,6 +50,11 @@ type Config struct {
 	// in memory.
 	DataDir string
 
+	// AncientDir is the file system folder holding the immutable chain segments
+	// (block bodies and receipts), allowing them to reside on a slower disk than
+	// the rest of the databases. If empty, they are kept inside DataDir.
+	AncientDir string
+
 	// KeyStoreDir is the file system folder that contains private keys. The directory can
 	// be specified as a relative path, in which case it is resolved relative to the
 	// current directory.
@@ -124,6 +129,15 @@ type Config struct {
 	// exposed.
 	HTTPModules []string
 
+	// HTTPUnixSocket is the path of a Unix domain socket on which to serve the
+	// HTTP RPC protocol, exposing the HTTPModules. It allows local tools to use
+	// plain HTTP clients without opening a TCP port. An empty path disables it.
+	HTTPUnixSocket string
+
+	// HealthMaxBlocksBehind is the number of blocks the node may lag behind its
+	// best peer while still reporting healthy on the HTTP /health probe.
+	HealthMaxBlocksBehind uint64
+
 	// WSHost is the host interface on which to start the websocket RPC server. If
 	// this field is empty, no websocket API endpoint will be started.
 	WSHost string
@@ -142,6 +156,17 @@ type Config struct {
 	// If the module list is empty, all RPC API endpoints designated public will be
 	// exposed.
 	WSModules []string
+
+	// RPCAccessLog enables logging of every request served over the IPC, HTTP
+	// and websocket RPC interfaces, recording the method, caller, duration and
+	// error status. Sensitive arguments such as passwords are redacted.
+	RPCAccessLog bool
+
+	// RPCMethodFilter is a comma separated list of glob patterns further restricting
+	// the methods callable over the HTTP and websocket interfaces within the enabled
+	// modules. Patterns prefixed with "!" block the matching methods, e.g.
+	// "siot_*,!siot_sendRawTransaction". An empty filter permits all methods.
+	RPCMethodFilter string
 }
 
 // IPCEndpoint resolves an IPC endpoint based on a configured value, taking into
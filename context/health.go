@@ -0,0 +1,75 @@
+package context
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+)
+
+// healthPath is the URL path of the HTTP health probe, served next to the
+// JSON-RPC API on the HTTP endpoint.
+const healthPath = "/health"
+
+// SyncReporter is implemented by services that track the chain, allowing the
+// node to tell whether it is in sync with the network when probed for health.
+type SyncReporter interface {
+	// SyncStatus returns the number of the current head block, the number of
+	// blocks known to be missing compared to the best peer, and whether the sync
+	// status is known at all, which it isn't before the first sync with a peer.
+	SyncStatus() (height uint64, behind uint64, known bool)
+}
+
+// healthStatus is the JSON body returned by the health probe.
+type healthStatus struct {
+	Healthy bool   `json:"healthy"`
+	Height  uint64 `json:"height"`
+	Behind  uint64 `json:"behind"`
+	Synced  bool   `json:"synced"`
+	Peers   int    `json:"peers"`
+}
+
+// healthHandler wraps an HTTP RPC handler, answering plain GET requests to the
+// health path without going through JSON-RPC, so dumb load balancer probes
+// work. It replies 200 if the node is running, connected to peers, synced with
+// them at least once and no more than the configured number of blocks behind,
+// and 503 otherwise.
+func (n *Node) healthHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" || r.URL.Path != healthPath {
+			next.ServeHTTP(w, r)
+			return
+		}
+		status := n.health()
+
+		w.Header().Set("content-type", "application/json")
+		if !status.Healthy {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(status)
+	})
+}
+
+// health collects the current health status of the node.
+func (n *Node) health() healthStatus {
+	var status healthStatus
+	if atomic.LoadInt32(&n.stopping) == 1 {
+		return status
+	}
+	n.lock.RLock()
+	defer n.lock.RUnlock()
+
+	if n.server == nil {
+		return status
+	}
+	status.Peers = n.server.PeerCount()
+	status.Healthy = status.Peers > 0
+	for _, service := range n.services {
+		if reporter, ok := service.(SyncReporter); ok {
+			status.Height, status.Behind, status.Synced = reporter.SyncStatus()
+			if !status.Synced || status.Behind > n.config.HealthMaxBlocksBehind {
+				status.Healthy = false
+			}
+		}
+	}
+	return status
+}
@@ -2,13 +2,16 @@ package context
 
 import (
 	"errors"
+	"fmt"
 	"net"
 	"os"
 	"path/filepath"
 	"reflect"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
+	"time"
 
 	"github.com/siotchain/siot/wallet"
 	"github.com/siotchain/siot/database"
@@ -44,8 +47,9 @@ type Node struct {
 	serviceFuncs []ServiceConstructor     // Service constructors (in dependency order)
 	services     map[reflect.Type]Service // Currently running services
 
-	rpcAPIs       []rpc.API   // List of APIs currently provided by the node
-	inprocHandler *rpc.Server // In-process RPC request handler to process the API requests
+	rpcAPIs       []rpc.API         // List of APIs currently provided by the node
+	inprocHandler *rpc.Server       // In-process RPC request handler to process the API requests
+	rpcFilter     *rpc.MethodFilter // Methods permitted over the HTTP and websocket endpoints
 
 	ipcEndpoint string       // IPC endpoint to listen at (empty = IPC disabled)
 	ipcListener net.Listener // IPC RPC listener socket to serve API requests
@@ -56,12 +60,17 @@ type Node struct {
 	httpListener  net.Listener // HTTP RPC listener socket to server API requests
 	httpHandler   *rpc.Server  // HTTP RPC request handler to process the API requests
 
+	unixEndpoint string       // Unix socket path to serve HTTP RPC at (empty = disabled)
+	unixListener net.Listener // Unix socket listener to serve HTTP RPC requests
+	unixHandler  *rpc.Server  // Unix socket HTTP RPC request handler to process the API requests
+
 	wsEndpoint string       // Websocket endpoint (interface + port) to listen at (empty = websocket disabled)
 	wsListener net.Listener // Websocket RPC listener socket to server API requests
 	wsHandler  *rpc.Server  // Websocket RPC request handler to process the API requests
 
-	stop chan struct{} // Channel to wait for termination notifications
-	lock sync.RWMutex
+	stop     chan struct{} // Channel to wait for termination notifications
+	stopping int32         // Set while shutting down to fail health probes (atomic)
+	lock     sync.RWMutex
 }
 
 // New creates a new P2P node, ready for protocol registration.
@@ -103,6 +112,7 @@ func New(conf *Config) (*Node, error) {
 		serviceFuncs:      []ServiceConstructor{},
 		ipcEndpoint:       conf.IPCEndpoint(),
 		httpEndpoint:      conf.HTTPEndpoint(),
+		unixEndpoint:      conf.HTTPUnixSocket,
 		wsEndpoint:        conf.WSEndpoint(),
 		eventmux:          new(subscribe.TypeMux),
 	}, nil
@@ -130,6 +140,7 @@ func (n *Node) Start() error {
 	if n.server != nil {
 		return ErrNodeRunning
 	}
+	atomic.StoreInt32(&n.stopping, 0)
 	if err := n.openDataDir(); err != nil {
 		return err
 	}
@@ -247,6 +258,13 @@ func (n *Node) startRPC(services map[reflect.Type]Service) error {
 	for _, service := range services {
 		apis = append(apis, service.APIs()...)
 	}
+	// Parse the method filter restricting the HTTP and websocket endpoints
+	filter, err := rpc.ParseMethodFilter(n.config.RPCMethodFilter)
+	if err != nil {
+		return err
+	}
+	n.rpcFilter = filter
+
 	// Start the various API endpoints, terminating all in case of errors
 	if err := n.startInProc(apis); err != nil {
 		return err
@@ -260,7 +278,14 @@ func (n *Node) startRPC(services map[reflect.Type]Service) error {
 		n.stopInProc()
 		return err
 	}
+	if err := n.startUnixHTTP(n.unixEndpoint, apis, n.config.HTTPModules); err != nil {
+		n.stopHTTP()
+		n.stopIPC()
+		n.stopInProc()
+		return err
+	}
 	if err := n.startWS(n.wsEndpoint, apis, n.config.WSModules, n.config.WSOrigins); err != nil {
+		n.stopUnixHTTP()
 		n.stopHTTP()
 		n.stopIPC()
 		n.stopInProc()
@@ -301,6 +326,7 @@ func (n *Node) startIPC(apis []rpc.API) error {
 	}
 	// Register all the APIs exposed by the services
 	handler := rpc.NewServer()
+	handler.SetAccessLog(n.config.RPCAccessLog)
 	for _, api := range apis {
 		if err := handler.RegisterName(api.Namespace, api.Service); err != nil {
 			return err
@@ -366,6 +392,8 @@ func (n *Node) startHTTP(endpoint string, apis []rpc.API, modules []string, cors
 	}
 	// Register all the APIs exposed by the services
 	handler := rpc.NewServer()
+	handler.SetAccessLog(n.config.RPCAccessLog)
+	handler.SetMethodFilter(n.rpcFilter)
 	for _, api := range apis {
 		if whitelist[api.Namespace] || (len(whitelist) == 0 && api.Public) {
 			if err := handler.RegisterName(api.Namespace, api.Service); err != nil {
@@ -382,7 +410,9 @@ func (n *Node) startHTTP(endpoint string, apis []rpc.API, modules []string, cors
 	if listener, err = net.Listen("tcp", endpoint); err != nil {
 		return err
 	}
-	go rpc.NewHTTPServer(cors, handler).Serve(listener)
+	server := rpc.NewHTTPServer(cors, handler)
+	server.Handler = n.healthHandler(server.Handler)
+	go server.Serve(listener)
 
 	// All listeners booted successfully
 	n.httpEndpoint = endpoint
@@ -404,6 +434,75 @@ func (n *Node) stopHTTP() {
 	}
 }
 
+// startUnixHTTP initializes and starts the HTTP RPC endpoint on a Unix domain
+// socket, exposing the same modules as the TCP HTTP endpoint.
+func (n *Node) startUnixHTTP(path string, apis []rpc.API, modules []string) error {
+	// Short circuit if the Unix socket endpoint isn't being exposed
+	if path == "" {
+		return nil
+	}
+	// Refuse to clobber a socket served by a running instance, but clean up any
+	// stale one left behind by a crashed node
+	if _, err := os.Stat(path); err == nil {
+		conn, err := net.DialTimeout("unix", path, time.Second)
+		if err == nil {
+			conn.Close()
+			return fmt.Errorf("unix socket %s is in use by another running instance", path)
+		}
+		glog.V(logger.Info).Infof("Removing stale unix socket %s", path)
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("failed to remove stale unix socket %s: %v", path, err)
+		}
+	}
+	// Generate the whitelist based on the allowed modules
+	whitelist := make(map[string]bool)
+	for _, module := range modules {
+		whitelist[module] = true
+	}
+	// Register all the APIs exposed by the services
+	handler := rpc.NewServer()
+	handler.SetAccessLog(n.config.RPCAccessLog)
+	handler.SetMethodFilter(n.rpcFilter)
+	for _, api := range apis {
+		if whitelist[api.Namespace] || (len(whitelist) == 0 && api.Public) {
+			if err := handler.RegisterName(api.Namespace, api.Service); err != nil {
+				return err
+			}
+			glog.V(logger.Debug).Infof("HTTP (unix) registered %T under '%s'", api.Service, api.Namespace)
+		}
+	}
+	// All APIs registered, start the HTTP listener on the socket
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+	server := rpc.NewHTTPServer("", handler)
+	server.Handler = n.healthHandler(server.Handler)
+	go server.Serve(listener)
+	glog.V(logger.Info).Infof("HTTP endpoint opened: unix://%s", path)
+
+	// All listeners booted successfully
+	n.unixListener = listener
+	n.unixHandler = handler
+
+	return nil
+}
+
+// stopUnixHTTP terminates the Unix socket HTTP RPC endpoint, removing the
+// socket file.
+func (n *Node) stopUnixHTTP() {
+	if n.unixListener != nil {
+		n.unixListener.Close()
+		n.unixListener = nil
+
+		os.Remove(n.unixEndpoint)
+	}
+	if n.unixHandler != nil {
+		n.unixHandler.Stop()
+		n.unixHandler = nil
+	}
+}
+
 // startWS initializes and starts the websocket RPC endpoint.
 func (n *Node) startWS(endpoint string, apis []rpc.API, modules []string, wsOrigins string) error {
 	// Short circuit if the WS endpoint isn't being exposed
@@ -417,6 +516,8 @@ func (n *Node) startWS(endpoint string, apis []rpc.API, modules []string, wsOrig
 	}
 	// Register all the APIs exposed by the services
 	handler := rpc.NewServer()
+	handler.SetAccessLog(n.config.RPCAccessLog)
+	handler.SetMethodFilter(n.rpcFilter)
 	for _, api := range apis {
 		if whitelist[api.Namespace] || (len(whitelist) == 0 && api.Public) {
 			if err := handler.RegisterName(api.Namespace, api.Service); err != nil {
@@ -461,6 +562,8 @@ func (n *Node) stopWS() {
 // Stop terminates a running node along with all it's services. In the node was
 // not started, an error is returned.
 func (n *Node) Stop() error {
+	atomic.StoreInt32(&n.stopping, 1)
+
 	n.lock.Lock()
 	defer n.lock.Unlock()
 
@@ -471,6 +574,7 @@ func (n *Node) Stop() error {
 
 	// Terminate the API, services and the p2p server.
 	n.stopWS()
+	n.stopUnixHTTP()
 	n.stopHTTP()
 	n.stopIPC()
 	n.rpcAPIs = nil
@@ -621,6 +725,16 @@ func (n *Node) OpenDatabase(name string, cache, handles int) (database.Database,
 	return database.NewLDBDatabase(n.config.resolvePath(name), cache, handles)
 }
 
+// OpenAncientDatabase opens the store for the immutable chain segments of the
+// named database. If no separate ancient directory was configured, nil is
+// returned and the data stays in the main database.
+func (n *Node) OpenAncientDatabase(name string, cache, handles int) (database.Database, error) {
+	if n.config.DataDir == "" || n.config.AncientDir == "" {
+		return nil, nil
+	}
+	return database.NewLDBDatabase(filepath.Join(n.config.AncientDir, name), cache, handles)
+}
+
 // ResolvePath returns the absolute path of a resource in the instance directory.
 func (n *Node) ResolvePath(x string) string {
 	return n.config.resolvePath(x)
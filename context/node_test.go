@@ -0,0 +1,54 @@
+package context
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Tests that the HTTP RPC Unix socket replaces a stale socket left behind by a
+// crashed node, refuses one in use, and serves the health probe.
+func TestUnixHTTPSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "unix-http")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "http.sock")
+
+	// Leave a stale socket behind, as a crashed node would
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("failed to create stale socket: %v", err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	n := &Node{config: &Config{}, unixEndpoint: path}
+	if err := n.startUnixHTTP(path, nil, nil); err != nil {
+		t.Fatalf("failed to start over a stale socket: %v", err)
+	}
+	defer n.stopUnixHTTP()
+
+	// A second endpoint on the live socket must be refused
+	other := &Node{config: &Config{}}
+	if err := other.startUnixHTTP(path, nil, nil); err == nil {
+		other.stopUnixHTTP()
+		t.Fatalf("started on a socket in use")
+	}
+	// The health probe must be served on the socket, unhealthy without a server
+	client := &http.Client{Transport: &http.Transport{
+		Dial: func(network, addr string) (net.Conn, error) { return net.Dial("unix", path) },
+	}}
+	res, err := client.Get("http://unix" + healthPath)
+	if err != nil {
+		t.Fatalf("failed to probe health: %v", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("health status mismatch: have %d, want %d", res.StatusCode, http.StatusServiceUnavailable)
+	}
+}
@@ -1,6 +1,7 @@
 package context
 
 import (
+	"path/filepath"
 	"reflect"
 
 	"github.com/siotchain/siot/wallet"
@@ -30,6 +31,15 @@ func (ctx *ServiceContext) OpenDatabase(name string, cache int, handles int) (da
 	return database.NewLDBDatabase(ctx.config.resolvePath(name), cache, handles)
 }
 
+// OpenAncientDatabase opens the store for the immutable chain segments of the
+// named database, or returns nil if they should stay in the main database.
+func (ctx *ServiceContext) OpenAncientDatabase(name string, cache int, handles int) (database.Database, error) {
+	if ctx.config.DataDir == "" || ctx.config.AncientDir == "" {
+		return nil, nil
+	}
+	return database.NewLDBDatabase(filepath.Join(ctx.config.AncientDir, name), cache, handles)
+}
+
 // Service retrieves a currently running service registered of a specific type.
 func (ctx *ServiceContext) Service(service interface{}) error {
 	element := reflect.ValueOf(service).Elem()
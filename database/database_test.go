@@ -0,0 +1,121 @@
+package database
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+// testIterator fills the database with entries under a few prefixes and checks
+// that iterating one of them returns exactly its entries in key order, and that
+// released iterators are exhausted.
+func testIterator(t *testing.T, db Database) {
+	entries := map[string]string{
+		"a":   "before",
+		"b-3": "three",
+		"b-1": "one",
+		"b-2": "two",
+		"b":   "prefix",
+		"c-1": "after",
+	}
+	for key, value := range entries {
+		if err := db.Put([]byte(key), []byte(value)); err != nil {
+			t.Fatalf("failed to put %q: %v", key, err)
+		}
+	}
+	it := db.NewIterator([]byte("b-"))
+	for _, key := range []string{"b-1", "b-2", "b-3"} {
+		if !it.Next() {
+			t.Fatalf("iterator exhausted before %q", key)
+		}
+		if !bytes.Equal(it.Key(), []byte(key)) || !bytes.Equal(it.Value(), []byte(entries[key])) {
+			t.Errorf("entry mismatch: have %q=%q, want %q=%q", it.Key(), it.Value(), key, entries[key])
+		}
+	}
+	if it.Next() {
+		t.Errorf("iterator not exhausted: positioned on %q", it.Key())
+	}
+	it.Release()
+
+	// A released iterator must not return anything anymore
+	it = db.NewIterator([]byte("b"))
+	if !it.Next() || !bytes.Equal(it.Key(), []byte("b")) {
+		t.Fatalf("prefix entry mismatch: have %q, want %q", it.Key(), "b")
+	}
+	it.Release()
+	if it.Next() {
+		t.Errorf("released iterator positioned on %q", it.Key())
+	}
+	// An empty prefix iterates everything
+	it = db.NewIterator(nil)
+	defer it.Release()
+
+	var count int
+	for it.Next() {
+		count++
+	}
+	if count != len(entries) {
+		t.Errorf("full iteration entry count mismatch: have %d, want %d", count, len(entries))
+	}
+}
+
+func TestMemDatabaseIterator(t *testing.T) {
+	db, _ := NewMemDatabase()
+	testIterator(t, db)
+}
+
+func TestLDBDatabaseIterator(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ldb-iterator")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := NewLDBDatabase(dir, 16, 16)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	testIterator(t, db)
+}
+
+// Tests that the iterator of a tiered database merges the entries of its
+// stores in key order, preferring the hot values of keys held by both.
+func TestTieredDatabaseIterator(t *testing.T) {
+	hot, _ := NewMemDatabase()
+	ancient, _ := NewMemDatabase()
+	db := NewTieredDatabase(hot, ancient, func([]byte) bool { return true })
+
+	testIterator(t, db)
+
+	ancient.Put([]byte("b-0"), []byte("zero"))
+	ancient.Put([]byte("b-2"), []byte("stale"))
+
+	it := db.NewIterator([]byte("b-"))
+	defer it.Release()
+
+	var keys, values []string
+	for it.Next() {
+		keys, values = append(keys, string(it.Key())), append(values, string(it.Value()))
+	}
+	if want := []string{"b-0", "b-1", "b-2", "b-3"}; !equalStrings(keys, want) {
+		t.Errorf("merged keys mismatch: have %v, want %v", keys, want)
+	}
+	if want := []string{"zero", "one", "two", "three"}; !equalStrings(values, want) {
+		t.Errorf("merged values mismatch: have %v, want %v", values, want)
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
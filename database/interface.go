@@ -6,9 +6,22 @@ type Database interface {
 	Delete(key []byte) error
 	Close()
 	NewBatch() Batch
+	NewIterator(prefix []byte) Iterator
 }
 
 type Batch interface {
 	Put(key, value []byte) error
 	Write() error
 }
+
+// Iterator walks the entries of a database with a common key prefix in ascending
+// key order. It starts positioned before the first entry, so Next has to be
+// called before accessing the first key. The contents returned by Key and Value
+// are only valid until the next call to Next. The iterator must be released once
+// no longer needed, after which it is exhausted.
+type Iterator interface {
+	Next() bool
+	Key() []byte
+	Value() []byte
+	Release()
+}
@@ -2,6 +2,8 @@ package database
 
 import (
 	"errors"
+	"sort"
+	"strings"
 	"sync"
 
 	"github.com/siotchain/siot/helper"
@@ -75,6 +77,28 @@ func (db *MemDatabase) Delete(key []byte) error {
 
 func (db *MemDatabase) Close() {}
 
+// NewIterator returns an iterator over a snapshot of the entries whose key starts
+// with prefix.
+func (db *MemDatabase) NewIterator(prefix []byte) Iterator {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	var keys []string
+	for key := range db.db {
+		if strings.HasPrefix(key, string(prefix)) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	it := &memIterator{index: -1}
+	for _, key := range keys {
+		it.keys = append(it.keys, []byte(key))
+		it.values = append(it.values, helper.CopyBytes(db.db[key]))
+	}
+	return it
+}
+
 func (db *MemDatabase) NewBatch() Batch {
 	return &memBatch{db: db}
 }
@@ -95,6 +119,39 @@ func (b *memBatch) Put(key, value []byte) error {
 	return nil
 }
 
+type memIterator struct {
+	keys   [][]byte
+	values [][]byte
+	index  int
+}
+
+func (it *memIterator) Next() bool {
+	if it.index >= len(it.keys) {
+		return false
+	}
+	it.index++
+	return it.index < len(it.keys)
+}
+
+func (it *memIterator) Key() []byte {
+	if it.index < 0 || it.index >= len(it.keys) {
+		return nil
+	}
+	return it.keys[it.index]
+}
+
+func (it *memIterator) Value() []byte {
+	if it.index < 0 || it.index >= len(it.keys) {
+		return nil
+	}
+	return it.values[it.index]
+}
+
+func (it *memIterator) Release() {
+	it.keys, it.values = nil, nil
+	it.index = 0
+}
+
 func (b *memBatch) Write() error {
 	b.lock.RLock()
 	defer b.lock.RUnlock()
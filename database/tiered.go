@@ -0,0 +1,156 @@
+package database
+
+import (
+	"bytes"
+
+	"github.com/siotchain/siot/helper"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// TieredDatabase splits the keys of a database between a hot store and an
+// ancient store. All writes land in the hot store; data only reaches the ancient
+// store when it is explicitly frozen, once it is old enough to be rarely read.
+// Reads of keys accepted by the classifier fall back to the ancient store.
+type TieredDatabase struct {
+	hot       Database
+	ancient   Database
+	isAncient func(key []byte) bool
+}
+
+// NewTieredDatabase creates a database whose keys matched by isAncient may be
+// frozen into the ancient store. If no ancient store is given, the hot one is
+// returned as is.
+func NewTieredDatabase(hot, ancient Database, isAncient func(key []byte) bool) Database {
+	if ancient == nil {
+		return hot
+	}
+	return &TieredDatabase{hot: hot, ancient: ancient, isAncient: isAncient}
+}
+
+// Hot returns the store holding the frequently accessed data.
+func (db *TieredDatabase) Hot() Database {
+	return db.hot
+}
+
+// LDB returns the LevelDB instance of the hot store, if it has one.
+func (db *TieredDatabase) LDB() *leveldb.DB {
+	if ldb, ok := db.hot.(*LDBDatabase); ok {
+		return ldb.LDB()
+	}
+	return nil
+}
+
+// Freeze moves the given keys from the hot store into the ancient one. Keys not
+// accepted by the classifier or missing from the hot store are skipped. The
+// ancient copies are persisted before anything is removed from the hot store.
+func (db *TieredDatabase) Freeze(keys [][]byte) error {
+	batch := db.ancient.NewBatch()
+	moved := make([][]byte, 0, len(keys))
+	for _, key := range keys {
+		if !db.isAncient(key) {
+			continue
+		}
+		value, err := db.hot.Get(key)
+		if err != nil {
+			continue
+		}
+		if err := batch.Put(key, value); err != nil {
+			return err
+		}
+		moved = append(moved, key)
+	}
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	for _, key := range moved {
+		if err := db.hot.Delete(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (db *TieredDatabase) Put(key []byte, value []byte) error {
+	return db.hot.Put(key, value)
+}
+
+func (db *TieredDatabase) Get(key []byte) ([]byte, error) {
+	value, err := db.hot.Get(key)
+	if err != nil && db.isAncient(key) {
+		return db.ancient.Get(key)
+	}
+	return value, err
+}
+
+func (db *TieredDatabase) Delete(key []byte) error {
+	if db.isAncient(key) {
+		if err := db.ancient.Delete(key); err != nil {
+			return err
+		}
+	}
+	return db.hot.Delete(key)
+}
+
+func (db *TieredDatabase) Close() {
+	db.ancient.Close()
+	db.hot.Close()
+}
+
+// NewIterator merges the entries of both stores with the given prefix. Keys found
+// in both are reported once, with the value held by the hot store.
+func (db *TieredDatabase) NewIterator(prefix []byte) Iterator {
+	return &tieredIterator{hot: db.hot.NewIterator(prefix), ancient: db.ancient.NewIterator(prefix)}
+}
+
+func (db *TieredDatabase) NewBatch() Batch {
+	return db.hot.NewBatch()
+}
+
+type tieredIterator struct {
+	hot       Iterator
+	ancient   Iterator
+	hotOk     bool // Whether the hot iterator is positioned on an unconsumed entry
+	ancientOk bool // Whether the ancient iterator is positioned on an unconsumed entry
+	started   bool
+
+	key   []byte
+	value []byte
+}
+
+func (it *tieredIterator) Next() bool {
+	if !it.started {
+		it.hotOk, it.ancientOk = it.hot.Next(), it.ancient.Next()
+		it.started = true
+	}
+	cmp := 0
+	if it.hotOk && it.ancientOk {
+		cmp = bytes.Compare(it.hot.Key(), it.ancient.Key())
+	}
+	switch {
+	case !it.hotOk && !it.ancientOk:
+		it.key, it.value = nil, nil
+		return false
+
+	case !it.ancientOk || (it.hotOk && cmp <= 0):
+		it.key, it.value = helper.CopyBytes(it.hot.Key()), helper.CopyBytes(it.hot.Value())
+		it.hotOk = it.hot.Next()
+		if it.ancientOk && cmp == 0 {
+			it.ancientOk = it.ancient.Next()
+		}
+
+	default:
+		it.key, it.value = helper.CopyBytes(it.ancient.Key()), helper.CopyBytes(it.ancient.Value())
+		it.ancientOk = it.ancient.Next()
+	}
+	return true
+}
+
+func (it *tieredIterator) Key() []byte   { return it.key }
+func (it *tieredIterator) Value() []byte { return it.value }
+
+func (it *tieredIterator) Release() {
+	it.hot.Release()
+	it.ancient.Release()
+	it.hotOk, it.ancientOk, it.started = false, false, true
+	it.key, it.value = nil, nil
+}
@@ -0,0 +1,21 @@
+package helper
+
+import (
+	"bytes"
+
+	"github.com/siotchain/siot/helper/rlp"
+)
+
+// RLPEqual reports whether a and b have identical RLP encodings. As only the
+// consensus fields are encoded, any in-memory caches are ignored.
+func RLPEqual(a, b interface{}) (bool, error) {
+	ablob, err := rlp.EncodeToBytes(a)
+	if err != nil {
+		return false, err
+	}
+	bblob, err := rlp.EncodeToBytes(b)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(ablob, bblob), nil
+}
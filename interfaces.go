@@ -72,6 +72,20 @@ type ChainHeadEventer interface {
 	SubscribeNewHead(ctx context.Context, ch chan<- *types.Header) (Subscription, error)
 }
 
+// ChainReorg describes a reorganisation of the canonical chain. Removed holds the
+// headers of the blocks dropped from the chain, newest first, and Added those of
+// the blocks that replaced them, oldest first.
+type ChainReorg struct {
+	Ancestor *types.Header   `json:"ancestor"`
+	Removed  []*types.Header `json:"removed"`
+	Added    []*types.Header `json:"added"`
+}
+
+// A ChainReorgEventer returns notifications whenever the canonical chain is reorganised.
+type ChainReorgEventer interface {
+	SubscribeChainReorg(ctx context.Context, ch chan<- *ChainReorg) (Subscription, error)
+}
+
 // CallMsg contains parameters for externalLogic calls.
 type CallMsg struct {
 	From     helper.Address  // the sender of the 'transaction'
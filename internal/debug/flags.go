@@ -3,8 +3,11 @@ package debug
 import (
 	"fmt"
 	"net/http"
-	_ "net/http/pprof"
+	"net/http/pprof"
 	"runtime"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/siotchain/siot/logger"
 	"github.com/siotchain/siot/logger/glog"
@@ -22,6 +25,10 @@ var (
 		Usage: "Per-module verbosity: comma-separated list of <pattern>=<level> (e.g. siot/*=6,p2p=5)",
 		Value: glog.GetVModule(),
 	}
+	logModuleFlag = cli.StringFlag{
+		Name:  "log.module",
+		Usage: "Per-subsystem verbosity: comma-separated list of <module>=<level> (e.g. txpool=5,miner=3)",
+	}
 	backtraceAtFlag = cli.GenericFlag{
 		Name:  "backtrace",
 		Usage: "Request a stack trace at a specific logging statement (e.g. \"block.go:271\")",
@@ -32,12 +39,12 @@ var (
 		Usage: "Enable the pprof HTTP server",
 	}
 	pprofPortFlag = cli.IntFlag{
-		Name:  "pprofport",
-		Usage: "pprof HTTP server listening port",
+		Name:  "pprof.port",
+		Usage: "pprof HTTP server listening port (separate from the RPC port)",
 		Value: 6060,
 	}
 	pprofAddrFlag = cli.StringFlag{
-		Name:  "pprofaddr",
+		Name:  "pprof.addr",
 		Usage: "pprof HTTP server listening interface",
 		Value: "127.0.0.1",
 	}
@@ -62,7 +69,7 @@ var (
 
 // Flags holds all cmd-line flags required for debugging.
 var Flags = []cli.Flag{
-	verbosityFlag, vmoduleFlag, backtraceAtFlag,
+	verbosityFlag, vmoduleFlag, logModuleFlag, backtraceAtFlag,
 	pprofFlag, pprofAddrFlag, pprofPortFlag,
 	memprofilerateFlag, blockprofilerateFlag, cpuprofileFlag, traceFlag,
 }
@@ -73,6 +80,18 @@ func Setup(ctx *cli.Context) error {
 	// logging
 	glog.CopyStandardLogTo("INFO")
 	glog.SetToStderr(true)
+	if spec := ctx.GlobalString(logModuleFlag.Name); spec != "" {
+		if ctx.GlobalIsSet(vmoduleFlag.Name) {
+			return fmt.Errorf("--%s and --%s are mutually exclusive", logModuleFlag.Name, vmoduleFlag.Name)
+		}
+		vmodule, err := parseLogModules(spec)
+		if err != nil {
+			return err
+		}
+		if err := glog.GetVModule().Set(vmodule); err != nil {
+			return err
+		}
+	}
 
 	// profiling, tracing
 	runtime.MemProfileRate = ctx.GlobalInt(memprofilerateFlag.Name)
@@ -93,15 +112,90 @@ func Setup(ctx *cli.Context) error {
 		address := fmt.Sprintf("%s:%d", ctx.GlobalString(pprofAddrFlag.Name), ctx.GlobalInt(pprofPortFlag.Name))
 		go func() {
 			glog.V(logger.Info).Infof("starting pprof server at http://%s/debug/pprof", address)
-			glog.Errorln(http.ListenAndServe(address, nil))
+			glog.Errorln(http.ListenAndServe(address, pprofHandler()))
 		}()
 	}
 	return nil
 }
 
+// pprofHandler returns a handler serving only the profiling endpoints. It is
+// used instead of http.DefaultServeMux, so nothing else registered there gets
+// exposed, and the profiles are never served from any other HTTP server.
+func pprofHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return mux
+}
+
+// parseLogModules converts a --log.module specification into the equivalent
+// glog vmodule pattern list, rejecting unknown modules and invalid levels.
+func parseLogModules(spec string) (string, error) {
+	// File patterns go first so they take precedence over the package-wide
+	// patterns of any enclosing module (glog applies the first match).
+	var files, packages []string
+	for _, entry := range strings.Split(spec, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		parts := strings.Split(entry, "=")
+		if len(parts) != 2 {
+			return "", fmt.Errorf("invalid log module entry %q, expected <module>=<level>", entry)
+		}
+		module, ok := logModules[parts[0]]
+		if !ok {
+			return "", fmt.Errorf("unknown log module %q (known: %s)", parts[0], strings.Join(knownLogModules(), ", "))
+		}
+		level, err := strconv.Atoi(parts[1])
+		if err != nil || level < 0 || level > logger.Detail {
+			return "", fmt.Errorf("invalid log level %q for module %s, expected 0-%d", parts[1], parts[0], logger.Detail)
+		}
+		for _, pattern := range module {
+			if strings.HasSuffix(pattern, ".go") {
+				files = append(files, fmt.Sprintf("%s=%d", pattern, level))
+			} else {
+				packages = append(packages, fmt.Sprintf("%s=%d", pattern, level))
+			}
+		}
+	}
+	return strings.Join(append(files, packages...), ","), nil
+}
+
+// knownLogModules returns the sorted names of the subsystems accepted by the
+// --log.module flag.
+func knownLogModules() []string {
+	names := make([]string, 0, len(logModules))
+	for name := range logModules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 // Exit stops all running profiles, flushing their output to the
 // respective file.
 func Exit() {
 	Handler.StopCPUProfile()
 	Handler.StopGoTrace()
 }
+
+// logModules maps the subsystem names accepted by --log.module to the source
+// file patterns that glog's vmodule filter matches against.
+var logModules = map[string][]string{
+	"blockchain": {"blockchainCore"},
+	"txpool":     {"blockchainCore/tx_pool.go", "blockchainCore/tx_list.go"},
+	"state":      {"blockchainCore/state"},
+	"vm":         {"blockchainCore/localEnv"},
+	"miner":      {"miner"},
+	"siot":       {"siot"},
+	"downloader": {"siot/downloader"},
+	"fetcher":    {"siot/fetcher"},
+	"p2p":        {"net/p2p/*"},
+	"rpc":        {"net/rpc"},
+	"node":       {"context"},
+	"wallet":     {"wallet"},
+	"trie":       {"trie"},
+}
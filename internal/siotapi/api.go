@@ -111,12 +111,16 @@ func (s *PublicTxPoolAPI) Content() map[string]map[string]map[string]*RPCTransac
 	return content
 }
 
-// Status returns the number of pending and queued transaction in the pool.
-func (s *PublicTxPoolAPI) Status() map[string]*rpc.HexNumber {
+// Status returns the number of pending and queued transaction in the pool, how
+// close the pool is to its capacity limits and for how many seconds the oldest
+// pending transaction has been waiting to be mined.
+func (s *PublicTxPoolAPI) Status() map[string]interface{} {
 	pending, queue := s.b.Stats()
-	return map[string]*rpc.HexNumber{
-		"pending": rpc.NewHexNumber(pending),
-		"queued":  rpc.NewHexNumber(queue),
+	return map[string]interface{}{
+		"pending":       rpc.NewHexNumber(pending),
+		"queued":        rpc.NewHexNumber(queue),
+		"pressure":      s.b.TxPoolPressure(),
+		"oldestPending": rpc.NewHexNumber(uint64(s.b.TxPoolOldestPending() / time.Second)),
 	}
 }
 
@@ -363,6 +367,20 @@ func (s *PublicBlockChainAPI) GetBalance(ctx context.Context, address helper.Add
 	return state.GetBalance(ctx, address)
 }
 
+// GetBalanceByHash returns the amount of wei for the given address in the state
+// of the block with the given hash. Unlike a block number, the hash identifies
+// the same state even across chain reorganisations.
+func (s *PublicBlockChainAPI) GetBalanceByHash(ctx context.Context, address helper.Address, blockHash helper.Hash) (*big.Int, error) {
+	state, _, err := s.b.StateAndHeaderByHash(ctx, blockHash)
+	if err != nil {
+		return nil, err
+	}
+	if state == nil {
+		return nil, fmt.Errorf("unknown block hash %x", blockHash)
+	}
+	return state.GetBalance(ctx, address)
+}
+
 // GetBlockByNumber returns the requested block. When blockNr is -1 the chain head is returned. When fullTx is true all
 // transactions in the block are returned in full detail, otherwise only the transaction hash is returned.
 func (s *PublicBlockChainAPI) GetBlockByNumber(ctx context.Context, blockNr rpc.BlockNumber, fullTx bool) (map[string]interface{}, error) {
@@ -466,6 +484,40 @@ func (s *PublicBlockChainAPI) GetStorageAt(ctx context.Context, address helper.A
 	return res.Hex(), nil
 }
 
+// GetCodeByHash returns the code stored at the given address in the state of the
+// block with the given hash.
+func (s *PublicBlockChainAPI) GetCodeByHash(ctx context.Context, address helper.Address, blockHash helper.Hash) (string, error) {
+	state, _, err := s.b.StateAndHeaderByHash(ctx, blockHash)
+	if err != nil {
+		return "", err
+	}
+	if state == nil {
+		return "", fmt.Errorf("unknown block hash %x", blockHash)
+	}
+	res, err := state.GetCode(ctx, address)
+	if len(res) == 0 || err != nil {
+		return "0x", err
+	}
+	return helper.ToHex(res), nil
+}
+
+// GetStorageAtByHash returns the storage from the state at the given address and
+// key in the block with the given hash.
+func (s *PublicBlockChainAPI) GetStorageAtByHash(ctx context.Context, address helper.Address, key string, blockHash helper.Hash) (string, error) {
+	state, _, err := s.b.StateAndHeaderByHash(ctx, blockHash)
+	if err != nil {
+		return "0x", err
+	}
+	if state == nil {
+		return "0x", fmt.Errorf("unknown block hash %x", blockHash)
+	}
+	res, err := state.GetState(ctx, address, helper.HexToHash(key))
+	if err != nil {
+		return "0x", err
+	}
+	return res.Hex(), nil
+}
+
 // callmsg is the message type used for call transations.
 type callmsg struct {
 	addr          helper.Address
@@ -496,13 +548,55 @@ type CallArgs struct {
 	Data     string          `json:"data"`
 }
 
-func (s *PublicBlockChainAPI) doCall(ctx context.Context, args CallArgs, blockNr rpc.BlockNumber) (string, *big.Int, error) {
+// AccountOverride specifies the fields of an account to replace before executing
+// a call. Fields left empty keep their current value. The State keys and values
+// are hex encoded storage slots.
+type AccountOverride struct {
+	Balance *rpc.HexNumber    `json:"balance"`
+	Nonce   *rpc.HexNumber    `json:"nonce"`
+	Code    *rpc.HexBytes     `json:"code"`
+	State   map[string]string `json:"state"`
+}
+
+// StateOverride is the set of account overrides to apply to the state, keyed
+// by the hex encoded account address.
+type StateOverride map[string]AccountOverride
+
+// apply writes the overridden account fields into the given state.
+func (diff StateOverride) apply(state State) error {
+	for hex, account := range diff {
+		if !helper.IsHexAddress(hex) {
+			return fmt.Errorf("invalid override address %q", hex)
+		}
+		addr := helper.HexToAddress(hex)
+		if account.Balance != nil {
+			state.SetBalance(addr, account.Balance.BigInt())
+		}
+		if account.Nonce != nil {
+			state.SetNonce(addr, account.Nonce.Uint64())
+		}
+		if account.Code != nil {
+			state.SetCode(addr, *account.Code)
+		}
+		for key, value := range account.State {
+			state.SetState(addr, helper.HexToHash(key), helper.HexToHash(value))
+		}
+	}
+	return nil
+}
+
+func (s *PublicBlockChainAPI) doCall(ctx context.Context, args CallArgs, blockNr rpc.BlockNumber, overrides *StateOverride) (string, *big.Int, error) {
 	defer func(start time.Time) { glog.V(logger.Debug).Infof("call took %v", time.Since(start)) }(time.Now())
 
 	state, header, err := s.b.StateAndHeaderByNumber(ctx, blockNr)
 	if state == nil || err != nil {
 		return "0x", helper.Big0, err
 	}
+	if overrides != nil {
+		if err := overrides.apply(state); err != nil {
+			return "0x", helper.Big0, err
+		}
+	}
 
 	// Set the account address to interact with
 	var addr helper.Address
@@ -519,9 +613,16 @@ func (s *PublicBlockChainAPI) doCall(ctx context.Context, args CallArgs, blockNr
 
 	// Assemble the CALL invocation
 	gas, gasPrice := args.Gas.BigInt(), args.GasPrice.BigInt()
-	if gas.Cmp(helper.Big0) == 0 {
+	requested := gas.Sign() > 0
+	if !requested {
 		gas = big.NewInt(50000000)
 	}
+	if limit, strict := s.b.RPCGasCap(); limit != nil && gas.Cmp(limit) > 0 {
+		if strict && requested {
+			return "0x", helper.Big0, fmt.Errorf("gas %v exceeds the RPC gas cap of %v", gas, limit)
+		}
+		gas = new(big.Int).Set(limit)
+	}
 	if gasPrice.Cmp(helper.Big0) == 0 {
 		gasPrice = new(big.Int).Mul(big.NewInt(50), helper.Shannon)
 	}
@@ -546,13 +647,15 @@ func (s *PublicBlockChainAPI) doCall(ctx context.Context, args CallArgs, blockNr
 // Call executes the given transaction on the state for the given block number.
 // It doesn't make and changes in the state/blockchain and is usefull to execute and retrieve values.
 func (s *PublicBlockChainAPI) Call(ctx context.Context, args CallArgs, blockNr rpc.BlockNumber) (string, error) {
-	result, _, err := s.doCall(ctx, args, blockNr)
+	result, _, err := s.doCall(ctx, args, blockNr, nil)
 	return result, err
 }
 
 // EstimateGas returns an estimate of the amount of gas needed to execute the given transaction.
-func (s *PublicBlockChainAPI) EstimateGas(ctx context.Context, args CallArgs) (*rpc.HexNumber, error) {
-	_, gas, err := s.doCall(ctx, args, rpc.PendingBlockNumber)
+// The optional overrides are applied to the pending state before executing it, allowing
+// estimation against hypothetical accounts and contracts.
+func (s *PublicBlockChainAPI) EstimateGas(ctx context.Context, args CallArgs, overrides *StateOverride) (*rpc.HexNumber, error) {
+	_, gas, err := s.doCall(ctx, args, rpc.PendingBlockNumber, overrides)
 	return rpc.NewHexNumber(gas), err
 }
 
@@ -848,6 +951,54 @@ func (s *PublicTransactionPoolAPI) GetTransactionCount(ctx context.Context, addr
 	return rpc.NewHexNumber(nonce), nil
 }
 
+// GetNonceGaps returns the nonces missing from the transaction pool between the
+// current nonce of the given address and its highest queued transaction.
+func (s *PublicTransactionPoolAPI) GetNonceGaps(address helper.Address) []*rpc.HexNumber {
+	gaps := s.b.NonceGaps(address)
+
+	result := make([]*rpc.HexNumber, len(gaps))
+	for i, nonce := range gaps {
+		result[i] = rpc.NewHexNumber(nonce)
+	}
+	return result
+}
+
+// TxpoolContentFrom returns the pending and queued transactions of the given
+// address, keyed by nonce.
+func (s *PublicTransactionPoolAPI) TxpoolContentFrom(address helper.Address) map[string]map[string]*RPCTransaction {
+	content := map[string]map[string]*RPCTransaction{
+		"pending": make(map[string]*RPCTransaction),
+		"queued":  make(map[string]*RPCTransaction),
+	}
+	pending, queue := s.b.TxPoolContentFrom(address)
+	for _, tx := range pending {
+		content["pending"][fmt.Sprintf("%d", tx.Nonce())] = newRPCPendingTransaction(tx)
+	}
+	for _, tx := range queue {
+		content["queued"][fmt.Sprintf("%d", tx.Nonce())] = newRPCPendingTransaction(tx)
+	}
+	return content
+}
+
+// TxpoolPressure returns the fill ratio (0.0-1.0) of the transaction pool, which
+// clients may use to back off before their transactions start being dropped.
+func (s *PublicTransactionPoolAPI) TxpoolPressure() float64 {
+	return s.b.TxPoolPressure()
+}
+
+// TxpoolHistogram returns the number of pending transactions per gas price bucket,
+// keyed by the lower bound of the buckets. Transactions cheaper than every bucket
+// are counted under "0".
+func (s *PublicTransactionPoolAPI) TxpoolHistogram(buckets []*rpc.HexNumber) map[string]int {
+	bounds := make([]*big.Int, 0, len(buckets))
+	for _, bucket := range buckets {
+		if bucket != nil {
+			bounds = append(bounds, bucket.BigInt())
+		}
+	}
+	return s.b.TxPoolPriceHistogram(bounds)
+}
+
 // getTransactionBlockData fetches the meta data for the given transaction from the chain database. This is useful to
 // retrieve block information for a hash. It returns the block hash, block index and transaction index.
 func getTransactionBlockData(chainDb database.Database, txHash helper.Hash) (helper.Hash, uint64, uint64, error) {
@@ -3,6 +3,7 @@ package siotapi
 
 import (
 	"math/big"
+	"time"
 
 	"github.com/siotchain/siot/wallet"
 	"github.com/siotchain/siot/helper"
@@ -32,6 +33,7 @@ type Backend interface {
 	HeaderByNumber(ctx context.Context, blockNr rpc.BlockNumber) (*types.Header, error)
 	BlockByNumber(ctx context.Context, blockNr rpc.BlockNumber) (*types.Block, error)
 	StateAndHeaderByNumber(ctx context.Context, blockNr rpc.BlockNumber) (State, *types.Header, error)
+	StateAndHeaderByHash(ctx context.Context, blockHash helper.Hash) (State, *types.Header, error)
 	GetBlock(ctx context.Context, blockHash helper.Hash) (*types.Block, error)
 	GetReceipts(ctx context.Context, blockHash helper.Hash) (types.Receipts, error)
 	GetTd(blockHash helper.Hash) *big.Int
@@ -43,10 +45,18 @@ type Backend interface {
 	GetPoolTransaction(txHash helper.Hash) *types.Transaction
 	GetPoolNonce(ctx context.Context, addr helper.Address) (uint64, error)
 	Stats() (pending int, queued int)
+	TxPoolPressure() float64
+	TxPoolOldestPending() time.Duration
+	TxPoolPriceHistogram(buckets []*big.Int) map[string]int
 	TxPoolContent() (map[helper.Address]types.Transactions, map[helper.Address]types.Transactions)
+	TxPoolContentFrom(addr helper.Address) (types.Transactions, types.Transactions)
+	NonceGaps(addr helper.Address) []uint64
 
 	ChainConfig() *configure.ChainConfig
 	CurrentBlock() *types.Block
+	// RPCGasCap returns the max gas of the call executions (nil = unlimited) and
+	// whether calls above it are rejected rather than capped.
+	RPCGasCap() (*big.Int, bool)
 }
 
 type State interface {
@@ -54,6 +64,12 @@ type State interface {
 	GetCode(ctx context.Context, addr helper.Address) ([]byte, error)
 	GetState(ctx context.Context, a helper.Address, b helper.Hash) (helper.Hash, error)
 	GetNonce(ctx context.Context, addr helper.Address) (uint64, error)
+
+	// Setters used to override parts of the state before executing a call.
+	SetBalance(addr helper.Address, amount *big.Int)
+	SetNonce(addr helper.Address, nonce uint64)
+	SetCode(addr helper.Address, code []byte)
+	SetState(addr helper.Address, key, value helper.Hash)
 }
 
 func GetAPIs(apiBackend Backend) []rpc.API {
@@ -0,0 +1,132 @@
+package miner
+
+import (
+	"errors"
+	"math/big"
+	"sync"
+
+	"github.com/siotchain/siot/blockchainCore"
+	"github.com/siotchain/siot/blockchainCore/types"
+	"github.com/siotchain/siot/helper"
+	"github.com/siotchain/siot/logger"
+	"github.com/siotchain/siot/logger/glog"
+)
+
+const (
+	maxBundleTxs       = 64 // Maximum number of transactions in a single bundle
+	maxBundlesPerBlock = 16 // Maximum number of bundles targeting the same block
+)
+
+var (
+	errEmptyBundle    = errors.New("empty transaction bundle")
+	errBundleTooLarge = errors.New("transaction bundle too large")
+	errTooManyBundles = errors.New("too many bundles for the block")
+)
+
+// txBundle is an ordered set of transactions to be included atomically at the
+// top of the block with the given number, or not at all.
+type txBundle struct {
+	txs    types.Transactions
+	number uint64
+}
+
+// bundleSet holds the bundles submitted for upcoming blocks.
+type bundleSet struct {
+	bundles []*txBundle
+	lock    sync.Mutex
+}
+
+// add stores a bundle targeting the given block number.
+func (s *bundleSet) add(txs types.Transactions, number uint64) error {
+	if len(txs) == 0 {
+		return errEmptyBundle
+	}
+	if len(txs) > maxBundleTxs {
+		return errBundleTooLarge
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	count := 0
+	for _, bundle := range s.bundles {
+		if bundle.number == number {
+			count++
+		}
+	}
+	if count >= maxBundlesPerBlock {
+		return errTooManyBundles
+	}
+	s.bundles = append(s.bundles, &txBundle{txs: txs, number: number})
+	return nil
+}
+
+// target returns the bundles submitted for the given block number in order of
+// submission, dropping those for blocks already past.
+func (s *bundleSet) target(number uint64) []*txBundle {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var (
+		keep    []*txBundle
+		matched []*txBundle
+	)
+	for _, bundle := range s.bundles {
+		switch {
+		case bundle.number == number:
+			matched = append(matched, bundle)
+			keep = append(keep, bundle)
+		case bundle.number > number:
+			keep = append(keep, bundle)
+		}
+	}
+	s.bundles = keep
+	return matched
+}
+
+// commitBundles applies the bundles to the work in order. Every bundle is run on
+// a copy of the state, which replaces the work's state only if all transactions
+// of the bundle succeed. If any of them fails or its execution errors out (e.g.
+// reverts), the copy is discarded and the bundle skipped.
+func (env *Work) commitBundles(bundles []*txBundle, bc *blockchainCore.BlockChain) {
+	for _, bundle := range bundles {
+		var (
+			statedb  = env.state.Copy()
+			gasUsed  = new(big.Int).Set(env.header.GasUsed)
+			gp       = new(blockchainCore.GasPool).AddGas(new(big.Int).Sub(env.header.GasLimit, env.header.GasUsed))
+			receipts = make([]*types.Receipt, 0, len(bundle.txs))
+			failedTx *types.Transaction
+			err      error
+		)
+		for i, tx := range bundle.txs {
+			statedb.Prepare(tx.Hash(), helper.Hash{}, env.tcount+i)
+
+			var (
+				receipt *types.Receipt
+				vmerr   error
+			)
+			receipt, _, _, vmerr, err = blockchainCore.ApplyTransactionWithVMError(env.config, bc, gp, statedb, env.header, tx, gasUsed)
+			if err == nil {
+				err = vmerr
+			}
+			if err != nil {
+				failedTx = tx
+				break
+			}
+			receipts = append(receipts, receipt)
+		}
+		if failedTx != nil {
+			glog.V(logger.Debug).Infof("Bundle of %d txs for block #%d dropped, tx %x failed: %v", len(bundle.txs), bundle.number, failedTx.Hash().Bytes()[:4], err)
+			continue
+		}
+		env.state = statedb
+		env.header.GasUsed.Set(gasUsed)
+		for i, tx := range bundle.txs {
+			env.txs = append(env.txs, tx)
+			env.receipts = append(env.receipts, receipts[i])
+			env.addFee(tx, receipts[i])
+		}
+		env.tcount += len(bundle.txs)
+
+		glog.V(logger.Debug).Infof("Bundle of %d txs included in block #%d", len(bundle.txs), bundle.number)
+	}
+}
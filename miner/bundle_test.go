@@ -0,0 +1,120 @@
+package miner
+
+import (
+	"crypto/ecdsa"
+	"math/big"
+	"testing"
+
+	"github.com/siotchain/siot/blockchainCore"
+	"github.com/siotchain/siot/blockchainCore/state"
+	"github.com/siotchain/siot/blockchainCore/types"
+	"github.com/siotchain/siot/configure"
+	"github.com/siotchain/siot/crypto"
+	"github.com/siotchain/siot/database"
+	"github.com/siotchain/siot/helper"
+)
+
+var (
+	testBankKey, _  = crypto.GenerateKey()
+	testBankAddress = crypto.PubkeyToAddress(testBankKey.PublicKey)
+	testBankFunds   = big.NewInt(1000000000)
+	testRecipient   = helper.HexToAddress("0x0000000000000000000000000000000000000b0b")
+)
+
+// newTestWork creates a mining work for the block on top of a genesis funding
+// the test bank account.
+func newTestWork(t *testing.T) *Work {
+	db, _ := database.NewMemDatabase()
+	genesis := blockchainCore.GenesisBlockForTesting(db, testBankAddress, testBankFunds)
+
+	statedb, err := state.New(genesis.Root(), db)
+	if err != nil {
+		t.Fatalf("failed to open genesis state: %v", err)
+	}
+	return &Work{
+		config: configure.TestChainConfig,
+		signer: types.MakeSigner(configure.TestChainConfig, helper.Big1),
+		state:  statedb,
+		header: &types.Header{
+			ParentHash: genesis.Hash(),
+			Number:     big.NewInt(1),
+			GasLimit:   genesis.GasLimit(),
+			GasUsed:    new(big.Int),
+		},
+		fees: new(big.Int),
+	}
+}
+
+// transfer creates a value transfer from the test bank signed for the work.
+func transfer(t *testing.T, work *Work, key *ecdsa.PrivateKey, nonce uint64) *types.Transaction {
+	tx := types.NewTransaction(nonce, testRecipient, big.NewInt(1000), big.NewInt(21000), big.NewInt(1), nil)
+	signed, err := types.SignECDSA(work.signer, tx, key)
+	if err != nil {
+		t.Fatalf("failed to sign transaction: %v", err)
+	}
+	return signed
+}
+
+// Tests that all transactions of a bundle are included together, in order.
+func TestCommitBundle(t *testing.T) {
+	work := newTestWork(t)
+	bundle := &txBundle{
+		txs:    types.Transactions{transfer(t, work, testBankKey, 0), transfer(t, work, testBankKey, 1)},
+		number: 1,
+	}
+	work.commitBundles([]*txBundle{bundle}, nil)
+
+	if len(work.txs) != 2 || work.tcount != 2 || len(work.receipts) != 2 {
+		t.Fatalf("included transactions mismatch: have %d/%d txs/receipts (count %d), want 2", len(work.txs), len(work.receipts), work.tcount)
+	}
+	for i, tx := range bundle.txs {
+		if work.txs[i] != tx {
+			t.Errorf("tx %d: included out of order", i)
+		}
+	}
+	if nonce := work.state.GetNonce(testBankAddress); nonce != 2 {
+		t.Errorf("sender nonce mismatch: have %d, want 2", nonce)
+	}
+	if balance := work.state.GetBalance(testRecipient); balance.Cmp(big.NewInt(2000)) != 0 {
+		t.Errorf("recipient balance mismatch: have %v, want 2000", balance)
+	}
+	if gas := work.header.GasUsed; gas.Cmp(big.NewInt(42000)) != 0 {
+		t.Errorf("gas used mismatch: have %v, want 42000", gas)
+	}
+	if fees := work.fees; fees.Cmp(big.NewInt(42000)) != 0 {
+		t.Errorf("fees mismatch: have %v, want 42000", fees)
+	}
+}
+
+// Tests that a bundle whose second transaction fails is dropped entirely, the
+// state changes of its first transaction included, without affecting bundles
+// committed before or after it.
+func TestCommitBundleFailingTx(t *testing.T) {
+	work := newTestWork(t)
+
+	var (
+		first  = &txBundle{txs: types.Transactions{transfer(t, work, testBankKey, 0)}, number: 1}
+		failed = &txBundle{txs: types.Transactions{transfer(t, work, testBankKey, 1), transfer(t, work, testBankKey, 5)}, number: 1}
+		last   = &txBundle{txs: types.Transactions{transfer(t, work, testBankKey, 1)}, number: 1}
+	)
+	work.commitBundles([]*txBundle{first, failed, last}, nil)
+
+	if len(work.txs) != 2 || work.tcount != 2 || len(work.receipts) != 2 {
+		t.Fatalf("included transactions mismatch: have %d/%d txs/receipts (count %d), want 2", len(work.txs), len(work.receipts), work.tcount)
+	}
+	if work.txs[0] != first.txs[0] || work.txs[1] != last.txs[0] {
+		t.Errorf("included transactions mismatch: have %x, %x", work.txs[0].Hash(), work.txs[1].Hash())
+	}
+	if nonce := work.state.GetNonce(testBankAddress); nonce != 2 {
+		t.Errorf("sender nonce mismatch: have %d, want 2", nonce)
+	}
+	if balance := work.state.GetBalance(testRecipient); balance.Cmp(big.NewInt(2000)) != 0 {
+		t.Errorf("recipient balance mismatch: have %v, want 2000", balance)
+	}
+	if gas := work.header.GasUsed; gas.Cmp(big.NewInt(42000)) != 0 {
+		t.Errorf("gas used mismatch: have %v, want 42000", gas)
+	}
+	if used := work.receipts[1].CumulativeGasUsed; used.Cmp(big.NewInt(42000)) != 0 {
+		t.Errorf("cumulative gas of the last receipt mismatch: have %v, want 42000", used)
+	}
+}
@@ -0,0 +1,54 @@
+package miner
+
+import (
+	"math/big"
+	"sync"
+
+	"github.com/siotchain/siot/blockchainCore/types"
+	"github.com/siotchain/siot/helper"
+)
+
+const feeHistoryLength = 64 // Number of recently sealed blocks whose fees are remembered
+
+// BlockFees is the transaction fee revenue of a locally sealed block, excluding
+// the block and uncle rewards.
+type BlockFees struct {
+	Number uint64
+	Hash   helper.Hash
+	Fees   *big.Int
+}
+
+// feeHistory keeps the fee totals of the most recently sealed blocks.
+type feeHistory struct {
+	blocks []BlockFees // Oldest first, capped at feeHistoryLength
+	lock   sync.Mutex
+}
+
+// record adds the fees of a freshly sealed block, dropping the oldest entry if
+// the history is full.
+func (h *feeHistory) record(block *types.Block, fees *big.Int) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if len(h.blocks) >= feeHistoryLength {
+		h.blocks = append(h.blocks[:0], h.blocks[1:]...)
+	}
+	h.blocks = append(h.blocks, BlockFees{Number: block.NumberU64(), Hash: block.Hash(), Fees: new(big.Int).Set(fees)})
+}
+
+// recent returns a copy of the recorded fee totals, oldest first.
+func (h *feeHistory) recent() []BlockFees {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	blocks := make([]BlockFees, len(h.blocks))
+	for i, b := range h.blocks {
+		blocks[i] = BlockFees{Number: b.Number, Hash: b.Hash, Fees: new(big.Int).Set(b.Fees)}
+	}
+	return blocks
+}
+
+// addFee accounts the fee paid by an included transaction to the block.
+func (env *Work) addFee(tx *types.Transaction, receipt *types.Receipt) {
+	env.fees.Add(env.fees, new(big.Int).Mul(receipt.GasUsed, tx.GasPrice()))
+}
@@ -0,0 +1,15 @@
+// Contains the metrics collected while building blocks.
+
+package miner
+
+import (
+	"github.com/siotchain/siot/helper/metrics"
+)
+
+var (
+	workPrepareTimer  = metrics.NewTimer("miner/work/prepare")  // Header and state environment setup
+	workExecuteTimer  = metrics.NewTimer("miner/work/execute")  // Execution of all pending transactions
+	workFinalizeTimer = metrics.NewTimer("miner/work/finalize") // Reward accumulation and state root hashing
+	workTxTimer       = metrics.NewTimer("miner/work/tx")       // Execution of a single transaction
+	workTxsHistogram  = metrics.NewHistogram("miner/work/txs")  // Number of transactions per built block
+)
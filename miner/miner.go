@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"math/big"
 	"sync/atomic"
+	"time"
 
 	"github.com/siotchain/siot/wallet"
 	"github.com/siotchain/siot/helper"
@@ -46,12 +47,12 @@ type Miner struct {
 	shouldStart int32 // should start indicates whether we should start after sync
 }
 
-func New(siot Backend, config *configure.ChainConfig, mux *subscribe.TypeMux, pow validation.PoW) *Miner {
+func New(siot Backend, mux *subscribe.TypeMux, pow validation.PoW) *Miner {
 	miner := &Miner{
 		siot:      siot,
 		mux:      mux,
 		pow:      pow,
-		worker:   newWorker(config, helper.Address{}, siot, mux),
+		worker:   newWorker(helper.Address{}, siot, mux),
 		canStart: 1,
 	}
 	go miner.update()
@@ -100,6 +101,21 @@ func (m *Miner) SetGasPrice(price *big.Int) {
 	m.worker.setGasPrice(price)
 }
 
+// SubmitBundle schedules an ordered bundle of transactions for inclusion at the
+// top of the block with the given number. The bundle is included atomically: if
+// any of its transactions can't be applied or fails executing, none of them are.
+// At most maxBundlesPerBlock bundles of up to maxBundleTxs transactions each
+// are accepted per block.
+func (m *Miner) SubmitBundle(txs types.Transactions, number uint64) error {
+	return m.worker.bundles.add(txs, number)
+}
+
+// GasPrice returns the gas price floor of the transactions the miner accepts,
+// or nil if no gas price was set yet.
+func (m *Miner) GasPrice() *big.Int {
+	return m.worker.getGasPrice()
+}
+
 func (self *Miner) Start(coinbase helper.Address, threads int) {
 	atomic.StoreInt32(&self.shouldStart, 1)
 	self.threads = threads
@@ -113,8 +129,11 @@ func (self *Miner) Start(coinbase helper.Address, threads int) {
 
 	atomic.StoreInt32(&self.mining, 1)
 
-	for i := 0; i < threads; i++ {
-		self.worker.register(NewCpuAgent(i, self.pow))
+	// Dry runs never seal, so don't spin up any sealers either
+	if atomic.LoadInt32(&self.worker.dryRun) == 0 {
+		for i := 0; i < threads; i++ {
+			self.worker.register(NewCpuAgent(i, self.pow))
+		}
 	}
 	self.worker.start()
 
@@ -171,3 +190,99 @@ func (self *Miner) SetMiner(addr helper.Address) {
 	self.coinbase = addr
 	self.worker.SetMiner(addr)
 }
+
+// SetDryRun toggles the dry-run mode, in which blocks are assembled as usual but
+// never sealed: instead of going to the agents, each assembled block is logged
+// and posted as a PendingBlockEvent. It should be set before mining starts.
+func (self *Miner) SetDryRun(dryRun bool) {
+	if dryRun {
+		atomic.StoreInt32(&self.worker.dryRun, 1)
+	} else {
+		atomic.StoreInt32(&self.worker.dryRun, 0)
+	}
+}
+
+// SetEffectivePricing toggles ranking the wallet by the effective price of their
+// whole pending transaction sequence when assembling blocks, so that a cheap
+// transaction unblocking pricier ones of the same wallet is not left behind.
+func (self *Miner) SetEffectivePricing(enabled bool) {
+	if enabled {
+		atomic.StoreInt32(&self.worker.effectivePrice, 1)
+	} else {
+		atomic.StoreInt32(&self.worker.effectivePrice, 0)
+	}
+}
+
+// SetBlockTime sets the target interval between the sealed blocks, rounded up to
+// whole seconds. Blocks are then held back until the interval since their parent
+// has passed, instead of being sealed as fast as the proof-of-work allows. This
+// is only meant for private networks with a trivial difficulty.
+func (self *Miner) SetBlockTime(interval time.Duration) {
+	secs := int64((interval + time.Second - 1) / time.Second)
+	if secs < 0 {
+		secs = 0
+	}
+	atomic.StoreInt64(&self.worker.blockTime, secs)
+}
+
+// SetTxPrioritizer registers a custom policy deciding which pending transactions
+// are included in the mined blocks and in which order. A nil prioritizer restores
+// the default ordering by gas price. It takes effect from the next block on.
+func (self *Miner) SetTxPrioritizer(prioritizer TxPrioritizer) {
+	self.worker.setPrioritizer(prioritizer)
+}
+
+// UncleRate returns the fraction of the recent locally mined blocks that didn't
+// make it into the canonical chain, along with the number of blocks measured.
+func (self *Miner) UncleRate() (rate float64, samples int) {
+	rate, samples, _, _ = self.worker.uncleRate.stats()
+	return rate, samples
+}
+
+// RecentFees returns the transaction fees collected by the most recently sealed
+// local blocks, oldest first.
+func (self *Miner) RecentFees() []BlockFees {
+	return self.worker.fees.recent()
+}
+
+// SetUncleRateLimits sets the number of recent locally mined blocks the uncle
+// rate is measured over, and the rate above which a warning is logged.
+func (self *Miner) SetUncleRateLimits(window int, threshold float64) error {
+	if window <= 0 {
+		return fmt.Errorf("invalid uncle rate window: %d", window)
+	}
+	if threshold < 0 || threshold > 1 {
+		return fmt.Errorf("invalid uncle rate threshold: %v", threshold)
+	}
+	self.worker.uncleRate.setLimits(window, threshold)
+	return nil
+}
+
+// SetUncleRetention sets the number of blocks below the chain head the side
+// blocks are kept as possible uncles before being discarded.
+func (self *Miner) SetUncleRetention(blocks uint64) {
+	self.worker.setUncleRetention(blocks)
+}
+
+// SetUnclePolicy sets which uncles are included in the mined blocks: all of
+// them, none, or only those earning the miner more than minReward.
+func (self *Miner) SetUnclePolicy(policy string, minReward *big.Int) error {
+	switch policy {
+	case UnclesAlways, UnclesNever, UnclesProfitable:
+	default:
+		return fmt.Errorf("invalid uncle policy: %q", policy)
+	}
+	if minReward == nil {
+		minReward = new(big.Int)
+	}
+	if minReward.Sign() < 0 {
+		return fmt.Errorf("invalid uncle reward threshold: %v", minReward)
+	}
+	self.worker.setUnclePolicy(policy, minReward)
+	return nil
+}
+
+// SetMiners sets the reward addresses rotated among the mined blocks.
+func (self *Miner) SetMiners(addrs []helper.Address) {
+	self.worker.SetMiners(addrs)
+}
@@ -0,0 +1,45 @@
+package miner
+
+import (
+	"github.com/siotchain/siot/blockchainCore/types"
+	"github.com/siotchain/siot/helper"
+)
+
+// TransactionSet is an ordered source of transactions to include in a block.
+// Transactions of the same wallet must be yielded in nonce order.
+type TransactionSet interface {
+	// Peek returns the next transaction to include, or nil if none are left.
+	Peek() *types.Transaction
+
+	// Shift replaces the next transaction with the following one of its sender.
+	Shift()
+
+	// Pop discards the next transaction along with all the remaining ones of
+	// its sender, as none of them can be executed.
+	Pop()
+}
+
+// TxPrioritizer decides which of the pending transactions are considered for
+// inclusion in a new block and in which order. It may be replaced to favour
+// certain senders on a private chain, for example.
+type TxPrioritizer interface {
+	// Prioritize orders the pending transactions, given per wallet in nonce
+	// order. The map is owned by the prioritizer and may be modified.
+	Prioritize(pending map[helper.Address]types.Transactions) TransactionSet
+}
+
+// PricePrioritizer is the default prioritizer, including the transactions with
+// the highest gas price first.
+type PricePrioritizer struct {
+	// Effective ranks every wallet by the average price of its whole pending
+	// sequence instead of the price of its next transaction only.
+	Effective bool
+}
+
+// Prioritize implements TxPrioritizer, ordering the transactions by price.
+func (p PricePrioritizer) Prioritize(pending map[helper.Address]types.Transactions) TransactionSet {
+	if p.Effective {
+		return types.NewTransactionsByEffectivePrice(pending)
+	}
+	return types.NewTransactionsByPriceAndNonce(pending)
+}
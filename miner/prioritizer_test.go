@@ -0,0 +1,89 @@
+package miner
+
+import (
+	"crypto/ecdsa"
+	"math/big"
+	"testing"
+
+	"github.com/siotchain/siot/blockchainCore/types"
+	"github.com/siotchain/siot/crypto"
+	"github.com/siotchain/siot/helper"
+	"github.com/siotchain/siot/subscribe"
+)
+
+// senderFirst is a prioritizer including all transactions of a given sender
+// before the others, which are ordered by price.
+type senderFirst struct {
+	sender helper.Address
+}
+
+func (p senderFirst) Prioritize(pending map[helper.Address]types.Transactions) TransactionSet {
+	first := pending[p.sender]
+	delete(pending, p.sender)
+
+	return &senderFirstSet{first: first, rest: types.NewTransactionsByPriceAndNonce(pending)}
+}
+
+type senderFirstSet struct {
+	first types.Transactions
+	rest  TransactionSet
+}
+
+func (s *senderFirstSet) Peek() *types.Transaction {
+	if len(s.first) > 0 {
+		return s.first[0]
+	}
+	return s.rest.Peek()
+}
+
+func (s *senderFirstSet) Shift() {
+	if len(s.first) > 0 {
+		s.first = s.first[1:]
+		return
+	}
+	s.rest.Shift()
+}
+
+func (s *senderFirstSet) Pop() {
+	if len(s.first) > 0 {
+		s.first = nil
+		return
+	}
+	s.rest.Pop()
+}
+
+// Tests that a custom prioritizer decides the inclusion order of the pending
+// transactions, overriding their gas prices.
+func TestCustomPrioritizer(t *testing.T) {
+	work := newTestWork(t)
+
+	favouredKey, _ := crypto.GenerateKey()
+	favoured := crypto.PubkeyToAddress(favouredKey.PublicKey)
+	work.state.AddBalance(favoured, testBankFunds)
+
+	priced := func(nonce uint64, price int64, key *ecdsa.PrivateKey) *types.Transaction {
+		tx := types.NewTransaction(nonce, testRecipient, big.NewInt(1000), big.NewInt(21000), big.NewInt(price), nil)
+		signed, err := types.SignECDSA(work.signer, tx, key)
+		if err != nil {
+			t.Fatalf("failed to sign transaction: %v", err)
+		}
+		return signed
+	}
+	pending := map[helper.Address]types.Transactions{
+		testBankAddress: {priced(0, 10, testBankKey), priced(1, 10, testBankKey)},
+		favoured:        {priced(0, 1, favouredKey), priced(1, 1, favouredKey)},
+	}
+	want := types.Transactions{pending[favoured][0], pending[favoured][1], pending[testBankAddress][0], pending[testBankAddress][1]}
+
+	txs := senderFirst{sender: favoured}.Prioritize(pending)
+	work.commitTransactions(new(subscribe.TypeMux), txs, big.NewInt(1), nil)
+
+	if len(work.txs) != len(want) {
+		t.Fatalf("included transactions mismatch: have %d, want %d", len(work.txs), len(want))
+	}
+	for i, tx := range want {
+		if work.txs[i] != tx {
+			t.Errorf("tx %d: inclusion order mismatch: have %x, want %x", i, work.txs[i].Hash(), tx.Hash())
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package miner
+
+import "sync"
+
+const (
+	defaultUncleRateWindow    = 20   // Number of recent locally mined blocks the uncle rate is measured over
+	defaultUncleRateThreshold = 0.25 // Uncle rate above which a warning is logged
+)
+
+// uncleRateTracker keeps a sliding window of the fate of the most recent
+// locally mined blocks, recording which of them failed to make it into the
+// canonical chain (i.e. became uncles or were dropped altogether).
+type uncleRateTracker struct {
+	lost      []bool  // Ring buffer of outcomes, true if the block is not canonical
+	next      int     // Position of the next insertion into the ring
+	count     int     // Number of outcomes recorded, capped at the window size
+	threshold float64 // Uncle rate above which the tracker reports trouble
+
+	lock sync.Mutex
+}
+
+func newUncleRateTracker(window int, threshold float64) *uncleRateTracker {
+	return &uncleRateTracker{
+		lost:      make([]bool, window),
+		threshold: threshold,
+	}
+}
+
+// setLimits resizes the window and changes the warning threshold, discarding
+// all previously recorded outcomes.
+func (t *uncleRateTracker) setLimits(window int, threshold float64) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.lost, t.next, t.count = make([]bool, window), 0, 0
+	t.threshold = threshold
+}
+
+// record adds the outcome of a locally mined block to the window, returning
+// whether the uncle rate is above the threshold over a full window.
+func (t *uncleRateTracker) record(lost bool) bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.lost[t.next] = lost
+	t.next = (t.next + 1) % len(t.lost)
+	if t.count < len(t.lost) {
+		t.count++
+	}
+	return t.count == len(t.lost) && t.rate() > t.threshold
+}
+
+// stats returns the current uncle rate along with the number of blocks it was
+// measured over and the configured limits.
+func (t *uncleRateTracker) stats() (rate float64, samples int, window int, threshold float64) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	return t.rate(), t.count, len(t.lost), t.threshold
+}
+
+// rate computes the fraction of lost blocks in the window.
+//
+// Note, this method assumes the lock is held!
+func (t *uncleRateTracker) rate() float64 {
+	if t.count == 0 {
+		return 0
+	}
+	lost := 0
+	for i := 0; i < t.count; i++ {
+		if t.lost[i] {
+			lost++
+		}
+	}
+	return float64(lost) / float64(t.count)
+}
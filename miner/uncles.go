@@ -0,0 +1,53 @@
+package miner
+
+import (
+	"math/big"
+
+	"github.com/siotchain/siot/blockchainCore"
+	"github.com/siotchain/siot/blockchainCore/types"
+)
+
+// Uncle inclusion policies of the mined blocks.
+const (
+	UnclesAlways     = "always"     // Include every valid uncle (default)
+	UnclesNever      = "never"      // Never include uncles
+	UnclesProfitable = "profitable" // Include uncles whose reward to the miner exceeds a threshold
+)
+
+// uncleReward returns what including the uncle in the given block earns its
+// miner: the inclusion reward, plus the uncle's own reward if the uncle was
+// mined by the same coinbase.
+func uncleReward(header, uncle *types.Header) *big.Int {
+	reward := new(big.Int).Div(blockchainCore.BlockReward, big.NewInt(32))
+	if uncle.Coinbase == header.Coinbase {
+		own := new(big.Int).Add(uncle.Number, big.NewInt(8))
+		own.Sub(own, header.Number)
+		own.Mul(own, blockchainCore.BlockReward)
+		own.Div(own, big.NewInt(8))
+		reward.Add(reward, own)
+	}
+	return reward
+}
+
+// includeUncle reports whether the uncle policy allows including the uncle in
+// the given block. The caller must hold uncleMu.
+func (self *worker) includeUncle(header, uncle *types.Header) bool {
+	switch self.unclePolicy {
+	case UnclesNever:
+		return false
+	case UnclesProfitable:
+		return uncleReward(header, uncle).Cmp(self.uncleMinReward) > 0
+	default:
+		return true
+	}
+}
+
+// setUnclePolicy sets the uncle inclusion policy and the minimum reward of the
+// profitable policy.
+func (self *worker) setUnclePolicy(policy string, minReward *big.Int) {
+	self.uncleMu.Lock()
+	defer self.uncleMu.Unlock()
+
+	self.unclePolicy = policy
+	self.uncleMinReward = new(big.Int).Set(minReward)
+}
@@ -0,0 +1,59 @@
+package miner
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/siotchain/siot/blockchainCore"
+	"github.com/siotchain/siot/blockchainCore/types"
+	"github.com/siotchain/siot/configure"
+	"github.com/siotchain/siot/subscribe"
+)
+
+// Tests that the uncle policy decides whether a valid candidate uncle is
+// included in the assembled work.
+func TestUnclePolicy(t *testing.T) {
+	inclusion := new(big.Int).Div(blockchainCore.BlockReward, big.NewInt(32))
+
+	tests := []struct {
+		policy    string
+		minReward *big.Int
+		want      bool
+	}{
+		{UnclesAlways, new(big.Int), true},
+		{UnclesNever, new(big.Int), false},
+		{UnclesProfitable, new(big.Int).Sub(inclusion, big.NewInt(1)), true},
+		{UnclesProfitable, inclusion, false},
+	}
+	for i, tt := range tests {
+		mux := new(subscribe.TypeMux)
+		backend := newTestBackend(t, configure.TestChainConfig, mux)
+
+		w := newWorker(testBankAddress, backend, mux)
+		w.setUnclePolicy(tt.policy, tt.minReward)
+
+		// A side block of another miner on top of the genesis is a valid uncle
+		uncle := types.NewBlockWithHeader(&types.Header{
+			ParentHash: backend.chain.Genesis().Hash(),
+			Number:     big.NewInt(1),
+			Coinbase:   testRecipient,
+			Difficulty: big.NewInt(1),
+			Extra:      []byte("uncle"),
+		})
+		w.uncleMu.Lock()
+		w.possibleUncles[uncle.Hash()] = uncle
+		w.uncleMu.Unlock()
+
+		w.commitNewWork()
+
+		w.currentMu.Lock()
+		included := len(w.current.Block.Uncles()) == 1
+		w.currentMu.Unlock()
+
+		if included != tt.want {
+			t.Errorf("test %d (policy %s, min reward %v): uncle inclusion mismatch: have %v, want %v", i, tt.policy, tt.minReward, included, tt.want)
+		}
+		backend.close()
+		mux.Stop()
+	}
+}
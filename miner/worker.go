@@ -28,6 +28,8 @@ var jsonlogger = logger.NewJsonLogger()
 const (
 	resultQueueSize  = 10
 	miningLogAtDepth = 5
+
+	defaultUncleRetention = 7 // Side blocks deeper than this can't be included as uncles anyway
 )
 
 // Agent can register themself with the worker
@@ -65,6 +67,7 @@ type Work struct {
 	header   *types.Header
 	txs      []*types.Transaction
 	receipts []*types.Receipt
+	fees     *big.Int // Sum of the fees paid by the included transactions
 
 	createdAt time.Time
 }
@@ -76,8 +79,6 @@ type Result struct {
 
 // worker is the main object which takes care of applying messages to the new state
 type worker struct {
-	config *configure.ChainConfig
-
 	mu sync.Mutex
 
 	// update loop
@@ -94,8 +95,9 @@ type worker struct {
 	proc    blockchainCore.Validator
 	chainDb database.Database
 
-	coinbase helper.Address
-	gasPrice *big.Int
+	coinbase  helper.Address
+	coinbases []helper.Address // Reward addresses rotated per block (overrides coinbase if set)
+	gasPrice  *big.Int
 	extra    []byte
 
 	currentMu sync.Mutex
@@ -103,20 +105,32 @@ type worker struct {
 
 	uncleMu        sync.Mutex
 	possibleUncles map[helper.Hash]*types.Block
+	uncleRetention uint64 // Number of blocks below the head side blocks are kept as possible uncles
+	unclePolicy    string   // Uncle inclusion policy (UnclesAlways, UnclesNever or UnclesProfitable)
+	uncleMinReward *big.Int // Reward an uncle must exceed to be included under UnclesProfitable
+	uncleRate      *uncleRateTracker // Fate of the recent locally mined blocks
+	fees           feeHistory        // Fee revenue of the recently sealed blocks
 
 	txQueueMu sync.Mutex
 	txQueue   map[helper.Hash]*types.Transaction
 
+	bundles bundleSet // Transaction bundles to put atomically at the top of upcoming blocks
+
+	prioritizer TxPrioritizer // Custom ordering of the pending transactions (nil = by price)
+
 	// atomic status counters
 	mining int32
 	atWork int32
+	dryRun int32 // Assemble blocks without ever handing them to agents for sealing
+
+	effectivePrice int32 // Rank wallet by the effective price of their pending transactions
+	blockTime      int64 // Target interval between sealed blocks in seconds (0 = seal as fast as possible)
 
 	fullValidation bool
 }
 
-func newWorker(config *configure.ChainConfig, coinbase helper.Address, siot Backend, mux *subscribe.TypeMux) *worker {
+func newWorker(coinbase helper.Address, siot Backend, mux *subscribe.TypeMux) *worker {
 	worker := &worker{
-		config:         config,
 		siot:            siot,
 		mux:            mux,
 		chainDb:        siot.ChainDb(),
@@ -125,6 +139,10 @@ func newWorker(config *configure.ChainConfig, coinbase helper.Address, siot Back
 		chain:          siot.BlockChain(),
 		proc:           siot.BlockChain().Validator(),
 		possibleUncles: make(map[helper.Hash]*types.Block),
+		uncleRetention: defaultUncleRetention,
+		unclePolicy:    UnclesAlways,
+		uncleMinReward: new(big.Int),
+		uncleRate:      newUncleRateTracker(defaultUncleRateWindow, defaultUncleRateThreshold),
 		coinbase:       coinbase,
 		txQueue:        make(map[helper.Hash]*types.Transaction),
 		agents:         make(map[Agent]struct{}),
@@ -134,15 +152,67 @@ func newWorker(config *configure.ChainConfig, coinbase helper.Address, siot Back
 	go worker.update()
 
 	go worker.wait()
+
+	// Assemble the work on top of the current head right away, so that a miner
+	// started after a restart seals immediately instead of on the next head event
 	worker.commitNewWork()
 
+	// A head below the last block sealed here means the local chain lost blocks
+	// mined by this node, e.g. from a database restored from an older backup
+	if number, ok := blockchainCore.GetLastMinedNumber(worker.chainDb); ok {
+		if head := worker.chain.CurrentBlock().NumberU64(); head < number {
+			glog.V(logger.Warn).Infof("Chain head #%d is behind the last locally mined block #%d, the blocks mined since may be lost", head, number)
+		}
+	}
 	return worker
 }
 
+// setPrioritizer replaces the ordering of the pending transactions in new blocks,
+// reverting to the price based one if nil.
+func (self *worker) setPrioritizer(prioritizer TxPrioritizer) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	self.prioritizer = prioritizer
+}
+
 func (self *worker) SetMiner(addr helper.Address) {
 	self.mu.Lock()
 	defer self.mu.Unlock()
 	self.coinbase = addr
+	self.coinbases = nil
+}
+
+// SetMiners sets a list of reward addresses to be used round-robin, one per
+// block height. An empty list reverts to the single coinbase.
+func (self *worker) SetMiners(addrs []helper.Address) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	self.coinbases = append([]helper.Address(nil), addrs...)
+}
+
+// coinbaseAt returns the reward address to use for the block at the given
+// height. The rotation depends on the height only, so recommitting work for
+// the same block keeps the same coinbase.
+func (self *worker) coinbaseAt(number *big.Int) helper.Address {
+	if len(self.coinbases) == 0 {
+		return self.coinbase
+	}
+	idx := new(big.Int).Mod(number, big.NewInt(int64(len(self.coinbases))))
+	return self.coinbases[idx.Int64()]
+}
+
+// isMinerAddress reports whether addr is one of the configured reward addresses.
+func (self *worker) isMinerAddress(addr helper.Address) bool {
+	if addr == self.coinbase {
+		return true
+	}
+	for _, coinbase := range self.coinbases {
+		if addr == coinbase {
+			return true
+		}
+	}
+	return false
 }
 
 func (self *worker) pending() (*types.Block, *state.StateDB) {
@@ -211,6 +281,7 @@ func (self *worker) update() {
 		// A real subscribe arrived, process interesting content
 		switch ev := event.Data.(type) {
 		case blockchainCore.ChainHeadEvent:
+			self.pruneUncles(ev.Block.NumberU64())
 			self.commitNewWork()
 		case blockchainCore.ChainSideEvent:
 			self.uncleMu.Lock()
@@ -232,6 +303,28 @@ func (self *worker) update() {
 	}
 }
 
+// pruneUncles drops the side blocks that fell too far below the given head to
+// be worth keeping as possible uncles.
+func (self *worker) pruneUncles(head uint64) {
+	self.uncleMu.Lock()
+	defer self.uncleMu.Unlock()
+
+	for hash, uncle := range self.possibleUncles {
+		if uncle.NumberU64()+self.uncleRetention < head {
+			delete(self.possibleUncles, hash)
+		}
+	}
+}
+
+// setUncleRetention sets the number of blocks below the head side blocks are
+// kept as possible uncles.
+func (self *worker) setUncleRetention(blocks uint64) {
+	self.uncleMu.Lock()
+	defer self.uncleMu.Unlock()
+
+	self.uncleRetention = blocks
+}
+
 func newLocalMinedBlock(blockNumber uint64, prevMinedBlocks *uint64RingBuffer) (minedBlocks *uint64RingBuffer) {
 	if prevMinedBlocks == nil {
 		minedBlocks = &uint64RingBuffer{next: 0, ints: make([]uint64, miningLogAtDepth+1)}
@@ -261,8 +354,10 @@ func (self *worker) wait() {
 					continue
 				}
 				go self.mux.Post(blockchainCore.NewMinedBlockEvent{Block: block})
+				blockchainCore.WriteLastMinedNumber(self.chainDb, block.NumberU64())
+				self.fees.record(block, work.fees)
 			} else {
-				work.state.Commit(self.config.IsSiotImpr2(block.Number()))
+				work.state.Commit(work.config.IsSiotImpr2(block.Number()))
 				parent := self.chain.GetBlock(block.ParentHash(), block.NumberU64()-1)
 				if parent == nil {
 					glog.V(logger.Error).Infoln("Invalid block found during mining")
@@ -270,7 +365,7 @@ func (self *worker) wait() {
 				}
 
 				auxValidator := self.siot.BlockChain().AuxValidator()
-				if err := blockchainCore.ValidateHeader(self.config, auxValidator, block.Header(), parent.Header(), true, false); err != nil && err != blockchainCore.BlockFutureErr {
+				if err := blockchainCore.ValidateHeader(work.config, auxValidator, block.Header(), parent.Header(), true, false); err != nil && err != blockchainCore.BlockFutureErr {
 					glog.V(logger.Error).Infoln("Invalid header on mined block:", err)
 					continue
 				}
@@ -280,6 +375,8 @@ func (self *worker) wait() {
 					glog.V(logger.Error).Infoln("error writing block to chain", err)
 					continue
 				}
+				blockchainCore.WriteLastMinedNumber(self.chainDb, block.NumberU64())
+				self.fees.record(block, work.fees)
 
 				// update block hash since it is now available and not when the receipt/log of individual transactions were created
 				for _, r := range work.receipts {
@@ -333,6 +430,12 @@ func (self *worker) push(work *Work) {
 	if atomic.LoadInt32(&self.mining) != 1 {
 		return
 	}
+	if atomic.LoadInt32(&self.dryRun) == 1 {
+		block := work.Block
+		glog.V(logger.Info).Infof("Dry-run assembled block #%d: %d txs, %v/%v gas used", block.NumberU64(), len(block.Transactions()), block.GasUsed(), block.GasLimit())
+		go self.mux.Post(blockchainCore.PendingBlockEvent{Block: block, Logs: work.state.Logs()})
+		return
+	}
 	for agent := range self.agents {
 		atomic.AddInt32(&self.atWork, 1)
 		if ch := agent.Work(); ch != nil {
@@ -342,19 +445,20 @@ func (self *worker) push(work *Work) {
 }
 
 // makeCurrent creates a new environment for the current cycle.
-func (self *worker) makeCurrent(parent *types.Block, header *types.Header) error {
+func (self *worker) makeCurrent(config *configure.ChainConfig, parent *types.Block, header *types.Header) error {
 	state, err := self.chain.StateAt(parent.Root())
 	if err != nil {
 		return err
 	}
 	work := &Work{
-		config:    self.config,
-		signer:    types.NewSiotImpr1Signer(self.config.ChainId),
+		config:    config,
+		signer:    types.NewSiotImpr1Signer(config.ChainId),
 		state:     state,
 		ancestors: set.New(),
 		family:    set.New(),
 		uncles:    set.New(),
 		header:    header,
+		fees:      new(big.Int),
 		createdAt: time.Now(),
 	}
 
@@ -379,17 +483,37 @@ func (self *worker) makeCurrent(parent *types.Block, header *types.Header) error
 }
 
 func (w *worker) setGasPrice(p *big.Int) {
-	w.mu.Lock()
-	defer w.mu.Unlock()
-
 	// calculate the minimal gas price the miner accepts when sorting out transactions.
 	const pct = int64(90)
-	w.gasPrice = gasprice(p, pct)
+	price := gasprice(p, pct)
+
+	w.mu.Lock()
+	w.gasPrice = price
+	w.mu.Unlock()
+
+	// Post outside the lock: delivery waits for every subscriber, some of which
+	// may be reading the gas price themselves
+	w.mux.Post(blockchainCore.GasPriceChanged{Price: new(big.Int).Set(price)})
+}
+
+// getGasPrice returns the minimal gas price the miner accepts, nil if unset.
+func (w *worker) getGasPrice() *big.Int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
 
-	w.mux.Post(blockchainCore.GasPriceChanged{Price: w.gasPrice})
+	if w.gasPrice == nil {
+		return nil
+	}
+	return new(big.Int).Set(w.gasPrice)
 }
 
-func (self *worker) isBlockLocallyMined(current *Work, deepBlockNum uint64) bool {
+// isBlockLocallyMined reports whether this instance mined a block at the given
+// height, and if so, whether that block ended up in the canonical chain.
+func (self *worker) isBlockLocallyMined(current *Work, deepBlockNum uint64) (mined bool, canonical bool) {
+	//The genesis block is never mined, but matches the empty ring buffer slots
+	if deepBlockNum == 0 {
+		return false, false
+	}
 	//Did this instance mine a block at {deepBlockNum} ?
 	var isLocal = false
 	for idx, blockNum := range current.localMinedBlocks.ints {
@@ -401,12 +525,12 @@ func (self *worker) isBlockLocallyMined(current *Work, deepBlockNum uint64) bool
 	}
 	//Short-circuit on false, because the previous and following tests must both be true
 	if !isLocal {
-		return false
+		return false, false
 	}
 
-	//Does the block at {deepBlockNum} send earnings to my coinbase?
+	//Does the block at {deepBlockNum} send earnings to one of my coinbases?
 	var block = self.chain.GetBlockByNumber(deepBlockNum)
-	return block != nil && block.Coinbase() == self.coinbase
+	return true, block != nil && self.isMinerAddress(block.Coinbase())
 }
 
 func (self *worker) logLocalMinedBlocks(current, previous *Work) {
@@ -414,7 +538,16 @@ func (self *worker) logLocalMinedBlocks(current, previous *Work) {
 		nextBlockNum := current.Block.NumberU64()
 		for checkBlockNum := previous.Block.NumberU64(); checkBlockNum < nextBlockNum; checkBlockNum++ {
 			inspectBlockNum := checkBlockNum - miningLogAtDepth
-			if self.isBlockLocallyMined(current, inspectBlockNum) {
+			mined, canonical := self.isBlockLocallyMined(current, inspectBlockNum)
+			if !mined {
+				continue
+			}
+			if !canonical {
+				glog.V(logger.Info).Infof("Mined block #%d didn't make it into the canonical chain", inspectBlockNum)
+			}
+			if self.uncleRate.record(!canonical) {
+				rate, samples, _, threshold := self.uncleRate.stats()
+				glog.V(logger.Warn).Infof("High uncle rate: %.0f%% of the last %d mined blocks lost (threshold %.0f%%), check network latency or competing miners", rate*100, samples, threshold*100)
 			}
 		}
 	}
@@ -428,36 +561,48 @@ func (self *worker) commitNewWork() {
 	self.currentMu.Lock()
 	defer self.currentMu.Unlock()
 
+	// Build the whole block on the same configuration, it may be replaced live
+	config := self.chain.Config()
+
 	tstart := time.Now()
 	parent := self.chain.CurrentBlock()
 	tstamp := tstart.Unix()
 	if parent.Time().Cmp(new(big.Int).SetInt64(tstamp)) >= 0 {
 		tstamp = parent.Time().Int64() + 1
 	}
-	// this will ensure we're not going off too far in the future
-	if now := time.Now().Unix(); tstamp > now+4 {
+	// On private networks pace the blocks to the target interval. The work is
+	// held back until its timestamp instead of sleeping here, since that would
+	// stall the event loop for the whole interval.
+	interval := atomic.LoadInt64(&self.blockTime)
+	if interval > 0 {
+		if target := parent.Time().Int64() + interval; tstamp < target {
+			tstamp = target
+		}
+	} else if now := time.Now().Unix(); tstamp > now+4 {
+		// this will ensure we're not going off too far in the future
 		wait := time.Duration(tstamp-now) * time.Second
 		time.Sleep(wait)
 	}
+	pstart := time.Now()
 
 	num := parent.Number()
 	header := &types.Header{
 		ParentHash: parent.Hash(),
 		Number:     num.Add(num, helper.Big1),
-		Difficulty: blockchainCore.CalcDifficulty(self.config, uint64(tstamp), parent.Time().Uint64(), parent.Number(), parent.Difficulty()),
+		Difficulty: blockchainCore.CalcDifficulty(config, uint64(tstamp), parent.Time().Uint64(), parent.Number(), parent.Difficulty()),
 		GasLimit:   blockchainCore.CalcGasLimit(parent),
 		GasUsed:    new(big.Int),
-		Coinbase:   self.coinbase,
 		Extra:      self.extra,
 		Time:       big.NewInt(tstamp),
 	}
+	header.Coinbase = self.coinbaseAt(header.Number)
 	// If we are care about hard-fork check whether to override the extra-data or not
-	if daoBlock := self.config.DAOForkBlock; daoBlock != nil {
+	if daoBlock := config.DAOForkBlock; daoBlock != nil {
 		// Check whether the block is among the fork extra-override range
 		limit := new(big.Int).Add(daoBlock, configure.DAOForkExtraRange)
 		if header.Number.Cmp(daoBlock) >= 0 && header.Number.Cmp(limit) < 0 {
 			// Depending whether we support or oppose the fork, override differently
-			if self.config.DAOForkSupport {
+			if config.DAOForkSupport {
 				header.Extra = helper.CopyBytes(configure.DAOForkBlockExtra)
 			} else if bytes.Compare(header.Extra, configure.DAOForkBlockExtra) == 0 {
 				header.Extra = []byte{} // If miner opposes, don't let it use the reserved extra-data
@@ -466,18 +611,29 @@ func (self *worker) commitNewWork() {
 	}
 	previous := self.current
 	// Could potentially happen if starting to mine in an odd state.
-	err := self.makeCurrent(parent, header)
+	err := self.makeCurrent(config, parent, header)
 	if err != nil {
 		glog.V(logger.Info).Infoln("Could not create new env for mining, retrying on next block.")
 		return
 	}
 	// Create the current work task and check any fork transitions needed
 	work := self.current
-	if self.config.DAOForkSupport && self.config.DAOForkBlock != nil && self.config.DAOForkBlock.Cmp(header.Number) == 0 {
+	if config.DAOForkSupport && config.DAOForkBlock != nil && config.DAOForkBlock.Cmp(header.Number) == 0 {
 		blockchainCore.ApplyDAOHardFork(work.state)
 	}
-	txs := types.NewTransactionsByPriceAndNonce(self.siot.TxPool().Pending())
+	workPrepareTimer.UpdateSince(pstart)
+
+	estart := time.Now()
+	work.commitBundles(self.bundles.target(header.Number.Uint64()), self.chain)
+
+	prioritizer := self.prioritizer
+	if prioritizer == nil {
+		prioritizer = PricePrioritizer{Effective: atomic.LoadInt32(&self.effectivePrice) == 1}
+	}
+	txs := prioritizer.Prioritize(self.siot.TxPool().Pending())
 	work.commitTransactions(self.mux, txs, self.gasPrice, self.chain)
+	workExecuteTimer.UpdateSince(estart)
+	workTxsHistogram.Update(int64(work.tcount))
 
 	self.siot.TxPool().RemoveBatch(work.lowGasTxs)
 	self.siot.TxPool().RemoveBatch(work.failedTxs)
@@ -488,9 +644,12 @@ func (self *worker) commitNewWork() {
 		badUncles []helper.Hash
 	)
 	for hash, uncle := range self.possibleUncles {
-		if len(uncles) == 2 {
+		if len(uncles) == 2 || self.unclePolicy == UnclesNever {
 			break
 		}
+		if !self.includeUncle(header, uncle.Header()) {
+			continue
+		}
 		if err := self.commitUncle(work, uncle.Header()); err != nil {
 			if glog.V(logger.Ridiculousness) {
 				glog.V(logger.Detail).Infof("Bad uncle found and will be removed (%x)\n", hash[:4])
@@ -508,8 +667,10 @@ func (self *worker) commitNewWork() {
 
 	if atomic.LoadInt32(&self.mining) == 1 {
 		// commit state root after all state transitions.
+		fstart := time.Now()
 		blockchainCore.AccumulateRewards(work.state, header, uncles)
-		header.Root = work.state.IntermediateRoot(self.config.IsSiotImpr2(header.Number))
+		header.Root = work.state.IntermediateRoot(config.IsSiotImpr2(header.Number))
+		workFinalizeTimer.UpdateSince(fstart)
 	}
 
 	// create the new block whose nonce will be mined.
@@ -519,6 +680,18 @@ func (self *worker) commitNewWork() {
 	if atomic.LoadInt32(&self.mining) == 1 {
 		self.logLocalMinedBlocks(work, previous)
 	}
+	if wait := time.Unix(tstamp, 0).Sub(time.Now()); interval > 0 && wait > 0 {
+		time.AfterFunc(wait, func() {
+			self.currentMu.Lock()
+			defer self.currentMu.Unlock()
+
+			// Drop the work if a new head superseded it in the meantime
+			if self.current == work {
+				self.push(work)
+			}
+		})
+		return
+	}
 	self.push(work)
 }
 
@@ -537,8 +710,8 @@ func (self *worker) commitUncle(work *Work, uncle *types.Header) error {
 	return nil
 }
 
-func (env *Work) commitTransactions(mux *subscribe.TypeMux, txs *types.TransactionsByPriceAndNonce, gasPrice *big.Int, bc *blockchainCore.BlockChain) {
-	gp := new(blockchainCore.GasPool).AddGas(env.header.GasLimit)
+func (env *Work) commitTransactions(mux *subscribe.TypeMux, txs TransactionSet, gasPrice *big.Int, bc *blockchainCore.BlockChain) {
+	gp := new(blockchainCore.GasPool).AddGas(new(big.Int).Sub(env.header.GasLimit, env.header.GasUsed))
 
 	var coalescedLogs localEnv.Logs
 
@@ -573,9 +746,11 @@ func (env *Work) commitTransactions(mux *subscribe.TypeMux, txs *types.Transacti
 			continue
 		}
 		// Start executing the transaction
-		env.state.StartRecord(tx.Hash(), helper.Hash{}, env.tcount)
+		env.state.Prepare(tx.Hash(), helper.Hash{}, env.tcount)
 
+		tstart := time.Now()
 		err, logs := env.commitTransaction(tx, bc, gp)
+		workTxTimer.UpdateSince(tstart)
 		switch {
 		case blockchainCore.IsGasLimitErr(err):
 			// Pop the current out-of-gas transaction without shifting in the next from the account
@@ -583,8 +758,11 @@ func (env *Work) commitTransactions(mux *subscribe.TypeMux, txs *types.Transacti
 			txs.Pop()
 
 		case err != nil:
-			// Pop the current failed transaction without shifting in the next from the account
-			glog.V(logger.Detail).Infof("Transaction (%x) failed, will be removed: %v\n", tx.Hash().Bytes()[:4], err)
+			// Pop the current failed transaction without shifting in the next from the account.
+			// The virtual machine doesn't return any revert data, the error is the only reason.
+			if glog.V(logger.Debug) {
+				glog.Infof("Transaction (%x) from %x (nonce %d, gas %v) failed, will be removed: %v\n", tx.Hash().Bytes()[:4], from[:4], tx.Nonce(), tx.Gas(), err)
+			}
 			env.failedTxs = append(env.failedTxs, tx)
 			txs.Pop()
 
@@ -617,6 +795,7 @@ func (env *Work) commitTransaction(tx *types.Transaction, bc *blockchainCore.Blo
 	}
 	env.txs = append(env.txs, tx)
 	env.receipts = append(env.receipts, receipt)
+	env.addFee(tx, receipt)
 
 	return nil, logs
 }
@@ -0,0 +1,278 @@
+package miner
+
+import (
+	"io/ioutil"
+	"math/big"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/siotchain/siot/blockchainCore"
+	"github.com/siotchain/siot/blockchainCore/types"
+	"github.com/siotchain/siot/configure"
+	"github.com/siotchain/siot/database"
+	"github.com/siotchain/siot/subscribe"
+	"github.com/siotchain/siot/validation"
+	"github.com/siotchain/siot/wallet"
+)
+
+// testGenesis is a minimal genesis specification carrying its chain config.
+const testGenesis = `{
+	"config":     {"chainId": 1, "homesteadBlock": 0},
+	"nonce":      "0x0000000000000042",
+	"difficulty": "0x400",
+	"gasLimit":   "0x2fefd8",
+	"alloc":      {}
+}`
+
+// testBackend is a miner backend on an in-memory chain.
+type testBackend struct {
+	accman *wallet.Manager
+	chain  *blockchainCore.BlockChain
+	txpool *blockchainCore.TxPool
+	db     database.Database
+	keydir string
+}
+
+// newTestBackend creates a miner backend on a chain whose genesis funds the test
+// bank account.
+func newTestBackend(t *testing.T, config *configure.ChainConfig, mux *subscribe.TypeMux) *testBackend {
+	spec, err := blockchainCore.GenesisWithAlloc(testGenesis, blockchainCore.GenesisAccount{Address: testBankAddress, Balance: testBankFunds})
+	if err != nil {
+		t.Fatalf("failed to assemble genesis: %v", err)
+	}
+	db, _ := database.NewMemDatabase()
+	if _, err := blockchainCore.WriteGenesisBlock(db, strings.NewReader(spec)); err != nil {
+		t.Fatalf("failed to write genesis: %v", err)
+	}
+	chain, err := blockchainCore.NewBlockChain(db, config, blockchainCore.FakePow{}, mux)
+	if err != nil {
+		t.Fatalf("failed to create blockchain: %v", err)
+	}
+	keydir, err := ioutil.TempDir("", "miner-test")
+	if err != nil {
+		t.Fatalf("failed to create keystore dir: %v", err)
+	}
+	return &testBackend{
+		accman: wallet.NewManager(keydir, wallet.LightScryptN, wallet.LightScryptP),
+		chain:  chain,
+		txpool: blockchainCore.NewTxPool(config, mux, chain.State, chain.GasLimit, 0),
+		db:     db,
+		keydir: keydir,
+	}
+}
+
+func (b *testBackend) AccountManager() *wallet.Manager        { return b.accman }
+func (b *testBackend) BlockChain() *blockchainCore.BlockChain { return b.chain }
+func (b *testBackend) TxPool() *blockchainCore.TxPool         { return b.txpool }
+func (b *testBackend) ChainDb() database.Database             { return b.db }
+
+func (b *testBackend) close() {
+	b.txpool.Stop()
+	b.chain.Stop()
+	os.RemoveAll(b.keydir)
+}
+
+// Tests that a new worker assembles the work on top of the current head right
+// away, without waiting for a chain head event.
+func TestNewWorkerPreparesWork(t *testing.T) {
+	mux := new(subscribe.TypeMux)
+	defer mux.Stop()
+
+	config := configure.TestChainConfig
+	backend := newTestBackend(t, config, mux)
+	defer backend.close()
+
+	w := newWorker(testBankAddress, backend, mux)
+
+	w.currentMu.Lock()
+	defer w.currentMu.Unlock()
+
+	if w.current == nil {
+		t.Fatalf("no work assembled after construction")
+	}
+	head := backend.chain.CurrentBlock()
+	if number := w.current.header.Number.Uint64(); number != head.NumberU64()+1 {
+		t.Errorf("work number mismatch: have #%d, want #%d", number, head.NumberU64()+1)
+	}
+	if parent := w.current.header.ParentHash; parent != head.Hash() {
+		t.Errorf("work parent mismatch: have %x, want %x", parent, head.Hash())
+	}
+}
+
+// Tests that a chain configuration replaced live is picked up by the next work
+// assembled by the worker.
+func TestWorkerLiveChainConfig(t *testing.T) {
+	mux := new(subscribe.TypeMux)
+	defer mux.Stop()
+
+	backend := newTestBackend(t, configure.TestChainConfig, mux)
+	defer backend.close()
+
+	w := newWorker(testBankAddress, backend, mux)
+
+	config := *configure.TestChainConfig
+	config.SiotImpr2Block = big.NewInt(1000)
+	backend.chain.SetConfig(&config)
+	backend.txpool.SetChainConfig(&config)
+
+	w.commitNewWork()
+
+	w.currentMu.Lock()
+	defer w.currentMu.Unlock()
+
+	if w.current.config != &config {
+		t.Fatalf("work assembled on a stale chain config")
+	}
+}
+
+// instantPow is a proof of work sealing every block right away.
+type instantPow struct{ blockchainCore.FakePow }
+
+func (instantPow) Search(block validation.Block, stop <-chan struct{}, index int) (uint64, []byte) {
+	return 1, nil
+}
+
+// Tests that with a block time target, blocks are sealed one interval apart and
+// never ahead of the local clock.
+func TestWorkerBlockTime(t *testing.T) {
+	mux := new(subscribe.TypeMux)
+	defer mux.Stop()
+
+	backend := newTestBackend(t, configure.TestChainConfig, mux)
+	defer backend.close()
+
+	sub := mux.Subscribe(blockchainCore.ChainHeadEvent{})
+	defer sub.Unsubscribe()
+
+	w := newWorker(testBankAddress, backend, mux)
+	atomic.StoreInt64(&w.blockTime, 1)
+	w.register(NewCpuAgent(0, instantPow{}))
+	w.start()
+	defer w.stop()
+	w.commitNewWork()
+
+	var (
+		blocks []*types.Block
+		times  []time.Time
+	)
+	timeout := time.After(10 * time.Second)
+	for len(blocks) < 3 {
+		select {
+		case ev := <-sub.Chan():
+			block := ev.Data.(blockchainCore.ChainHeadEvent).Block
+			if now := time.Now(); block.Time().Int64() > now.Unix() {
+				t.Errorf("block #%d sealed ahead of the clock: timestamp %v, now %d", block.NumberU64(), block.Time(), now.Unix())
+			}
+			blocks, times = append(blocks, block), append(times, time.Now())
+		case <-timeout:
+			t.Fatalf("only %d blocks mined in time", len(blocks))
+		}
+	}
+	for i := 1; i < len(blocks); i++ {
+		if gap := new(big.Int).Sub(blocks[i].Time(), blocks[i-1].Time()); gap.Int64() != 1 {
+			t.Errorf("block #%d: timestamp gap mismatch: have %v, want 1", blocks[i].NumberU64(), gap)
+		}
+	}
+	// Two intervals must have passed between the first and the last block, give
+	// or take the rounding of the first timestamp to whole seconds
+	if spacing := times[2].Sub(times[0]); spacing < time.Second {
+		t.Errorf("blocks sealed too fast: %v for two intervals", spacing)
+	}
+}
+
+// Tests that the fees paid by the transactions of a sealed block are accounted
+// to it.
+func TestWorkerBlockFees(t *testing.T) {
+	mux := new(subscribe.TypeMux)
+	defer mux.Stop()
+
+	backend := newTestBackend(t, configure.TestChainConfig, mux)
+	defer backend.close()
+
+	// Pace the blocks, sealing instantly would soon get them ahead of the clock
+	w := newWorker(testBankAddress, backend, mux)
+	w.setGasPrice(big.NewInt(1))
+	atomic.StoreInt64(&w.blockTime, 1)
+
+	// Pool two transfers paying different gas prices
+	backend.txpool.Revalidate()
+	signer := types.MakeSigner(configure.TestChainConfig, big.NewInt(1))
+	for nonce, price := range []int64{5, 3} {
+		tx := types.NewTransaction(uint64(nonce), testRecipient, big.NewInt(1000), big.NewInt(21000), big.NewInt(price), nil)
+		signed, err := types.SignECDSA(signer, tx, testBankKey)
+		if err != nil {
+			t.Fatalf("failed to sign transaction: %v", err)
+		}
+		if err := backend.txpool.Add(signed); err != nil {
+			t.Fatalf("failed to pool transaction: %v", err)
+		}
+	}
+	w.register(NewCpuAgent(0, instantPow{}))
+	w.start()
+	defer w.stop()
+	w.commitNewWork()
+
+	for start := time.Now(); len(w.fees.recent()) == 0; time.Sleep(10 * time.Millisecond) {
+		if time.Since(start) > 5*time.Second {
+			t.Fatalf("no block sealed in time")
+		}
+	}
+	fees := w.fees.recent()[0]
+	block := backend.chain.GetBlockByHash(fees.Hash)
+	if block == nil || block.NumberU64() != fees.Number {
+		t.Fatalf("fees recorded for unknown block #%d [%x]", fees.Number, fees.Hash)
+	}
+	if len(block.Transactions()) != 2 {
+		t.Fatalf("sealed transaction count mismatch: have %d, want 2", len(block.Transactions()))
+	}
+	if want := big.NewInt(21000 * (5 + 3)); fees.Fees.Cmp(want) != 0 {
+		t.Errorf("block fees mismatch: have %v, want %v", fees.Fees, want)
+	}
+}
+
+// Tests that side blocks fed to the worker are kept as possible uncles only
+// while they are within the retention window below the head.
+func TestWorkerUnclePruning(t *testing.T) {
+	mux := new(subscribe.TypeMux)
+	defer mux.Stop()
+
+	backend := newTestBackend(t, configure.TestChainConfig, mux)
+	defer backend.close()
+
+	w := newWorker(testBankAddress, backend, mux)
+	w.setUncleRetention(3)
+
+	for i := int64(1); i <= 20; i++ {
+		side := types.NewBlockWithHeader(&types.Header{Number: big.NewInt(i), Difficulty: big.NewInt(1)})
+		mux.Post(blockchainCore.ChainSideEvent{Block: side})
+	}
+	uncles := func() map[uint64]bool {
+		w.uncleMu.Lock()
+		defer w.uncleMu.Unlock()
+
+		numbers := make(map[uint64]bool)
+		for _, uncle := range w.possibleUncles {
+			numbers[uncle.NumberU64()] = true
+		}
+		return numbers
+	}
+	for start := time.Now(); len(uncles()) < 20; time.Sleep(10 * time.Millisecond) {
+		if time.Since(start) > 5*time.Second {
+			t.Fatalf("side blocks not tracked: have %d, want 20", len(uncles()))
+		}
+	}
+	w.pruneUncles(20)
+
+	kept := uncles()
+	if len(kept) != 4 {
+		t.Errorf("retained side block count mismatch: have %d, want 4", len(kept))
+	}
+	for number := uint64(17); number <= 20; number++ {
+		if !kept[number] {
+			t.Errorf("side block #%d within the window pruned", number)
+		}
+	}
+}
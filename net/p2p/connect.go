@@ -47,6 +47,7 @@ type discoverTable interface {
 	Resolve(target discover.NodeID) *discover.Node
 	Lookup(target discover.NodeID) []*discover.Node
 	ReadRandomNodes([]*discover.Node) int
+	Len() int
 }
 
 // the dial history remembers recent dials.
@@ -253,6 +254,7 @@ func (t *dialTask) dial(srv *Server, dest *discover.Node) bool {
 	fd, err := srv.Dialer.Dial("tcp", addr.String())
 	if err != nil {
 		glog.V(logger.Detail).Infof("%v", err)
+		dialFailureCounter.Inc(1)
 		return false
 	}
 	mfd := newMeteredConn(fd, false)
@@ -276,6 +278,9 @@ func (t *discoverTask) Do(srv *Server) {
 	var target discover.NodeID
 	rand.Read(target[:])
 	t.results = srv.ntab.Lookup(target)
+
+	discoverNodesMeter.Mark(int64(len(t.results)))
+	discoverTableGauge.Update(int64(srv.ntab.Len()))
 }
 
 func (t *discoverTask) String() string {
@@ -108,6 +108,13 @@ func (tab *Table) Self() *Node {
 	return tab.self
 }
 
+// Len returns the number of nodes currently in the table.
+func (tab *Table) Len() int {
+	tab.mutex.Lock()
+	defer tab.mutex.Unlock()
+	return tab.len()
+}
+
 // ReadRandomNodes fills the given slice with random nodes from the
 // table. It will not write the same node more than once. The nodes in
 // the slice are copies and can be modified by the caller.
@@ -5,6 +5,7 @@ package p2p
 import (
 	"net"
 
+	gometrics "github.com/rcrowley/go-metrics"
 	"github.com/siotchain/siot/helper/metrics"
 )
 
@@ -13,8 +14,22 @@ var (
 	ingressTrafficMeter = metrics.NewMeter("p2p/InboundTraffic")
 	egressConnectMeter  = metrics.NewMeter("p2p/OutboundConnects")
 	egressTrafficMeter  = metrics.NewMeter("p2p/OutboundTraffic")
+
+	discoverTableGauge = metrics.NewGauge("p2p/discover/Table")
+
+	// The discovery metrics also back the discovery stats, which are available
+	// regardless of the metrics flag. They are only registered if it's set.
+	discoverNodesMeter = gometrics.NewMeter()
+	dialFailureCounter = gometrics.NewCounter()
 )
 
+func init() {
+	if metrics.Enabled {
+		gometrics.Register("p2p/discover/Nodes", discoverNodesMeter)
+		gometrics.Register("p2p/DialFailures", dialFailureCounter)
+	}
+}
+
 // meteredConn is a wrapper around a network TCP connection that meters both the
 // inbound and outbound network traffic.
 type meteredConn struct {
@@ -36,6 +36,12 @@ type Protocol struct {
 	// about a certain peer in the network. If an info retrieval function is set,
 	// but returns nil, it is assumed that the protocol handshake is still running.
 	PeerInfo func(id discover.NodeID) interface{}
+
+	// Evict is an optional helper method consulted when a peer supporting the
+	// protocol connects while the server is full. It returns a connected peer to
+	// disconnect in favour of the newcomer, or nil if the newcomer should be
+	// turned away.
+	Evict func(id discover.NodeID) *discover.NodeID
 }
 
 func (p Protocol) cap() Cap {
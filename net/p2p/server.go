@@ -481,12 +481,21 @@ running:
 			}
 			glog.V(logger.Detail).Infoln("<-posthandshake:", c)
 			// TODO: track in-progress inbound node IDs (pre-Peer) to avoid dialing them.
-			c.cont <- srv.encHandshakeChecks(peers, c)
+			err := srv.encHandshakeChecks(peers, c)
+			if err == DiscTooManyPeers && srv.canEvict() {
+				// Whether a peer can be evicted depends on the capabilities,
+				// decide after the protocol handshake.
+				err = nil
+			}
+			c.cont <- err
 		case c := <-srv.addpeer:
 			// At this point the connection is past the protocol handshake.
 			// Its capabilities are known and the remote identity is verified.
 			glog.V(logger.Detail).Infoln("<-addpeer:", c)
 			err := srv.protoHandshakeChecks(peers, c)
+			if err == DiscTooManyPeers {
+				err = srv.evictFor(peers, c)
+			}
 			if err != nil {
 				glog.V(logger.Detail).Infof("Not adding %v as peer: %v", c, err)
 			} else {
@@ -548,6 +557,45 @@ func (srv *Server) encHandshakeChecks(peers map[discover.NodeID]*Peer, c *conn)
 	}
 }
 
+// canEvict reports whether any protocol may evict peers to admit new ones.
+func (srv *Server) canEvict() bool {
+	for _, proto := range srv.Protocols {
+		if proto.Evict != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// evictFor asks the protocols shared with a connection arriving while the server
+// is full to name a peer to disconnect in its favour. The connection may replace
+// the evicted peer right away, the server temporarily exceeding MaxPeers until the
+// evicted peer is gone. DiscTooManyPeers is returned if no protocol evicts a peer.
+func (srv *Server) evictFor(peers map[discover.NodeID]*Peer, c *conn) error {
+	for _, proto := range srv.Protocols {
+		if proto.Evict == nil || !hasCap(c.caps, proto.cap()) {
+			continue
+		}
+		if id := proto.Evict(c.id); id != nil {
+			if p, ok := peers[*id]; ok {
+				glog.V(logger.Debug).Infof("Evicting %v for %v", p, c)
+				p.Disconnect(DiscTooManyPeers)
+				return nil
+			}
+		}
+	}
+	return DiscTooManyPeers
+}
+
+func hasCap(caps []Cap, cap Cap) bool {
+	for _, c := range caps {
+		if c == cap {
+			return true
+		}
+	}
+	return false
+}
+
 type tempError interface {
 	Temporary() bool
 }
@@ -747,6 +795,34 @@ func (srv *Server) NodeInfo() *NodeInfo {
 	return info
 }
 
+// DiscoveryStats is a snapshot of the health of the peer discovery.
+type DiscoveryStats struct {
+	Enabled             bool    `json:"enabled"`             // Whether node discovery is running
+	TableSize           int     `json:"tableSize"`           // Number of nodes in the routing table
+	Discovered          int64   `json:"discovered"`          // Nodes returned by lookups since startup
+	DiscoveredPerMinute float64 `json:"discoveredPerMinute"` // One minute moving average of discovered nodes
+	FailedDials         int64   `json:"failedDials"`         // Outbound dials failed since startup
+}
+
+// DiscoveryStats gathers the discovery health metrics. They are collected even
+// if metrics reporting is disabled.
+func (srv *Server) DiscoveryStats() *DiscoveryStats {
+	srv.lock.Lock()
+	ntab := srv.ntab
+	srv.lock.Unlock()
+
+	stats := &DiscoveryStats{
+		Discovered:          discoverNodesMeter.Count(),
+		DiscoveredPerMinute: discoverNodesMeter.Rate1() * 60,
+		FailedDials:         dialFailureCounter.Count(),
+	}
+	if ntab != nil {
+		stats.Enabled = true
+		stats.TableSize = ntab.Len()
+	}
+	return stats
+}
+
 // PeersInfo returns an array of metadata objects describing connected peers.
 func (srv *Server) PeersInfo() []*PeerInfo {
 	// Gather all the generic and sub-protocol specific infos
@@ -0,0 +1,83 @@
+package rpc
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/siotchain/siot/logger"
+	"github.com/siotchain/siot/logger/glog"
+	"golang.org/x/net/context"
+)
+
+// redactedParams lists the methods carrying secrets (passwords, private keys)
+// along with the positions of the arguments that must never reach the logs.
+var redactedParams = map[string][]int{
+	"user_newAccount":             {0},
+	"user_importRawKey":           {0, 1},
+	"user_unlockAccount":          {1},
+	"user_sendTransaction":        {1},
+	"user_signAndSendTransaction": {1},
+	"user_sign":                   {2},
+}
+
+// remoteAddrKey is the context key under which transports store the address of
+// the remote caller for access logging.
+type remoteAddrKey struct{}
+
+// SetAccessLog enables or disables per-request access logging on the server.
+func (s *Server) SetAccessLog(enabled bool) {
+	if enabled {
+		atomic.StoreInt32(&s.accessLog, 1)
+	} else {
+		atomic.StoreInt32(&s.accessLog, 0)
+	}
+}
+
+// logAccess records the method name, caller address, duration and error status
+// of a handled request, redacting any sensitive arguments.
+func (s *Server) logAccess(ctx context.Context, req *serverRequest, elapsed time.Duration, response interface{}) {
+	if atomic.LoadInt32(&s.accessLog) == 0 {
+		return
+	}
+	remote, _ := ctx.Value(remoteAddrKey{}).(string)
+	if remote == "" {
+		remote = "-"
+	}
+	status := "ok"
+	if res, ok := response.(*jsonErrResponse); ok {
+		status = fmt.Sprintf("error(%d)", res.Error.Code)
+	}
+	glog.V(logger.Debug).Infof("rpc access: method=%s remote=%s duration=%v status=%s params=[%s]", requestMethod(req), remote, elapsed, status, formatParams(req))
+}
+
+// requestMethod returns the fully qualified method name of a request, or a
+// placeholder if the request could not be resolved to a callback.
+func requestMethod(req *serverRequest) string {
+	switch {
+	case req.isUnsubscribe:
+		return unsubscribeMethod
+	case req.callb == nil:
+		return "<unknown>"
+	}
+	return req.svcname + serviceMethodSeparator + formatName(req.callb.method.Name)
+}
+
+// formatParams renders the arguments of a request for logging, replacing the
+// sensitive ones with a placeholder.
+func formatParams(req *serverRequest) string {
+	redact := make(map[int]bool)
+	for _, pos := range redactedParams[requestMethod(req)] {
+		redact[pos] = true
+	}
+	params := make([]string, len(req.args))
+	for i, arg := range req.args {
+		if redact[i] {
+			params[i] = "<redacted>"
+			continue
+		}
+		params[i] = fmt.Sprintf("%v", arg.Interface())
+	}
+	return strings.Join(params, ", ")
+}
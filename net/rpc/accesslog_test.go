@@ -0,0 +1,31 @@
+package rpc
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Tests that the access log names the called method and redacts the sensitive
+// arguments of the methods carrying secrets.
+func TestAccessLogParams(t *testing.T) {
+	req := &serverRequest{
+		svcname: "user",
+		callb:   &callback{method: reflect.Method{Name: "UnlockAccount"}},
+		args:    []reflect.Value{reflect.ValueOf("0x0102"), reflect.ValueOf("hunter2"), reflect.ValueOf(300)},
+	}
+	if method := requestMethod(req); method != "user_unlockAccount" {
+		t.Errorf("method mismatch: have %s, want user_unlockAccount", method)
+	}
+	params := formatParams(req)
+	if strings.Contains(params, "hunter2") {
+		t.Errorf("password leaked into the access log: %s", params)
+	}
+	if want := "0x0102, <redacted>, 300"; params != want {
+		t.Errorf("params mismatch: have %q, want %q", params, want)
+	}
+	// Requests not resolved to a method are logged with a placeholder
+	if method := requestMethod(&serverRequest{svcname: "user"}); method != "<unknown>" {
+		t.Errorf("unresolved method mismatch: have %s, want <unknown>", method)
+	}
+}
@@ -143,7 +143,9 @@ func (srv *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// a single request.
 	codec := NewJSONCodec(&httpReadWriteNopCloser{r.Body, w})
 	defer codec.Close()
-	srv.ServeSingleRequest(codec, OptionMethodInvocation)
+
+	ctx := context.WithValue(context.Background(), remoteAddrKey{}, r.RemoteAddr)
+	srv.serveRequest(ctx, codec, true, OptionMethodInvocation)
 }
 
 func newCorsHandler(srv *Server, corsString string) http.Handler {
@@ -0,0 +1,90 @@
+package rpc
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// MethodFilter restricts the methods a server is willing to invoke on a finer
+// grain than the module list. It is built from a comma separated list of glob
+// patterns matched against fully qualified method names (e.g. siot_getBalance),
+// where patterns prefixed with "!" deny instead of allow.
+//
+// A method is permitted if it matches no deny pattern and either matches one of
+// the allow patterns or no allow patterns were given at all.
+//
+// Subscriptions are matched both by the subscribe call itself (siot_subscribe)
+// and by the subscription name (e.g. siot_newHeads): denying either one denies
+// the subscription, allowing either one allows it. Unsubscribing is always
+// permitted.
+type MethodFilter struct {
+	allow []string
+	deny  []string
+}
+
+// ParseMethodFilter creates a method filter from its textual specification, e.g.
+// "siot_*,!siot_sendRawTransaction". An empty specification permits everything.
+func ParseMethodFilter(spec string) (*MethodFilter, error) {
+	filter := new(MethodFilter)
+	for _, pattern := range strings.Split(spec, ",") {
+		pattern = strings.TrimSpace(pattern)
+		deny := strings.HasPrefix(pattern, "!")
+		if deny {
+			pattern = strings.TrimSpace(pattern[1:])
+		}
+		if pattern == "" {
+			continue
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid method pattern %q: %v", pattern, err)
+		}
+		if deny {
+			filter.deny = append(filter.deny, pattern)
+		} else {
+			filter.allow = append(filter.allow, pattern)
+		}
+	}
+	return filter, nil
+}
+
+// Allowed reports whether the filter permits invoking the given method.
+func (f *MethodFilter) Allowed(method string) bool {
+	if f == nil {
+		return true
+	}
+	if matchAny(f.deny, method) {
+		return false
+	}
+	return len(f.allow) == 0 || matchAny(f.allow, method)
+}
+
+// allowedSubscription reports whether the filter permits subscribing to the
+// given subscription of a service.
+func (f *MethodFilter) allowedSubscription(service, name string) bool {
+	if f == nil {
+		return true
+	}
+	outer, inner := service+serviceMethodSeparator+subscribeMethod, service+serviceMethodSeparator+name
+	if matchAny(f.deny, outer) || matchAny(f.deny, inner) {
+		return false
+	}
+	return len(f.allow) == 0 || matchAny(f.allow, outer) || matchAny(f.allow, inner)
+}
+
+// matchAny checks whether the method name matches any of the glob patterns.
+func matchAny(patterns []string, method string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, method); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// SetMethodFilter restricts the methods the server invokes to those permitted by
+// the filter, answering all others as if they did not exist. It must be called
+// before the server starts serving requests.
+func (s *Server) SetMethodFilter(filter *MethodFilter) {
+	s.filter = filter
+}
@@ -0,0 +1,85 @@
+package rpc
+
+import "testing"
+
+// FilterTestService is a service with a harmless and a dangerous method, used to
+// test method filtering.
+type FilterTestService struct{}
+
+func (s *FilterTestService) GetBalance() int         { return 1 }
+func (s *FilterTestService) SendRawTransaction() int { return 2 }
+
+// Tests that method filters permit and block methods by their glob patterns.
+func TestMethodFilter(t *testing.T) {
+	tests := []struct {
+		spec    string
+		allowed map[string]bool
+	}{
+		// Everything permitted without patterns
+		{"", map[string]bool{"siot_getBalance": true, "admin_peers": true}},
+		// Allow all of a module but one method
+		{"siot_*,!siot_sendRawTransaction", map[string]bool{
+			"siot_getBalance": true, "siot_sendRawTransaction": false, "admin_peers": false,
+		}},
+		// Deny all but one method
+		{"siot_getBalance", map[string]bool{
+			"siot_getBalance": true, "siot_sendRawTransaction": false, "admin_peers": false,
+		}},
+		// Deny a whole module, permitting the rest
+		{"!admin_*", map[string]bool{"siot_getBalance": true, "admin_peers": false}},
+	}
+	for _, tt := range tests {
+		filter, err := ParseMethodFilter(tt.spec)
+		if err != nil {
+			t.Fatalf("%q: failed to parse filter: %v", tt.spec, err)
+		}
+		for method, want := range tt.allowed {
+			if have := filter.Allowed(method); have != want {
+				t.Errorf("%q: %s allowed mismatch: have %v, want %v", tt.spec, method, have, want)
+			}
+		}
+	}
+	if _, err := ParseMethodFilter("siot_[,"); err == nil {
+		t.Errorf("invalid pattern accepted")
+	}
+	// Subscriptions are denied by either the subscribe call or their name
+	filter, _ := ParseMethodFilter("siot_*,!siot_newHeads")
+	if filter.allowedSubscription("siot", "newHeads") {
+		t.Errorf("denied subscription allowed")
+	}
+	if !filter.allowedSubscription("siot", "logs") {
+		t.Errorf("allowed subscription denied")
+	}
+	filter, _ = ParseMethodFilter("!siot_subscribe")
+	if filter.allowedSubscription("siot", "logs") {
+		t.Errorf("subscription allowed with subscribing denied")
+	}
+}
+
+// Tests that the server answers methods blocked by its filter as unavailable,
+// while serving the permitted ones.
+func TestMethodFilterDispatch(t *testing.T) {
+	server := NewServer()
+	defer server.Stop()
+
+	if err := server.RegisterName("siot", new(FilterTestService)); err != nil {
+		t.Fatalf("failed to register service: %v", err)
+	}
+	filter, _ := ParseMethodFilter("siot_*,!siot_sendRawTransaction")
+	server.SetMethodFilter(filter)
+
+	client := DialInProc(server)
+	defer client.Close()
+
+	var result int
+	if err := client.Call(&result, "siot_getBalance"); err != nil || result != 1 {
+		t.Errorf("allowed method failed: have %d (%v), want 1", result, err)
+	}
+	err := client.Call(&result, "siot_sendRawTransaction")
+	if err == nil {
+		t.Fatalf("blocked method invoked")
+	}
+	if rpcErr, ok := err.(Error); !ok || rpcErr.ErrorCode() != (&methodNotFoundError{}).ErrorCode() {
+		t.Errorf("blocked method error mismatch: have %v, want method not found", err)
+	}
+}
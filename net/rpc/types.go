@@ -62,9 +62,11 @@ type Server struct {
 	muSubcriptions sync.Mutex // protects subscriptions
 	subscriptions  subscriptionRegistry
 
-	run      int32
-	codecsMu sync.Mutex
-	codecs   *set.Set
+	run       int32
+	accessLog int32         // whether to log every handled request (atomic)
+	filter    *MethodFilter // methods permitted to be invoked (nil = all)
+	codecsMu  sync.Mutex
+	codecs    *set.Set
 }
 
 // rpcRequest represents a raw incoming RPC request
@@ -24,7 +24,11 @@ func (srv *Server) WebsocketHandler(allowedOrigins string) http.Handler {
 	return websocket.Server{
 		Handshake: wsHandshakeValidator(strings.Split(allowedOrigins, ",")),
 		Handler: func(conn *websocket.Conn) {
-			srv.ServeCodec(NewJSONCodec(conn), OptionMethodInvocation|OptionSubscriptions)
+			codec := NewJSONCodec(conn)
+			defer codec.Close()
+
+			ctx := context.WithValue(context.Background(), remoteAddrKey{}, conn.Request().RemoteAddr)
+			srv.serveRequest(ctx, codec, false, OptionMethodInvocation|OptionSubscriptions)
 		},
 	}
 }
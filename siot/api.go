@@ -1,21 +1,27 @@
 package siot
 
 import (
+	"bufio"
 	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"math/big"
 	"os"
 	"runtime"
+	"sync"
 	"time"
 
 	"github.com/ethereum/ethash"
+	"github.com/siotchain/siot"
 	"github.com/siotchain/siot/helper"
 	"github.com/siotchain/siot/blockchainCore"
 	"github.com/siotchain/siot/blockchainCore/state"
 	"github.com/siotchain/siot/blockchainCore/types"
 	"github.com/siotchain/siot/blockchainCore/localEnv"
+	"github.com/siotchain/siot/database"
 	"github.com/siotchain/siot/internal/siotapi"
 	"github.com/siotchain/siot/logger"
 	"github.com/siotchain/siot/logger/glog"
@@ -23,6 +29,7 @@ import (
 	"github.com/siotchain/siot/configure"
 	"github.com/siotchain/siot/helper/rlp"
 	"github.com/siotchain/siot/net/rpc"
+	"golang.org/x/net/context"
 )
 
 const defaultTraceTimeout = 5 * time.Second
@@ -50,9 +57,88 @@ func (s *PublicSiotchainAPI) Coinbase() (helper.Address, error) {
 
 // Hashrate returns the POW hashrate
 func (s *PublicSiotchainAPI) Hashrate() *rpc.HexNumber {
+	if s.e.Miner() == nil {
+		return rpc.NewHexNumber(0)
+	}
 	return rpc.NewHexNumber(s.e.Miner().HashRate())
 }
 
+// ChainReorg creates a subscription that is notified whenever the canonical chain
+// is reorganised, with the common ancestor and the headers of the removed and the
+// added blocks.
+func (s *PublicSiotchainAPI) ChainReorg(ctx context.Context) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+	rpcSub := notifier.CreateSubscription()
+
+	go func() {
+		sub := s.e.EventMux().Subscribe(blockchainCore.ChainReorgEvent{})
+		defer sub.Unsubscribe()
+
+		for {
+			select {
+			case ev, ok := <-sub.Chan():
+				if !ok {
+					return
+				}
+				reorg := ev.Data.(blockchainCore.ChainReorgEvent)
+				notifier.Notify(rpcSub.ID, &siotchain.ChainReorg{
+					Ancestor: reorg.Ancestor.Header(),
+					Removed:  blockHeaders(reorg.Removed),
+					Added:    blockHeaders(reorg.Added),
+				})
+			case <-rpcSub.Err():
+				return
+			case <-notifier.Closed():
+				return
+			}
+		}
+	}()
+	return rpcSub, nil
+}
+
+// blockHeaders returns the headers of a list of blocks.
+func blockHeaders(blocks types.Blocks) []*types.Header {
+	headers := make([]*types.Header, len(blocks))
+	for i, block := range blocks {
+		headers[i] = block.Header()
+	}
+	return headers
+}
+
+// UncleRate returns the fraction of the recently mined local blocks that didn't
+// make it into the canonical chain, and the number of blocks it's measured over.
+func (s *PublicSiotchainAPI) UncleRate() (map[string]interface{}, error) {
+	if s.e.Miner() == nil {
+		return nil, errReadOnly
+	}
+	rate, samples := s.e.Miner().UncleRate()
+	return map[string]interface{}{
+		"rate":    rate,
+		"samples": samples,
+	}, nil
+}
+
+// BlockFees returns the transaction fees collected by the most recently sealed
+// local blocks, oldest first. Block rewards are not included.
+func (s *PublicSiotchainAPI) BlockFees() ([]map[string]interface{}, error) {
+	if s.e.Miner() == nil {
+		return nil, errReadOnly
+	}
+	recent := s.e.Miner().RecentFees()
+	fees := make([]map[string]interface{}, len(recent))
+	for i, block := range recent {
+		fees[i] = map[string]interface{}{
+			"number": rpc.NewHexNumber(block.Number),
+			"hash":   block.Hash,
+			"fees":   rpc.NewHexNumber(block.Fees),
+		}
+	}
+	return fees, nil
+}
+
 // PublicMinerAPI provides an API to control the miner.
 // It offers only methods that operate on data that pose no security risk when it is publicly accessible.
 type PublicMinerAPI struct {
@@ -104,6 +190,34 @@ func (s *PublicMinerAPI) SubmitHashrate(hashrate rpc.HexNumber, id helper.Hash)
 	return true
 }
 
+// GasPrice creates a subscription that is notified of the gas price floor of the
+// miner, first with its current value and then whenever it changes.
+func (s *PublicMinerAPI) GasPrice(ctx context.Context) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+	rpcSub := notifier.CreateSubscription()
+
+	go func() {
+		prices := make(chan *big.Int)
+		sub := s.e.SubscribeGasPrice(prices)
+		defer sub.Unsubscribe()
+
+		for {
+			select {
+			case price := <-prices:
+				notifier.Notify(rpcSub.ID, (*rpc.HexNumber)(price))
+			case <-rpcSub.Err():
+				return
+			case <-notifier.Closed():
+				return
+			}
+		}
+	}()
+	return rpcSub, nil
+}
+
 // PrivateMinerAPI provides private RPC methods to control the miner.
 // These methods can be abused by external users and must be considered insecure for use by untrusted users.
 type PrivateMinerAPI struct {
@@ -145,6 +259,32 @@ func (s *PrivateMinerAPI) SetExtra(extra string) (bool, error) {
 	return true, nil
 }
 
+// SubmitBundle schedules the RLP encoded transactions to be included in the given
+// order at the top of the block with the given number, all together or not at
+// all. Transactions failing to apply void the entire bundle.
+func (s *PrivateMinerAPI) SubmitBundle(encodedTxs []rpc.HexBytes, number uint64) (bool, error) {
+	if current := s.e.BlockChain().CurrentBlock().NumberU64(); number <= current {
+		return false, fmt.Errorf("target block #%d not above current head #%d", number, current)
+	}
+	signer := types.MakeSigner(s.e.blockchain.Config(), new(big.Int).SetUint64(number))
+
+	txs := make(types.Transactions, len(encodedTxs))
+	for i, enc := range encodedTxs {
+		tx := new(types.Transaction)
+		if err := rlp.DecodeBytes(enc, tx); err != nil {
+			return false, fmt.Errorf("transaction %d: %v", i, err)
+		}
+		if _, err := types.Sender(signer, tx); err != nil {
+			return false, fmt.Errorf("transaction %d: %v", i, err)
+		}
+		txs[i] = tx
+	}
+	if err := s.e.Miner().SubmitBundle(txs, number); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
 // SetGasPrice sets the minimum accepted gas price for the miner.
 func (s *PrivateMinerAPI) SetGasPrice(gasPrice rpc.HexNumber) bool {
 	s.e.Miner().SetGasPrice(gasPrice.BigInt())
@@ -157,6 +297,16 @@ func (s *PrivateMinerAPI) SetMiner(mineraddr helper.Address) bool {
 	return true
 }
 
+// SetMiners sets the reward addresses of the miner, rotating among them with
+// every mined block
+func (s *PrivateMinerAPI) SetMiners(mineraddrs []helper.Address) (bool, error) {
+	if len(mineraddrs) == 0 {
+		return false, fmt.Errorf("no miner addresses given")
+	}
+	s.e.SetMiners(mineraddrs)
+	return true, nil
+}
+
 // StartAutoDAG starts auto DAG generation. This will prevent the DAG generating on epoch change
 // which will cause the node to stop mining during the generation process.
 func (s *PrivateMinerAPI) StartAutoDAG() bool {
@@ -206,9 +356,28 @@ func (api *PrivateAdminAPI) ExportChain(file string) (bool, error) {
 	return true, nil
 }
 
+// RevalidateTxPool re-checks the pooled transactions against the current state,
+// reconciling the pool after manual changes to the chain. It returns the number
+// of transactions promoted to pending and of those dropped as invalid.
+func (api *PrivateAdminAPI) RevalidateTxPool() map[string]int {
+	promoted, dropped := api.siot.TxPool().Revalidate()
+	glog.V(logger.Info).Infof("Revalidated transaction pool: %d promoted, %d dropped", promoted, dropped)
+
+	return map[string]int{
+		"promoted": promoted,
+		"dropped":  dropped,
+	}
+}
+
+// hasAllBlocks checks whether every block in the batch is already present in
+// the local chain, byte-for-byte identical to the one being imported.
 func hasAllBlocks(chain *blockchainCore.BlockChain, bs []*types.Block) bool {
 	for _, b := range bs {
-		if !chain.HasBlock(b.Hash()) {
+		existing := chain.GetBlock(b.Hash(), b.NumberU64())
+		if existing == nil {
+			return false
+		}
+		if equal, err := types.BlockEqual(existing, b); err != nil || !equal {
 			return false
 		}
 	}
@@ -258,6 +427,133 @@ func (api *PrivateAdminAPI) ImportChain(file string) (bool, error) {
 	return true, nil
 }
 
+// ExportTxPool writes all pending and queued transactions of the pool into a
+// local file as a stream of RLP encoded transactions, so that they can be
+// reloaded with ImportTxPool after a restart.
+func (api *PrivateAdminAPI) ExportTxPool(file string) (bool, error) {
+	out, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.ModePerm)
+	if err != nil {
+		return false, err
+	}
+	defer out.Close()
+
+	exported := 0
+	pending, queued := api.siot.TxPool().Content()
+	for _, content := range []map[helper.Address]types.Transactions{pending, queued} {
+		for _, txs := range content {
+			for _, tx := range txs {
+				if err := rlp.Encode(out, tx); err != nil {
+					return false, err
+				}
+				exported++
+			}
+		}
+	}
+	glog.V(logger.Info).Infof("Exported %d transactions from the pool to %s", exported, file)
+	return true, nil
+}
+
+// ImportTxPool loads the transactions previously saved by ExportTxPool into the
+// pool. Transactions with an invalid signature, already in the pool or with a
+// nonce already used up on chain are skipped.
+func (api *PrivateAdminAPI) ImportTxPool(file string) (bool, error) {
+	in, err := os.Open(file)
+	if err != nil {
+		return false, err
+	}
+	defer in.Close()
+
+	pool := api.siot.TxPool()
+	statedb, err := api.siot.BlockChain().State()
+	if err != nil {
+		return false, err
+	}
+	signer := types.MakeSigner(api.siot.BlockChain().Config(), api.siot.BlockChain().CurrentBlock().Number())
+
+	var (
+		stream  = rlp.NewStream(in, 0)
+		txs     []*types.Transaction
+		skipped int
+	)
+	for index := 0; ; index++ {
+		tx := new(types.Transaction)
+		if err := stream.Decode(tx); err == io.EOF {
+			break
+		} else if err != nil {
+			return false, fmt.Errorf("transaction %d: failed to parse: %v", index, err)
+		}
+		from, err := types.Sender(signer, tx)
+		if err != nil || pool.Get(tx.Hash()) != nil || statedb.GetNonce(from) > tx.Nonce() {
+			skipped++
+			continue
+		}
+		txs = append(txs, tx)
+	}
+	pool.AddBatch(txs)
+
+	glog.V(logger.Info).Infof("Imported %d transactions into the pool from %s, skipped %d", len(txs), file, skipped)
+	return true, nil
+}
+
+// SetHead rewinds the canonical chain to the given block number, discarding
+// every block above it. It is meant to recover from a corrupted chain head
+// without having to resynchronise from scratch.
+func (api *PrivateAdminAPI) SetHead(number uint64) (bool, error) {
+	chain := api.siot.BlockChain()
+
+	current := chain.CurrentBlock().NumberU64()
+	if number == 0 {
+		return false, fmt.Errorf("cannot rewind to the genesis block")
+	}
+	if number >= current {
+		return false, fmt.Errorf("target #%d not below current head #%d", number, current)
+	}
+	chain.SetHead(number)
+
+	// Make sure all head markers point to the new canonical head
+	head := chain.CurrentBlock()
+	db := api.siot.ChainDb()
+	if err := blockchainCore.WriteHeadBlockHash(db, head.Hash()); err != nil {
+		return false, err
+	}
+	if err := blockchainCore.WriteHeadHeaderHash(db, head.Hash()); err != nil {
+		return false, err
+	}
+	if err := blockchainCore.WriteHeadFastBlockHash(db, head.Hash()); err != nil {
+		return false, err
+	}
+	// Notify the subsystems (transaction pool reset included) of the new head
+	api.siot.EventMux().Post(blockchainCore.ChainHeadEvent{Block: head})
+
+	glog.V(logger.Info).Infof("Chain head rewound from #%d to #%d [%x…]", current, head.NumberU64(), head.Hash().Bytes()[:4])
+	return true, nil
+}
+
+// ReloadChainConfig replaces the chain configuration of the running node with
+// the one given in JSON format, provided it does not alter any fork that has
+// already activated. The new configuration is persisted and swapped into the
+// chain, transaction pool and miner without a restart.
+func (api *PrivateAdminAPI) ReloadChainConfig(config string) (bool, error) {
+	newcfg := new(configure.ChainConfig)
+	if err := json.Unmarshal([]byte(config), newcfg); err != nil {
+		return false, fmt.Errorf("invalid chain config: %v", err)
+	}
+	chain := api.siot.BlockChain()
+	head := chain.CurrentBlock().Number()
+	if err := chain.Config().CheckCompatible(newcfg, head); err != nil {
+		return false, fmt.Errorf("incompatible chain config: %v", err)
+	}
+	if err := blockchainCore.WriteChainConfig(api.siot.ChainDb(), chain.Genesis().Hash(), newcfg); err != nil {
+		return false, err
+	}
+	// The miner reads the configuration from the chain when assembling new work
+	chain.SetConfig(newcfg)
+	api.siot.TxPool().SetChainConfig(newcfg)
+
+	glog.V(logger.Info).Infof("Chain configuration reloaded at block #%v", head)
+	return true, nil
+}
+
 // PublicDebugAPI is the collection of Siotchain full node APIs exposed
 // over the public debugging endpoint.
 type PublicDebugAPI struct {
@@ -283,11 +579,29 @@ func (api *PublicDebugAPI) DumpBlock(number uint64) (state.Dump, error) {
 	return stateDb.RawDump(), nil
 }
 
+// DirtyStats reports the number of state objects modified in the pending
+// block and an estimate of the memory they occupy.
+func (api *PublicDebugAPI) DirtyStats() (map[string]interface{}, error) {
+	_, stateDb, err := api.siot.pending()
+	if err != nil {
+		return nil, err
+	}
+	count, size := stateDb.DirtyStats()
+	return map[string]interface{}{
+		"count":       count,
+		"approxBytes": size,
+	}, nil
+}
+
 // PrivateDebugAPI is the collection of Siotchain full node APIs exposed over
 // the private debugging endpoint.
 type PrivateDebugAPI struct {
 	config *configure.ChainConfig
 	siot   *Siotchain
+
+	diskUsage     map[string]uint64 // Last computed database usage per data category
+	diskUsageTime time.Time         // Time when the disk usage was last computed
+	diskUsageLock sync.Mutex
 }
 
 // NewPrivateDebugAPI creates a new API definition for the full node-related
@@ -296,6 +610,36 @@ func NewPrivateDebugAPI(config *configure.ChainConfig, siot *Siotchain) *Private
 	return &PrivateDebugAPI{config: config, siot: siot}
 }
 
+// diskUsageCacheTime is the duration for which a database usage scan is reused.
+const diskUsageCacheTime = time.Minute
+
+// TxPropagation returns how many peers a recently broadcast transaction was sent
+// to in full or announced to, and when it was first received back from the network. It helps telling
+// apart transactions that failed to propagate from underpriced ones.
+func (api *PrivateDebugAPI) TxPropagation(hash helper.Hash) (*TxPropagation, error) {
+	prop := api.siot.protocolManager.txProp.get(hash)
+	if prop == nil {
+		return nil, fmt.Errorf("transaction %x not broadcast in the last %v", hash, txPropagationTTL)
+	}
+	return prop, nil
+}
+
+// DiskUsage estimates the number of bytes the chain database occupies for each
+// category of data (headers, bodies, receipts, state, ...). The database is
+// scanned at most once every diskUsageCacheTime.
+func (api *PrivateDebugAPI) DiskUsage() (map[string]uint64, error) {
+	api.diskUsageLock.Lock()
+	defer api.diskUsageLock.Unlock()
+
+	if api.diskUsage == nil || time.Since(api.diskUsageTime) > diskUsageCacheTime {
+		start := time.Now()
+		api.diskUsage = blockchainCore.DiskUsage(api.siot.ChainDb())
+		api.diskUsageTime = time.Now()
+		glog.V(logger.Info).Infof("Database usage scan completed in %v", time.Since(start))
+	}
+	return api.diskUsage, nil
+}
+
 // BlockTraceResult is the returned value when replaying a block to check for
 // consensus results and full VM trace logs for all included transactions.
 type BlockTraceResult struct {
@@ -384,21 +728,253 @@ func (api *PrivateDebugAPI) traceBlock(block *types.Block, logConfig *localEnv.L
 	if err := blockchainCore.ValidateHeader(api.config, blockchain.AuxValidator(), block.Header(), blockchain.GetHeader(block.ParentHash(), block.NumberU64()-1), true, false); err != nil {
 		return false, structLogger.StructLogs(), err
 	}
-	statedb, err := blockchain.StateAt(blockchain.GetBlock(block.ParentHash(), block.NumberU64()-1).Root())
+	parent, statedb, err := api.parentState(block)
 	if err != nil {
 		return false, structLogger.StructLogs(), err
 	}
 
-	receipts, _, usedGas, err := processor.Process(block, statedb)
+	receipts, _, usedGas, err := processor.Process(block, statedb, nil)
 	if err != nil {
 		return false, structLogger.StructLogs(), err
 	}
-	if err := validator.ValidateState(block, blockchain.GetBlock(block.ParentHash(), block.NumberU64()-1), statedb, receipts, usedGas); err != nil {
+	if err := validator.ValidateState(block, parent, statedb, receipts, usedGas); err != nil {
 		return false, structLogger.StructLogs(), err
 	}
 	return true, structLogger.StructLogs(), nil
 }
 
+// parentState retrieves the parent of a block along with the state the block
+// is to be applied on.
+func (api *PrivateDebugAPI) parentState(block *types.Block) (*types.Block, *state.StateDB, error) {
+	blockchain := api.siot.BlockChain()
+
+	parent := blockchain.GetBlock(block.ParentHash(), block.NumberU64()-1)
+	if parent == nil {
+		return nil, nil, fmt.Errorf("parent block #%x not found", block.ParentHash())
+	}
+	statedb, err := blockchain.StateAt(parent.Root())
+	if err != nil {
+		return nil, nil, err
+	}
+	return parent, statedb, nil
+}
+
+// StartShadowValidation starts reprocessing every new canonical block on top of
+// its parent state under the chain configuration given in JSON format, e.g. one
+// scheduling an upcoming fork, and logs the blocks whose state root diverges.
+// The canonical chain is not affected. Blocks are skipped if the shadow falls
+// behind the chain.
+func (api *PrivateDebugAPI) StartShadowValidation(config string) (bool, error) {
+	shadowcfg := new(configure.ChainConfig)
+	if err := json.Unmarshal([]byte(config), shadowcfg); err != nil {
+		return false, fmt.Errorf("invalid chain config: %v", err)
+	}
+	if err := api.siot.StartShadowValidation(shadowcfg); err != nil {
+		return false, err
+	}
+	glog.V(logger.Info).Infoln("Shadow validation started")
+	return true, nil
+}
+
+// ShadowValidationStatus returns the most recent divergences found by the running
+// shadow validation, along with the number of blocks processed and skipped.
+func (api *PrivateDebugAPI) ShadowValidationStatus() (map[string]interface{}, error) {
+	api.siot.shadowMu.Lock()
+	defer api.siot.shadowMu.Unlock()
+
+	if api.siot.shadow == nil {
+		return nil, errShadowNotRunning
+	}
+	divergences, processed, skipped := api.siot.shadow.status()
+	return map[string]interface{}{
+		"divergences": divergences,
+		"processed":   processed,
+		"skipped":     skipped,
+	}, nil
+}
+
+// StopShadowValidation stops the running shadow validation and returns the most
+// recent divergences it found.
+func (api *PrivateDebugAPI) StopShadowValidation() ([]ShadowDivergence, error) {
+	return api.siot.StopShadowValidation()
+}
+
+// DumpBlockBinary writes the entire state at a given block to a file in the
+// compact binary dump format, which can be loaded back with state.LoadDumpBinary.
+func (api *PrivateDebugAPI) DumpBlockBinary(number uint64, file string) (bool, error) {
+	block := api.siot.BlockChain().GetBlockByNumber(number)
+	if block == nil {
+		return false, fmt.Errorf("block #%d not found", number)
+	}
+	stateDb, err := api.siot.BlockChain().StateAt(block.Root())
+	if err != nil {
+		return false, err
+	}
+	out, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.ModePerm)
+	if err != nil {
+		return false, err
+	}
+	defer out.Close()
+
+	if err := stateDb.RawDumpBinary(out); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// ComputeStateRoot replays the transactions of a canonical block on top of its
+// parent state and returns the resulting state root. If it differs from the one
+// stored in the header, the state at that height is corrupted and an error is
+// returned alongside the computed root.
+func (api *PrivateDebugAPI) ComputeStateRoot(number uint64) (helper.Hash, error) {
+	if number == 0 {
+		return helper.Hash{}, errors.New("genesis state cannot be recomputed")
+	}
+	block := api.siot.BlockChain().GetBlockByNumber(number)
+	if block == nil {
+		return helper.Hash{}, fmt.Errorf("block #%d not found", number)
+	}
+	_, statedb, err := api.parentState(block)
+	if err != nil {
+		return helper.Hash{}, err
+	}
+	if _, _, _, err := api.siot.BlockChain().Processor().Process(block, statedb, nil); err != nil {
+		return helper.Hash{}, err
+	}
+	root := statedb.IntermediateRoot(api.config.IsSiotImpr2(block.Number()))
+	if root != block.Root() {
+		return root, fmt.Errorf("state root mismatch at block #%d: computed %x, stored %x", number, root, block.Root())
+	}
+	return root, nil
+}
+
+// ExportLogs writes the logs emitted by the given addresses in the block range
+// [from, to] to a file, one JSON object per line, and returns the number of logs
+// exported. The mipmap blooms are used to skip whole ranges of blocks that none
+// of the addresses touched, so only the receipts of candidate blocks are read.
+func (api *PrivateDebugAPI) ExportLogs(file string, addresses []helper.Address, from, to uint64) (int, error) {
+	if len(addresses) == 0 {
+		return 0, errors.New("no addresses to export logs for")
+	}
+	if head := api.siot.BlockChain().CurrentBlock().NumberU64(); to > head {
+		to = head
+	}
+	if from > to {
+		return 0, fmt.Errorf("invalid block range #%d-#%d", from, to)
+	}
+	out, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.ModePerm)
+	if err != nil {
+		return 0, err
+	}
+	defer out.Close()
+
+	buffer := bufio.NewWriter(out)
+	exporter := &logExporter{
+		db:        api.siot.ChainDb(),
+		addresses: addresses,
+		out:       json.NewEncoder(buffer),
+		start:     time.Now(),
+		report:    time.Now(),
+	}
+	if err := exporter.scan(from, to, 0); err != nil {
+		return exporter.logs, err
+	}
+	if err := buffer.Flush(); err != nil {
+		return exporter.logs, err
+	}
+	glog.V(logger.Info).Infof("Exported %d logs from blocks #%d-#%d in %v, %d of %d blocks skipped by the blooms",
+		exporter.logs, from, to, time.Since(exporter.start), exporter.skipped, to-from+1)
+	return exporter.logs, nil
+}
+
+// logExporter walks the mipmap bloom levels of a block range, descending only
+// into the sections that may contain logs of the exported addresses.
+type logExporter struct {
+	db        database.Database
+	addresses []helper.Address
+	out       *json.Encoder
+
+	logs    int    // Number of logs written so far
+	skipped uint64 // Number of blocks ruled out without reading their receipts
+
+	start  time.Time
+	report time.Time
+}
+
+// matches reports whether any of the exported addresses may be in the bloom.
+func (e *logExporter) matches(bloom types.Bloom) bool {
+	for _, addr := range e.addresses {
+		if bloom.TestBytes(addr[:]) {
+			return true
+		}
+	}
+	return false
+}
+
+// scan exports the logs of the blocks in [start, end], checking the blooms of
+// the mipmap level at the given depth first.
+func (e *logExporter) scan(start, end uint64, depth int) error {
+	level := blockchainCore.MIPMapLevels[depth]
+
+	for num := start / level * level; num <= end; num += level {
+		lo, hi := num, num+level-1
+		if lo < start {
+			lo = start
+		}
+		if hi > end {
+			hi = end
+		}
+		if !e.matches(blockchainCore.GetMipmapBloom(e.db, num, level)) {
+			e.skipped += hi - lo + 1
+			continue
+		}
+		if depth+1 < len(blockchainCore.MIPMapLevels) {
+			if err := e.scan(lo, hi, depth+1); err != nil {
+				return err
+			}
+			continue
+		}
+		for n := lo; n <= hi; n++ {
+			if err := e.export(n); err != nil {
+				return err
+			}
+		}
+		if time.Since(e.report) > 8*time.Second {
+			glog.V(logger.Info).Infof("Exporting logs: block #%d, %d logs written, %d blocks skipped", hi, e.logs, e.skipped)
+			e.report = time.Now()
+		}
+	}
+	return nil
+}
+
+// export writes the matching logs of a single canonical block.
+func (e *logExporter) export(number uint64) error {
+	hash := blockchainCore.GetCanonicalHash(e.db, number)
+	header := blockchainCore.GetHeader(e.db, hash, number)
+	if header == nil {
+		return fmt.Errorf("block #%d not found", number)
+	}
+	if !e.matches(header.Bloom) {
+		e.skipped++
+		return nil
+	}
+	for _, receipt := range blockchainCore.GetBlockReceipts(e.db, hash, number) {
+		for _, log := range receipt.Logs {
+			for _, addr := range e.addresses {
+				if log.Address != addr {
+					continue
+				}
+				if err := e.out.Encode(log); err != nil {
+					return err
+				}
+				e.logs++
+				break
+			}
+		}
+	}
+	return nil
+}
+
 // callmsg is the message type used for call transations.
 type callmsg struct {
 	addr          helper.Address
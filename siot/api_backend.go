@@ -2,6 +2,7 @@ package siot
 
 import (
 	"math/big"
+	"time"
 
 	"github.com/siotchain/siot/wallet"
 	"github.com/siotchain/siot/helper"
@@ -26,7 +27,11 @@ type SiotApiBackend struct {
 }
 
 func (b *SiotApiBackend) ChainConfig() *configure.ChainConfig {
-	return b.siot.chainConfig
+	return b.siot.blockchain.Config()
+}
+
+func (b *SiotApiBackend) RPCGasCap() (*big.Int, bool) {
+	return b.siot.rpcGasCap, b.siot.rpcGasCapStrict
 }
 
 func (b *SiotApiBackend) CurrentBlock() *types.Block {
@@ -40,7 +45,7 @@ func (b *SiotApiBackend) SetHead(number uint64) {
 func (b *SiotApiBackend) HeaderByNumber(ctx context.Context, blockNr rpc.BlockNumber) (*types.Header, error) {
 	// Pending block is only known by the miner
 	if blockNr == rpc.PendingBlockNumber {
-		block, _ := b.siot.miner.Pending()
+		block, _, _ := b.siot.pending()
 		return block.Header(), nil
 	}
 	// Otherwise resolve and return the block
@@ -53,7 +58,7 @@ func (b *SiotApiBackend) HeaderByNumber(ctx context.Context, blockNr rpc.BlockNu
 func (b *SiotApiBackend) BlockByNumber(ctx context.Context, blockNr rpc.BlockNumber) (*types.Block, error) {
 	// Pending block is only known by the miner
 	if blockNr == rpc.PendingBlockNumber {
-		block, _ := b.siot.miner.Pending()
+		block, _, _ := b.siot.pending()
 		return block, nil
 	}
 	// Otherwise resolve and return the block
@@ -66,7 +71,10 @@ func (b *SiotApiBackend) BlockByNumber(ctx context.Context, blockNr rpc.BlockNum
 func (b *SiotApiBackend) StateAndHeaderByNumber(ctx context.Context, blockNr rpc.BlockNumber) (siotapi.State, *types.Header, error) {
 	// Pending state is only known by the miner
 	if blockNr == rpc.PendingBlockNumber {
-		block, state := b.siot.miner.Pending()
+		block, state, err := b.siot.pending()
+		if err != nil {
+			return nil, nil, err
+		}
 		return SiotApiState{state}, block.Header(), nil
 	}
 	// Otherwise resolve the block number and return its state
@@ -78,6 +86,15 @@ func (b *SiotApiBackend) StateAndHeaderByNumber(ctx context.Context, blockNr rpc
 	return SiotApiState{stateDb}, header, err
 }
 
+func (b *SiotApiBackend) StateAndHeaderByHash(ctx context.Context, blockHash helper.Hash) (siotapi.State, *types.Header, error) {
+	header := b.siot.blockchain.GetHeaderByHash(blockHash)
+	if header == nil {
+		return nil, nil, nil
+	}
+	stateDb, err := b.siot.BlockChain().StateAt(header.Root)
+	return SiotApiState{stateDb}, header, err
+}
+
 func (b *SiotApiBackend) GetBlock(ctx context.Context, blockHash helper.Hash) (*types.Block, error) {
 	return b.siot.blockchain.GetBlockByHash(blockHash), nil
 }
@@ -95,7 +112,7 @@ func (b *SiotApiBackend) GetLocalEnv(ctx context.Context, msg blockchainCore.Mes
 	from := statedb.GetOrNewStateObject(msg.From())
 	from.SetBalance(helper.MaxBig)
 	vmError := func() error { return nil }
-	return blockchainCore.NewEnv(statedb, b.siot.chainConfig, b.siot.blockchain, msg, header), vmError, nil
+	return blockchainCore.NewEnv(statedb, b.siot.blockchain.Config(), b.siot.blockchain, msg, header), vmError, nil
 }
 
 func (b *SiotApiBackend) SendTx(ctx context.Context, signedTx *types.Transaction) error {
@@ -118,7 +135,7 @@ func (b *SiotApiBackend) GetPoolTransactions() types.Transactions {
 	defer b.siot.txMu.Unlock()
 
 	var txs types.Transactions
-	for _, batch := range b.siot.txPool.Pending() {
+	for _, batch := range b.siot.txPool.PendingSnapshot() {
 		txs = append(txs, batch...)
 	}
 	return txs
@@ -145,6 +162,27 @@ func (b *SiotApiBackend) Stats() (pending int, queued int) {
 	return b.siot.txPool.Stats()
 }
 
+func (b *SiotApiBackend) TxPoolPressure() float64 {
+	b.siot.txMu.Lock()
+	defer b.siot.txMu.Unlock()
+
+	return b.siot.txPool.Pressure()
+}
+
+func (b *SiotApiBackend) TxPoolOldestPending() time.Duration {
+	b.siot.txMu.Lock()
+	defer b.siot.txMu.Unlock()
+
+	return b.siot.txPool.OldestPending()
+}
+
+func (b *SiotApiBackend) TxPoolPriceHistogram(buckets []*big.Int) map[string]int {
+	b.siot.txMu.Lock()
+	defer b.siot.txMu.Unlock()
+
+	return b.siot.txPool.PriceHistogram(buckets)
+}
+
 func (b *SiotApiBackend) TxPoolContent() (map[helper.Address]types.Transactions, map[helper.Address]types.Transactions) {
 	b.siot.txMu.Lock()
 	defer b.siot.txMu.Unlock()
@@ -152,6 +190,20 @@ func (b *SiotApiBackend) TxPoolContent() (map[helper.Address]types.Transactions,
 	return b.siot.TxPool().Content()
 }
 
+func (b *SiotApiBackend) TxPoolContentFrom(addr helper.Address) (types.Transactions, types.Transactions) {
+	b.siot.txMu.Lock()
+	defer b.siot.txMu.Unlock()
+
+	return b.siot.TxPool().ContentFrom(addr)
+}
+
+func (b *SiotApiBackend) NonceGaps(addr helper.Address) []uint64 {
+	b.siot.txMu.Lock()
+	defer b.siot.txMu.Unlock()
+
+	return b.siot.TxPool().NonceGaps(addr)
+}
+
 func (b *SiotApiBackend) Downloader() *downloader.Downloader {
 	return b.siot.Downloader()
 }
@@ -195,3 +247,19 @@ func (s SiotApiState) GetState(ctx context.Context, a helper.Address, b helper.H
 func (s SiotApiState) GetNonce(ctx context.Context, addr helper.Address) (uint64, error) {
 	return s.state.GetNonce(addr), nil
 }
+
+func (s SiotApiState) SetBalance(addr helper.Address, amount *big.Int) {
+	s.state.SetBalance(addr, amount)
+}
+
+func (s SiotApiState) SetNonce(addr helper.Address, nonce uint64) {
+	s.state.SetNonce(addr, nonce)
+}
+
+func (s SiotApiState) SetCode(addr helper.Address, code []byte) {
+	s.state.SetCode(addr, code)
+}
+
+func (s SiotApiState) SetState(addr helper.Address, key, value helper.Hash) {
+	s.state.SetState(addr, key, value)
+}
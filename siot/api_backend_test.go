@@ -0,0 +1,67 @@
+package siot
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/siotchain/siot/configure"
+	"github.com/siotchain/siot/helper"
+	"github.com/siotchain/siot/internal/siotapi"
+	"github.com/siotchain/siot/net/rpc"
+	"golang.org/x/net/context"
+)
+
+// Tests that the gas of the call executions is bounded by the RPC gas cap,
+// either capped or rejected depending on the strictness. The cap is set just
+// below the intrinsic gas of a call, so a capped call runs out of gas while an
+// uncapped one would succeed.
+func TestRPCGasCap(t *testing.T) {
+	to := helper.HexToAddress("0x0000000000000000000000000000000000000100")
+	args := siotapi.CallArgs{To: &to, Gas: *rpc.NewHexNumber(1000000)}
+
+	for _, strict := range []bool{false, true} {
+		stack, siot := newTestService(t, &Config{
+			Genesis:                 testGenesis,
+			ChainConfig:             configure.TestChainConfig,
+			PowTest:                 true,
+			GasPrice:                big.NewInt(1),
+			GpoMinGasPrice:          big.NewInt(1),
+			GpoMaxGasPrice:          big.NewInt(5000),
+			GpobaseCorrectionFactor: 110,
+			RPCGasCap:               20999,
+			RPCGasCapStrict:         strict,
+		})
+		api := siotapi.NewPublicBlockChainAPI(siot.ApiBackend)
+
+		_, err := api.EstimateGas(context.Background(), args, nil)
+		switch {
+		case err == nil:
+			t.Errorf("strict %v: call above the cap ran on the requested gas", strict)
+		case strict && !strings.Contains(err.Error(), "gas cap"):
+			t.Errorf("strict: call above the cap error mismatch: have %v, want gas cap rejection", err)
+		case !strict && strings.Contains(err.Error(), "gas cap"):
+			t.Errorf("call above the cap rejected instead of capped: %v", err)
+		}
+		stack.Stop()
+	}
+	// Without a cap, the same call runs on the requested gas
+	stack, siot := newTestService(t, &Config{
+		Genesis:                 testGenesis,
+		ChainConfig:             configure.TestChainConfig,
+		PowTest:                 true,
+		GasPrice:                big.NewInt(1),
+		GpoMinGasPrice:          big.NewInt(1),
+		GpoMaxGasPrice:          big.NewInt(5000),
+		GpobaseCorrectionFactor: 110,
+	})
+	defer stack.Stop()
+
+	gas, err := siotapi.NewPublicBlockChainAPI(siot.ApiBackend).EstimateGas(context.Background(), args, nil)
+	if err != nil {
+		t.Fatalf("uncapped call failed: %v", err)
+	}
+	if gas.BigInt().Cmp(big.NewInt(21000)) != 0 {
+		t.Errorf("uncapped call gas mismatch: have %v, want 21000", gas.BigInt())
+	}
+}
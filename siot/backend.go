@@ -10,6 +10,7 @@ import (
 	"regexp"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ethereum/ethash"
@@ -17,11 +18,13 @@ import (
 	"github.com/siotchain/siot/helper"
 	"github.com/siotchain/siot/helper/httpclient"
 	"github.com/siotchain/siot/blockchainCore"
+	"github.com/siotchain/siot/blockchainCore/state"
 	"github.com/siotchain/siot/blockchainCore/types"
 	"github.com/siotchain/siot/siot/downloader"
 	"github.com/siotchain/siot/siot/gasprice"
 	"github.com/siotchain/siot/database"
 	"github.com/siotchain/siot/subscribe"
+	"github.com/siotchain/siot/trie"
 	"github.com/siotchain/siot/internal/siotapi"
 	"github.com/siotchain/siot/logger"
 	"github.com/siotchain/siot/logger/glog"
@@ -41,6 +44,8 @@ const (
 )
 
 var (
+	errReadOnly = errors.New("node is running in read-only mode")
+
 	datadirInUseErrnos = map[uint]bool{11: true, 32: true, 35: true}
 	portInUseErrRE     = regexp.MustCompile("address already in use")
 )
@@ -56,9 +61,28 @@ type Config struct {
 	LightPeers int    // Maximum number of LES client peers
 	MaxPeers   int    // Maximum number of global peers
 
+	ImportTimeout time.Duration // Maximum time allowed to process an imported block (0 = unlimited)
+
+	TxPoolSimulate bool          // Execute transactions before admitting them into the pool
+	TxPoolLifetime time.Duration // Max time queued transactions of idle wallet are kept (0 = default)
+	TxAnnounceMode string        // Transaction propagation mode, TxAnnounceFull (default) or TxAnnounceHash
+	TxPoolPromote  int           // Max number of wallet promoted per pool lock acquisition (0 = all)
+	TxPoolCooldown time.Duration // Min time between replacements of the same transaction nonce (0 = disabled)
+	TxPoolMaxGas   int           // Max gas of a single transaction in percent of the block gas limit (0 = 100)
+	TxPrivacyDelay time.Duration // Max random delay before broadcasting local transactions (0 = immediate)
+	ReadOnly       bool          // Serve queries only: no miner, no transaction submission
+
+	RPCGasCap       uint64 // Max gas of the siot_call and siot_estimateGas executions (0 = unlimited)
+	RPCGasCapStrict bool   // Reject calls requesting more gas than RPCGasCap instead of capping them
+
+	TxResubmits     int           // Times a local transaction dropped by the pool limits is resubmitted (0 = disabled)
+	TxResubmitDelay time.Duration // Time to wait before resubmitting a dropped local transaction
+
 	SkipBcVersionCheck bool // e.g. blockchain export
 	DatabaseCache      int
 	DatabaseHandles    int
+	TrieCache          int // Megabytes of trie nodes cached across all tries (0 = disabled)
+	CodeCacheSize      int // Number of externalLogic codes cached across all states (0 = default, negative = disabled)
 
 	NatSpec   bool
 	DocRoot   string
@@ -67,9 +91,20 @@ type Config struct {
 	PowShared bool
 	ExtraData []byte
 
-	MinerAddr    helper.Address
-	GasPrice     *big.Int
-	MinerThreads int
+	MinerAddr           helper.Address
+	MinerAddrs          []helper.Address // Reward addresses rotated per block, overriding MinerAddr
+	GasPrice            *big.Int
+	MinerMinFee         *big.Int      // Gas price floor of the mined transactions, overriding GasPrice for the miner (nil = GasPrice)
+	MinerThreads        int
+	MinerDryRun         bool          // Assemble blocks without sealing them, for profiling
+	MinerEffectivePrice bool          // Rank wallet by the effective price of their pending transaction sequence
+	MinerBlockTime      time.Duration // Target block interval on private networks (0 = seal as fast as possible)
+
+	UncleRateWindow    int     // Number of locally mined blocks the uncle rate is measured over
+	UncleRateThreshold float64 // Uncle rate above which a warning is logged
+	UncleRetention     int     // Number of blocks below the head side blocks are kept as possible uncles (0 = default)
+	UnclePolicy        string   // Uncle inclusion policy, see miner.UnclesAlways (default), UnclesNever and UnclesProfitable
+	UncleMinReward     *big.Int // Reward an uncle must exceed to be included under the profitable policy (nil = 0)
 
 	GpoMinGasPrice          *big.Int
 	GpoMaxGasPrice          *big.Int
@@ -119,6 +154,16 @@ type Siotchain struct {
 	AutoDAG      bool
 	autodagquit  chan bool
 	mineraddr    helper.Address
+	readonly     bool // Whether the node serves queries only (miner is nil)
+
+	shadow   *shadowValidator // Reprocessing of new blocks under an alternative chain config (nil = off)
+	shadowMu sync.Mutex
+
+	resubmits     int           // Max resubmissions of a dropped local transaction
+	resubmitDelay time.Duration // Delay before resubmitting a dropped local transaction
+
+	rpcGasCap       *big.Int // Max gas of the RPC call executions (nil = unlimited)
+	rpcGasCapStrict bool     // Reject calls above rpcGasCap instead of capping them
 
 	NatSpec       bool
 	PowTest       bool
@@ -137,6 +182,11 @@ func New(ctx *context.ServiceContext, config *Config) (*Siotchain, error) {
 	if err != nil {
 		return nil, err
 	}
+	if config.CodeCacheSize != 0 {
+		state.SetCodeCacheSize(config.CodeCacheSize)
+	}
+	trie.SetCleanCacheSize(config.TrieCache)
+
 	stopDbUpgrade := upgradeSequentialKeys(chainDb)
 	if err := SetupGenesisBlock(&chainDb, config); err != nil {
 		return nil, err
@@ -160,6 +210,13 @@ func New(ctx *context.ServiceContext, config *Config) (*Siotchain, error) {
 		mineraddr:      config.MinerAddr,
 		MinerThreads:   config.MinerThreads,
 		AutoDAG:        config.AutoDAG,
+		readonly:       config.ReadOnly,
+		resubmits:      config.TxResubmits,
+		resubmitDelay:  config.TxResubmitDelay,
+	}
+	if config.RPCGasCap > 0 {
+		siot.rpcGasCap = new(big.Int).SetUint64(config.RPCGasCap)
+		siot.rpcGasCapStrict = config.RPCGasCapStrict
 	}
 
 	if err := upgradeChainDatabase(chainDb); err != nil {
@@ -194,6 +251,9 @@ func New(ctx *context.ServiceContext, config *Config) (*Siotchain, error) {
 		return nil, errors.New("missing chain config")
 	}
 	blockchainCore.WriteChainConfig(chainDb, genesis.Hash(), config.ChainConfig)
+	if err := blockchainCore.WriteNetworkId(chainDb, genesis.Hash(), uint64(config.NetworkId)); err != nil {
+		return nil, err
+	}
 
 	siot.chainConfig = config.ChainConfig
 
@@ -204,7 +264,24 @@ func New(ctx *context.ServiceContext, config *Config) (*Siotchain, error) {
 		}
 		return nil, err
 	}
-	newPool := blockchainCore.NewTxPool(siot.chainConfig, siot.EventMux(), siot.blockchain.State, siot.blockchain.GasLimit)
+	siot.blockchain.SetProcessTimeout(config.ImportTimeout)
+
+	newPool := blockchainCore.NewTxPool(siot.chainConfig, siot.EventMux(), siot.blockchain.State, siot.blockchain.GasLimit, config.TxPoolLifetime)
+	if config.TxPoolSimulate {
+		newPool.EnableSimulation(siot.blockchain)
+	}
+	if config.ReadOnly {
+		newPool.SetReadOnly()
+	}
+	if config.TxPoolPromote > 0 {
+		newPool.SetPromoteBatch(config.TxPoolPromote)
+	}
+	if config.TxPoolCooldown > 0 {
+		newPool.SetReplaceCooldown(config.TxPoolCooldown)
+	}
+	if config.TxPoolMaxGas > 0 {
+		newPool.SetMaxTxGas(config.TxPoolMaxGas)
+	}
 	siot.txPool = newPool
 
 	maxPeers := config.MaxPeers
@@ -218,12 +295,44 @@ func New(ctx *context.ServiceContext, config *Config) (*Siotchain, error) {
 		}
 	}
 
-	if siot.protocolManager, err = NewProtocolManager(siot.chainConfig, config.FastSync, config.NetworkId, maxPeers, siot.eventMux, siot.txPool, siot.pow, siot.blockchain, chainDb); err != nil {
+	if siot.protocolManager, err = NewProtocolManager(config.FastSync, config.NetworkId, maxPeers, siot.eventMux, siot.txPool, siot.pow, siot.blockchain, chainDb); err != nil {
 		return nil, err
 	}
-	siot.miner = miner.New(siot, siot.chainConfig, siot.EventMux(), siot.pow)
-	siot.miner.SetGasPrice(config.GasPrice)
-	siot.miner.SetExtra(config.ExtraData)
+	if config.TxAnnounceMode != "" {
+		siot.protocolManager.txAnnounce = config.TxAnnounceMode
+	}
+	siot.protocolManager.txDelay = config.TxPrivacyDelay
+	if !config.ReadOnly {
+		siot.miner = miner.New(siot, siot.EventMux(), siot.pow)
+		// The miner's floor is independent of the oracle, which is seeded by GpoMinGasPrice
+		if config.MinerMinFee != nil {
+			siot.miner.SetGasPrice(config.MinerMinFee)
+		} else {
+			siot.miner.SetGasPrice(config.GasPrice)
+		}
+		siot.miner.SetExtra(config.ExtraData)
+		siot.miner.SetDryRun(config.MinerDryRun)
+		siot.miner.SetEffectivePricing(config.MinerEffectivePrice)
+		siot.miner.SetBlockTime(config.MinerBlockTime)
+		if len(config.MinerAddrs) > 0 {
+			siot.SetMiners(config.MinerAddrs)
+		}
+		if config.UncleRetention > 0 {
+			siot.miner.SetUncleRetention(uint64(config.UncleRetention))
+		}
+		if config.UnclePolicy != "" {
+			if err := siot.miner.SetUnclePolicy(config.UnclePolicy, config.UncleMinReward); err != nil {
+				return nil, err
+			}
+		}
+		if config.UncleRateWindow > 0 {
+			if err := siot.miner.SetUncleRateLimits(config.UncleRateWindow, config.UncleRateThreshold); err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		glog.V(logger.Info).Infoln("Running in read-only mode, mining and transaction submission disabled")
+	}
 
 	gpoParams := &gasprice.GpoParams{
 		GpoMinGasPrice:          config.GpoMinGasPrice,
@@ -242,10 +351,22 @@ func New(ctx *context.ServiceContext, config *Config) (*Siotchain, error) {
 // CreateDB creates the chain database.
 func CreateDB(ctx *context.ServiceContext, config *Config, name string) (database.Database, error) {
 	db, err := ctx.OpenDatabase(name, config.DatabaseCache, config.DatabaseHandles)
+	if err != nil {
+		return nil, err
+	}
 	if db, ok := db.(*database.LDBDatabase); ok {
 		db.Meter("siot/db/chaindata/")
 	}
-	return db, err
+	// Old chain segments are rarely read, a minimal cache suffices for them
+	ancient, err := ctx.OpenAncientDatabase(name, 0, 0)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	if ancient, ok := ancient.(*database.LDBDatabase); ok {
+		ancient.Meter("siot/db/ancient/")
+	}
+	return database.NewTieredDatabase(db, ancient, blockchainCore.IsAncientKey), nil
 }
 
 // SetupGenesisBlock initializes the genesis block for an Siotchain service
@@ -289,7 +410,7 @@ func CreatePoW(config *Config) (*ethash.Ethash, error) {
 // APIs returns the collection of RPC services the Siotchain package offers.
 // NOTE, some of these services probably need to be moved to somewhere else.
 func (s *Siotchain) APIs() []rpc.API {
-	return append(siotapi.GetAPIs(s.ApiBackend), []rpc.API{
+	apis := append(siotapi.GetAPIs(s.ApiBackend), []rpc.API{
 		{
 			Namespace: "siot",
 			Version:   "1.0",
@@ -298,22 +419,29 @@ func (s *Siotchain) APIs() []rpc.API {
 		}, {
 			Namespace: "siot",
 			Version:   "1.0",
-			Service:   NewPublicMinerAPI(s),
+			Service:   downloader.NewPublicDownloaderAPI(s.protocolManager.downloader, s.eventMux),
 			Public:    true,
 		}, {
+			Namespace: "manage",
+			Version:   "1.0",
+			Service:   NewPrivateAdminAPI(s),
+		},
+	}...)
+	// Read-only nodes have no miner to expose
+	if s.readonly {
+		return apis
+	}
+	return append(apis, []rpc.API{
+		{
 			Namespace: "siot",
 			Version:   "1.0",
-			Service:   downloader.NewPublicDownloaderAPI(s.protocolManager.downloader, s.eventMux),
+			Service:   NewPublicMinerAPI(s),
 			Public:    true,
 		}, {
 			Namespace: "miner",
 			Version:   "1.0",
 			Service:   NewPrivateMinerAPI(s),
 			Public:    false,
-		}, {
-			Namespace: "manage",
-			Version:   "1.0",
-			Service:   NewPrivateAdminAPI(s),
 		},
 	}...)
 }
@@ -337,10 +465,26 @@ func (s *Siotchain) Mineraddr() (eb helper.Address, err error) {
 // set in js console via admin interface or wrapper from cli flags
 func (self *Siotchain) SetMiner(mineraddr helper.Address) {
 	self.mineraddr = mineraddr
-	self.miner.SetMiner(mineraddr)
+	if self.miner != nil {
+		self.miner.SetMiner(mineraddr)
+	}
+}
+
+// SetMiners sets the reward addresses to rotate among the mined blocks. The
+// first one also becomes the primary miner address.
+func (self *Siotchain) SetMiners(mineraddrs []helper.Address) {
+	if len(mineraddrs) > 0 && (self.mineraddr == helper.Address{}) {
+		self.mineraddr = mineraddrs[0]
+	}
+	if self.miner != nil {
+		self.miner.SetMiners(mineraddrs)
+	}
 }
 
 func (s *Siotchain) StartMining(threads int) error {
+	if s.readonly {
+		return errReadOnly
+	}
 	eb, err := s.Mineraddr()
 	if err != nil {
 		err = fmt.Errorf("Cannot start mining without miner address: %v", err)
@@ -352,11 +496,28 @@ func (s *Siotchain) StartMining(threads int) error {
 	return nil
 }
 
-func (s *Siotchain) StopMining()         { s.miner.Stop()
-fmt.Println("Mining stopped")}
-func (s *Siotchain) IsMining() bool      { return s.miner.Mining() }
+func (s *Siotchain) StopMining() {
+	if s.miner == nil {
+		return
+	}
+	s.miner.Stop()
+	fmt.Println("Mining stopped")
+}
+func (s *Siotchain) IsMining() bool      { return s.miner != nil && s.miner.Mining() }
 func (s *Siotchain) Miner() *miner.Miner { return s.miner }
 
+// pending returns the block and state currently being mined. Read-only nodes
+// don't build blocks, so the current head stands in for the pending one.
+func (s *Siotchain) pending() (*types.Block, *state.StateDB, error) {
+	if s.miner != nil {
+		block, statedb := s.miner.Pending()
+		return block, statedb, nil
+	}
+	block := s.blockchain.CurrentBlock()
+	statedb, err := s.blockchain.StateAt(block.Root())
+	return block, statedb, err
+}
+
 func (s *Siotchain) AccountManager() *wallet.Manager        { return s.accountManager }
 func (s *Siotchain) BlockChain() *blockchainCore.BlockChain { return s.blockchain }
 func (s *Siotchain) TxPool() *blockchainCore.TxPool         { return s.txPool }
@@ -367,6 +528,32 @@ func (s *Siotchain) IsListening() bool                      { return true } // A
 func (s *Siotchain) SiotVersion() int                       { return int(s.protocolManager.SubProtocols[0].Version) }
 func (s *Siotchain) NetVersion() int                        { return s.netVersionId }
 func (s *Siotchain) Downloader() *downloader.Downloader { return s.protocolManager.downloader }
+func (s *Siotchain) Synchronising() bool                { return s.protocolManager.downloader.Synchronising() }
+
+// SyncStatus implements context.SyncReporter, returning the current head and
+// the number of blocks still to be downloaded if a sync is in progress. The
+// status is known once a sync completed, or if the local chain is already at
+// least as heavy as the one of the best peer.
+func (s *Siotchain) SyncStatus() (height uint64, behind uint64, known bool) {
+	current := s.blockchain.CurrentBlock()
+	height = current.NumberU64()
+	if s.protocolManager.downloader.Synchronising() {
+		progress := s.protocolManager.downloader.Progress()
+		if progress.HighestBlock > height {
+			behind = progress.HighestBlock - height
+		}
+		return height, behind, true
+	}
+	if atomic.LoadUint32(&s.protocolManager.synced) == 1 {
+		return height, 0, true
+	}
+	if best := s.protocolManager.peers.BestPeer(); best != nil {
+		if _, td := best.Head(); td.Cmp(s.blockchain.GetTd(current.Hash(), height)) <= 0 {
+			return height, 0, true
+		}
+	}
+	return height, 0, false
+}
 
 // Protocols implements node.Service, returning all the currently configured
 // network protocols to start.
@@ -389,22 +576,138 @@ func (s *Siotchain) Start(srvr *p2p.Server) error {
 	if s.lesServer != nil {
 		s.lesServer.Start(srvr)
 	}
+	if s.resubmits > 0 && !s.readonly {
+		go s.resubmitLoop()
+	}
+	if tiered, ok := s.chainDb.(*database.TieredDatabase); ok {
+		go s.freezeLoop(tiered)
+	}
 	return nil
 }
 
+// freezeLoop moves the bodies and receipts of canonical blocks that fell deep
+// enough behind the head into the ancient store as the chain advances. The data
+// is moved on a separate goroutine so that head events are never held up, and
+// only the latest head is acted upon. The loop terminates when the event mux is
+// stopped.
+func (s *Siotchain) freezeLoop(db *database.TieredDatabase) {
+	sub := s.eventMux.Subscribe(blockchainCore.ChainHeadEvent{})
+	defer sub.Unsubscribe()
+
+	heads := make(chan uint64, 1)
+	defer close(heads)
+
+	go func() {
+		for head := range heads {
+			for {
+				frozen, err := blockchainCore.FreezeAncientBlocks(db, head)
+				if err != nil {
+					glog.V(logger.Error).Infof("Failed to move blocks to the ancient store: %v", err)
+					break
+				}
+				if frozen == 0 {
+					break
+				}
+				glog.V(logger.Debug).Infof("Moved %d blocks to the ancient store", frozen)
+			}
+		}
+	}()
+	for ev := range sub.Chan() {
+		select {
+		case <-heads:
+		default:
+		}
+		heads <- ev.Data.(blockchainCore.ChainHeadEvent).Block.NumberU64()
+	}
+}
+
+// droppedTx is a local transaction evicted from the pool, tracked for resubmission.
+type droppedTx struct {
+	tx       *types.Transaction
+	attempts int  // Number of times the transaction was resubmitted
+	waiting  bool // Whether the transaction is out of the pool awaiting resubmission
+}
+
+// resubmitLoop puts local transactions dropped to keep the pool within its limits
+// back into the pool, so that transactions the operator cares about survive the
+// churn of a busy pool. Transactions dropped as invalid are not resubmitted, and
+// resubmission stops once a transaction is mined or it ran out of attempts. The
+// loop terminates when the event mux is stopped.
+func (s *Siotchain) resubmitLoop() {
+	sub := s.eventMux.Subscribe(blockchainCore.TxDroppedEvent{})
+	defer sub.Unsubscribe()
+
+	ticker := time.NewTicker(s.resubmitDelay)
+	defer ticker.Stop()
+
+	dropped := make(map[helper.Hash]*droppedTx)
+	for {
+		select {
+		case ev, ok := <-sub.Chan():
+			if !ok {
+				return
+			}
+			event := ev.Data.(blockchainCore.TxDroppedEvent)
+			hash := event.Tx.Hash()
+			if event.Reason != blockchainCore.ErrRateLimited {
+				glog.V(logger.Debug).Infof("Local transaction %x dropped: %v", hash[:4], event.Reason)
+				delete(dropped, hash)
+				continue
+			}
+			if entry, ok := dropped[hash]; ok {
+				entry.waiting = true
+			} else {
+				dropped[hash] = &droppedTx{tx: event.Tx, waiting: true}
+			}
+
+		case <-ticker.C:
+			for hash, entry := range dropped {
+				if tx, _, _, _ := blockchainCore.GetTransaction(s.chainDb, hash); tx != nil {
+					delete(dropped, hash) // Mined, nothing left to do
+					continue
+				}
+				if !entry.waiting {
+					if s.txPool.Get(hash) == nil {
+						delete(dropped, hash) // Gone from the pool for other reasons
+					}
+					continue
+				}
+				if entry.attempts >= s.resubmits {
+					glog.V(logger.Info).Infof("Giving up on local transaction %x after %d resubmissions", hash[:4], entry.attempts)
+					delete(dropped, hash)
+					continue
+				}
+				entry.attempts++
+				entry.waiting = false
+
+				s.txPool.SetLocal(entry.tx)
+				if err := s.txPool.Add(entry.tx); err != nil {
+					glog.V(logger.Info).Infof("Failed to resubmit local transaction %x: %v", hash[:4], err)
+					delete(dropped, hash)
+					continue
+				}
+				glog.V(logger.Debug).Infof("Resubmitted dropped local transaction %x (attempt %d)", hash[:4], entry.attempts)
+			}
+		}
+	}
+}
+
 // Stop implements node.Service, terminating all internal goroutines used by the
 // Siotchain protocol.
 func (s *Siotchain) Stop() error {
 	if s.stopDbUpgrade != nil {
 		s.stopDbUpgrade()
 	}
+	s.StopShadowValidation()
 	s.blockchain.Stop()
 	s.protocolManager.Stop()
 	if s.lesServer != nil {
 		s.lesServer.Stop()
 	}
 	s.txPool.Stop()
-	s.miner.Stop()
+	if s.miner != nil {
+		s.miner.Stop()
+	}
 	s.eventMux.Stop()
 
 	s.StopAutoDAG()
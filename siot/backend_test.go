@@ -0,0 +1,116 @@
+package siot
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/siotchain/siot/blockchainCore"
+	"github.com/siotchain/siot/blockchainCore/types"
+	"github.com/siotchain/siot/configure"
+	"github.com/siotchain/siot/context"
+	"github.com/siotchain/siot/crypto"
+)
+
+// testGenesis is a minimal genesis specification carrying its chain config.
+const testGenesis = `{
+	"config":     {"chainId": 1, "homesteadBlock": 0},
+	"nonce":      "0x0000000000000042",
+	"difficulty": "0x400",
+	"gasLimit":   "0x2fefd8",
+	"alloc":      {}
+}`
+
+// newTestService starts an ephemeral node running a Siotchain service with the
+// given configuration.
+func newTestService(t *testing.T, config *Config) (*context.Node, *Siotchain) {
+	stack, err := context.New(&context.Config{NoDiscovery: true, ListenAddr: "127.0.0.1:0"})
+	if err != nil {
+		t.Fatalf("failed to create node: %v", err)
+	}
+	if err := stack.Register(func(ctx *context.ServiceContext) (context.Service, error) { return New(ctx, config) }); err != nil {
+		t.Fatalf("failed to register service: %v", err)
+	}
+	if err := stack.Start(); err != nil {
+		t.Fatalf("failed to start node: %v", err)
+	}
+	var siot *Siotchain
+	if err := stack.Service(&siot); err != nil {
+		stack.Stop()
+		t.Fatalf("failed to retrieve service: %v", err)
+	}
+	return stack, siot
+}
+
+// Tests that the miner's gas price floor and the minimum of the price oracle
+// are configured independently, the miner falling back to the gas price.
+func TestMinerMinFee(t *testing.T) {
+	tests := []struct {
+		minFee, gasPrice, gpoMin *big.Int
+		floor                    *big.Int
+	}{
+		// The miner accepts transactions down to 90% of its configured price
+		{minFee: big.NewInt(100), gasPrice: big.NewInt(500), gpoMin: big.NewInt(300), floor: big.NewInt(90)},
+		{minFee: nil, gasPrice: big.NewInt(500), gpoMin: big.NewInt(300), floor: big.NewInt(450)},
+	}
+	for i, tt := range tests {
+		stack, siot := newTestService(t, &Config{
+			Genesis:                 testGenesis,
+			ChainConfig:             configure.TestChainConfig,
+			PowTest:                 true,
+			MinerMinFee:             tt.minFee,
+			GasPrice:                tt.gasPrice,
+			GpoMinGasPrice:          tt.gpoMin,
+			GpoMaxGasPrice:          big.NewInt(5000),
+			GpobaseCorrectionFactor: 110,
+		})
+		if floor := siot.Miner().GasPrice(); floor.Cmp(tt.floor) != 0 {
+			t.Errorf("test %d: miner floor mismatch: have %v, want %v", i, floor, tt.floor)
+		}
+		if price := siot.ApiBackend.gpo.SuggestPrice(); price.Cmp(tt.gpoMin) < 0 {
+			t.Errorf("test %d: oracle suggestion %v below its minimum %v", i, price, tt.gpoMin)
+		}
+		stack.Stop()
+	}
+}
+
+// Tests that a local transaction is pooled and picked up by the pending block
+// right away, even if its broadcast to the peers is delayed for privacy.
+func TestTxPrivacyDelayLocalInclusion(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	addr := crypto.PubkeyToAddress(key.PublicKey)
+
+	genesis, err := blockchainCore.GenesisWithAlloc(testGenesis, blockchainCore.GenesisAccount{Address: addr, Balance: big.NewInt(1000000000)})
+	if err != nil {
+		t.Fatalf("failed to assemble genesis: %v", err)
+	}
+	stack, siot := newTestService(t, &Config{
+		Genesis:                 genesis,
+		ChainConfig:             configure.TestChainConfig,
+		PowTest:                 true,
+		GasPrice:                big.NewInt(1),
+		GpoMinGasPrice:          big.NewInt(1),
+		GpoMaxGasPrice:          big.NewInt(5000),
+		GpobaseCorrectionFactor: 110,
+		TxPrivacyDelay:          MaxTxPrivacyDelay,
+	})
+	defer stack.Stop()
+
+	signer := types.MakeSigner(configure.TestChainConfig, big.NewInt(1))
+	tx, _ := types.SignECDSA(signer, types.NewTransaction(0, addr, big.NewInt(1), big.NewInt(21000), big.NewInt(1), nil), key)
+	siot.TxPool().SetLocal(tx)
+	if err := siot.TxPool().Add(tx); err != nil {
+		t.Fatalf("failed to send transaction: %v", err)
+	}
+	if siot.TxPool().Get(tx.Hash()) == nil {
+		t.Fatalf("local transaction not pooled")
+	}
+	for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+		if pending, _ := siot.Miner().Pending(); pending.Transaction(tx.Hash()) != nil {
+			break
+		}
+		if time.Since(start) > MaxTxPrivacyDelay/10 {
+			t.Fatalf("local transaction not in the pending block after %v", time.Since(start))
+		}
+	}
+}
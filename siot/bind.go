@@ -107,7 +107,7 @@ func (b *ExternalLogicBackend) SuggestGasPrice(ctx context.Context) (*big.Int, e
 // requirement as other transactions may be added or removed by miners, but it
 // should provide a basis for setting a reasonable default.
 func (b *ExternalLogicBackend) EstimateGas(ctx context.Context, msg siotchain.CallMsg) (*big.Int, error) {
-	out, err := b.bcapi.EstimateGas(ctx, toCallArgs(msg))
+	out, err := b.bcapi.EstimateGas(ctx, toCallArgs(msg), nil)
 	return out.BigInt(), err
 }
 
@@ -24,6 +24,11 @@ var useSequentialKeys = []byte("dbUpgrade_20160530sequentialKeys")
 // Returns a stop function that blocks until the process has
 // been safely stopped.
 func upgradeSequentialKeys(db database.Database) (stopFn func()) {
+	// Old format keys can only be iterated in the hot store, the converted data
+	// remains readable through the ancient store's fallback.
+	if tiered, ok := db.(*database.TieredDatabase); ok {
+		db = tiered.Hot()
+	}
 	data, _ := db.Get(useSequentialKeys)
 	if len(data) > 0 && data[0] == 42 {
 		return nil // already converted
@@ -76,7 +81,7 @@ func upgradeSequentialKeys(db database.Database) (stopFn func()) {
 // the database, writes them in new format and deletes the old ones if successful.
 func upgradeSequentialCanonicalNumbers(db database.Database, stopFn func() bool) (error, bool) {
 	prefix := []byte("block-num-")
-	it := db.(*database.LDBDatabase).NewIterator()
+	it := db.(*database.LDBDatabase).LDB().NewIterator(nil, nil)
 	defer func() {
 		it.Release()
 	}()
@@ -88,7 +93,7 @@ func upgradeSequentialCanonicalNumbers(db database.Database, stopFn func() bool)
 			cnt++
 			if cnt%100000 == 0 {
 				it.Release()
-				it = db.(*database.LDBDatabase).NewIterator()
+				it = db.(*database.LDBDatabase).LDB().NewIterator(nil, nil)
 				it.Seek(keyPtr)
 				glog.V(logger.Info).Infof("converting %d canonical numbers...", cnt)
 			}
@@ -119,7 +124,7 @@ func upgradeSequentialCanonicalNumbers(db database.Database, stopFn func() bool)
 // if successful.
 func upgradeSequentialBlocks(db database.Database, stopFn func() bool) (error, bool) {
 	prefix := []byte("block-")
-	it := db.(*database.LDBDatabase).NewIterator()
+	it := db.(*database.LDBDatabase).LDB().NewIterator(nil, nil)
 	defer func() {
 		it.Release()
 	}()
@@ -131,7 +136,7 @@ func upgradeSequentialBlocks(db database.Database, stopFn func() bool) (error, b
 			cnt++
 			if cnt%10000 == 0 {
 				it.Release()
-				it = db.(*database.LDBDatabase).NewIterator()
+				it = db.(*database.LDBDatabase).LDB().NewIterator(nil, nil)
 				it.Seek(keyPtr)
 				glog.V(logger.Info).Infof("converting %d blocks...", cnt)
 			}
@@ -170,7 +175,7 @@ func upgradeSequentialBlocks(db database.Database, stopFn func() bool) (error, b
 // database that did not have a corresponding block
 func upgradeSequentialOrphanedReceipts(db database.Database, stopFn func() bool) (error, bool) {
 	prefix := []byte("receipts-block-")
-	it := db.(*database.LDBDatabase).NewIterator()
+	it := db.(*database.LDBDatabase).LDB().NewIterator(nil, nil)
 	defer it.Release()
 	it.Seek(prefix)
 	cnt := 0
@@ -253,13 +258,12 @@ func upgradeChainDatabase(db database.Database) error {
 	// At least some of the database is still the old format, upgrade (skip the head block!)
 	glog.V(logger.Info).Info("Old database detected, upgrading...")
 
+	if tiered, ok := db.(*database.TieredDatabase); ok {
+		db = tiered.Hot()
+	}
 	if db, ok := db.(*database.LDBDatabase); ok {
 		blockPrefix := []byte("block-hash-")
-		for it := db.NewIterator(); it.Next(); {
-			// Skip anything other than a combined block
-			if !bytes.HasPrefix(it.Key(), blockPrefix) {
-				continue
-			}
+		for it := db.NewIterator(blockPrefix); it.Next(); {
 			// Skip the head block (merge last to signal upgrade completion)
 			if bytes.HasSuffix(it.Key(), head.Bytes()) {
 				continue
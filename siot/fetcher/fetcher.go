@@ -667,6 +667,9 @@ func (f *Fetcher) insert(peer string, block *types.Block) {
 		// Run the actual import and log any issues
 		if _, err := f.insertChain(types.Blocks{block}); err != nil {
 			glog.V(logger.Warn).Infof("Peer %s: block #%d [%x…] import failed: %v", peer, block.NumberU64(), hash[:4], err)
+			if blockchainCore.IsBlockTimeoutErr(err) {
+				f.dropPeer(peer)
+			}
 			return
 		}
 		// If import succeeded, broadcast the block
@@ -0,0 +1,62 @@
+package siot
+
+import (
+	"math/big"
+	"sync"
+
+	"github.com/siotchain/siot/blockchainCore"
+	"github.com/siotchain/siot/subscribe"
+)
+
+// GasPriceSubscription delivers the changes of the miner's gas price floor to a
+// typed channel, sparing in-process consumers the generic event stream.
+type GasPriceSubscription struct {
+	sub  subscribe.Subscription
+	quit chan struct{}
+	once sync.Once
+}
+
+// SubscribeGasPrice starts delivering the gas price floor of the miner to the
+// given channel, beginning with its current value if one is set. Nodes without
+// a miner never deliver anything.
+func (s *Siotchain) SubscribeGasPrice(ch chan<- *big.Int) *GasPriceSubscription {
+	// Subscribe before reading the current value so no update slips through
+	gps := &GasPriceSubscription{
+		sub:  s.eventMux.Subscribe(blockchainCore.GasPriceChanged{}),
+		quit: make(chan struct{}),
+	}
+	var current *big.Int
+	if s.miner != nil {
+		current = s.miner.GasPrice()
+	}
+	go gps.loop(ch, current)
+	return gps
+}
+
+// Unsubscribe stops the delivery of gas price changes. It can be called more
+// than once.
+func (gps *GasPriceSubscription) Unsubscribe() {
+	gps.once.Do(func() {
+		gps.sub.Unsubscribe()
+		close(gps.quit)
+	})
+}
+
+// loop forwards the gas price change events to the subscriber's channel.
+func (gps *GasPriceSubscription) loop(ch chan<- *big.Int, current *big.Int) {
+	if current != nil {
+		select {
+		case ch <- current:
+		case <-gps.quit:
+			return
+		}
+	}
+	for ev := range gps.sub.Chan() {
+		price := ev.Data.(blockchainCore.GasPriceChanged).Price
+		select {
+		case ch <- new(big.Int).Set(price):
+		case <-gps.quit:
+			return
+		}
+	}
+}
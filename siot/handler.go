@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"math"
 	"math/big"
+	"math/rand"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -21,9 +22,10 @@ import (
 	"github.com/siotchain/siot/logger/glog"
 	"github.com/siotchain/siot/net/p2p"
 	"github.com/siotchain/siot/net/p2p/discover"
-	"github.com/siotchain/siot/configure"
 	"github.com/siotchain/siot/validation"
 	"github.com/siotchain/siot/helper/rlp"
+	"github.com/hashicorp/golang-lru"
+	"gopkg.in/fatih/set.v0"
 )
 
 const (
@@ -35,6 +37,10 @@ var (
 	daoChallengeTimeout = 15 * time.Second // Time allowance for a node to reply to the DAO handshake challenge
 )
 
+// MaxTxPrivacyDelay is the longest random delay allowed before broadcasting a
+// local transaction. Longer ones would only slow down its inclusion by others.
+const MaxTxPrivacyDelay = 10 * time.Second
+
 // errIncompatibleConfig is returned if the requested protocols and configs are
 // not compatible (low protocol version restrictions and high requirements).
 var errIncompatibleConfig = errors.New("incompatible configuration")
@@ -52,12 +58,17 @@ type ProtocolManager struct {
 	txpool      txPool
 	blockchain  *blockchainCore.BlockChain
 	chaindb     database.Database
-	chainconfig *configure.ChainConfig
 	maxPeers    int
 
 	downloader *downloader.Downloader
 	fetcher    *fetcher.Fetcher
 	peers      *peerSet
+	scores     *lru.Cache            // Reputation scores of recently disconnected peers, by peer id
+	txProp     *txPropagationTracker // Propagation stats of the recently broadcast transactions
+	txFetch    *txFetchTracker       // Announced transactions requested from the peers
+	txAnnounce string                // Transaction announcement mode (TxAnnounceFull or TxAnnounceHash)
+	txDelay    time.Duration         // Upper bound of the random delay before broadcasting local transactions (0 = immediate)
+	txDelayed  *set.Set              // Hashes of the local transactions held back by the delay, not to be relayed yet
 
 	SubProtocols []p2p.Protocol
 
@@ -80,7 +91,7 @@ type ProtocolManager struct {
 
 // NewProtocolManager returns a new Siotchain sub protocol manager. The Siotchain sub protocol manages peers capable
 // with the Siotchain network.
-func NewProtocolManager(config *configure.ChainConfig, fastSync bool, networkId int, maxPeers int, mux *subscribe.TypeMux, txpool txPool, pow validation.PoW, blockchain *blockchainCore.BlockChain, chaindb database.Database) (*ProtocolManager, error) {
+func NewProtocolManager(fastSync bool, networkId int, maxPeers int, mux *subscribe.TypeMux, txpool txPool, pow validation.PoW, blockchain *blockchainCore.BlockChain, chaindb database.Database) (*ProtocolManager, error) {
 	// Create the protocol manager with the base fields
 	manager := &ProtocolManager{
 		networkId:   networkId,
@@ -88,14 +99,19 @@ func NewProtocolManager(config *configure.ChainConfig, fastSync bool, networkId
 		txpool:      txpool,
 		blockchain:  blockchain,
 		chaindb:     chaindb,
-		chainconfig: config,
 		maxPeers:    maxPeers,
 		peers:       newPeerSet(),
+		txProp:      newTxPropagationTracker(),
+		txFetch:     newTxFetchTracker(),
+		txDelayed:   set.New(),
+		txAnnounce:  TxAnnounceFull,
 		newPeerCh:   make(chan *peer),
 		noMorePeers: make(chan struct{}),
 		txsyncCh:    make(chan *txsync),
 		quitSync:    make(chan struct{}),
 	}
+	manager.scores, _ = lru.New(maxRememberedScores)
+
 	// Figure out whether to allow fast sync or not
 	if fastSync && blockchain.CurrentBlock().NumberU64() > 0 {
 		glog.V(logger.Info).Infof("blockchain not empty, fast sync disabled")
@@ -137,6 +153,9 @@ func NewProtocolManager(config *configure.ChainConfig, fastSync bool, networkId
 				}
 				return nil
 			},
+			Evict: func(id discover.NodeID) *discover.NodeID {
+				return manager.evictFor(id)
+			},
 		})
 	}
 	if len(manager.SubProtocols) == 0 {
@@ -149,7 +168,7 @@ func NewProtocolManager(config *configure.ChainConfig, fastSync bool, networkId
 		manager.removePeer)
 
 	validator := func(block *types.Block, parent *types.Block) error {
-		return blockchainCore.ValidateHeader(config, pow, block.Header(), parent.Header(), true, false)
+		return blockchainCore.ValidateHeader(blockchain.Config(), pow, block.Header(), parent.Header(), true, false)
 	}
 	heighter := func() uint64 {
 		return blockchain.CurrentBlock().NumberU64()
@@ -183,6 +202,7 @@ func (pm *ProtocolManager) removePeer(id string) {
 		return
 	}
 	glog.V(logger.Debug).Infoln("Removing peer", id)
+	pm.scores.Add(id, peer.Score())
 
 	// Unregister the peer from the downloader and Siotchain peer set
 	pm.downloader.UnregisterPeer(id)
@@ -195,6 +215,31 @@ func (pm *ProtocolManager) removePeer(id string) {
 	}
 }
 
+// knownScore returns the reputation a peer had when it last disconnected, or zero
+// for a peer not seen recently.
+func (pm *ProtocolManager) knownScore(id string) int {
+	if score, ok := pm.scores.Get(id); ok {
+		return score.(int)
+	}
+	return 0
+}
+
+// evictFor is consulted by the p2p server when a peer connects while the node is
+// full. It drops the peer with the lowest reputation if that one did worse than
+// the newcomer is expected to, and returns its node id so that the connection
+// can be torn down.
+func (pm *ProtocolManager) evictFor(id discover.NodeID) *discover.NodeID {
+	worst := pm.peers.WorstPeer()
+	if worst == nil || worst.Score() >= pm.knownScore(fmt.Sprintf("%x", id[:8])) {
+		return nil
+	}
+	glog.V(logger.Debug).Infof("%v: evicting for %x (score %d)", worst, id[:8], worst.Score())
+
+	evicted := worst.ID()
+	pm.removePeer(worst.id)
+	return &evicted
+}
+
 func (pm *ProtocolManager) Start() {
 	// broadcast transactions
 	pm.txSub = pm.eventMux.Subscribe(blockchainCore.TxPreEvent{})
@@ -206,6 +251,7 @@ func (pm *ProtocolManager) Start() {
 	// start sync handlers
 	go pm.syncer()
 	go pm.txsyncLoop()
+	go pm.txFetchLoop()
 }
 
 func (pm *ProtocolManager) Stop() {
@@ -216,7 +262,7 @@ func (pm *ProtocolManager) Stop() {
 	// After this send has completed, no new peers will be accepted.
 	pm.noMorePeers <- struct{}{}
 
-	// Quit fetcher, txsyncLoop.
+	// Quit fetcher, txsyncLoop, txFetchLoop.
 	close(pm.quitSync)
 
 	// Disconnect existing sessions.
@@ -239,6 +285,7 @@ func (pm *ProtocolManager) handle(p *peer) error {
 	if pm.peers.Len() >= pm.maxPeers {
 		return p2p.DiscTooManyPeers
 	}
+	p.setScore(pm.knownScore(p.id))
 
 	glog.V(logger.Debug).Infof("%v: peer connected [%s]", p, p.Name())
 
@@ -268,7 +315,7 @@ func (pm *ProtocolManager) handle(p *peer) error {
 	pm.syncTransactions(p)
 
 	// If we're DAO hard-fork aware, validate any remote peer with regard to the hard-fork
-	if daoBlock := pm.chainconfig.DAOForkBlock; daoBlock != nil {
+	if daoBlock := pm.blockchain.Config().DAOForkBlock; daoBlock != nil {
 		// Request the peer's DAO fork header for extra-data validation
 		if err := p.RequestHeadersByNumber(daoBlock.Uint64(), 1, 0, false); err != nil {
 			return err
@@ -276,6 +323,7 @@ func (pm *ProtocolManager) handle(p *peer) error {
 		// Start a timer to disconnect if the peer doesn't reply in time
 		p.forkDrop = time.AfterFunc(daoChallengeTimeout, func() {
 			glog.V(logger.Debug).Infof("%v: timed out DAO fork-check, dropping", p)
+			p.invalid()
 			pm.removePeer(p.id)
 		})
 		// Make sure it's cleaned up if the peer dies off
@@ -304,6 +352,7 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 		return err
 	}
 	if msg.Size > ProtocolMaxMsgSize {
+		p.invalid()
 		return errResp(ErrMsgTooLarge, "%v > %v", msg.Size, ProtocolMaxMsgSize)
 	}
 	defer msg.Discard()
@@ -312,6 +361,7 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 	switch {
 	case msg.Code == StatusMsg:
 		// Status messages should never arrive after the handshake
+		p.invalid()
 		return errResp(ErrExtraStatusMsg, "uncontrolled status message")
 
 	// Block header query, collect the requested headers and reply
@@ -319,6 +369,7 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 		// Decode the complex header query
 		var query getBlockHeadersData
 		if err := msg.Decode(&query); err != nil {
+			p.invalid()
 			return errResp(ErrDecode, "%v: %v", msg, err)
 		}
 		hashMode := query.Origin.Hash != (helper.Hash{})
@@ -397,16 +448,22 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 		// A batch of headers arrived to one of our previous requests
 		var headers []*types.Header
 		if err := msg.Decode(&headers); err != nil {
+			p.invalid()
 			return errResp(ErrDecode, "msg %v: %v", msg, err)
 		}
+		p.responded(len(headers))
+
+		// The configuration may be replaced live, check the fork against a single one
+		config := pm.blockchain.Config()
+
 		// If no headers were received, but we're expending a DAO fork check, maybe it's that
-		if len(headers) == 0 && p.forkDrop != nil {
+		if len(headers) == 0 && p.forkDrop != nil && config.DAOForkBlock != nil {
 			// Possibly an empty reply to the fork header checks, sanity check TDs
 			verifyDAO := true
 
 			// If we already have a DAO header, we can check the peer's TD against it. If
 			// the peer's ahead of this, it too must have a reply to the DAO check
-			if daoHeader := pm.blockchain.GetHeaderByNumber(pm.chainconfig.DAOForkBlock.Uint64()); daoHeader != nil {
+			if daoHeader := pm.blockchain.GetHeaderByNumber(config.DAOForkBlock.Uint64()); daoHeader != nil {
 				if _, td := p.Head(); td.Cmp(pm.blockchain.GetTd(daoHeader.Hash(), daoHeader.Number.Uint64())) >= 0 {
 					verifyDAO = false
 				}
@@ -423,14 +480,15 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 		filter := len(headers) == 1
 		if filter {
 			// If it's a potential DAO fork check, validate against the rules
-			if p.forkDrop != nil && pm.chainconfig.DAOForkBlock.Cmp(headers[0].Number) == 0 {
+			if p.forkDrop != nil && config.DAOForkBlock != nil && config.DAOForkBlock.Cmp(headers[0].Number) == 0 {
 				// Disable the fork drop timer
 				p.forkDrop.Stop()
 				p.forkDrop = nil
 
 				// Validate the header and either drop the peer or continue
-				if err := blockchainCore.ValidateDAOHeaderExtraData(pm.chainconfig, headers[0]); err != nil {
+				if err := blockchainCore.ValidateDAOHeaderExtraData(config, headers[0]); err != nil {
 					glog.V(logger.Debug).Infof("%v: verified to be on the other side of the DAO fork, dropping", p)
+					p.invalid()
 					return err
 				}
 				glog.V(logger.Debug).Infof("%v: verified to be on the same side of the DAO fork", p)
@@ -463,6 +521,7 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 			if err := msgStream.Decode(&hash); err == rlp.EOL {
 				break
 			} else if err != nil {
+				p.invalid()
 				return errResp(ErrDecode, "msg %v: %v", msg, err)
 			}
 			// Retrieve the requested block body, stopping if enough was found
@@ -477,8 +536,11 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 		// A batch of block bodies arrived to one of our previous requests
 		var request blockBodiesData
 		if err := msg.Decode(&request); err != nil {
+			p.invalid()
 			return errResp(ErrDecode, "msg %v: %v", msg, err)
 		}
+		p.responded(len(request))
+
 		// Deliver them all to the downloader for queuing
 		trasactions := make([][]*types.Transaction, len(request))
 		uncles := make([][]*types.Header, len(request))
@@ -516,6 +578,7 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 			if err := msgStream.Decode(&hash); err == rlp.EOL {
 				break
 			} else if err != nil {
+				p.invalid()
 				return errResp(ErrDecode, "msg %v: %v", msg, err)
 			}
 			// Retrieve the requested state entry, stopping if enough was found
@@ -530,8 +593,11 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 		// A batch of node state data arrived to one of our previous requests
 		var data [][]byte
 		if err := msg.Decode(&data); err != nil {
+			p.invalid()
 			return errResp(ErrDecode, "msg %v: %v", msg, err)
 		}
+		p.responded(len(data))
+
 		// Deliver all to the downloader
 		if err := pm.downloader.DeliverNodeData(p.id, data); err != nil {
 			glog.V(logger.Debug).Infof("failed to deliver node state data: %v", err)
@@ -554,6 +620,7 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 			if err := msgStream.Decode(&hash); err == rlp.EOL {
 				break
 			} else if err != nil {
+				p.invalid()
 				return errResp(ErrDecode, "msg %v: %v", msg, err)
 			}
 			// Retrieve the requested block's receipts, skipping if unknown to us
@@ -577,8 +644,11 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 		// A batch of receipts arrived to one of our previous requests
 		var receipts [][]*types.Receipt
 		if err := msg.Decode(&receipts); err != nil {
+			p.invalid()
 			return errResp(ErrDecode, "msg %v: %v", msg, err)
 		}
+		p.responded(len(receipts))
+
 		// Deliver all to the downloader
 		if err := pm.downloader.DeliverReceipts(p.id, receipts); err != nil {
 			glog.V(logger.Debug).Infof("failed to deliver receipts: %v", err)
@@ -596,6 +666,7 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 			// We're running the old protocol, make block number unknown (0)
 			var hashes []helper.Hash
 			if err := msg.Decode(&hashes); err != nil {
+				p.invalid()
 				return errResp(ErrDecode, "%v: %v", msg, err)
 			}
 			for _, hash := range hashes {
@@ -605,6 +676,7 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 			// Otherwise extract both block hash and number
 			var request newBlockHashesData
 			if err := msg.Decode(&request); err != nil {
+				p.invalid()
 				return errResp(ErrDecode, "%v: %v", msg, err)
 			}
 			for _, block := range request {
@@ -630,6 +702,7 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 		// Retrieve and decode the propagated block
 		var request newBlockData
 		if err := msg.Decode(&request); err != nil {
+			p.invalid()
 			return errResp(ErrDecode, "%v: %v", msg, err)
 		}
 		request.Block.ReceivedAt = msg.ReceivedAt
@@ -666,18 +739,72 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 		// Transactions can be processed, parse all of them and deliver to the pool
 		var txs []*types.Transaction
 		if err := msg.Decode(&txs); err != nil {
+			p.invalid()
 			return errResp(ErrDecode, "msg %v: %v", msg, err)
 		}
+		hashes := make([]helper.Hash, len(txs))
 		for i, tx := range txs {
 			// Validate and mark the remote transaction
 			if tx == nil {
+				p.invalid()
 				return errResp(ErrDecode, "transaction %d is nil", i)
 			}
-			p.MarkTransaction(tx.Hash())
+			hashes[i] = tx.Hash()
+			p.MarkTransaction(hashes[i])
+			pm.txProp.seen(hashes[i])
 		}
+		pm.txFetch.delivered(hashes)
 		pm.txpool.AddBatch(txs)
 
+	case p.version >= eth64 && msg.Code == NewTxHashesMsg:
+		// Transactions were announced, make sure we have a valid and fresh chain to handle them
+		if atomic.LoadUint32(&pm.synced) == 0 {
+			break
+		}
+		var hashes []helper.Hash
+		if err := msg.Decode(&hashes); err != nil {
+			p.invalid()
+			return errResp(ErrDecode, "msg %v: %v", msg, err)
+		}
+		// Mark the hashes as present at the remote node and fetch the unknown ones
+		// not already requested from another peer
+		var unknown []helper.Hash
+		for _, hash := range hashes {
+			p.MarkTransaction(hash)
+			if pm.txpool.Get(hash) == nil && len(unknown) < maxTxFetch {
+				unknown = append(unknown, hash)
+			}
+		}
+		if unknown = pm.txFetch.reserve(p.id, unknown); len(unknown) > 0 {
+			return p.RequestTxs(unknown)
+		}
+
+	case p.version >= eth64 && msg.Code == GetTxsMsg:
+		// Decode the retrieval message
+		var hashes []helper.Hash
+		if err := msg.Decode(&hashes); err != nil {
+			p.invalid()
+			return errResp(ErrDecode, "msg %v: %v", msg, err)
+		}
+		// Gather the requested transactions still in the pool
+		var txs types.Transactions
+		for _, hash := range hashes {
+			if len(txs) >= maxTxFetch {
+				break
+			}
+			if pm.txDelayed.Has(hash) {
+				continue // Don't reveal local transactions before their broadcast
+			}
+			if tx := pm.txpool.Get(hash); tx != nil {
+				txs = append(txs, tx)
+			}
+		}
+		if len(txs) > 0 {
+			return p.SendTransactions(txs)
+		}
+
 	default:
+		p.invalid()
 		return errResp(ErrInvalidMsgCode, "%v", msg.Code)
 	}
 	return nil
@@ -720,11 +847,60 @@ func (pm *ProtocolManager) BroadcastBlock(block *types.Block, propagate bool) {
 func (pm *ProtocolManager) BroadcastTx(hash helper.Hash, tx *types.Transaction) {
 	// Broadcast transaction to a batch of peers not knowing about it
 	peers := pm.peers.PeersWithoutTx(hash)
-	//FIXME include this again: peers = peers[:int(math.Sqrt(float64(len(peers))))]
+
+	// In hash mode, only send the full transaction to the square root of the peers
+	// and announce the hash to the rest. Peers not speaking siot/64 can't request
+	// announced transactions, so they keep receiving them in full on top.
+	direct := len(peers)
+	if pm.txAnnounce == TxAnnounceHash {
+		direct = int(math.Sqrt(float64(len(peers))))
+	}
+	var sent, announced int
 	for _, peer := range peers {
-		peer.SendTransactions(types.Transactions{tx})
+		switch {
+		case peer.version < eth64:
+			peer.SendTransactions(types.Transactions{tx})
+			sent++
+		case direct > 0:
+			peer.SendTransactions(types.Transactions{tx})
+			direct--
+			sent++
+		default:
+			peer.SendTxHashes([]helper.Hash{hash})
+			announced++
+		}
+	}
+	pm.txProp.sent(hash, sent, announced)
+	glog.V(logger.Detail).Infof("broadcast tx to %d peers, announced to %d", sent, announced)
+}
+
+// txFetchLoop periodically re-requests the announced transactions a peer failed
+// to deliver in time from another peer that announced them.
+func (pm *ProtocolManager) txFetchLoop() {
+	ticker := time.NewTicker(txFetchTimeout / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			for id, hashes := range pm.txFetch.expire(now) {
+				p := pm.peers.Peer(id)
+				if p == nil {
+					continue // Gone, the request will time out towards the next announcer
+				}
+				for len(hashes) > 0 {
+					batch := hashes
+					if len(batch) > maxTxFetch {
+						batch = batch[:maxTxFetch]
+					}
+					hashes = hashes[len(batch):]
+					p.RequestTxs(batch)
+				}
+			}
+		case <-pm.quitSync:
+			return
+		}
 	}
-	glog.V(logger.Detail).Infoln("broadcast tx to", len(peers), "peers")
 }
 
 // Mined broadcast loop
@@ -743,10 +919,31 @@ func (self *ProtocolManager) txBroadcastLoop() {
 	// automatically stops if unsubscribe
 	for obj := range self.txSub.Chan() {
 		event := obj.Data.(blockchainCore.TxPreEvent)
+		if self.txDelay > 0 && self.txpool.IsLocal(event.Tx.Hash()) {
+			self.txDelayed.Add(event.Tx.Hash())
+			go self.broadcastTxDelayed(event.Tx)
+			continue
+		}
 		self.BroadcastTx(event.Tx.Hash(), event.Tx)
 	}
 }
 
+// broadcastTxDelayed propagates a local transaction after a random delay of up
+// to txDelay, so that peers can't tell it originated here by being the first to
+// relay it. The transaction is already in the pool, so mining isn't delayed.
+// Until the broadcast, it is also kept out of the transaction syncs with new
+// peers and the replies to transaction requests.
+func (self *ProtocolManager) broadcastTxDelayed(tx *types.Transaction) {
+	defer self.txDelayed.Remove(tx.Hash())
+
+	delay := time.Duration(rand.Int63n(int64(self.txDelay) + 1))
+	select {
+	case <-time.After(delay):
+		self.BroadcastTx(tx.Hash(), tx)
+	case <-self.quitSync:
+	}
+}
+
 // SiotNodeInfo represents a short summary of the Siotchain sub-protocol metadata known
 // about the host peer.
 type SiotNodeInfo struct {
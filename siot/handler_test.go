@@ -0,0 +1,145 @@
+package siot
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/siotchain/siot/blockchainCore"
+	"github.com/siotchain/siot/blockchainCore/types"
+	"github.com/siotchain/siot/configure"
+	"github.com/siotchain/siot/database"
+	"github.com/siotchain/siot/helper"
+	"github.com/siotchain/siot/net/p2p"
+	"github.com/siotchain/siot/net/p2p/discover"
+	"github.com/siotchain/siot/subscribe"
+)
+
+// Tests that in hash announcement mode transactions are sent in full to the
+// square root of the peers only and announced by hash to the rest, except to
+// peers unable to request announced transactions.
+func TestBroadcastTxAnnounce(t *testing.T) {
+	tests := []struct {
+		mode            string
+		peers, legacy   int
+		full, announced int
+	}{
+		{TxAnnounceFull, 9, 0, 9, 0},
+		{TxAnnounceHash, 9, 0, 3, 6},
+		{TxAnnounceHash, 9, 2, 5, 4},
+	}
+	for i, tt := range tests {
+		pm := &ProtocolManager{
+			peers:      newPeerSet(),
+			txProp:     newTxPropagationTracker(),
+			txAnnounce: tt.mode,
+		}
+		codes := make(chan uint64, tt.peers)
+		for j := 0; j < tt.peers; j++ {
+			version := eth64
+			if j < tt.legacy {
+				version = eth63
+			}
+			local, remote := p2p.MsgPipe()
+			defer local.Close()
+
+			p := newPeer(version, p2p.NewPeer(discover.NodeID{byte(j + 1)}, "test", nil), local)
+			if err := pm.peers.Register(p); err != nil {
+				t.Fatalf("test %d: failed to register peer %d: %v", i, j, err)
+			}
+			go func() {
+				msg, err := remote.ReadMsg()
+				if err != nil {
+					return
+				}
+				msg.Discard()
+				codes <- msg.Code
+			}()
+		}
+		tx := types.NewTransaction(0, helper.Address{}, big.NewInt(1), big.NewInt(21000), big.NewInt(1), nil)
+		pm.BroadcastTx(tx.Hash(), tx)
+
+		var full, announced int
+		for j := 0; j < tt.peers; j++ {
+			switch code := <-codes; code {
+			case TxMsg:
+				full++
+			case NewTxHashesMsg:
+				announced++
+			default:
+				t.Errorf("test %d: unexpected message %d", i, code)
+			}
+		}
+		if full != tt.full || announced != tt.announced {
+			t.Errorf("test %d: propagation mismatch: have %d full, %d announced; want %d, %d", i, full, announced, tt.full, tt.announced)
+		}
+		if prop := pm.txProp.get(tx.Hash()); prop == nil || prop.Peers != tt.full || prop.Announced != tt.announced {
+			t.Errorf("test %d: propagation stats mismatch: have %+v, want %d full, %d announced", i, prop, tt.full, tt.announced)
+		}
+	}
+}
+
+// newTestProtocolManager creates a protocol manager on an in-memory chain holding
+// the genesis block only.
+func newTestProtocolManager(t *testing.T, maxPeers int) *ProtocolManager {
+	db, _ := database.NewMemDatabase()
+	if _, err := blockchainCore.WriteGenesisBlock(db, strings.NewReader(testGenesis)); err != nil {
+		t.Fatalf("failed to write genesis: %v", err)
+	}
+	mux := new(subscribe.TypeMux)
+	chain, err := blockchainCore.NewBlockChain(db, configure.TestChainConfig, blockchainCore.FakePow{}, mux)
+	if err != nil {
+		t.Fatalf("failed to create blockchain: %v", err)
+	}
+	pool := blockchainCore.NewTxPool(configure.TestChainConfig, mux, chain.State, chain.GasLimit, 0)
+	pm, err := NewProtocolManager(false, 1, maxPeers, mux, pool, blockchainCore.FakePow{}, chain, db)
+	if err != nil {
+		t.Fatalf("failed to create protocol manager: %v", err)
+	}
+	return pm
+}
+
+// Tests that a peer connecting at capacity displaces the connected peer with the
+// lowest reputation only if it is expected to do better.
+func TestEvictForReputation(t *testing.T) {
+	pm := newTestProtocolManager(t, 2)
+	defer pm.blockchain.Stop()
+
+	scores := []int{5, -3}
+	ids := make([]discover.NodeID, len(scores))
+	for i, score := range scores {
+		ids[i] = discover.NodeID{byte(i + 1)}
+		local, _ := p2p.MsgPipe()
+		defer local.Close()
+
+		p := newPeer(eth64, p2p.NewPeer(ids[i], "test", nil), local)
+		p.setScore(score)
+		if err := pm.peers.Register(p); err != nil {
+			t.Fatalf("failed to register peer %d: %v", i, err)
+		}
+	}
+	// An unknown peer displaces a peer doing worse than an unknown one
+	unknown := discover.NodeID{0xf0}
+	if evicted := pm.evictFor(unknown); evicted == nil || *evicted != ids[1] {
+		t.Fatalf("evicted peer mismatch: have %v, want %x", evicted, ids[1][:8])
+	}
+	if pm.peers.Peer(fmt.Sprintf("%x", ids[1][:8])) != nil {
+		t.Errorf("evicted peer still registered")
+	}
+	if score := pm.knownScore(fmt.Sprintf("%x", ids[1][:8])); score != -3 {
+		t.Errorf("evicted peer score mismatch: have %d, want -3", score)
+	}
+	// Only peers known to do better may displace a useful peer
+	if evicted := pm.evictFor(unknown); evicted != nil {
+		t.Errorf("unknown peer evicted %x", (*evicted)[:8])
+	}
+	good := discover.NodeID{0xf1}
+	pm.scores.Add(fmt.Sprintf("%x", good[:8]), 10)
+	if evicted := pm.evictFor(good); evicted == nil || *evicted != ids[0] {
+		t.Fatalf("evicted peer mismatch: have %v, want %x", evicted, ids[0][:8])
+	}
+	if pm.peers.Len() != 0 {
+		t.Errorf("peer count mismatch: have %d, want 0", pm.peers.Len())
+	}
+}
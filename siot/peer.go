@@ -24,6 +24,7 @@ var (
 
 const (
 	maxKnownTxs      = 32768 // Maximum transactions hashes to keep in the known list (prevent DOS)
+	maxTxFetch       = 256   // Maximum transactions to request or serve in a single message
 	maxKnownBlocks   = 1024  // Maximum block hashes to keep in the known list (prevent DOS)
 	handshakeTimeout = 5 * time.Second
 )
@@ -34,6 +35,7 @@ type PeerInfo struct {
 	Version    int      `json:"version"`    // Siotchain protocol version negotiated
 	Difficulty *big.Int `json:"difficulty"` // Total difficulty of the peer's blockchain
 	Head       string   `json:"head"`       // SHA3 hash of the peer's best owned block
+	Score      int      `json:"score"`      // Reputation earned by the peer's responses
 }
 
 type peer struct {
@@ -51,6 +53,8 @@ type peer struct {
 
 	knownTxs    *set.Set // Set of transaction hashes known to be known by this peer
 	knownBlocks *set.Set // Set of block hashes known to be known by this peer
+
+	reputation // Usefulness of the peer's responses, deciding evictions
 }
 
 func newPeer(version int, p *p2p.Peer, rw p2p.MsgReadWriter) *peer {
@@ -74,6 +78,7 @@ func (p *peer) Info() *PeerInfo {
 		Version:    p.version,
 		Difficulty: td,
 		Head:       hash.Hex(),
+		Score:      p.Score(),
 	}
 }
 
@@ -125,6 +130,21 @@ func (p *peer) SendTransactions(txs types.Transactions) error {
 	return p2p.Send(p.rw, TxMsg, txs)
 }
 
+// SendTxHashes announces the availability of a number of transactions through a
+// hash notification, leaving it up to the peer to request the ones it lacks.
+func (p *peer) SendTxHashes(hashes []helper.Hash) error {
+	for _, hash := range hashes {
+		p.knownTxs.Add(hash)
+	}
+	return p2p.Send(p.rw, NewTxHashesMsg, hashes)
+}
+
+// RequestTxs fetches a batch of announced transactions from the remote node.
+func (p *peer) RequestTxs(hashes []helper.Hash) error {
+	glog.V(logger.Debug).Infof("%v fetching %d transactions", p, len(hashes))
+	return p2p.Send(p.rw, GetTxsMsg, hashes)
+}
+
 // SendNewBlockHashes announces the availability of a number of blocks through
 // a hash notification.
 func (p *peer) SendNewBlockHashes(hashes []helper.Hash, numbers []uint64) error {
@@ -177,6 +197,7 @@ func (p *peer) SendReceiptsRLP(receipts []rlp.RawValue) error {
 // single header. It is used solely by the fetcher.
 func (p *peer) RequestOneHeader(hash helper.Hash) error {
 	glog.V(logger.Debug).Infof("%v fetching a single header: %x", p, hash)
+	p.requested()
 	return p2p.Send(p.rw, GetBlockHeadersMsg, &getBlockHeadersData{Origin: hashOrNumber{Hash: hash}, Amount: uint64(1), Skip: uint64(0), Reverse: false})
 }
 
@@ -184,6 +205,7 @@ func (p *peer) RequestOneHeader(hash helper.Hash) error {
 // specified header query, based on the hash of an origin block.
 func (p *peer) RequestHeadersByHash(origin helper.Hash, amount int, skip int, reverse bool) error {
 	glog.V(logger.Debug).Infof("%v fetching %d headers from %x, skipping %d (reverse = %v)", p, amount, origin[:4], skip, reverse)
+	p.requested()
 	return p2p.Send(p.rw, GetBlockHeadersMsg, &getBlockHeadersData{Origin: hashOrNumber{Hash: origin}, Amount: uint64(amount), Skip: uint64(skip), Reverse: reverse})
 }
 
@@ -191,6 +213,7 @@ func (p *peer) RequestHeadersByHash(origin helper.Hash, amount int, skip int, re
 // specified header query, based on the number of an origin block.
 func (p *peer) RequestHeadersByNumber(origin uint64, amount int, skip int, reverse bool) error {
 	glog.V(logger.Debug).Infof("%v fetching %d headers from #%d, skipping %d (reverse = %v)", p, amount, origin, skip, reverse)
+	p.requested()
 	return p2p.Send(p.rw, GetBlockHeadersMsg, &getBlockHeadersData{Origin: hashOrNumber{Number: origin}, Amount: uint64(amount), Skip: uint64(skip), Reverse: reverse})
 }
 
@@ -198,6 +221,7 @@ func (p *peer) RequestHeadersByNumber(origin uint64, amount int, skip int, rever
 // specified.
 func (p *peer) RequestBodies(hashes []helper.Hash) error {
 	glog.V(logger.Debug).Infof("%v fetching %d block bodies", p, len(hashes))
+	p.requested()
 	return p2p.Send(p.rw, GetBlockBodiesMsg, hashes)
 }
 
@@ -205,12 +229,14 @@ func (p *peer) RequestBodies(hashes []helper.Hash) error {
 // data, corresponding to the specified hashes.
 func (p *peer) RequestNodeData(hashes []helper.Hash) error {
 	glog.V(logger.Debug).Infof("%v fetching %v state data", p, len(hashes))
+	p.requested()
 	return p2p.Send(p.rw, GetNodeDataMsg, hashes)
 }
 
 // RequestReceipts fetches a batch of transaction receipts from a remote node.
 func (p *peer) RequestReceipts(hashes []helper.Hash) error {
 	glog.V(logger.Debug).Infof("%v fetching %v receipts", p, len(hashes))
+	p.requested()
 	return p2p.Send(p.rw, GetReceiptsMsg, hashes)
 }
 
@@ -390,6 +416,23 @@ func (ps *peerSet) BestPeer() *peer {
 	return bestPeer
 }
 
+// WorstPeer retrieves the known peer with the currently lowest reputation.
+func (ps *peerSet) WorstPeer() *peer {
+	ps.lock.RLock()
+	defer ps.lock.RUnlock()
+
+	var (
+		worstPeer  *peer
+		worstScore int
+	)
+	for _, p := range ps.peers {
+		if score := p.Score(); worstPeer == nil || score < worstScore {
+			worstPeer, worstScore = p, score
+		}
+	}
+	return worstPeer
+}
+
 // Close disconnects all peers.
 // No new peers can be registered after Close has returned.
 func (ps *peerSet) Close() {
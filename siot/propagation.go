@@ -0,0 +1,93 @@
+package siot
+
+import (
+	"sync"
+	"time"
+
+	"github.com/siotchain/siot/helper"
+)
+
+const (
+	txPropagationTTL     = 10 * time.Minute // Time after which propagation stats of a transaction are dropped
+	txPropagationCleanup = time.Minute      // Minimum interval between two sweeps for expired stats
+)
+
+// TxPropagation contains the propagation stats of a broadcast transaction.
+type TxPropagation struct {
+	Peers     int        `json:"peers"`     // Number of peers the transaction was sent to in full
+	Announced int        `json:"announced"` // Number of peers only the hash of the transaction was announced to
+	FirstSent time.Time  `json:"firstSent"` // Time of the first broadcast
+	SeenBack  *time.Time `json:"seenBack"`  // Time the transaction was first received from a peer after the broadcast
+}
+
+// txPropagationTracker records how many peers each broadcast transaction was
+// sent to and when it was first relayed back to us, confirming that it made
+// its way into the network. Stats are kept for txPropagationTTL only.
+type txPropagationTracker struct {
+	txs     map[helper.Hash]*TxPropagation
+	cleaned time.Time
+	lock    sync.Mutex
+}
+
+func newTxPropagationTracker() *txPropagationTracker {
+	return &txPropagationTracker{
+		txs:     make(map[helper.Hash]*TxPropagation),
+		cleaned: time.Now(),
+	}
+}
+
+// sent records that a transaction was broadcast in full to the given number of
+// peers, and announced by hash to a number of others.
+func (t *txPropagationTracker) sent(hash helper.Hash, peers, announced int) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	now := time.Now()
+	if now.Sub(t.cleaned) > txPropagationCleanup {
+		t.expire(now)
+	}
+	if prop, ok := t.txs[hash]; ok {
+		prop.Peers += peers
+		prop.Announced += announced
+		return
+	}
+	t.txs[hash] = &TxPropagation{Peers: peers, Announced: announced, FirstSent: now}
+}
+
+// seen records that a transaction was received from a remote peer. Only the
+// first arrival after a broadcast is of interest.
+func (t *txPropagationTracker) seen(hash helper.Hash) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if prop, ok := t.txs[hash]; ok && prop.SeenBack == nil {
+		now := time.Now()
+		prop.SeenBack = &now
+	}
+}
+
+// get retrieves a copy of the propagation stats of a transaction, or nil if it
+// wasn't broadcast recently.
+func (t *txPropagationTracker) get(hash helper.Hash) *TxPropagation {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	prop, ok := t.txs[hash]
+	if !ok || time.Since(prop.FirstSent) > txPropagationTTL {
+		return nil
+	}
+	cpy := *prop
+	return &cpy
+}
+
+// expire drops the stats of all transactions broadcast longer than the TTL ago.
+//
+// Note, this method assumes the lock is held!
+func (t *txPropagationTracker) expire(now time.Time) {
+	for hash, prop := range t.txs {
+		if now.Sub(prop.FirstSent) > txPropagationTTL {
+			delete(t.txs, hash)
+		}
+	}
+	t.cleaned = now
+}
@@ -14,16 +14,23 @@ import (
 const (
 	eth62 = 62
 	eth63 = 63
+	eth64 = 64
 )
 
 // Official short name of the protocol used during capability negotiation.
 var ProtocolName = "siot"
 
 // Supported versions of the siot protocol (first is primary).
-var ProtocolVersions = []uint{eth63, eth62}
+var ProtocolVersions = []uint{eth64, eth63, eth62}
 
 // Number of implemented message corresponding to different protocol versions.
-var ProtocolLengths = []uint64{17, 8}
+var ProtocolLengths = []uint64{19, 17, 8}
+
+// Transaction announcement modes, selecting how new transactions are propagated.
+const (
+	TxAnnounceFull = "full" // Send every transaction in full to every peer
+	TxAnnounceHash = "hash" // Send transactions in full to sqrt(N) peers, announce the hash to the rest
+)
 
 const (
 	IP				   = "localhost"
@@ -48,6 +55,10 @@ const (
 	NodeDataMsg    = 0x0e
 	GetReceiptsMsg = 0x0f
 	ReceiptsMsg    = 0x10
+
+	// Protocol messages belonging to siot/64
+	NewTxHashesMsg = 0x11
+	GetTxsMsg      = 0x12
 )
 
 type errCode int
@@ -88,6 +99,12 @@ type txPool interface {
 	// Pending should return pending transactions.
 	// The slice should be modifiable by the caller.
 	Pending() map[helper.Address]types.Transactions
+
+	// Get should return the transaction with the given hash if it's in the pool.
+	Get(hash helper.Hash) *types.Transaction
+
+	// IsLocal should report whether the transaction was submitted locally.
+	IsLocal(hash helper.Hash) bool
 }
 
 // statusData is the network packet for the status message.
@@ -0,0 +1,97 @@
+package siot
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	scoreUseful      = 1    // Reward for a response with data, arriving in time
+	scoreSlow        = -2   // Penalty for a response arriving after slowResponseTime
+	scoreUnasked     = -10  // Penalty for a response to a request never made
+	scoreInvalid     = -100 // Penalty for an invalid message or a failed DAO fork check
+	scoreMinimum     = -1000
+	scoreMaximum     = 1000
+	maxInFlight      = 64 // Outstanding requests tracked per peer, older ones count as slow
+	slowResponseTime = 5 * time.Second
+
+	maxRememberedScores = 1024 // Disconnected peers whose score is kept for their reconnection
+)
+
+// reputation scores the usefulness of a peer from the responses to the data
+// requests made to it. Fresh peers start at zero, so that a negative score marks
+// a peer doing worse than an unknown one.
+type reputation struct {
+	score    int
+	inFlight []time.Time // Send times of the outstanding requests, oldest first
+	lock     sync.Mutex
+}
+
+// requested records a data request sent to the peer.
+func (r *reputation) requested() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if len(r.inFlight) >= maxInFlight {
+		r.inFlight = r.inFlight[1:]
+		r.adjust(scoreSlow)
+	}
+	r.inFlight = append(r.inFlight, time.Now())
+}
+
+// responded scores a response of the peer carrying the given number of items,
+// matching it against the oldest outstanding request.
+func (r *reputation) responded(items int) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if len(r.inFlight) == 0 {
+		r.adjust(scoreUnasked)
+		return
+	}
+	sent := r.inFlight[0]
+	r.inFlight = r.inFlight[1:]
+
+	switch {
+	case time.Since(sent) > slowResponseTime:
+		r.adjust(scoreSlow)
+	case items > 0:
+		r.adjust(scoreUseful)
+	}
+}
+
+// invalid penalises the peer for a message violating the protocol.
+func (r *reputation) invalid() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.adjust(scoreInvalid)
+}
+
+// adjust changes the score by the given delta, keeping it within bounds so that
+// a long history can't shield a peer from recent misbehaviour.
+func (r *reputation) adjust(delta int) {
+	r.score += delta
+	if r.score < scoreMinimum {
+		r.score = scoreMinimum
+	}
+	if r.score > scoreMaximum {
+		r.score = scoreMaximum
+	}
+}
+
+// Score returns the current reputation score.
+func (r *reputation) Score() int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.score
+}
+
+// setScore initialises the score, carrying over the one of an earlier session.
+func (r *reputation) setScore(score int) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.score = score
+}
@@ -0,0 +1,176 @@
+package siot
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/siotchain/siot/blockchainCore"
+	"github.com/siotchain/siot/blockchainCore/types"
+	"github.com/siotchain/siot/configure"
+	"github.com/siotchain/siot/helper"
+	"github.com/siotchain/siot/logger"
+	"github.com/siotchain/siot/logger/glog"
+	"github.com/siotchain/siot/subscribe"
+)
+
+const (
+	shadowQueueSize      = 16 // Canonical blocks waiting for shadow processing before new ones are skipped
+	maxShadowDivergences = 64 // Number of most recent divergences kept for reporting
+)
+
+var (
+	errShadowRunning    = errors.New("shadow validation already running")
+	errShadowNotRunning = errors.New("shadow validation not running")
+)
+
+// ShadowDivergence describes a canonical block whose state root differs when
+// processed under the shadow chain configuration.
+type ShadowDivergence struct {
+	Number      uint64      `json:"number"`
+	Hash        helper.Hash `json:"hash"`
+	PrimaryRoot helper.Hash `json:"primaryRoot"`
+	ShadowRoot  helper.Hash `json:"shadowRoot"`
+	Error       string      `json:"error,omitempty"` // Processing error under the shadow config, if any
+}
+
+// shadowValidator reprocesses every new canonical block on top of its parent
+// state under an alternative chain configuration, reporting the blocks whose
+// resulting state root differs. Canonical processing is never affected: the
+// shadow runs on its own goroutine and skips blocks if it falls behind.
+type shadowValidator struct {
+	config    *configure.ChainConfig
+	chain     *blockchainCore.BlockChain
+	processor *blockchainCore.StateProcessor
+
+	sub   subscribe.Subscription
+	queue chan *types.Block
+	quit  chan struct{}
+	wg    sync.WaitGroup
+
+	divergences []ShadowDivergence // Most recent divergences, oldest first
+	processed   uint64             // Number of blocks processed under the shadow config
+	skipped     uint64             // Number of blocks skipped due to a full queue
+	lock        sync.Mutex
+}
+
+func newShadowValidator(config *configure.ChainConfig, chain *blockchainCore.BlockChain, mux *subscribe.TypeMux) *shadowValidator {
+	shadow := &shadowValidator{
+		config:    config,
+		chain:     chain,
+		processor: blockchainCore.NewStateProcessor(config, chain),
+		sub:       mux.Subscribe(blockchainCore.ChainEvent{}),
+		queue:     make(chan *types.Block, shadowQueueSize),
+		quit:      make(chan struct{}),
+	}
+	shadow.wg.Add(2)
+	go shadow.feed()
+	go shadow.loop()
+	return shadow
+}
+
+// stop terminates the shadow processing and waits for it to come down.
+func (s *shadowValidator) stop() {
+	s.sub.Unsubscribe()
+	close(s.quit)
+	s.wg.Wait()
+}
+
+// feed queues the new canonical blocks for processing, dropping them if the
+// shadow can't keep up with the chain.
+func (s *shadowValidator) feed() {
+	defer s.wg.Done()
+
+	for ev := range s.sub.Chan() {
+		block := ev.Data.(blockchainCore.ChainEvent).Block
+		select {
+		case s.queue <- block:
+		default:
+			s.lock.Lock()
+			s.skipped++
+			s.lock.Unlock()
+		}
+	}
+}
+
+// loop processes the queued blocks until stopped.
+func (s *shadowValidator) loop() {
+	defer s.wg.Done()
+
+	for {
+		select {
+		case block := <-s.queue:
+			s.validate(block)
+		case <-s.quit:
+			return
+		}
+	}
+}
+
+// validate processes a single block under the shadow config, recording it if
+// the state root diverges from the canonical one.
+func (s *shadowValidator) validate(block *types.Block) {
+	parent := s.chain.GetBlock(block.ParentHash(), block.NumberU64()-1)
+	if parent == nil {
+		return
+	}
+	statedb, err := s.chain.StateAt(parent.Root())
+	if err != nil {
+		glog.V(logger.Debug).Infof("Shadow validation of #%d skipped: %v", block.NumberU64(), err)
+		return
+	}
+	divergence := ShadowDivergence{Number: block.NumberU64(), Hash: block.Hash(), PrimaryRoot: block.Root()}
+	if _, _, _, err := s.processor.Process(block, statedb, s.quit); err != nil {
+		divergence.Error = err.Error()
+	} else {
+		divergence.ShadowRoot = statedb.IntermediateRoot(s.config.IsSiotImpr2(block.Number()))
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.processed++
+	if divergence.Error == "" && divergence.ShadowRoot == divergence.PrimaryRoot {
+		return
+	}
+	glog.V(logger.Warn).Infof("Shadow config diverges at #%d [%x…]: primary root %x, shadow root %x %s", divergence.Number, divergence.Hash[:4], divergence.PrimaryRoot, divergence.ShadowRoot, divergence.Error)
+
+	if len(s.divergences) >= maxShadowDivergences {
+		s.divergences = append(s.divergences[:0], s.divergences[1:]...)
+	}
+	s.divergences = append(s.divergences, divergence)
+}
+
+// status returns the recorded divergences along with the processing counters.
+func (s *shadowValidator) status() (divergences []ShadowDivergence, processed, skipped uint64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return append([]ShadowDivergence{}, s.divergences...), s.processed, s.skipped
+}
+
+// StartShadowValidation starts reprocessing every new canonical block under the
+// given alternative chain configuration.
+func (s *Siotchain) StartShadowValidation(config *configure.ChainConfig) error {
+	s.shadowMu.Lock()
+	defer s.shadowMu.Unlock()
+
+	if s.shadow != nil {
+		return errShadowRunning
+	}
+	s.shadow = newShadowValidator(config, s.blockchain, s.eventMux)
+	return nil
+}
+
+// StopShadowValidation stops the shadow validation, returning the divergences
+// it found.
+func (s *Siotchain) StopShadowValidation() ([]ShadowDivergence, error) {
+	s.shadowMu.Lock()
+	defer s.shadowMu.Unlock()
+
+	if s.shadow == nil {
+		return nil, errShadowNotRunning
+	}
+	s.shadow.stop()
+	divergences, _, _ := s.shadow.status()
+	s.shadow = nil
+	return divergences, nil
+}
@@ -27,11 +27,16 @@ type txsync struct {
 	txs []*types.Transaction
 }
 
-// syncTransactions starts sending all currently pending transactions to the given peer.
+// syncTransactions starts sending all currently pending transactions to the given
+// peer, except for the local ones whose delayed broadcast is still due.
 func (pm *ProtocolManager) syncTransactions(p *peer) {
 	var txs types.Transactions
 	for _, batch := range pm.txpool.Pending() {
-		txs = append(txs, batch...)
+		for _, tx := range batch {
+			if !pm.txDelayed.Has(tx.Hash()) {
+				txs = append(txs, tx)
+			}
+		}
 	}
 	if len(txs) == 0 {
 		return
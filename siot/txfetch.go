@@ -0,0 +1,90 @@
+package siot
+
+import (
+	"sync"
+	"time"
+
+	"github.com/siotchain/siot/helper"
+)
+
+const (
+	txFetchTimeout    = 5 * time.Second // Time a peer has to deliver requested transactions before others are asked
+	maxTxFetchSources = 4               // Alternative announcers remembered per transaction in flight
+)
+
+// txFetch is an announced transaction requested from a peer.
+type txFetch struct {
+	peer       string    // Peer the transaction was requested from
+	requested  time.Time // Time of the request
+	alternates []string  // Other peers that announced the transaction meanwhile
+}
+
+// txFetchTracker keeps the announced transactions requested from the peers, so
+// that every transaction is fetched from a single peer at a time. Requests not
+// answered within txFetchTimeout are handed over to another announcer, or are
+// forgotten if there is none.
+type txFetchTracker struct {
+	fetching map[helper.Hash]*txFetch
+	lock     sync.Mutex
+}
+
+func newTxFetchTracker() *txFetchTracker {
+	return &txFetchTracker{
+		fetching: make(map[helper.Hash]*txFetch),
+	}
+}
+
+// reserve filters the hashes announced by a peer down to those not yet requested
+// from anyone, and marks them as requested from the peer. For the others, the
+// peer is remembered as a fallback source.
+func (t *txFetchTracker) reserve(peer string, hashes []helper.Hash) []helper.Hash {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	var reserved []helper.Hash
+	for _, hash := range hashes {
+		fetch, ok := t.fetching[hash]
+		if !ok {
+			t.fetching[hash] = &txFetch{peer: peer, requested: time.Now()}
+			reserved = append(reserved, hash)
+			continue
+		}
+		if fetch.peer != peer && len(fetch.alternates) < maxTxFetchSources {
+			fetch.alternates = append(fetch.alternates, peer)
+		}
+	}
+	return reserved
+}
+
+// delivered drops the requests of the transactions received, from whichever peer.
+func (t *txFetchTracker) delivered(hashes []helper.Hash) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	for _, hash := range hashes {
+		delete(t.fetching, hash)
+	}
+}
+
+// expire hands the requests unanswered for longer than txFetchTimeout over to
+// the next announcer, returning the hashes to request from each peer. Requests
+// without an alternative source are dropped.
+func (t *txFetchTracker) expire(now time.Time) map[string][]helper.Hash {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	retries := make(map[string][]helper.Hash)
+	for hash, fetch := range t.fetching {
+		if now.Sub(fetch.requested) < txFetchTimeout {
+			continue
+		}
+		if len(fetch.alternates) == 0 {
+			delete(t.fetching, hash)
+			continue
+		}
+		fetch.peer, fetch.alternates = fetch.alternates[0], fetch.alternates[1:]
+		fetch.requested = now
+		retries[fetch.peer] = append(retries[fetch.peer], hash)
+	}
+	return retries
+}
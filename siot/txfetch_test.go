@@ -0,0 +1,42 @@
+package siot
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/siotchain/siot/helper"
+)
+
+// Tests that announced transactions are requested from a single peer at a time,
+// and handed over to another announcer if not delivered in time.
+func TestTxFetchTracker(t *testing.T) {
+	var (
+		tracker = newTxFetchTracker()
+		first   = helper.HexToHash("0x01")
+		second  = helper.HexToHash("0x02")
+	)
+	if reserved := tracker.reserve("a", []helper.Hash{first, second}); !reflect.DeepEqual(reserved, []helper.Hash{first, second}) {
+		t.Fatalf("first announcement reservations mismatch: have %v", reserved)
+	}
+	if reserved := tracker.reserve("b", []helper.Hash{first}); len(reserved) != 0 {
+		t.Fatalf("transaction in flight reserved again: %v", reserved)
+	}
+	tracker.delivered([]helper.Hash{second})
+
+	// Nothing to retry before the timeout, the alternate announcer after it
+	if retries := tracker.expire(time.Now()); len(retries) != 0 {
+		t.Fatalf("retries before the timeout: %v", retries)
+	}
+	retries := tracker.expire(time.Now().Add(txFetchTimeout))
+	if want := map[string][]helper.Hash{"b": {first}}; !reflect.DeepEqual(retries, want) {
+		t.Fatalf("retries mismatch: have %v, want %v", retries, want)
+	}
+	// Without further announcers, the transaction is forgotten
+	if retries := tracker.expire(time.Now().Add(3 * txFetchTimeout)); len(retries) != 0 {
+		t.Fatalf("retries without announcers: %v", retries)
+	}
+	if reserved := tracker.reserve("c", []helper.Hash{first}); len(reserved) != 1 {
+		t.Errorf("forgotten transaction not reserved again: %v", reserved)
+	}
+}
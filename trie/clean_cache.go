@@ -0,0 +1,101 @@
+package trie
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/siotchain/siot/helper"
+)
+
+// cleanCache is an LRU cache of encoded trie nodes bounded by the total size of
+// the cached values. Nodes are content addressed, so a single cache can safely
+// serve every trie and database.
+type cleanCache struct {
+	limit int // Maximum number of bytes cached
+	size  int // Number of bytes currently cached
+
+	items map[helper.Hash]*list.Element
+	order *list.List // Least recently used entries at the back
+	lock  sync.Mutex
+}
+
+type cleanEntry struct {
+	hash helper.Hash
+	blob []byte
+}
+
+var (
+	cleanCacheLock sync.RWMutex
+	cleanNodes     *cleanCache // Disabled unless a size is configured
+)
+
+// SetCleanCacheSize replaces the node cache shared by all tries with one holding
+// up to the given number of megabytes of encoded nodes, dropping any cached
+// ones. The cache saves database lookups for nodes unloaded from memory by the
+// cache generations. A non-positive size disables the cache.
+func SetCleanCacheSize(megabytes int) {
+	cleanCacheLock.Lock()
+	defer cleanCacheLock.Unlock()
+
+	if megabytes <= 0 {
+		cleanNodes = nil
+		return
+	}
+	cleanNodes = &cleanCache{
+		limit: megabytes * 1024 * 1024,
+		items: make(map[helper.Hash]*list.Element),
+		order: list.New(),
+	}
+}
+
+// cachedNode retrieves the encoded node with the given hash from the shared cache.
+func cachedNode(hash []byte) ([]byte, bool) {
+	cleanCacheLock.RLock()
+	defer cleanCacheLock.RUnlock()
+
+	if cleanNodes == nil {
+		return nil, false
+	}
+	return cleanNodes.get(helper.BytesToHash(hash))
+}
+
+// cacheNode inserts a loaded encoded node into the shared cache.
+func cacheNode(hash []byte, blob []byte) {
+	cleanCacheLock.RLock()
+	defer cleanCacheLock.RUnlock()
+
+	if cleanNodes != nil {
+		cleanNodes.add(helper.BytesToHash(hash), blob)
+	}
+}
+
+func (c *cleanCache) get(hash helper.Hash) ([]byte, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if elem, ok := c.items[hash]; ok {
+		c.order.MoveToFront(elem)
+		return elem.Value.(*cleanEntry).blob, true
+	}
+	return nil, false
+}
+
+func (c *cleanCache) add(hash helper.Hash, blob []byte) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if _, ok := c.items[hash]; ok || len(blob) > c.limit {
+		return
+	}
+	c.items[hash] = c.order.PushFront(&cleanEntry{hash: hash, blob: blob})
+	c.size += len(blob)
+
+	for c.size > c.limit {
+		oldest := c.order.Back()
+		entry := oldest.Value.(*cleanEntry)
+
+		c.order.Remove(oldest)
+		delete(c.items, entry.hash)
+		c.size -= len(entry.blob)
+	}
+}
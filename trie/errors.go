@@ -33,3 +33,20 @@ type MissingNodeError struct {
 func (err *MissingNodeError) Error() string {
 	return fmt.Sprintf("Missing trie node %064x", err.NodeHash)
 }
+
+// CorruptTrieError is returned by the trie functions (TryGet, TryUpdate, TryDelete)
+// if a node loaded from the database is reachable from itself. Content addressed
+// tries can't contain such cycles, so the database is corrupted. The access is
+// aborted instead of following the cycle.
+//
+// NodeHash is the hash of the node found twice on the same path
+//
+// Path is the nibble path from the root to the second occurrence of the node
+type CorruptTrieError struct {
+	RootHash, NodeHash helper.Hash
+	Path               []byte
+}
+
+func (err *CorruptTrieError) Error() string {
+	return fmt.Sprintf("Corrupt trie %064x: node %064x references itself at path %x", err.RootHash, err.NodeHash, err.Path)
+}
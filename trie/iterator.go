@@ -36,6 +36,11 @@ func (it *Iterator) Next() bool {
 	return false
 }
 
+// Err returns the error that terminated the iteration, if any.
+func (it *Iterator) Err() error {
+	return it.nodeIt.Error
+}
+
 func (it *Iterator) makeKey() []byte {
 	key := it.keyBuf[:0]
 	for _, se := range it.nodeIt.stack {
@@ -50,6 +50,24 @@ func NewSecure(root helper.Hash, db Database, cachelimit uint16) (*SecureTrie, e
 	return &SecureTrie{trie: *trie}, nil
 }
 
+// Copy returns an independent copy of the trie. Nodes are never modified in
+// place, so the copy shares all of them with the original and the cost of the
+// copy doesn't depend on the size of the trie. Preimages not yet committed are
+// carried over.
+func (t *SecureTrie) Copy() *SecureTrie {
+	cpy := *t
+	cpy.trie.ancestors = nil
+	cpy.secKeyCache = make(map[string][]byte)
+	if t.secKeyCacheOwner == t {
+		// Entries held for another trie (t being a value copy) are not ours to carry over
+		for hk, key := range t.secKeyCache {
+			cpy.secKeyCache[hk] = key
+		}
+	}
+	cpy.secKeyCacheOwner = &cpy
+	return &cpy
+}
+
 // Get returns the value for key stored in the trie.
 // The value bytes must not be modified by the caller.
 func (t *SecureTrie) Get(key []byte) []byte {
@@ -72,6 +72,10 @@ type Trie struct {
 	// new nodes are tagged with the current generation and unloaded
 	// when their generation is older than than cachegen-cachelimit.
 	cachegen, cachelimit uint16
+
+	// Hash nodes resolved on the path currently being traversed, used to abort
+	// on cycles in corrupted databases instead of following them.
+	ancestors []hashNode
 }
 
 // SetCacheLimit sets the number of 'cache generations' to keep.
@@ -160,6 +164,11 @@ func (t *Trie) tryGet(origNode node, key []byte, pos int) (value []byte, newnode
 		}
 		return value, n, didResolve, err
 	case hashNode:
+		if err := t.enter(n, key[:pos]); err != nil {
+			return nil, n, false, err
+		}
+		defer t.leave()
+
 		child, err := t.resolveHash(n, key[:pos], key[pos:])
 		if err != nil {
 			return nil, n, true, err
@@ -263,6 +272,11 @@ func (t *Trie) insert(n node, prefix, key []byte, value node) (bool, node, error
 		// We've hit a part of the trie that isn't loaded yet. Load
 		// the node and insert into it. This leaves all child nodes on
 		// the path to the value in the trie.
+		if err := t.enter(n, prefix); err != nil {
+			return false, nil, err
+		}
+		defer t.leave()
+
 		rn, err := t.resolveHash(n, prefix, key)
 		if err != nil {
 			return false, nil, err
@@ -394,6 +408,11 @@ func (t *Trie) delete(n node, prefix, key []byte) (bool, node, error) {
 		// We've hit a part of the trie that isn't loaded yet. Load
 		// the node and delete from it. This leaves all child nodes on
 		// the path to the value in the trie.
+		if err := t.enter(n, prefix); err != nil {
+			return false, nil, err
+		}
+		defer t.leave()
+
 		rn, err := t.resolveHash(n, prefix, key)
 		if err != nil {
 			return false, nil, err
@@ -416,6 +435,27 @@ func concat(s1 []byte, s2 ...byte) []byte {
 	return r
 }
 
+// enter marks a hash node as being traversed, failing if it is already on the
+// current path.
+func (t *Trie) enter(n hashNode, path []byte) error {
+	for _, ancestor := range t.ancestors {
+		if bytes.Equal(ancestor, n) {
+			return &CorruptTrieError{
+				RootHash: t.originalRoot,
+				NodeHash: helper.BytesToHash(n),
+				Path:     helper.CopyBytes(path),
+			}
+		}
+	}
+	t.ancestors = append(t.ancestors, n)
+	return nil
+}
+
+// leave unmarks the last hash node entered.
+func (t *Trie) leave() {
+	t.ancestors = t.ancestors[:len(t.ancestors)-1]
+}
+
 func (t *Trie) resolve(n node, prefix, suffix []byte) (node, error) {
 	if n, ok := n.(hashNode); ok {
 		return t.resolveHash(n, prefix, suffix)
@@ -426,15 +466,19 @@ func (t *Trie) resolve(n node, prefix, suffix []byte) (node, error) {
 func (t *Trie) resolveHash(n hashNode, prefix, suffix []byte) (node, error) {
 	cacheMissCounter.Inc(1)
 
-	enc, err := t.db.Get(n)
-	if err != nil || enc == nil {
-		return nil, &MissingNodeError{
-			RootHash:  t.originalRoot,
-			NodeHash:  helper.BytesToHash(n),
-			Key:       compactHexEncode(append(prefix, suffix...)),
-			PrefixLen: len(prefix),
-			SuffixLen: len(suffix),
+	enc, ok := cachedNode(n)
+	if !ok {
+		var err error
+		if enc, err = t.db.Get(n); err != nil || enc == nil {
+			return nil, &MissingNodeError{
+				RootHash:  t.originalRoot,
+				NodeHash:  helper.BytesToHash(n),
+				Key:       compactHexEncode(append(prefix, suffix...)),
+				PrefixLen: len(prefix),
+				SuffixLen: len(suffix),
+			}
 		}
+		cacheNode(n, enc)
 	}
 	dec := mustDecodeNode(n, enc, t.cachegen)
 	return dec, nil